@@ -0,0 +1,14 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"webook_go/webook/internal/job"
+)
+
+// App 整个应用，所有依赖只初始化一次，Web 服务和后台任务共用
+type App struct {
+	server     *gin.Engine
+	purgeJob   *job.AccountPurgeJob
+	migrateJob *job.ArticleMigrateJob
+	refreshJob *job.TokenRefreshJob
+}
@@ -0,0 +1,11 @@
+package domain
+
+import "time"
+
+// AccountExport 导出给用户自己的数据
+type AccountExport struct {
+	User       User
+	Identities []Identity
+	Articles   []Article
+	ExportedAt time.Time
+}
@@ -0,0 +1,59 @@
+package domain
+
+import "time"
+
+// UserQuery 管理后台搜索用户，只按照有唯一索引的字段精确查找
+// 零值的条件会被忽略
+type UserQuery struct {
+	Id    int64
+	Email string
+	Phone string
+}
+
+// Empty 一个条件都没有
+func (q UserQuery) Empty() bool {
+	return q.Id == 0 && q.Email == "" && q.Phone == ""
+}
+
+// LoginLog 一次成功的登录
+type LoginLog struct {
+	Id  int64
+	Uid int64
+	// Method 登录方式，用的是登录接口的路径，比如 /users/login_sms
+	Method    string
+	IP        string
+	UserAgent string
+	Ctime     time.Time
+}
+
+// AuditAction 管理员的操作
+type AuditAction string
+
+const (
+	AuditActionSearchUser   AuditAction = "user:search"
+	AuditActionBanUser      AuditAction = "user:ban"
+	AuditActionUnbanUser    AuditAction = "user:unban"
+	AuditActionLogoutUser   AuditAction = "user:logout"
+	AuditActionLoginHistory AuditAction = "user:login_history"
+	AuditActionListBanned   AuditAction = "user:list_banned"
+	AuditActionUpdateRoles  AuditAction = "user:role"
+)
+
+// AuditLog 管理员的每一次操作都要留下记录，查看用户信息也算
+type AuditLog struct {
+	Id int64
+	// Operator 操作的管理员
+	Operator int64
+	Action   AuditAction
+	// TargetUid 被操作的用户，搜索的时候是搜到的用户，一个都没搜到的时候没有
+	TargetUid int64
+	// Detail 操作的参数，比如封禁的原因、搜索的条件
+	Detail string
+	// Result 成功是 AuditResultSuccess，失败或者被拒绝了记返回给管理员的提示
+	Result string
+	IP     string
+	Ctime  time.Time
+}
+
+// AuditResultSuccess 操作成功了
+const AuditResultSuccess = "success"
@@ -0,0 +1,11 @@
+package domain
+
+// CodeSendMeta 发送验证码的请求来源，用于多维度的防刷限制
+type CodeSendMeta struct {
+	// IP 为空的时候，不做 IP 维度的限制
+	IP string
+	// Device 前端上报的设备指纹，为空的时候，不做设备维度的限制
+	Device string
+	// CaptchaPassed 调用方已经校验过图形验证码了
+	CaptchaPassed bool
+}
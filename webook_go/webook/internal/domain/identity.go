@@ -0,0 +1,37 @@
+package domain
+
+import "time"
+
+// 第三方平台的名字，OIDC 的名字是在配置里面指定的
+const (
+	IdentityProviderWechat = "wechat"
+	IdentityProviderGithub = "github"
+)
+
+// Identity 第三方平台的账号，一个用户可以绑定多个
+type Identity struct {
+	Uid      int64
+	Provider string
+	// Subject 在第三方平台上的用户 ID，微信是 openid，OIDC 是 sub
+	Subject string
+	// UnionID 微信同一个开放平台下面各个应用共用的 ID，其他平台是空的
+	UnionID string
+
+	// 调用第三方平台接口用的，每次登录都会更新
+	AccessToken  string
+	RefreshToken string
+	// TokenExpiresAt 零值代表不会过期
+	TokenExpiresAt time.Time
+
+	// 下面是第三方平台返回的资料，只在新建账号的时候用，不会存起来
+	Email    string
+	Nickname string
+	Avatar   string
+}
+
+// AccountLinks 账号绑定了哪些登录方式
+type AccountLinks struct {
+	Phone     string
+	Email     string
+	Providers []string
+}
@@ -0,0 +1,56 @@
+package domain
+
+// Role 角色，普通用户没有任何角色
+type Role string
+
+// Permission 权限，命名规则是 资源:操作
+type Permission string
+
+const (
+	RoleAdmin Role = "admin"
+)
+
+const (
+	// PermUserRole 给用户分配角色
+	PermUserRole Permission = "user:role"
+	// PermUserBan 封禁、解封用户
+	PermUserBan Permission = "user:ban"
+	// PermUserView 搜索用户、查看登录记录
+	PermUserView Permission = "user:view"
+	// PermUserLogout 把用户踢下线
+	PermUserLogout Permission = "user:logout"
+	// PermArticleUnpublish 强制下架文章
+	PermArticleUnpublish Permission = "article:unpublish"
+	// PermSystemView 查看运行状态，比如缓存的命中率
+	PermSystemView Permission = "system:view"
+)
+
+// rolePermissions 每个角色有哪些权限
+// 权限没有放进 token 里面，改了这里之后不需要用户重新登录就能生效
+var rolePermissions = map[Role][]Permission{
+	RoleAdmin: {PermUserRole, PermUserBan, PermUserView, PermUserLogout, PermArticleUnpublish, PermSystemView},
+}
+
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+func (r Role) Has(perm Permission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission 任意一个角色有这个权限就可以
+func HasPermission(roles []Role, perm Permission) bool {
+	for _, r := range roles {
+		if r.Has(perm) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,9 @@
+package domain
+
+// TOTP 用户的两步验证
+type TOTP struct {
+	Uid    int64
+	Secret string
+	// Enabled 绑定之后确认过一次验证码才算启用
+	Enabled bool
+}
@@ -9,10 +9,67 @@ type User struct {
 	Email    string
 	Password string
 	Nickname string
-	Birthday string
+	// Birthday 只有日期，零值代表没有填
+	Birthday time.Time
 	AboutMe  string
+	Avatar   string
 	Phone    string
 	// 不要组合，万一你可能还有钉钉的相同字段 UionID
 	WechatInfo WechatInfo
-	Ctime      time.Time
+	Status     UserStatus
+	Roles      []Role
+	// DeleteAt 申请注销之后，到了这个时间才真正删除，零值代表没有申请注销
+	DeleteAt time.Time
+	// BannedAt 被封禁的时间，零值代表没有被封禁
+	BannedAt time.Time
+	// BanReason 封禁的原因，给管理员看的
+	BanReason string
+	Ctime     time.Time
 }
+
+// Banned 被封禁的账号不能登录，已经登录的也会被踢下线
+func (u User) Banned() bool {
+	return !u.BannedAt.IsZero()
+}
+
+// RoleNames 放到 token 里面的角色
+func (u User) RoleNames() []string {
+	res := make([]string, 0, len(u.Roles))
+	for _, r := range u.Roles {
+		res = append(res, string(r))
+	}
+	return res
+}
+
+// ProfileUpdate 修改个人资料，只会更新不为 nil 的字段
+// 指向零值代表清空，比如 Birthday 指向 time.Time{}
+type ProfileUpdate struct {
+	Nickname *string
+	Birthday *time.Time
+	AboutMe  *string
+	Avatar   *string
+}
+
+// Empty 什么都没有改
+func (p ProfileUpdate) Empty() bool {
+	return p.Nickname == nil && p.Birthday == nil && p.AboutMe == nil && p.Avatar == nil
+}
+
+// UserStatus 账号状态
+type UserStatus uint8
+
+const (
+	// UserStatusActive 正常的账号
+	// 用零值代表正常，是为了兼容加这个字段之前的历史数据
+	UserStatusActive UserStatus = iota
+	// UserStatusPending 邮箱注册之后，还没有点激活链接的账号
+	UserStatusPending
+	// UserStatusMerged 已经合并到别的账号里面了
+	UserStatusMerged
+	// UserStatusDeleting 申请注销了，还在冷静期里面，可以撤销
+	UserStatusDeleting
+	// UserStatusDeleted 已经注销了，个人信息都匿名化了
+	UserStatusDeleted
+	// UserStatusPurging 正在注销，个人信息已经匿名化了，不能再撤销
+	UserStatusPurging
+)
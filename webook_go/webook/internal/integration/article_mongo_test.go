@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"github.com/bwmarrin/snowflake"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -18,6 +17,7 @@ import (
 	"webook_go/webook/internal/integration/startup"
 	"webook_go/webook/internal/repository/dao/article"
 	ijwt "webook_go/webook/internal/web/jwt"
+	"webook_go/webook/pkg/idgen"
 )
 
 type ArticleMongoHandlerTestSuite struct {
@@ -38,7 +38,7 @@ func (s *ArticleMongoHandlerTestSuite) SetupSuite() {
 		context.Next()
 	})
 	s.mdb = startup.InitMongoDB()
-	node, err := snowflake.NewNode(1)
+	gen, err := idgen.NewSnowflake(idgen.StaticLease(1), idgen.SnowflakeConfig{})
 	assert.NoError(s.T(), err)
 	err = article.InitCollections(s.mdb)
 	if err != nil {
@@ -46,7 +46,7 @@ func (s *ArticleMongoHandlerTestSuite) SetupSuite() {
 	}
 	s.col = s.mdb.Collection("articles")
 	s.liveCol = s.mdb.Collection("published_articles")
-	hdl := startup.InitArticleHandler(article.NewMongoDBDAO(s.mdb, node))
+	hdl := startup.InitArticleHandler(article.NewMongoDBDAO(s.mdb, gen))
 	hdl.RegisterRoutes(s.server)
 }
 
@@ -33,7 +33,7 @@ func (s *ArticleTestSuite) SetupSuite() {
 		})
 	})
 	s.db = startup.InitTestDB()
-	artHdl := startup.InitArticleHandler()
+	artHdl := startup.InitArticleHandler(article.NewGORMArticleDAO(s.db, nil))
 	// 注册好了路由
 	artHdl.RegisterRoutes(s.server)
 }
@@ -0,0 +1,11 @@
+package startup
+
+import (
+	"webook_go/webook/internal/service/captcha"
+	"webook_go/webook/internal/service/captcha/memory"
+)
+
+// InitCaptchaService 集成测试不去找服务商，有票据就算通过
+func InitCaptchaService() captcha.Service {
+	return memory.NewService()
+}
@@ -0,0 +1,31 @@
+package startup
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/spf13/viper"
+)
+
+// 集成测试不读配置文件，密钥每次启动随机生成，和生产一样通过 ioc 里面读配置的方法初始化
+func init() {
+	viper.Set("jwt", map[string]any{
+		"accessToken": map[string]any{
+			"active": "at-test",
+			"keys":   []map[string]any{{"kid": "at-test", "alg": "HS512", "secret": randomSecret()}},
+		},
+		"refreshToken": map[string]any{
+			"active": "rt-test",
+			"keys":   []map[string]any{{"kid": "rt-test", "alg": "HS512", "secret": randomSecret()}},
+		},
+	})
+	viper.Set("user.activation.key", randomSecret())
+	viper.Set("oauth2.stateKey", randomSecret())
+}
+
+func randomSecret() string {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
@@ -5,6 +5,7 @@ package startup
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/wire"
+	"webook_go/webook/internal/job"
 	"webook_go/webook/internal/repository"
 	"webook_go/webook/internal/repository/article"
 	"webook_go/webook/internal/repository/cache"
@@ -16,11 +17,13 @@ import (
 	"webook_go/webook/ioc"
 )
 
-var thirdProvider = wire.NewSet(InitRedis, InitTestDB, InitLog)
+var thirdProvider = wire.NewSet(InitRedis, InitTestDB, InitLog, ioc.InitIDGenerator, ioc.InitSharding, ioc.InitMongoDB)
 var userSvcProvider = wire.NewSet(
-	dao.NewUserDAO,
-	cache.NewUserCache,
-	cache.NewCodeCache,
+	ioc.InitUserDAO,
+	ioc.InitUserCache,
+	ioc.InitCodeCache,
+	ioc.InitCodeLimitConfig,
+	ioc.InitUserCacheConfig,
 	repository.NewUserRepository,
 	service.NewUserService)
 
@@ -29,23 +32,52 @@ func InitWebServer() *gin.Engine {
 		thirdProvider,
 		userSvcProvider,
 		//articlSvcProvider,
-		article2.NewGORMArticleDAO,
+		ioc.InitArticleDAO,
 		repository.NewCodeRepository,
 		article.NewArticleRepository,
 		// service 部分
 		// 集成测试我们显示指定使用内存实现
 		ioc.InitSMSService,
-
-		// 指定啥也不干的 wechat service
+		InitCaptchaService,
+		ioc.InitEmailService,
 		service.NewCodeService,
+		service.NewEmailCodeService,
+		service.NewActivationService,
+		dao.NewTOTPDAO,
+		repository.NewTOTPRepository,
+		service.NewTOTPService,
+		ioc.InitTOTPConfig,
+		cache.NewLoginLimitCache,
+		ioc.InitLoginLimitConfig,
+		repository.NewLoginLimitRepository,
+		service.NewLoginLimitService,
+		ioc.InitActivationConfig,
 		service.NewArticleService,
-		// 直接基于内存的实现
-		ioc.InitWechatService,
+		ioc.InitIdentityDAO,
+		repository.NewIdentityRepository,
+		service.NewIdentityService,
+		cache.NewMergeTicketCache,
+		repository.NewMergeTicketRepository,
+		service.NewLinkService,
+		service.NewAccountService,
+		ioc.InitAccountConfig,
+		// 集成测试没有配置第三方平台，一个都不会启用
+		ioc.InitOAuth2Providers,
 		web.NewUserHandler,
-		web.NewOAuth2WechatHandler,
+		web.NewOAuth2Handler,
 		web.NewArticleHandler,
-		InitWechatHandlerConfig,
-		ijwt.NewRedisJWTHandler,
+		ioc.InitOAuth2HandlerConfig,
+		dao.NewLoginLogDAO,
+		repository.NewLoginLogRepository,
+		service.NewLoginLogService,
+		ioc.InitJWTHandler,
+		ioc.InitSessionConfig,
+		ioc.InitJWTKeys,
+		web.NewJWKSHandler,
+		dao.NewAuditLogDAO,
+		repository.NewAuditLogRepository,
+		service.NewAdminService,
+		web.NewAdminHandler,
 		// 你中间件呢
 		// 你注册路由呢
 		// 你这个地方没有用到前面的任何东西
@@ -57,9 +89,8 @@ func InitWebServer() *gin.Engine {
 	return new(gin.Engine)
 }
 
-func InitArticleHandler(dao article.ArticleDAO) *web.ArticleHandler {
+func InitArticleHandler(artDAO article2.ArticleDAO) *web.ArticleHandler {
 	wire.Build(thirdProvider,
-		article2.NewGORMArticleDAO,
 		service.NewArticleService,
 		web.NewArticleHandler,
 		article.NewArticleRepository)
@@ -67,11 +98,31 @@ func InitArticleHandler(dao article.ArticleDAO) *web.ArticleHandler {
 }
 
 func InitUserSvc() service.UserService {
-	wire.Build(thirdProvider, userSvcProvider)
+	wire.Build(thirdProvider, userSvcProvider, ioc.InitArticleDAO)
 	return service.NewUserService(nil, nil, nil)
 }
 
+// InitAccountPurgeJob 后台注销冷静期过了的账号
+func InitAccountPurgeJob() *job.AccountPurgeJob {
+	wire.Build(thirdProvider, userSvcProvider,
+		ioc.InitArticleDAO,
+		article.NewArticleRepository,
+		ioc.InitIdentityDAO,
+		repository.NewIdentityRepository,
+		service.NewAccountService,
+		ioc.InitAccountConfig,
+		ijwt.NewRedisJWTHandler, ioc.InitSessionConfig, ioc.InitJWTKeys,
+		job.NewAccountPurgeJob)
+	return &job.AccountPurgeJob{}
+}
+
+// InitArticleMigrateJob 文章迁移到 MongoDB 的时候校验和修复
+func InitArticleMigrateJob() *job.ArticleMigrateJob {
+	wire.Build(thirdProvider, ioc.InitArticleMigrateJob)
+	return &job.ArticleMigrateJob{}
+}
+
 func InitJwtHdl() ijwt.Handler {
-	wire.Build(thirdProvider, ijwt.NewRedisJWTHandler)
-	return ijwt.NewRedisJWTHandler(nil)
+	wire.Build(thirdProvider, ijwt.NewRedisJWTHandler, ioc.InitSessionConfig, ioc.InitJWTKeys)
+	return ijwt.NewRedisJWTHandler(nil, ijwt.SessionConfig{}, ijwt.Keys{})
 }
@@ -9,11 +9,12 @@ package startup
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/wire"
+	"webook_go/webook/internal/job"
 	"webook_go/webook/internal/repository"
-	article2 "webook_go/webook/internal/repository/article"
+	"webook_go/webook/internal/repository/article"
 	"webook_go/webook/internal/repository/cache"
 	"webook_go/webook/internal/repository/dao"
-	"webook_go/webook/internal/repository/dao/article"
+	article2 "webook_go/webook/internal/repository/dao/article"
 	"webook_go/webook/internal/service"
 	"webook_go/webook/internal/web"
 	"webook_go/webook/internal/web/jwt"
@@ -24,34 +25,68 @@ import (
 
 func InitWebServer() *gin.Engine {
 	cmdable := InitRedis()
-	handler := jwt.NewRedisJWTHandler(cmdable)
-	loggerV1 := InitLog()
-	v := ioc.InitMiddlewares(cmdable, handler, loggerV1)
+	sessionConfig := ioc.InitSessionConfig()
+	keys := ioc.InitJWTKeys()
 	gormDB := InitTestDB()
-	userDAO := dao.NewUserDAO(gormDB)
-	userCache := cache.NewUserCache(cmdable)
-	userRepository := repository.NewUserRepository(userDAO, userCache)
-	codeRedisCache := cache.NewCodeCache(cmdable)
+	loginLogDAO := dao.NewLoginLogDAO(gormDB)
+	loginLogRepository := repository.NewLoginLogRepository(loginLogDAO)
+	loginLogService := service.NewLoginLogService(loginLogRepository)
+	loggerV1 := InitLog()
+	handler := ioc.InitJWTHandler(cmdable, sessionConfig, keys, loginLogService, loggerV1)
+	sharding := ioc.InitSharding(loggerV1)
+	generator := ioc.InitIDGenerator(cmdable, loggerV1)
+	database := ioc.InitMongoDB()
+	articleDAO := ioc.InitArticleDAO(gormDB, sharding, generator, database, loggerV1)
+	userDAO := ioc.InitUserDAO(gormDB, sharding, generator, articleDAO)
+	userCache := ioc.InitUserCache(cmdable, loggerV1)
+	userCacheConfig := ioc.InitUserCacheConfig()
+	userRepository := repository.NewUserRepository(userDAO, userCache, userCacheConfig)
+	codeLimitConfig := ioc.InitCodeLimitConfig()
+	codeRedisCache := ioc.InitCodeCache(cmdable, codeLimitConfig)
 	userService := service.NewUserService(userRepository, codeRedisCache, loggerV1)
+	v := ioc.InitMiddlewares(cmdable, handler, userService, loggerV1)
 	codeRepository := repository.NewCodeRepository(codeRedisCache)
 	smsService := ioc.InitSMSService()
 	codeService := service.NewCodeService(codeRepository, smsService)
-	userHandler := web.NewUserHandler(userService, codeService, handler)
-	wechatService := ioc.InitWechatService(loggerV1)
-	wechatHandlerConfig := InitWechatHandlerConfig()
-	oAuth2WechatHandler := web.NewOAuth2WechatHandler(wechatService, userService, handler, wechatHandlerConfig)
-	articleDAO := article.NewGORMArticleDAO(gormDB)
-	articleRepository := article2.NewArticleRepository(articleDAO)
+	emailService := ioc.InitEmailService()
+	emailCodeService := service.NewEmailCodeService(codeRepository, emailService)
+	activationConfig := ioc.InitActivationConfig()
+	activationService := service.NewActivationService(userRepository, codeRepository, emailService, activationConfig, loggerV1)
+	totpdao := dao.NewTOTPDAO(gormDB)
+	totpRepository := repository.NewTOTPRepository(totpdao)
+	totpConfig := ioc.InitTOTPConfig()
+	totpService := service.NewTOTPService(totpRepository, userRepository, totpConfig)
+	loginLimitConfig := ioc.InitLoginLimitConfig()
+	loginLimitCache := cache.NewLoginLimitCache(cmdable, loginLimitConfig)
+	loginLimitRepository := repository.NewLoginLimitRepository(loginLimitCache)
+	loginLimitService := service.NewLoginLimitService(loginLimitRepository, userRepository, codeService, emailCodeService)
+	identityDAO := ioc.InitIdentityDAO(gormDB, userDAO, sharding, generator)
+	identityRepository := repository.NewIdentityRepository(identityDAO)
+	mergeTicketCache := cache.NewMergeTicketCache(cmdable)
+	mergeTicketRepository := repository.NewMergeTicketRepository(mergeTicketCache)
+	linkService := service.NewLinkService(userRepository, identityRepository, mergeTicketRepository)
+	articleRepository := article.NewArticleRepository(articleDAO)
+	accountConfig := ioc.InitAccountConfig()
+	accountService := service.NewAccountService(userRepository, identityRepository, articleRepository, accountConfig, loggerV1)
+	captchaService := InitCaptchaService()
+	userHandler := web.NewUserHandler(userService, codeService, emailCodeService, activationService, totpService, loginLimitService, linkService, accountService, captchaService, handler, loggerV1)
+	v2 := ioc.InitOAuth2Providers(loggerV1)
+	identityService := service.NewIdentityService(identityRepository, userRepository, v2, loggerV1)
+	oAuth2HandlerConfig := ioc.InitOAuth2HandlerConfig()
+	oAuth2Handler := web.NewOAuth2Handler(v2, identityService, linkService, totpService, handler, oAuth2HandlerConfig, loggerV1)
 	articleService := service.NewArticleService(articleRepository)
 	articleHandler := web.NewArticleHandler(articleService, loggerV1)
-	engine := ioc.InitGin(v, userHandler, oAuth2WechatHandler, articleHandler)
+	jwksHandler := web.NewJWKSHandler(handler)
+	auditLogDAO := dao.NewAuditLogDAO(gormDB)
+	auditLogRepository := repository.NewAuditLogRepository(auditLogDAO)
+	adminService := service.NewAdminService(userRepository, loginLogRepository, auditLogRepository)
+	adminHandler := web.NewAdminHandler(userService, adminService, handler, loggerV1)
+	engine := ioc.InitGin(v, userHandler, oAuth2Handler, articleHandler, jwksHandler, adminHandler)
 	return engine
 }
 
-func InitArticleHandler(dao article.ArticleDAO) *web.ArticleHandler {
-	gormDB := InitTestDB()
-	articleDAO := article.NewGORMArticleDAO(gormDB)
-	articleRepository := article2.NewArticleRepository(articleDAO)
+func InitArticleHandler(artDAO article2.ArticleDAO) *web.ArticleHandler {
+	articleRepository := article.NewArticleRepository(artDAO)
 	articleService := service.NewArticleService(articleRepository)
 	loggerV1 := InitLog()
 	articleHandler := web.NewArticleHandler(articleService, loggerV1)
@@ -60,24 +95,66 @@ func InitArticleHandler(dao article.ArticleDAO) *web.ArticleHandler {
 
 func InitUserSvc() service.UserService {
 	gormDB := InitTestDB()
-	userDAO := dao.NewUserDAO(gormDB)
-	cmdable := InitRedis()
-	userCache := cache.NewUserCache(cmdable)
-	userRepository := repository.NewUserRepository(userDAO, userCache)
-	codeRedisCache := cache.NewCodeCache(cmdable)
 	loggerV1 := InitLog()
+	sharding := ioc.InitSharding(loggerV1)
+	cmdable := InitRedis()
+	generator := ioc.InitIDGenerator(cmdable, loggerV1)
+	database := ioc.InitMongoDB()
+	articleDAO := ioc.InitArticleDAO(gormDB, sharding, generator, database, loggerV1)
+	userDAO := ioc.InitUserDAO(gormDB, sharding, generator, articleDAO)
+	userCache := ioc.InitUserCache(cmdable, loggerV1)
+	userCacheConfig := ioc.InitUserCacheConfig()
+	userRepository := repository.NewUserRepository(userDAO, userCache, userCacheConfig)
+	codeLimitConfig := ioc.InitCodeLimitConfig()
+	codeRedisCache := ioc.InitCodeCache(cmdable, codeLimitConfig)
 	userService := service.NewUserService(userRepository, codeRedisCache, loggerV1)
 	return userService
 }
 
+// InitAccountPurgeJob 后台注销冷静期过了的账号
+func InitAccountPurgeJob() *job.AccountPurgeJob {
+	gormDB := InitTestDB()
+	loggerV1 := InitLog()
+	sharding := ioc.InitSharding(loggerV1)
+	cmdable := InitRedis()
+	generator := ioc.InitIDGenerator(cmdable, loggerV1)
+	database := ioc.InitMongoDB()
+	articleDAO := ioc.InitArticleDAO(gormDB, sharding, generator, database, loggerV1)
+	userDAO := ioc.InitUserDAO(gormDB, sharding, generator, articleDAO)
+	userCache := ioc.InitUserCache(cmdable, loggerV1)
+	userCacheConfig := ioc.InitUserCacheConfig()
+	userRepository := repository.NewUserRepository(userDAO, userCache, userCacheConfig)
+	identityDAO := ioc.InitIdentityDAO(gormDB, userDAO, sharding, generator)
+	identityRepository := repository.NewIdentityRepository(identityDAO)
+	articleRepository := article.NewArticleRepository(articleDAO)
+	accountConfig := ioc.InitAccountConfig()
+	accountService := service.NewAccountService(userRepository, identityRepository, articleRepository, accountConfig, loggerV1)
+	sessionConfig := ioc.InitSessionConfig()
+	keys := ioc.InitJWTKeys()
+	handler := jwt.NewRedisJWTHandler(cmdable, sessionConfig, keys)
+	accountPurgeJob := job.NewAccountPurgeJob(accountService, handler, loggerV1)
+	return accountPurgeJob
+}
+
+// InitArticleMigrateJob 文章迁移到 MongoDB 的时候校验和修复
+func InitArticleMigrateJob() *job.ArticleMigrateJob {
+	gormDB := InitTestDB()
+	database := ioc.InitMongoDB()
+	loggerV1 := InitLog()
+	articleMigrateJob := ioc.InitArticleMigrateJob(gormDB, database, loggerV1)
+	return articleMigrateJob
+}
+
 func InitJwtHdl() jwt.Handler {
 	cmdable := InitRedis()
-	handler := jwt.NewRedisJWTHandler(cmdable)
+	sessionConfig := ioc.InitSessionConfig()
+	keys := ioc.InitJWTKeys()
+	handler := jwt.NewRedisJWTHandler(cmdable, sessionConfig, keys)
 	return handler
 }
 
 // wire.go:
 
-var thirdProvider = wire.NewSet(InitRedis, InitTestDB, InitLog)
+var thirdProvider = wire.NewSet(InitRedis, InitTestDB, InitLog, ioc.InitIDGenerator, ioc.InitSharding, ioc.InitMongoDB)
 
-var userSvcProvider = wire.NewSet(dao.NewUserDAO, cache.NewUserCache, cache.NewCodeCache, repository.NewUserRepository, service.NewUserService)
+var userSvcProvider = wire.NewSet(ioc.InitUserDAO, ioc.InitUserCache, ioc.InitCodeCache, ioc.InitCodeLimitConfig, ioc.InitUserCacheConfig, repository.NewUserRepository, service.NewUserService)
@@ -37,10 +37,16 @@ func TestUserHandler_e2e_SendLoginSMSCode(t *testing.T) {
 				ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
 				// 你要清理数据
 				val, err := rdb.GetDel(ctx, "phone_code:login:15234562222").Result()
-				cancel()
 				assert.NoError(t, err)
 				// 你的验证码是 6 位
 				assert.True(t, len(val) == 6)
+				// 发送成功会给各层限制计数，也要清理掉，不然会影响下一次测试
+				cnt, err := rdb.Del(ctx, "phone_code_limit:login:phone_hour:15234562222",
+					"phone_code_limit:login:phone_day:15234562222",
+					"phone_code_limit:login:biz:all").Result()
+				cancel()
+				assert.NoError(t, err)
+				assert.Equal(t, int64(3), cnt)
 			},
 			reqBody:  `{"phone":"15234562222"}`,
 			wantCode: 200,
@@ -70,7 +76,8 @@ func TestUserHandler_e2e_SendLoginSMSCode(t *testing.T) {
 			reqBody:  `{"phone":"15234562222"}`,
 			wantCode: 200,
 			wantBody: web.Result{
-				Msg: "发送太频繁，请稍候重试",
+				Code: 401001,
+				Msg:  "发送太频繁，请稍候重试",
 			},
 		},
 		{
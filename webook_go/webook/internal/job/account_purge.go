@@ -0,0 +1,79 @@
+package job
+
+import (
+	"context"
+	"time"
+	"webook_go/webook/internal/service"
+	ijwt "webook_go/webook/internal/web/jwt"
+	"webook_go/webook/pkg/logger"
+)
+
+// AccountPurgeJob 定时把冷静期过了的账号真正注销掉
+// 多个实例同时跑也没关系，注销是幂等的
+type AccountPurgeJob struct {
+	svc service.AccountService
+	// sessions 注销之后要把登录态都清掉，冷静期里面用户可能又登录过
+	sessions ijwt.Handler
+	interval time.Duration
+	// batch 每一轮最多注销多少个
+	batch int
+	// unclean 已经注销了但是登录态没清掉的，账号不会再被查出来，只能记在这里下一轮重试
+	unclean map[int64]struct{}
+	l       logger.LoggerV1
+}
+
+func NewAccountPurgeJob(svc service.AccountService, sessions ijwt.Handler, l logger.LoggerV1) *AccountPurgeJob {
+	return &AccountPurgeJob{
+		svc:      svc,
+		sessions: sessions,
+		interval: time.Minute,
+		batch:    100,
+		unclean:  map[int64]struct{}{},
+		l:        l,
+	}
+}
+
+// Start 一直运行到 ctx 被取消
+func (j *AccountPurgeJob) Start(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := j.Run(ctx); err != nil {
+				j.l.Error("注销账号任务失败", logger.Error(err))
+			}
+		}
+	}
+}
+
+// Run 跑一轮，一次注销满了 batch 个的话说明还有，接着跑
+// 不能并发调用，Start 里面是串行的
+func (j *AccountPurgeJob) Run(ctx context.Context) error {
+	for id := range j.unclean {
+		j.clearSessions(ctx, id)
+	}
+	for {
+		ids, err := j.svc.PurgeDeleted(ctx, j.batch)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			j.clearSessions(ctx, id)
+		}
+		if len(ids) < j.batch {
+			return nil
+		}
+	}
+}
+
+func (j *AccountPurgeJob) clearSessions(ctx context.Context, id int64) {
+	if err := j.sessions.ClearUserSessions(ctx, id); err != nil {
+		j.unclean[id] = struct{}{}
+		j.l.Error("清除注销账号的登录态失败", logger.Error(err), logger.Int64("uid", id))
+		return
+	}
+	delete(j.unclean, id)
+}
@@ -0,0 +1,117 @@
+package job
+
+import (
+	"context"
+	"time"
+	"webook_go/webook/internal/repository/dao/article"
+	"webook_go/webook/pkg/logger"
+	"webook_go/webook/pkg/migrator"
+)
+
+// ArticleMigrateTable 要迁移的一张表，制作库和线上库分开校验
+type ArticleMigrateTable struct {
+	Name string
+	Src  migrator.Store[article.Article]
+	Dst  migrator.Store[article.Article]
+}
+
+type ArticleMigrateConfig struct {
+	Interval time.Duration
+	// Lag 每一轮从上一轮开始的时间再往前这么多开始校验，更新时间是提交之前生成的，不往前一点会漏掉
+	Lag time.Duration
+	// Full 启动的时候先全量校验一次，src_only 的时候用它把历史数据搬到目标表
+	Full      bool
+	BatchSize int
+}
+
+// ArticleMigrateJob 文章从 MySQL 迁移到 MongoDB 的时候，定时校验两边的数据，不一致的直接修复
+// 以哪边为准跟着双写的阶段走：dst_first 之前以源表为准，之后以目标表为准
+// 多个实例同时跑也没关系，修复的时候会重新查为准的那边
+type ArticleMigrateJob struct {
+	tables  []ArticleMigrateTable
+	pattern func() string
+	cfg     ArticleMigrateConfig
+	l       logger.LoggerV1
+	// utime 下一轮增量校验从哪里开始
+	utime int64
+}
+
+// NewArticleMigrateJob tables 为空代表没有在迁移，Start 直接返回
+func NewArticleMigrateJob(tables []ArticleMigrateTable, pattern func() string,
+	cfg ArticleMigrateConfig, l logger.LoggerV1) *ArticleMigrateJob {
+	return &ArticleMigrateJob{
+		tables:  tables,
+		pattern: pattern,
+		cfg:     cfg,
+		l:       l,
+	}
+}
+
+// Start 一直运行到 ctx 被取消
+func (j *ArticleMigrateJob) Start(ctx context.Context) {
+	if len(j.tables) == 0 {
+		return
+	}
+	if j.cfg.Full {
+		if err := j.RunFull(ctx); err != nil {
+			j.l.Error("文章迁移全量校验失败", logger.Error(err))
+		}
+	}
+	ticker := time.NewTicker(j.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := j.Run(ctx); err != nil {
+				j.l.Error("文章迁移增量校验失败", logger.Error(err))
+			}
+		}
+	}
+}
+
+// RunFull 全量校验，结束之后增量校验从开始全量校验的时候接着来
+func (j *ArticleMigrateJob) RunFull(ctx context.Context) error {
+	return j.run(ctx, func(ctx context.Context, v *migrator.Validator[article.Article]) error {
+		return v.Full(ctx)
+	})
+}
+
+// Run 增量校验上一轮之后更新过的
+func (j *ArticleMigrateJob) Run(ctx context.Context) error {
+	from := j.utime - j.cfg.Lag.Milliseconds()
+	return j.run(ctx, func(ctx context.Context, v *migrator.Validator[article.Article]) error {
+		return v.Incremental(ctx, from)
+	})
+}
+
+func (j *ArticleMigrateJob) run(ctx context.Context,
+	validate func(ctx context.Context, v *migrator.Validator[article.Article]) error) error {
+	p, err := migrator.ParsePattern(j.pattern())
+	if err != nil {
+		return err
+	}
+	start := time.Now().UnixMilli()
+	for _, t := range j.tables {
+		if err = validate(ctx, j.validator(t, p.Base())); err != nil {
+			j.l.Error("校验失败", logger.Error(err), logger.String("table", t.Name))
+			return err
+		}
+	}
+	// 中间失败了的话下一轮还从原来的地方开始
+	j.utime = start
+	return nil
+}
+
+func (j *ArticleMigrateJob) validator(t ArticleMigrateTable, base migrator.Direction) *migrator.Validator[article.Article] {
+	src, dst := t.Src, t.Dst
+	if base == migrator.DirectionDst {
+		src, dst = dst, src
+	}
+	v := migrator.NewValidator[article.Article](src, dst, base, migrator.NewFixer[article.Article](src, dst), j.l)
+	if j.cfg.BatchSize > 0 {
+		v = v.BatchSize(j.cfg.BatchSize)
+	}
+	return v
+}
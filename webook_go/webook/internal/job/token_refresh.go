@@ -0,0 +1,43 @@
+package job
+
+import (
+	"context"
+	"time"
+	"webook_go/webook/internal/service"
+	"webook_go/webook/pkg/logger"
+)
+
+// TokenRefreshJob 定时刷新第三方平台快过期的 access_token
+// 多个实例同时跑也没关系，最多重复刷新一次
+type TokenRefreshJob struct {
+	svc      service.IdentityService
+	interval time.Duration
+	// batch 每一轮最多刷新多少个，刷不完的下一轮接着刷
+	batch int
+	l     logger.LoggerV1
+}
+
+func NewTokenRefreshJob(svc service.IdentityService, l logger.LoggerV1) *TokenRefreshJob {
+	return &TokenRefreshJob{
+		svc:      svc,
+		interval: time.Minute,
+		batch:    100,
+		l:        l,
+	}
+}
+
+// Start 一直运行到 ctx 被取消
+func (j *TokenRefreshJob) Start(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := j.svc.RefreshExpiring(ctx, j.batch); err != nil {
+				j.l.Error("刷新第三方平台 token 失败", logger.Error(err))
+			}
+		}
+	}
+}
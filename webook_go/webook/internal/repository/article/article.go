@@ -3,6 +3,7 @@ package article
 import (
 	"context"
 	"gorm.io/gorm"
+	"time"
 	"webook_go/webook/internal/domain"
 	dao "webook_go/webook/internal/repository/dao/article"
 )
@@ -15,7 +16,14 @@ type ArticleRepository interface {
 	// Sync 存储并同步数据
 	Sync(ctx context.Context, art domain.Article) (int64, error)
 	SyncStatus(ctx context.Context, id int64, author int64, status domain.ArticleStatus) error
-	//FindById(ctx context.Context, id int64) domain.Article
+	// ListByAuthor 作者自己的文章，包括没有发表的
+	ListByAuthor(ctx context.Context, author int64, offset, limit int) ([]domain.Article, error)
+	// FindById 制作库里面的，迁移的时候跟着双写的阶段读 MySQL 或者 MongoDB
+	FindById(ctx context.Context, id int64) (domain.Article, error)
+	// FindPubById 线上库里面的
+	FindPubById(ctx context.Context, id int64) (domain.Article, error)
+	// ListPub 线上库里面 start 之前更新的文章，按照更新时间倒序
+	ListPub(ctx context.Context, start time.Time, offset, limit int) ([]domain.Article, error)
 }
 
 type CacheArticleRepository struct {
@@ -125,6 +133,56 @@ func (c *CacheArticleRepository) Update(ctx context.Context, art domain.Article)
 	})
 }
 
+func (c *CacheArticleRepository) ListByAuthor(ctx context.Context, author int64, offset, limit int) ([]domain.Article, error) {
+	arts, err := c.dao.GetByAuthor(ctx, author, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.Article, 0, len(arts))
+	for _, art := range arts {
+		res = append(res, c.toDomain(art))
+	}
+	return res, nil
+}
+
+func (c *CacheArticleRepository) FindById(ctx context.Context, id int64) (domain.Article, error) {
+	art, err := c.dao.GetById(ctx, id)
+	if err != nil {
+		return domain.Article{}, err
+	}
+	return c.toDomain(art), nil
+}
+
+func (c *CacheArticleRepository) FindPubById(ctx context.Context, id int64) (domain.Article, error) {
+	art, err := c.dao.GetPubById(ctx, id)
+	if err != nil {
+		return domain.Article{}, err
+	}
+	return c.toDomain(art.Article), nil
+}
+
+func (c *CacheArticleRepository) ListPub(ctx context.Context, start time.Time, offset, limit int) ([]domain.Article, error) {
+	arts, err := c.dao.ListPubByUtime(ctx, start, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.Article, 0, len(arts))
+	for _, art := range arts {
+		res = append(res, c.toDomain(art.Article))
+	}
+	return res, nil
+}
+
+func (c *CacheArticleRepository) toDomain(art dao.Article) domain.Article {
+	return domain.Article{
+		Id:      art.Id,
+		Title:   art.Title,
+		Content: art.Content,
+		Author:  domain.Author{Id: art.AuthorId},
+		Status:  domain.ArticleStatus(art.Status),
+	}
+}
+
 func (c *CacheArticleRepository) toEntity(art domain.Article) dao.Article {
 	return dao.Article{
 		Id:       art.Id,
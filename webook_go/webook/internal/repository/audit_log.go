@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"context"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/repository/dao"
+)
+
+type AuditLogRepository interface {
+	Create(ctx context.Context, l domain.AuditLog) error
+}
+
+type GORMAuditLogRepository struct {
+	dao dao.AuditLogDAO
+}
+
+func NewAuditLogRepository(dao dao.AuditLogDAO) AuditLogRepository {
+	return &GORMAuditLogRepository{
+		dao: dao,
+	}
+}
+
+func (repo *GORMAuditLogRepository) Create(ctx context.Context, l domain.AuditLog) error {
+	return repo.dao.Insert(ctx, dao.AuditLog{
+		Operator:  l.Operator,
+		Action:    string(l.Action),
+		TargetUid: l.TargetUid,
+		Detail:    l.Detail,
+		Result:    l.Result,
+		IP:        l.IP,
+		Ctime:     l.Ctime.UnixMilli(),
+	})
+}
@@ -7,12 +7,22 @@ import (
 	"fmt"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
+	"time"
+	"webook_go/webook/internal/domain"
 )
 
 var (
 	ErrCodeSendTooMany        = errors.New("发送验证码太频繁")
 	ErrCodeVerifyTooManyTimes = errors.New("验证次数太多")
 	ErrUnknowForCode          = errors.New("我也不知发生什么了，反正是跟 code 有关")
+
+	// 多层限制，每一种都单独返回，方便前端提示
+	ErrCodePhoneHourLimit  = errors.New("该手机号一小时内发送验证码次数太多")
+	ErrCodePhoneDayLimit   = errors.New("该手机号今天发送验证码次数太多")
+	ErrCodeIPLimit         = errors.New("该 IP 发送验证码次数太多")
+	ErrCodeDeviceLimit     = errors.New("该设备发送验证码次数太多")
+	ErrCodeBizLimit        = errors.New("该业务发送验证码太多，触发了全局限制")
+	ErrCodeCaptchaRequired = errors.New("发送验证码需要先通过图形验证码")
 )
 
 // 编译器会在编译的时候，把 set_code 的代码放进来这个 luaSetCode 变量里
@@ -25,30 +35,49 @@ var luaSetCode string
 var luaVerifyCode string
 
 type CodeRedisCache interface {
-	Set(ctx context.Context, biz string, phone string, code string) error
+	Set(ctx context.Context, biz string, phone string, code string, meta domain.CodeSendMeta) error
 	Verify(ctx context.Context, biz, phone, inputCode string) (bool, error)
 }
 
+// CodeLimitConfig 发送验证码的多层限制，所有的阈值 0 都代表不限制
+type CodeLimitConfig struct {
+	PhonePerHour  int
+	PhonePerDay   int
+	IPPerHour     int
+	DevicePerHour int
+	// BizPerMinute 同一个业务所有人加起来每分钟能发多少条，防止被人刷爆短信费
+	BizPerMinute int
+	// CaptchaThreshold 同一个手机号或者同一个 IP 一小时内发送次数达到这个值之后，
+	// 就要求先通过图形验证码
+	CaptchaThreshold int
+}
+
 type RedisCodeCache struct {
 	client redis.Cmdable
+	limit  CodeLimitConfig
 }
 
-func NewCodeCache(client redis.Cmdable) CodeRedisCache {
+func NewCodeCache(client redis.Cmdable, limit CodeLimitConfig) CodeRedisCache {
 	return &RedisCodeCache{
 		client: client,
+		limit:  limit,
 	}
 }
 
 // Set 方法用于在 Redis 中为指定的业务(biz)和手机号(phone)设置验证码(code)
-func (c *RedisCodeCache) Set(ctx context.Context, biz string, phone string, code string) error {
+// 多层限制和验证码放在同一个 Lua 脚本里面，保证检查、计数和设置验证码是原子的
+func (c *RedisCodeCache) Set(ctx context.Context, biz string, phone string, code string, meta domain.CodeSendMeta) error {
 	// 使用 Redis 的 Eval 方法执行 Lua 脚本，设置验证码。
 	// luaSetCode 是预定义的 Lua 脚本，用于在 Redis 中设置键值对。
 	// c.key(biz, phone) 是生成 Redis 键的方法，键由业务标识和手机号组成。
 	// code 是要设置的验证码。
 	// Eval 方法执行后返回一个结果 res 和一个错误 err。
-	res, err := c.client.Eval(ctx, luaSetCode, []string{c.key(biz, phone)}, code).Int()
+	keys, args := c.limitKeysAndArgs(biz, phone, meta)
+	res, err := c.client.Eval(ctx, luaSetCode,
+		append([]string{c.key(biz, phone)}, keys...),
+		append([]any{code}, args...)...).Int()
 	if err != nil {
-		return nil
+		return err
 	}
 	// 根据 Lua 脚本返回的结果判断设置验证码的状态。
 	switch res {
@@ -63,12 +92,77 @@ func (c *RedisCodeCache) Set(ctx context.Context, biz string, phone string, code
 		// 你要在对应的告警系统里面配置
 		// 比如说规则，一分钟内出现超过100次 WARN，你就要告警
 		return ErrCodeSendTooMany
+	case -3, -4, -5, -6, -7, -8:
+		err = limitErrs[res]
+		// 同样要配置告警，突然大量出现就说明有人在刷
+		zap.L().Warn("验证码发送触发限制", zap.String("biz", biz),
+			zap.Error(err))
+		return err
 	default:
 		// 系统错误
 		return errors.New("系统错误")
 	}
 }
 
+// limitErrs Lua 脚本的返回值和错误的对应关系
+var limitErrs = map[int]error{
+	-3: ErrCodePhoneHourLimit,
+	-4: ErrCodePhoneDayLimit,
+	-5: ErrCodeIPLimit,
+	-6: ErrCodeDeviceLimit,
+	-7: ErrCodeBizLimit,
+	-8: ErrCodeCaptchaRequired,
+}
+
+// codeLimitLayer 发送验证码的一层限制，Redis 和本地实现共用
+type codeLimitLayer struct {
+	key   string
+	limit int
+	// window 为 0 代表这一层不启用
+	window time.Duration
+	// err 超过限制的时候返回的错误
+	err error
+}
+
+// codeLimitLayers 构造各层限制，顺序要和 set_code.lua 的约定一致
+// 没有 IP 或者设备指纹的时候，窗口为 0，这一层就会被跳过
+func codeLimitLayers(biz, phone string, meta domain.CodeSendMeta, limit CodeLimitConfig) []codeLimitLayer {
+	layers := []codeLimitLayer{
+		{key: codeLimitKey(biz, "phone_hour", phone), limit: limit.PhonePerHour, window: time.Hour, err: ErrCodePhoneHourLimit},
+		{key: codeLimitKey(biz, "phone_day", phone), limit: limit.PhonePerDay, window: time.Hour * 24, err: ErrCodePhoneDayLimit},
+		{key: codeLimitKey(biz, "ip", meta.IP), limit: limit.IPPerHour, window: time.Hour, err: ErrCodeIPLimit},
+		{key: codeLimitKey(biz, "device", meta.Device), limit: limit.DevicePerHour, window: time.Hour, err: ErrCodeDeviceLimit},
+		{key: codeLimitKey(biz, "biz", "all"), limit: limit.BizPerMinute, window: time.Minute, err: ErrCodeBizLimit},
+	}
+	if meta.IP == "" {
+		layers[2].window = 0
+	}
+	if meta.Device == "" {
+		layers[3].window = 0
+	}
+	return layers
+}
+
+// limitKeysAndArgs 按照 set_code.lua 的约定，构造各层计数器的 key，以及阈值、窗口等参数
+func (c *RedisCodeCache) limitKeysAndArgs(biz, phone string, meta domain.CodeSendMeta) ([]string, []any) {
+	layers := codeLimitLayers(biz, phone, meta, c.limit)
+	keys := make([]string, 0, len(layers))
+	limits := make([]any, 0, len(layers))
+	windows := make([]any, 0, len(layers))
+	for _, l := range layers {
+		keys = append(keys, l.key)
+		limits = append(limits, l.limit)
+		windows = append(windows, int64(l.window.Seconds()))
+	}
+	captchaPassed := "0"
+	if meta.CaptchaPassed {
+		captchaPassed = "1"
+	}
+	args := append(limits, windows...)
+	args = append(args, c.limit.CaptchaThreshold, captchaPassed)
+	return keys, args
+}
+
 // Verify 方法用于验证用户输入的验证码是否与 Redis 中存储的验证码匹配。
 // ctx 是上下文，用于控制请求的生命周期。
 // biz 是业务标识。
@@ -105,5 +199,13 @@ func (c *RedisCodeCache) Verify(ctx context.Context, biz, phone, inputCode strin
 }
 
 func (c *RedisCodeCache) key(biz, phone string) string {
+	return codeKey(biz, phone)
+}
+
+func codeKey(biz, phone string) string {
 	return fmt.Sprintf("phone_code:%s:%s", biz, phone)
 }
+
+func codeLimitKey(biz, dimension, val string) string {
+	return fmt.Sprintf("phone_code_limit:%s:%s:%s", biz, dimension, val)
+}
@@ -0,0 +1,168 @@
+package cache
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"time"
+	"webook_go/webook/internal/domain"
+)
+
+// CodeCacheContractSuite CodeRedisCache 的契约测试
+// Redis 实现和本地实现跑的是同一套用例，保证两边的语义是一致的
+type CodeCacheContractSuite struct {
+	suite.Suite
+	// newCache 每个用例都创建一个新的实现
+	// 返回的 fastForward 用来模拟时间流逝
+	newCache func(limit CodeLimitConfig) (CodeRedisCache, func(d time.Duration))
+}
+
+const contractBiz = "contract"
+
+func (s *CodeCacheContractSuite) TestSetAndVerify() {
+	t := s.T()
+	c, _ := s.newCache(CodeLimitConfig{})
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, contractBiz, "15212345678", "123456", domain.CodeSendMeta{}))
+
+	ok, err := c.Verify(ctx, contractBiz, "15212345678", "123456")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// 验证码用过了就不能再用
+	ok, err = c.Verify(ctx, contractBiz, "15212345678", "123456")
+	assert.Equal(t, ErrCodeVerifyTooManyTimes, err)
+	assert.False(t, ok)
+}
+
+func (s *CodeCacheContractSuite) TestResendWindow() {
+	t := s.T()
+	c, fastForward := s.newCache(CodeLimitConfig{})
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, contractBiz, "15212345678", "123456", domain.CodeSendMeta{}))
+
+	// 一分钟之内不能重发
+	fastForward(time.Second * 30)
+	err := c.Set(ctx, contractBiz, "15212345678", "654321", domain.CodeSendMeta{})
+	assert.Equal(t, ErrCodeSendTooMany, err)
+
+	// 过了一分钟就可以了，新的验证码会覆盖旧的
+	fastForward(time.Second * 31)
+	require.NoError(t, c.Set(ctx, contractBiz, "15212345678", "654321", domain.CodeSendMeta{}))
+	ok, err := c.Verify(ctx, contractBiz, "15212345678", "123456")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = c.Verify(ctx, contractBiz, "15212345678", "654321")
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func (s *CodeCacheContractSuite) TestVerifyBudget() {
+	t := s.T()
+	c, _ := s.newCache(CodeLimitConfig{})
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, contractBiz, "15212345678", "123456", domain.CodeSendMeta{}))
+
+	// 只有三次机会
+	for i := 0; i < 3; i++ {
+		ok, err := c.Verify(ctx, contractBiz, "15212345678", "000000")
+		require.NoError(t, err)
+		assert.False(t, ok)
+	}
+	ok, err := c.Verify(ctx, contractBiz, "15212345678", "123456")
+	assert.Equal(t, ErrCodeVerifyTooManyTimes, err)
+	assert.False(t, ok)
+}
+
+func (s *CodeCacheContractSuite) TestExpiration() {
+	t := s.T()
+	c, fastForward := s.newCache(CodeLimitConfig{})
+	ctx := context.Background()
+
+	// 没发过验证码
+	ok, err := c.Verify(ctx, contractBiz, "15212345678", "123456")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, c.Set(ctx, contractBiz, "15212345678", "123456", domain.CodeSendMeta{}))
+	// 十分钟之后过期
+	fastForward(time.Minute*10 + time.Second)
+	ok, err = c.Verify(ctx, contractBiz, "15212345678", "123456")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func (s *CodeCacheContractSuite) TestPhoneLimit() {
+	t := s.T()
+	c, fastForward := s.newCache(CodeLimitConfig{PhonePerHour: 2})
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		require.NoError(t, c.Set(ctx, contractBiz, "15212345678", "123456", domain.CodeSendMeta{}))
+		fastForward(time.Second * 61)
+	}
+	err := c.Set(ctx, contractBiz, "15212345678", "123456", domain.CodeSendMeta{})
+	assert.Equal(t, ErrCodePhoneHourLimit, err)
+
+	// 窗口过去之后又可以发了
+	fastForward(time.Hour)
+	require.NoError(t, c.Set(ctx, contractBiz, "15212345678", "123456", domain.CodeSendMeta{}))
+}
+
+func (s *CodeCacheContractSuite) TestIPLimit() {
+	t := s.T()
+	c, _ := s.newCache(CodeLimitConfig{IPPerHour: 1})
+	ctx := context.Background()
+	meta := domain.CodeSendMeta{IP: "127.0.0.1"}
+	require.NoError(t, c.Set(ctx, contractBiz, "15212345678", "123456", meta))
+	// 同一个 IP 换个手机号也不行
+	err := c.Set(ctx, contractBiz, "15212345679", "123456", meta)
+	assert.Equal(t, ErrCodeIPLimit, err)
+	// 没有 IP 信息的不受这一层限制
+	require.NoError(t, c.Set(ctx, contractBiz, "15212345679", "123456", domain.CodeSendMeta{}))
+}
+
+func (s *CodeCacheContractSuite) TestCaptchaRequired() {
+	t := s.T()
+	c, fastForward := s.newCache(CodeLimitConfig{CaptchaThreshold: 1})
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, contractBiz, "15212345678", "123456", domain.CodeSendMeta{}))
+	fastForward(time.Second * 61)
+
+	err := c.Set(ctx, contractBiz, "15212345678", "123456", domain.CodeSendMeta{})
+	assert.Equal(t, ErrCodeCaptchaRequired, err)
+	require.NoError(t, c.Set(ctx, contractBiz, "15212345678", "123456",
+		domain.CodeSendMeta{CaptchaPassed: true}))
+}
+
+func TestLocalCodeCache_Contract(t *testing.T) {
+	suite.Run(t, &CodeCacheContractSuite{
+		newCache: func(limit CodeLimitConfig) (CodeRedisCache, func(d time.Duration)) {
+			c := NewLocalCodeCache(100, 500, limit).(*LocalCodeCache)
+			now := time.Now()
+			c.now = func() time.Time {
+				return now
+			}
+			return c, func(d time.Duration) {
+				now = now.Add(d)
+			}
+		},
+	})
+}
+
+// TestRedisCodeCache_Contract 用 miniredis 跑，不需要本地的 Redis，也可以直接快进时间
+func TestRedisCodeCache_Contract(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	})
+	suite.Run(t, &CodeCacheContractSuite{
+		newCache: func(limit CodeLimitConfig) (CodeRedisCache, func(d time.Duration)) {
+			mr.FlushAll()
+			return NewCodeCache(rdb, limit), mr.FastForward
+		},
+	})
+}
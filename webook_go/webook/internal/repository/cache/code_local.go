@@ -2,54 +2,180 @@ package cache
 
 import (
 	"context"
+	"fmt"
+	lru "github.com/hashicorp/golang-lru/v2"
 	"sync" // 导入sync包，用于实现线程安全的并发控制
+	"time"
+	"webook_go/webook/internal/domain"
 )
 
-// CodeCache 是一个接口，定义了设置和验证验证码的方法
-type CodeCache interface {
-	Set(ctx context.Context, biz, phone, code string) error
-	Verify(ctx context.Context, biz, phone, inputCode string) (bool, error)
+// LocalCodeCache 是 CodeRedisCache 的本地内存实现，给单机部署用的
+// 语义和 RedisCodeCache 的 Lua 脚本保持一致：
+// 验证码十分钟过期，一分钟内不能重发，最多验证三次，验证成功之后就不能再用了
+// 发送限制也是一样的，只不过计数器放在了本地
+type LocalCodeCache struct {
+	// 验证码，key 和 Redis 实现一致
+	// 用 LRU 来控制内存，容量满了之后淘汰最久没有用到的
+	codes *lru.Cache[string, *localCode]
+	// 各层限制的计数器，只能等窗口过期了再删，用 LRU 淘汰的话限制就被重置了
+	counters map[string]*localCounter
+	// maxCounters 计数器最多有多少个，满了又清理不出来的时候不再发送
+	maxCounters int
+	// lastSweep 上一次清理过期计数器的时间，一分钟最多清理一次
+	lastSweep time.Time
+	limit     CodeLimitConfig
+	// Redis 里面靠 Lua 脚本保证检查和修改是原子的，这里就靠锁
+	// LRU 自己的锁只能保证单个操作是安全的
+	mutex sync.Mutex
+	// now 方便测试的时候模拟时间流逝
+	now func() time.Time
 }
 
-// LocalCodeCache 是一个结构体，用于实现本地验证码缓存
-type LocalCodeCache struct {
-	cache map[string]map[string]string // 用于存储验证码的map，其中外层map的键为业务标识，内层map的键为手机号，值为验证码
-	mutex sync.RWMutex                 // 读写锁，确保并发安全
+type localCode struct {
+	code     string
+	expireAt time.Time
+	// 剩余的验证次数，-1 代表已经验证成功过了
+	cnt int
+}
+
+type localCounter struct {
+	cnt      int
+	expireAt time.Time
 }
 
-// NewLocalCodeCache 是一个函数，用于创建一个新的LocalCodeCache实例
-func NewLocalCodeCache() CodeCache {
+// NewLocalCodeCache capacity 是最多保存多少个验证码，maxCounters 是最多保存多少个限制的计数器
+// 每发一次验证码最多会用到五个计数器
+func NewLocalCodeCache(capacity, maxCounters int, limit CodeLimitConfig) CodeRedisCache {
+	codes, err := lru.New[string, *localCode](capacity)
+	if err != nil {
+		panic(fmt.Errorf("创建本地验证码缓存失败 %w", err))
+	}
 	return &LocalCodeCache{
-		cache: make(map[string]map[string]string),
+		codes:       codes,
+		counters:    make(map[string]*localCounter),
+		maxCounters: maxCounters,
+		limit:       limit,
+		now:         time.Now,
 	}
 }
 
 // Set 方法用于将验证码存储到缓存中
-// 如果对应业务的验证码map不存在，则先创建它
-func (c *LocalCodeCache) Set(ctx context.Context, biz string, phone string, code string) error {
+// 检查的顺序和 set_code.lua 一样：先看是不是一分钟内发过，再看各层限制，最后看要不要图形验证码
+func (c *LocalCodeCache) Set(ctx context.Context, biz string, phone string, code string, meta domain.CodeSendMeta) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	now := c.now()
+	key := codeKey(biz, phone)
+	if item, ok := c.getCode(key, now); ok && item.expireAt.Sub(now) >= time.Minute*9 {
+		return ErrCodeSendTooMany
+	}
+
+	layers := codeLimitLayers(biz, phone, meta, c.limit)
+	counts := make([]int, len(layers))
+	added := 0
+	for i, l := range layers {
+		if l.window == 0 {
+			continue
+		}
+		counts[i] = c.count(l.key, now)
+		if l.limit > 0 && counts[i] >= l.limit {
+			return l.err
+		}
+		if counts[i] == 0 {
+			added++
+		}
+	}
+	if !c.reserve(added, now) {
+		// 计数器放不下了，和触发了全局限制一样，宁可不发也不能让限制失效
+		return ErrCodeBizLimit
+	}
+	// 同一个手机号或者同一个 IP 发送次数过多，要求先通过图形验证码
+	threshold := c.limit.CaptchaThreshold
+	if threshold > 0 && !meta.CaptchaPassed &&
+		(counts[0] >= threshold || counts[2] >= threshold) {
+		return ErrCodeCaptchaRequired
+	}
 
-	if _, ok := c.cache[biz]; !ok {
-		c.cache[biz] = make(map[string]string)
+	c.codes.Add(key, &localCode{
+		code:     code,
+		expireAt: now.Add(time.Minute * 10),
+		cnt:      3,
+	})
+	for _, l := range layers {
+		if l.window > 0 {
+			c.incr(l.key, l.window, now)
+		}
 	}
-	c.cache[biz][phone] = code
 	return nil
 }
 
 // Verify 方法用于验证缓存中的验证码是否匹配
-// 先通过读写锁获取读锁，检查对应业务的验证码map是否存在以及验证码是否匹配
-// 如果匹配成功，则删除缓存中的验证码
+// 验证码不存在或者过期了，当成验证码错误；验证次数用完了，或者已经用过了，返回 ErrCodeVerifyTooManyTimes
 func (c *LocalCodeCache) Verify(ctx context.Context, biz, phone, inputCode string) (bool, error) {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
-
-	if _, ok := c.cache[biz]; !ok {
-		return false, ErrUnknowForCode // 返回未知业务错误
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	item, ok := c.getCode(codeKey(biz, phone), c.now())
+	if !ok {
+		return false, nil
+	}
+	if item.cnt <= 0 {
+		return false, ErrCodeVerifyTooManyTimes
 	}
-	if code, ok := c.cache[biz][phone]; ok && code == inputCode {
-		delete(c.cache[biz], phone) // 验证成功后删除缓存中的验证码
+	if item.code == inputCode {
+		// 标记成已经用过了
+		item.cnt = -1
 		return true, nil
 	}
-	return false, nil // 返回验证失败错误（这里应该是自定义的错误类型ErrVerificationFailed）
+	item.cnt--
+	return false, nil
+}
+
+// getCode 取出没有过期的验证码，过期了的顺手删掉
+func (c *LocalCodeCache) getCode(key string, now time.Time) (*localCode, bool) {
+	item, ok := c.codes.Get(key)
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(item.expireAt) {
+		c.codes.Remove(key)
+		return nil, false
+	}
+	return item, true
+}
+
+// reserve 看看还能不能再放 n 个计数器，放不下的时候先清理过期的
+func (c *LocalCodeCache) reserve(n int, now time.Time) bool {
+	if len(c.counters)+n <= c.maxCounters {
+		return true
+	}
+	if now.Sub(c.lastSweep) >= time.Minute {
+		c.lastSweep = now
+		for key, counter := range c.counters {
+			if !now.Before(counter.expireAt) {
+				delete(c.counters, key)
+			}
+		}
+	}
+	return len(c.counters)+n <= c.maxCounters
+}
+
+func (c *LocalCodeCache) count(key string, now time.Time) int {
+	counter, ok := c.counters[key]
+	if !ok || !now.Before(counter.expireAt) {
+		return 0
+	}
+	return counter.cnt
+}
+
+// incr 和 Redis 里面 INCR 加上第一次计数的时候设置过期时间一样，是固定窗口
+func (c *LocalCodeCache) incr(key string, window time.Duration, now time.Time) {
+	counter, ok := c.counters[key]
+	if !ok || !now.Before(counter.expireAt) {
+		c.counters[key] = &localCounter{
+			cnt:      1,
+			expireAt: now.Add(window),
+		}
+		return
+	}
+	counter.cnt++
 }
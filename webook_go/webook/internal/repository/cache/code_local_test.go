@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+	"webook_go/webook/internal/domain"
+)
+
+func TestLocalCodeCache_Evict(t *testing.T) {
+	c := NewLocalCodeCache(2, 10, CodeLimitConfig{})
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "login", "15212345671", "111111", domain.CodeSendMeta{}))
+	require.NoError(t, c.Set(ctx, "login", "15212345672", "222222", domain.CodeSendMeta{}))
+	// 容量只有 2，第三个进来之后，最久没用的第一个会被淘汰
+	require.NoError(t, c.Set(ctx, "login", "15212345673", "333333", domain.CodeSendMeta{}))
+
+	ok, err := c.Verify(ctx, "login", "15212345671", "111111")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = c.Verify(ctx, "login", "15212345673", "333333")
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestLocalCodeCache_Counters(t *testing.T) {
+	now := time.Now()
+	// 发一次要用三个计数器：手机号每小时、每天，还有业务的全局限制
+	c := NewLocalCodeCache(10, 3, CodeLimitConfig{PhonePerHour: 1}).(*LocalCodeCache)
+	c.now = func() time.Time {
+		return now
+	}
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "login", "15212345671", "111111", domain.CodeSendMeta{}))
+	// 过了重发的间隔，但是一个小时内还是不能再发
+	now = now.Add(time.Minute * 2)
+	err := c.Set(ctx, "login", "15212345671", "111111", domain.CodeSendMeta{})
+	assert.Equal(t, ErrCodePhoneHourLimit, err)
+
+	// 计数器满了，又没有过期的，宁可不发
+	err = c.Set(ctx, "login", "15212345672", "222222", domain.CodeSendMeta{})
+	assert.Equal(t, ErrCodeBizLimit, err)
+
+	// 过期了的清理掉之后又能发了
+	now = now.Add(time.Hour * 24)
+	require.NoError(t, c.Set(ctx, "login", "15212345672", "222222", domain.CodeSendMeta{}))
+}
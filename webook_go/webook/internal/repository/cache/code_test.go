@@ -7,19 +7,40 @@ import (
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/mock/gomock"
 	"testing"
+	"webook_go/webook/internal/domain"
 	"webook_go/webook/internal/repository/cache/redismocks"
 )
 
 func TestRedisCodeCache_Set(t *testing.T) {
+	// 各层计数器的 key，顺序要和 set_code.lua 里面的约定一致
+	limitKeys := func(ip, device string) []string {
+		return []string{"phone_code:login:1525",
+			"phone_code_limit:login:phone_hour:1525",
+			"phone_code_limit:login:phone_day:1525",
+			"phone_code_limit:login:ip:" + ip,
+			"phone_code_limit:login:device:" + device,
+			"phone_code_limit:login:biz:all",
+		}
+	}
+	limit := CodeLimitConfig{
+		PhonePerHour:     5,
+		PhonePerDay:      10,
+		IPPerHour:        20,
+		DevicePerHour:    10,
+		BizPerMinute:     1000,
+		CaptchaThreshold: 3,
+	}
 	testCases := []struct {
 		name string
 		mock func(ctrl *gomock.Controller) redis.Cmdable
 
 		// 输入
 		ctx   context.Context
+		limit CodeLimitConfig
 		biz   string
 		phone string
 		code  string
+		meta  domain.CodeSendMeta
 
 		// 输出
 		wantErr error
@@ -31,8 +52,12 @@ func TestRedisCodeCache_Set(t *testing.T) {
 				res := redis.NewCmd(context.Background())
 				//res.SetErr(nil)
 				res.SetVal(int64(0))
+				// 没有 IP 和设备指纹，这两层的窗口是 0
 				cmd.EXPECT().Eval(gomock.Any(), luaSetCode,
-					[]string{"phone_code:login:1525"}, []any{"123456"}).Return(res)
+					limitKeys("", ""), []any{"123456",
+						0, 0, 0, 0, 0,
+						int64(3600), int64(86400), int64(0), int64(0), int64(60),
+						0, "0"}).Return(res)
 				return cmd
 			},
 			ctx:   context.Background(),
@@ -42,6 +67,32 @@ func TestRedisCodeCache_Set(t *testing.T) {
 
 			wantErr: nil,
 		},
+		{
+			name: "带上限制和请求来源",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				cmd := redismocks.NewMockCmdable(ctrl)
+				res := redis.NewCmd(context.Background())
+				res.SetVal(int64(0))
+				cmd.EXPECT().Eval(gomock.Any(), luaSetCode,
+					limitKeys("127.0.0.1", "abc"), []any{"123456",
+						5, 10, 20, 10, 1000,
+						int64(3600), int64(86400), int64(3600), int64(3600), int64(60),
+						3, "1"}).Return(res)
+				return cmd
+			},
+			ctx:   context.Background(),
+			limit: limit,
+			biz:   "login",
+			phone: "1525",
+			code:  "123456",
+			meta: domain.CodeSendMeta{
+				IP:            "127.0.0.1",
+				Device:        "abc",
+				CaptchaPassed: true,
+			},
+
+			wantErr: nil,
+		},
 		{
 			name: "redis错误",
 			mock: func(ctrl *gomock.Controller) redis.Cmdable {
@@ -50,7 +101,7 @@ func TestRedisCodeCache_Set(t *testing.T) {
 				res.SetErr(errors.New("mock redis 错误"))
 				//res.SetVal(int64(0))
 				cmd.EXPECT().Eval(gomock.Any(), luaSetCode,
-					[]string{"phone_code:login:1525"}, []any{"123456"}).Return(res)
+					gomock.Any(), gomock.Any()).Return(res)
 				return cmd
 			},
 			ctx:   context.Background(),
@@ -63,13 +114,7 @@ func TestRedisCodeCache_Set(t *testing.T) {
 		{
 			name: "发送太频繁",
 			mock: func(ctrl *gomock.Controller) redis.Cmdable {
-				cmd := redismocks.NewMockCmdable(ctrl)
-				res := redis.NewCmd(context.Background())
-				//res.SetErr(nil)
-				res.SetVal(int64(-1))
-				cmd.EXPECT().Eval(gomock.Any(), luaSetCode,
-					[]string{"phone_code:login:1525"}, []any{"123456"}).Return(res)
-				return cmd
+				return mockSetCodeRes(ctrl, -1)
 			},
 			ctx:   context.Background(),
 			biz:   "login",
@@ -78,16 +123,82 @@ func TestRedisCodeCache_Set(t *testing.T) {
 
 			wantErr: ErrCodeSendTooMany,
 		},
+		{
+			name: "手机号每小时超限",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				return mockSetCodeRes(ctrl, -3)
+			},
+			ctx:   context.Background(),
+			biz:   "login",
+			phone: "1525",
+			code:  "123456",
+
+			wantErr: ErrCodePhoneHourLimit,
+		},
+		{
+			name: "手机号每天超限",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				return mockSetCodeRes(ctrl, -4)
+			},
+			ctx:   context.Background(),
+			biz:   "login",
+			phone: "1525",
+			code:  "123456",
+
+			wantErr: ErrCodePhoneDayLimit,
+		},
+		{
+			name: "IP 超限",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				return mockSetCodeRes(ctrl, -5)
+			},
+			ctx:   context.Background(),
+			biz:   "login",
+			phone: "1525",
+			code:  "123456",
+
+			wantErr: ErrCodeIPLimit,
+		},
+		{
+			name: "设备超限",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				return mockSetCodeRes(ctrl, -6)
+			},
+			ctx:   context.Background(),
+			biz:   "login",
+			phone: "1525",
+			code:  "123456",
+
+			wantErr: ErrCodeDeviceLimit,
+		},
+		{
+			name: "业务全局超限",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				return mockSetCodeRes(ctrl, -7)
+			},
+			ctx:   context.Background(),
+			biz:   "login",
+			phone: "1525",
+			code:  "123456",
+
+			wantErr: ErrCodeBizLimit,
+		},
+		{
+			name: "需要图形验证码",
+			mock: func(ctrl *gomock.Controller) redis.Cmdable {
+				return mockSetCodeRes(ctrl, -8)
+			},
+			ctx:   context.Background(),
+			biz:   "login",
+			phone: "1525",
+			code:  "123456",
+
+			wantErr: ErrCodeCaptchaRequired,
+		},
 		{
 			name: "系统错误",
 			mock: func(ctrl *gomock.Controller) redis.Cmdable {
-				cmd := redismocks.NewMockCmdable(ctrl)
-				res := redis.NewCmd(context.Background())
-				//res.SetErr(nil)
-				res.SetVal(int64(-10))
-				cmd.EXPECT().Eval(gomock.Any(), luaSetCode,
-					[]string{"phone_code:login:1525"}, []any{"123456"}).Return(res)
-				return cmd
+				return mockSetCodeRes(ctrl, -10)
 			},
 			ctx:   context.Background(),
 			biz:   "login",
@@ -102,9 +213,19 @@ func TestRedisCodeCache_Set(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
-			c := NewCodeCache(tc.mock(ctrl))
-			err := c.Set(tc.ctx, tc.biz, tc.phone, tc.code)
+			c := NewCodeCache(tc.mock(ctrl), tc.limit)
+			err := c.Set(tc.ctx, tc.biz, tc.phone, tc.code, tc.meta)
 			assert.Equal(t, tc.wantErr, err)
 		})
 	}
 }
+
+// mockSetCodeRes 只关心 Lua 脚本返回值的用例
+func mockSetCodeRes(ctrl *gomock.Controller, val int64) redis.Cmdable {
+	cmd := redismocks.NewMockCmdable(ctrl)
+	res := redis.NewCmd(context.Background())
+	res.SetVal(val)
+	cmd.EXPECT().Eval(gomock.Any(), luaSetCode,
+		gomock.Any(), gomock.Any()).Return(res)
+	return cmd
+}
@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"strings"
+	"time"
+)
+
+var (
+	ErrLoginLocked      = errors.New("登录失败次数太多，账号暂时被锁定")
+	ErrLoginTooFrequent = errors.New("登录失败之后重试太快")
+	ErrLoginIPLimit     = errors.New("该 IP 登录失败次数太多")
+)
+
+//go:embed lua/attempt_login.lua
+var luaAttemptLogin string
+
+//go:embed lua/login_succeeded.lua
+var luaLoginSucceeded string
+
+// LoginLimitConfig 防止暴力破解密码，所有的次数 0 都代表不限制
+type LoginLimitConfig struct {
+	// Window 失败次数的统计窗口
+	Window time.Duration
+	// FreeAttempts 前几次失败不需要等待，输错密码很正常
+	FreeAttempts int
+	// BaseDelay 超过 FreeAttempts 之后，下一次登录要等待的时间，之后每多失败一次翻倍
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockThreshold 失败多少次之后锁定账号
+	LockThreshold int
+	LockDuration  time.Duration
+	// IPThreshold 同一个 IP 失败多少次之后，不管登录哪个账号都不行
+	IPThreshold int
+}
+
+// LoginLimitCache 登录失败的计数，账号不存在的时候也一样计数，不然可以借此判断邮箱有没有注册
+// 检查和计数如果分开，并发的请求可以在计数之前都通过检查，所以校验密码之前就先当作失败计数
+type LoginLimitCache interface {
+	// Attempt 校验密码之前调用，检查通过的话把这一次当作失败计数
+	// 返回 ErrLoginLocked、ErrLoginTooFrequent 或者 ErrLoginIPLimit
+	Attempt(ctx context.Context, account, ip string) error
+	// Failed 密码不对，次数在 Attempt 的时候已经计过了，这一次导致账号被锁定的话返回 ErrLoginLocked
+	Failed(ctx context.Context, account string) error
+	// Succeeded 登录成功，回滚 Attempt 的计数
+	Succeeded(ctx context.Context, account, ip string) error
+	// Reset 解锁之后，清掉账号的失败次数和锁定
+	Reset(ctx context.Context, account string) error
+}
+
+type RedisLoginLimitCache struct {
+	client redis.Cmdable
+	cfg    LoginLimitConfig
+}
+
+func NewLoginLimitCache(client redis.Cmdable, cfg LoginLimitConfig) LoginLimitCache {
+	return &RedisLoginLimitCache{
+		client: client,
+		cfg:    cfg,
+	}
+}
+
+func (c *RedisLoginLimitCache) Attempt(ctx context.Context, account, ip string) error {
+	account = c.normalize(account)
+	res, err := c.client.Eval(ctx, luaAttemptLogin,
+		[]string{c.key("lock", account), c.key("delay", account),
+			c.key("ip", ip), c.key("account", account)},
+		c.ipThreshold(ip), int64(c.cfg.Window.Seconds()), c.cfg.FreeAttempts,
+		c.cfg.BaseDelay.Milliseconds(), c.cfg.MaxDelay.Milliseconds(),
+		c.cfg.LockThreshold, int64(c.cfg.LockDuration.Seconds()), c.hasIP(ip)).Int()
+	if err != nil {
+		return err
+	}
+	switch {
+	case res > 0:
+		return nil
+	case res == -1:
+		return ErrLoginLocked
+	case res == -2:
+		return ErrLoginTooFrequent
+	case res == -3:
+		return ErrLoginIPLimit
+	default:
+		return errors.New("系统错误")
+	}
+}
+
+func (c *RedisLoginLimitCache) Failed(ctx context.Context, account string) error {
+	account = c.normalize(account)
+	cnt, err := c.client.Exists(ctx, c.key("lock", account)).Result()
+	if err != nil {
+		return err
+	}
+	if cnt > 0 {
+		return ErrLoginLocked
+	}
+	return nil
+}
+
+func (c *RedisLoginLimitCache) Succeeded(ctx context.Context, account, ip string) error {
+	account = c.normalize(account)
+	return c.client.Eval(ctx, luaLoginSucceeded,
+		[]string{c.key("account", account), c.key("delay", account),
+			c.key("lock", account), c.key("ip", ip)},
+		c.hasIP(ip)).Err()
+}
+
+func (c *RedisLoginLimitCache) Reset(ctx context.Context, account string) error {
+	account = c.normalize(account)
+	return c.client.Del(ctx, c.key("account", account),
+		c.key("delay", account), c.key("lock", account)).Err()
+}
+
+func (c *RedisLoginLimitCache) hasIP(ip string) string {
+	if ip == "" {
+		return "0"
+	}
+	return "1"
+}
+
+// ipThreshold 没有 IP 的时候不检查
+func (c *RedisLoginLimitCache) ipThreshold(ip string) int {
+	if ip == "" {
+		return 0
+	}
+	return c.cfg.IPThreshold
+}
+
+// normalize 邮箱不区分大小写，不然换个大小写就能绕过限制
+func (c *RedisLoginLimitCache) normalize(account string) string {
+	return strings.ToLower(strings.TrimSpace(account))
+}
+
+func (c *RedisLoginLimitCache) key(typ, val string) string {
+	return "login_limit:" + typ + ":" + val
+}
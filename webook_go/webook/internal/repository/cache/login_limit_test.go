@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"testing"
+	"time"
+	"webook_go/webook/internal/repository/cache/redismocks"
+)
+
+var testLoginLimitCfg = LoginLimitConfig{
+	Window:        time.Minute * 15,
+	FreeAttempts:  3,
+	BaseDelay:     time.Second,
+	MaxDelay:      time.Second * 30,
+	LockThreshold: 10,
+	LockDuration:  time.Minute * 30,
+	IPThreshold:   50,
+}
+
+func TestRedisLoginLimitCache_Attempt(t *testing.T) {
+	testCases := []struct {
+		name string
+		ip   string
+		// Lua 脚本的返回值
+		res int64
+
+		wantIPThreshold int
+		wantHasIP       string
+		wantErr         error
+	}{
+		{name: "可以登录", ip: "127.0.0.1", res: 1, wantIPThreshold: 50, wantHasIP: "1"},
+		{name: "没有 IP 不检查 IP", res: 1, wantIPThreshold: 0, wantHasIP: "0"},
+		{name: "账号被锁定", ip: "127.0.0.1", res: -1, wantIPThreshold: 50, wantHasIP: "1", wantErr: ErrLoginLocked},
+		{name: "要等待", ip: "127.0.0.1", res: -2, wantIPThreshold: 50, wantHasIP: "1", wantErr: ErrLoginTooFrequent},
+		{name: "IP 失败太多", ip: "127.0.0.1", res: -3, wantIPThreshold: 50, wantHasIP: "1", wantErr: ErrLoginIPLimit},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := redismocks.NewMockCmdable(ctrl)
+			res := redis.NewCmd(context.Background())
+			res.SetVal(tc.res)
+			// 邮箱统一转成小写
+			cmd.EXPECT().Eval(gomock.Any(), luaAttemptLogin,
+				[]string{"login_limit:lock:123@qq.com", "login_limit:delay:123@qq.com",
+					"login_limit:ip:" + tc.ip, "login_limit:account:123@qq.com"},
+				[]any{tc.wantIPThreshold, int64(900), 3, int64(1000), int64(30000),
+					10, int64(1800), tc.wantHasIP}).Return(res)
+			c := NewLoginLimitCache(cmd, testLoginLimitCfg)
+			err := c.Attempt(context.Background(), "123@QQ.com", tc.ip)
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
+
+func TestRedisLoginLimitCache_Failed(t *testing.T) {
+	testCases := []struct {
+		name   string
+		exists int64
+
+		wantErr error
+	}{
+		{name: "还没有锁定"},
+		{name: "这一次锁定了账号", exists: 1, wantErr: ErrLoginLocked},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := redismocks.NewMockCmdable(ctrl)
+			res := redis.NewIntCmd(context.Background())
+			res.SetVal(tc.exists)
+			cmd.EXPECT().Exists(gomock.Any(), "login_limit:lock:123@qq.com").Return(res)
+			c := NewLoginLimitCache(cmd, testLoginLimitCfg)
+			err := c.Failed(context.Background(), "123@qq.com")
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
+
+func TestRedisLoginLimitCache_Succeeded(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := redismocks.NewMockCmdable(ctrl)
+	res := redis.NewCmd(context.Background())
+	res.SetVal(int64(0))
+	cmd.EXPECT().Eval(gomock.Any(), luaLoginSucceeded,
+		[]string{"login_limit:account:123@qq.com", "login_limit:delay:123@qq.com",
+			"login_limit:lock:123@qq.com", "login_limit:ip:127.0.0.1"},
+		[]any{"1"}).Return(res)
+	c := NewLoginLimitCache(cmd, testLoginLimitCfg)
+	assert.NoError(t, c.Succeeded(context.Background(), "123@qq.com", "127.0.0.1"))
+}
+
+// TestRedisLoginLimitCache_Lua 上面的用例只校验了参数，这里用 miniredis 真的跑一遍脚本
+func TestRedisLoginLimitCache_Lua(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cfg := testLoginLimitCfg
+	cfg.IPThreshold = 12
+	c := NewLoginLimitCache(redis.NewClient(&redis.Options{Addr: mr.Addr()}), cfg)
+	ctx := context.Background()
+
+	// 前面几次失败不用等
+	for i := 0; i < cfg.FreeAttempts; i++ {
+		require.NoError(t, c.Attempt(ctx, "a@b.com", "ip1"))
+		require.NoError(t, c.Failed(ctx, "a@b.com"))
+	}
+	require.NoError(t, c.Attempt(ctx, "a@b.com", "ip1"))
+	// 检查和计数在一个脚本里面，并发的请求要等，账号不区分大小写
+	assert.Equal(t, ErrLoginTooFrequent, c.Attempt(ctx, "A@b.com", "ip1"))
+
+	// 登录成功了把这一次的计数退回去
+	require.NoError(t, c.Succeeded(ctx, "a@b.com", "ip1"))
+	ipCnt, err := mr.Get("login_limit:ip:ip1")
+	require.NoError(t, err)
+	assert.Equal(t, "3", ipCnt)
+
+	// 一直失败就锁定
+	require.NoError(t, c.Attempt(ctx, "a@b.com", "ip1"))
+	for i := 1; i < cfg.LockThreshold; i++ {
+		mr.FastForward(time.Minute)
+		require.NoError(t, c.Attempt(ctx, "a@b.com", ""))
+	}
+	assert.Equal(t, ErrLoginLocked, c.Failed(ctx, "a@b.com"))
+	assert.Equal(t, ErrLoginLocked, c.Attempt(ctx, "a@b.com", "ip1"))
+
+	// 解锁之后又可以登录了
+	require.NoError(t, c.Reset(ctx, "a@b.com"))
+	assert.NoError(t, c.Attempt(ctx, "a@b.com", "ip1"))
+}
@@ -0,0 +1,62 @@
+-- 校验密码之前调用，检查和计数放在一个脚本里面
+-- 先当作失败计数，并发的请求只有一个能通过等待时间和锁定的检查，登录成功之后再回滚
+local lockKey = KEYS[1]
+local delayKey = KEYS[2]
+local ipKey = KEYS[3]
+local accountKey = KEYS[4]
+-- 同一个 IP 在窗口内失败多少次之后就不允许登录，0 代表不限制
+local ipThreshold = tonumber(ARGV[1])
+-- 失败次数的统计窗口（秒）
+local window = tonumber(ARGV[2])
+-- 前几次失败不需要等待
+local freeAttempts = tonumber(ARGV[3])
+-- 等待时间（毫秒），超过 freeAttempts 之后每多失败一次翻倍，最多 maxDelay
+local baseDelay = tonumber(ARGV[4])
+local maxDelay = tonumber(ARGV[5])
+-- 失败多少次之后锁定账号，0 代表不锁定
+local lockThreshold = tonumber(ARGV[6])
+-- 锁定多久（秒）
+local lockDuration = tonumber(ARGV[7])
+-- 有没有 IP
+local hasIP = ARGV[8] == "1"
+
+if redis.call("exists", lockKey) == 1 then
+    -- 账号被锁定了
+    return -1
+end
+if redis.call("exists", delayKey) == 1 then
+    -- 上一次失败之后还没有等够时间
+    return -2
+end
+if ipThreshold > 0 then
+    local ipCnt = tonumber(redis.call("get", ipKey) or "0")
+    if ipCnt >= ipThreshold then
+        return -3
+    end
+end
+
+local cnt = redis.call("incr", accountKey)
+if cnt == 1 then
+    redis.call("expire", accountKey, window)
+end
+if hasIP then
+    if redis.call("incr", ipKey) == 1 then
+        redis.call("expire", ipKey, window)
+    end
+end
+
+if lockThreshold > 0 and cnt >= lockThreshold then
+    -- 这一次也不对的话账号就锁定了，对的话登录成功的时候会解锁
+    redis.call("set", lockKey, "1", "EX", lockDuration)
+    -- 解锁之后重新计数
+    redis.call("del", accountKey, delayKey)
+    return cnt
+end
+if cnt > freeAttempts and baseDelay > 0 then
+    local delay = baseDelay * 2 ^ (cnt - freeAttempts - 1)
+    if delay > maxDelay then
+        delay = maxDelay
+    end
+    redis.call("set", delayKey, "1", "PX", math.floor(delay))
+end
+return cnt
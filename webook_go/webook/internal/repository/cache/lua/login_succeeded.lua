@@ -0,0 +1,12 @@
+-- 登录成功，回滚校验之前记的失败次数
+local accountKey = KEYS[1]
+local delayKey = KEYS[2]
+local lockKey = KEYS[3]
+local ipKey = KEYS[4]
+local hasIP = ARGV[1] == "1"
+
+redis.call("del", accountKey, delayKey, lockKey)
+if hasIP and tonumber(redis.call("get", ipKey) or "0") > 0 then
+    redis.call("decr", ipKey)
+end
+return 0
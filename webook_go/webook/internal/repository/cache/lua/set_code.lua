@@ -6,24 +6,64 @@ local cntKey = key..":cnt"
 -- 你的验证码 123456
 -- 获取传入的验证码值
 local val = ARGV[1]
+-- 多层限制的计数器 key，依次是：
+-- KEYS[2] 手机号每小时，KEYS[3] 手机号每天，KEYS[4] IP 每小时，KEYS[5] 设备每小时，KEYS[6] 业务全局每分钟
+-- 对应的阈值是 ARGV[2] ~ ARGV[6]，0 代表只计数不限制
+-- 对应的窗口大小（秒）是 ARGV[7] ~ ARGV[11]，0 代表这一层不启用，既不计数也不限制
+local layers = #KEYS - 1
+-- 累计发送次数达到这个值之后，就要求图形验证码，0 代表不启用
+local captchaThreshold = tonumber(ARGV[2 * layers + 2])
+-- 调用方是否已经通过了图形验证码
+local captchaPassed = ARGV[2 * layers + 3] == "1"
 -- 获取验证码的过期时间
 local ttl = tonumber(redis.call("ttl", key))
 if ttl == -1 then
     -- 如果过期时间为 -1，说明这个 key 存在但没有设置过期时间
     -- 这可能是一个系统错误，例如同事手动设置了 key 但没有设置过期时间
     return -2
-    -- 如果过期时间小于 540（600秒 - 60秒的缓冲时间），说明验证码被频繁尝试
-    -- 这种情况可能是由于网络延迟、重试、恶意攻击等原因导致的
-    -- 在这种情况下，我们重新设置验证码和过期时间，并重置验证次数为3
-elseif ttl == -2 or ttl < 540 then
-    redis.call("set", key, val) -- 重新设置验证码
-    redis.call("expire", key, 600) -- 设置新的过期时间为600秒
-    redis.call("set", cntKey, 3) -- 重置验证次数为3
-    redis.call("expire", cntKey, 600) -- 设置新的过期时间为600秒
-    -- 完美，符合预期
-    return 0 -- 返回0，表示操作成功
-else
-    -- 如果过期时间大于或等于540秒，说明验证码发送太频繁
+elseif ttl >= 540 then
+    -- 如果过期时间大于或等于540秒，说明一分钟内已经发过了，验证码发送太频繁
     -- 这种情况下，我们不进行任何操作，并返回-1作为错误码
     return -1
-end
\ No newline at end of file
+end
+
+-- 逐层检查，任意一层超限都直接返回，并且不会计数
+-- 返回值 -3 ~ -7 依次对应上面的 KEYS[2] ~ KEYS[6]
+local counts = {}
+for i = 2, #KEYS do
+    local limit = tonumber(ARGV[i])
+    local window = tonumber(ARGV[i + layers])
+    local cnt = 0
+    if window > 0 then
+        cnt = tonumber(redis.call("get", KEYS[i]) or "0")
+        if limit > 0 and cnt >= limit then
+            return -(i + 1)
+        end
+    end
+    counts[i] = cnt
+end
+
+-- 同一个手机号或者同一个 IP 发送次数过多，要求先通过图形验证码
+if captchaThreshold > 0 and not captchaPassed and
+        (counts[2] >= captchaThreshold or counts[4] >= captchaThreshold) then
+    return -8
+end
+
+-- 这里要么 key 不存在，要么已经过了一分钟，可以重新发送
+-- 我们重新设置验证码和过期时间，并重置验证次数为3
+redis.call("set", key, val) -- 重新设置验证码
+redis.call("expire", key, 600) -- 设置新的过期时间为600秒
+redis.call("set", cntKey, 3) -- 重置验证次数为3
+redis.call("expire", cntKey, 600) -- 设置新的过期时间为600秒
+
+-- 所有启用的层都计数一次，第一次计数的时候设置窗口的过期时间
+for i = 2, #KEYS do
+    local window = tonumber(ARGV[i + layers])
+    if window > 0 then
+        if redis.call("incr", KEYS[i]) == 1 then
+            redis.call("expire", KEYS[i], window)
+        end
+    end
+end
+-- 完美，符合预期
+return 0 -- 返回0，表示操作成功
@@ -6,6 +6,10 @@ local cntKey = key .. ":cnt"
 local expectedCode = ARGV[1]
 -- 从 Redis 中获取与 key 对应的验证码
 local code = redis.call("get", key)
+-- 验证码不存在，要么没发过，要么已经过期了，当成验证码错误处理
+if not code then
+    return -2
+end
 -- 从 Redis 中获取与 cntKey 对应的验证次数
 local cnt = tonumber(redis.call("get", cntKey))
 -- 如果验证次数小于或等于0
@@ -18,7 +22,8 @@ end
 if code == expectedCode then
     -- 说明验证码输入正确
     -- 将验证次数设置为 -1，表示该验证码已经使用过
-    redis.call("set", cntKey, -1)
+    -- 保留原本的过期时间，不然这个 key 就永远不会过期了
+    redis.call("set", cntKey, -1, "KEEPTTL")
     return 0
 else
     -- 如果用户输入的验证码与 Redis 中存储的验证码不同
@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+var ErrMergeTicketInvalid = errors.New("合并账号的凭证无效或者已经过期")
+
+// mergeTicketExpiration 发现冲突之后，要在这个时间内确认合并
+const mergeTicketExpiration = time.Minute * 10
+
+// MergeTicketCache 绑定的时候发现手机号、邮箱或者第三方账号属于另外一个账号，
+// 用户已经证明了自己拥有那个账号，发一张凭证，确认之后就可以合并
+type MergeTicketCache interface {
+	// Set from 是要被合并的账号，to 是当前登录的账号
+	Set(ctx context.Context, ticket string, from, to int64) error
+	// Take 取出来就删掉，只能用一次
+	Take(ctx context.Context, ticket string) (from int64, to int64, err error)
+}
+
+type RedisMergeTicketCache struct {
+	cmd redis.Cmdable
+}
+
+func NewMergeTicketCache(cmd redis.Cmdable) MergeTicketCache {
+	return &RedisMergeTicketCache{
+		cmd: cmd,
+	}
+}
+
+func (c *RedisMergeTicketCache) Set(ctx context.Context, ticket string, from, to int64) error {
+	return c.cmd.Set(ctx, c.key(ticket), fmt.Sprintf("%d:%d", from, to), mergeTicketExpiration).Err()
+}
+
+func (c *RedisMergeTicketCache) Take(ctx context.Context, ticket string) (int64, int64, error) {
+	val, err := c.cmd.GetDel(ctx, c.key(ticket)).Result()
+	if err == redis.Nil {
+		return 0, 0, ErrMergeTicketInvalid
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	var from, to int64
+	_, err = fmt.Sscanf(val, "%d:%d", &from, &to)
+	if err != nil {
+		return 0, 0, ErrMergeTicketInvalid
+	}
+	return from, to, nil
+}
+
+func (c *RedisMergeTicketCache) key(ticket string) string {
+	return "users:merge_ticket:" + ticket
+}
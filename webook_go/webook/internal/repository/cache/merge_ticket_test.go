@@ -0,0 +1,44 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"testing"
+	"webook_go/webook/internal/repository/cache/redismocks"
+)
+
+func TestRedisMergeTicketCache_Take(t *testing.T) {
+	testCases := []struct {
+		name string
+		val  string
+		err  error
+
+		wantFrom int64
+		wantTo   int64
+		wantErr  error
+	}{
+		{name: "成功", val: "123:456", wantFrom: 123, wantTo: 456},
+		{name: "不存在或者用过了", err: redis.Nil, wantErr: ErrMergeTicketInvalid},
+		{name: "格式不对", val: "abc", wantErr: ErrMergeTicketInvalid},
+		{name: "Redis 错误", err: errors.New("redis 错误"), wantErr: errors.New("redis 错误")},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := redismocks.NewMockCmdable(ctrl)
+			res := redis.NewStringCmd(context.Background())
+			res.SetVal(tc.val)
+			res.SetErr(tc.err)
+			cmd.EXPECT().GetDel(gomock.Any(), "users:merge_ticket:abc").Return(res)
+			c := NewMergeTicketCache(cmd)
+			from, to, err := c.Take(context.Background(), "abc")
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantFrom, from)
+			assert.Equal(t, tc.wantTo, to)
+		})
+	}
+}
@@ -3,6 +3,7 @@ package cache
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/redis/go-redis/v9"
 	"time"
@@ -11,10 +12,20 @@ import (
 
 var ErrKeyNotExist = redis.Nil
 
+// ErrUserNotExist 缓存里面记录了这个用户不存在，不用再去查数据库
+var ErrUserNotExist = errors.New("用户不存在")
+
+// notExistExpiration 不存在的用户缓存的时间要短，防止刚注册的用户查不到
+const notExistExpiration = time.Minute
+
 // 定义一个接口承接下面 RedisUserCache 结构体的方法，如何在 service 里面将这个接口作为字段使用
 type UserCache interface {
 	Get(ctx context.Context, id int64) (domain.User, error)
+	// Set 密码不会放进缓存，哪怕是加密之后的
 	Set(ctx context.Context, u domain.User) error
+	// SetNotExist 防止有人一直用不存在的 id 来查，把请求都打到数据库上
+	SetNotExist(ctx context.Context, id int64) error
+	Delete(ctx context.Context, id int64) error
 }
 
 type RedisUserCache struct {
@@ -42,15 +53,20 @@ func (cache *RedisUserCache) Get(ctx context.Context, id int64) (domain.User, er
 	if err != nil {
 		return domain.User{}, err
 	}
+	if len(val) == 0 {
+		return domain.User{}, ErrUserNotExist
+	}
 	var u domain.User
 	err = json.Unmarshal(val, &u) // 将 val 的值，放到 u 中
 	if err != nil {
-		return domain.User{}, err
+		// 一般是 domain.User 的字段改了类型，当成没有缓存，重新加载之后会覆盖掉
+		return domain.User{}, ErrKeyNotExist
 	}
 	return u, nil
 }
 
 func (cache *RedisUserCache) Set(ctx context.Context, u domain.User) error {
+	u.Password = ""
 	val, err := json.Marshal(u)
 	if err != nil {
 		return err
@@ -59,6 +75,15 @@ func (cache *RedisUserCache) Set(ctx context.Context, u domain.User) error {
 	return cache.client.Set(ctx, key, val, cache.expiration).Err()
 }
 
+// SetNotExist 用空字符串代表不存在
+func (cache *RedisUserCache) SetNotExist(ctx context.Context, id int64) error {
+	return cache.client.Set(ctx, cache.key(id), "", notExistExpiration).Err()
+}
+
+func (cache *RedisUserCache) Delete(ctx context.Context, id int64) error {
+	return cache.client.Del(ctx, cache.key(id)).Err()
+}
+
 func (cache *RedisUserCache) key(id int64) string {
 	return fmt.Sprintf("user:info:%d", id)
 }
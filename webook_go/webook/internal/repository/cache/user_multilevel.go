@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"sync/atomic"
+	"time"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/pkg/logger"
+)
+
+// MultiLevelUserCacheConfig 本地缓存的配置
+type MultiLevelUserCacheConfig struct {
+	// Capacity 本地最多缓存多少个用户
+	Capacity int
+	// Expiration 本地缓存的过期时间要短，失效通知丢了的时候，最多也就读到这么久的旧数据
+	Expiration time.Duration
+	// Channel 失效通知用的 Redis 频道
+	Channel string
+}
+
+// UserCacheStats 每一级缓存的命中情况，可以挂到 expvar 或者监控系统上
+type UserCacheStats struct {
+	LocalHit   atomic.Int64
+	LocalMiss  atomic.Int64
+	RemoteHit  atomic.Int64
+	RemoteMiss atomic.Int64
+}
+
+// Snapshot 当前的计数，给 expvar.Func 用
+func (s *UserCacheStats) Snapshot() map[string]int64 {
+	return map[string]int64{
+		"local_hit":   s.LocalHit.Load(),
+		"local_miss":  s.LocalMiss.Load(),
+		"remote_hit":  s.RemoteHit.Load(),
+		"remote_miss": s.RemoteMiss.Load(),
+	}
+}
+
+// Subscriber 订阅失效通知，*redis.Client 和 *redis.ClusterClient 都满足
+type Subscriber interface {
+	Subscribe(ctx context.Context, channels ...string) *redis.PubSub
+}
+
+// MultiLevelUserCache 在 Redis 前面再加一层本地的 LRU
+// 用户信息变了之后，除了删 Redis，还会通过 Redis 的 pub/sub 通知所有实例删掉本地缓存
+type MultiLevelUserCache struct {
+	local  *lru.Cache[int64, localUser]
+	remote UserCache
+	// client 用来发布失效通知
+	client redis.Cmdable
+	cfg    MultiLevelUserCacheConfig
+	stats  *UserCacheStats
+	l      logger.LoggerV1
+	now    func() time.Time
+}
+
+type localUser struct {
+	u domain.User
+	// notExist 用户不存在的空值缓存
+	notExist bool
+	expireAt time.Time
+}
+
+// NewMultiLevelUserCache sub 为 nil 的时候不订阅失效通知，只能依赖本地缓存过期
+func NewMultiLevelUserCache(remote UserCache, client redis.Cmdable, sub Subscriber,
+	cfg MultiLevelUserCacheConfig, stats *UserCacheStats, l logger.LoggerV1) UserCache {
+	local, err := lru.New[int64, localUser](cfg.Capacity)
+	if err != nil {
+		panic(fmt.Errorf("创建本地用户缓存失败 %w", err))
+	}
+	c := &MultiLevelUserCache{
+		local:  local,
+		remote: remote,
+		client: client,
+		cfg:    cfg,
+		stats:  stats,
+		l:      l,
+		now:    time.Now,
+	}
+	if sub != nil {
+		go c.subscribe(sub)
+	}
+	return c
+}
+
+func (c *MultiLevelUserCache) Get(ctx context.Context, id int64) (domain.User, error) {
+	if item, ok := c.local.Get(id); ok && c.now().Before(item.expireAt) {
+		c.stats.LocalHit.Add(1)
+		if item.notExist {
+			return domain.User{}, ErrUserNotExist
+		}
+		return item.u, nil
+	}
+	c.stats.LocalMiss.Add(1)
+	u, err := c.remote.Get(ctx, id)
+	switch err {
+	case nil:
+		c.stats.RemoteHit.Add(1)
+		c.setLocal(id, localUser{u: u})
+	case ErrUserNotExist:
+		c.stats.RemoteHit.Add(1)
+		c.setLocal(id, localUser{notExist: true})
+	default:
+		c.stats.RemoteMiss.Add(1)
+	}
+	return u, err
+}
+
+func (c *MultiLevelUserCache) Set(ctx context.Context, u domain.User) error {
+	u.Password = ""
+	if err := c.remote.Set(ctx, u); err != nil {
+		return err
+	}
+	c.setLocal(u.Id, localUser{u: u})
+	return nil
+}
+
+func (c *MultiLevelUserCache) SetNotExist(ctx context.Context, id int64) error {
+	if err := c.remote.SetNotExist(ctx, id); err != nil {
+		return err
+	}
+	c.setLocal(id, localUser{notExist: true})
+	return nil
+}
+
+// Delete 先删 Redis 再通知其他实例
+func (c *MultiLevelUserCache) Delete(ctx context.Context, id int64) error {
+	c.local.Remove(id)
+	if err := c.remote.Delete(ctx, id); err != nil {
+		return err
+	}
+	err := c.client.Publish(ctx, c.cfg.Channel, strconv.FormatInt(id, 10)).Err()
+	if err != nil {
+		// Redis 里面已经删掉了，其他实例最多读到 Expiration 这么久的旧数据
+		c.l.Warn("发布用户缓存失效通知失败", logger.Int64("uid", id), logger.Error(err))
+	}
+	return nil
+}
+
+func (c *MultiLevelUserCache) setLocal(id int64, item localUser) {
+	item.expireAt = c.now().Add(c.cfg.Expiration)
+	c.local.Add(id, item)
+}
+
+// subscribe 跟着进程一直运行，go-redis 断线之后会自己重新订阅
+func (c *MultiLevelUserCache) subscribe(sub Subscriber) {
+	ps := sub.Subscribe(context.Background(), c.cfg.Channel)
+	defer ps.Close()
+	for msg := range ps.Channel() {
+		c.onInvalidate(msg.Payload)
+	}
+}
+
+func (c *MultiLevelUserCache) onInvalidate(payload string) {
+	id, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		c.l.Warn("用户缓存失效通知格式不对", logger.String("payload", payload))
+		return
+	}
+	c.local.Remove(id)
+}
@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"testing"
+	"time"
+	"webook_go/webook/internal/domain"
+	cachemocks "webook_go/webook/internal/repository/cache/mocks"
+	"webook_go/webook/internal/repository/cache/redismocks"
+	"webook_go/webook/pkg/logger"
+)
+
+var testMultiLevelCfg = MultiLevelUserCacheConfig{
+	Capacity:   10,
+	Expiration: time.Second * 10,
+	Channel:    "user:invalidate",
+}
+
+func TestMultiLevelUserCache_Get(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	remote := cachemocks.NewMockUserCache(ctrl)
+	stats := &UserCacheStats{}
+	c := NewMultiLevelUserCache(remote, redismocks.NewMockCmdable(ctrl), nil,
+		testMultiLevelCfg, stats, &logger.NopLogger{}).(*MultiLevelUserCache)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	// 第一次本地没有，去 Redis 拿，之后就走本地了
+	remote.EXPECT().Get(gomock.Any(), int64(123)).Return(domain.User{Id: 123, Nickname: "abc"}, nil)
+	for i := 0; i < 2; i++ {
+		u, err := c.Get(context.Background(), 123)
+		assert.NoError(t, err)
+		assert.Equal(t, domain.User{Id: 123, Nickname: "abc"}, u)
+	}
+
+	// 不存在的用户本地也缓存
+	remote.EXPECT().Get(gomock.Any(), int64(456)).Return(domain.User{}, ErrUserNotExist)
+	for i := 0; i < 2; i++ {
+		_, err := c.Get(context.Background(), 456)
+		assert.Equal(t, ErrUserNotExist, err)
+	}
+
+	// Redis 也没有
+	remote.EXPECT().Get(gomock.Any(), int64(789)).Return(domain.User{}, ErrKeyNotExist)
+	_, err := c.Get(context.Background(), 789)
+	assert.Equal(t, ErrKeyNotExist, err)
+
+	// 本地过期了要重新去 Redis 拿
+	now = now.Add(testMultiLevelCfg.Expiration)
+	remote.EXPECT().Get(gomock.Any(), int64(123)).Return(domain.User{Id: 123, Nickname: "new"}, nil)
+	u, err := c.Get(context.Background(), 123)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", u.Nickname)
+
+	assert.Equal(t, map[string]int64{
+		"local_hit":   2,
+		"local_miss":  4,
+		"remote_hit":  3,
+		"remote_miss": 1,
+	}, stats.Snapshot())
+}
+
+func TestMultiLevelUserCache_Delete(t *testing.T) {
+	testCases := []struct {
+		name       string
+		delErr     error
+		publishErr error
+
+		wantErr error
+	}{
+		{name: "删除成功"},
+		{name: "Redis 删除失败", delErr: errors.New("redis 错误"), wantErr: errors.New("redis 错误")},
+		// 发布失败不影响，靠本地缓存过期兜底
+		{name: "通知失败", publishErr: errors.New("redis 错误")},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			remote := cachemocks.NewMockUserCache(ctrl)
+			cmd := redismocks.NewMockCmdable(ctrl)
+			c := NewMultiLevelUserCache(remote, cmd, nil, testMultiLevelCfg,
+				&UserCacheStats{}, &logger.NopLogger{})
+
+			remote.EXPECT().Set(gomock.Any(), domain.User{Id: 123}).Return(nil)
+			err := c.Set(context.Background(), domain.User{Id: 123, Password: "hash"})
+			assert.NoError(t, err)
+
+			remote.EXPECT().Delete(gomock.Any(), int64(123)).Return(tc.delErr)
+			if tc.delErr == nil {
+				res := redis.NewIntCmd(context.Background())
+				res.SetErr(tc.publishErr)
+				cmd.EXPECT().Publish(gomock.Any(), "user:invalidate", "123").Return(res)
+			}
+			err = c.Delete(context.Background(), 123)
+			assert.Equal(t, tc.wantErr, err)
+
+			// 本地的一定被删掉了
+			remote.EXPECT().Get(gomock.Any(), int64(123)).Return(domain.User{}, ErrKeyNotExist)
+			_, err = c.Get(context.Background(), 123)
+			assert.Equal(t, ErrKeyNotExist, err)
+		})
+	}
+}
+
+func TestMultiLevelUserCache_onInvalidate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	remote := cachemocks.NewMockUserCache(ctrl)
+	c := NewMultiLevelUserCache(remote, redismocks.NewMockCmdable(ctrl), nil,
+		testMultiLevelCfg, &UserCacheStats{}, &logger.NopLogger{}).(*MultiLevelUserCache)
+
+	remote.EXPECT().SetNotExist(gomock.Any(), int64(123)).Return(nil)
+	assert.NoError(t, c.SetNotExist(context.Background(), 123))
+	// 格式不对的忽略掉
+	c.onInvalidate("abc")
+	_, err := c.Get(context.Background(), 123)
+	assert.Equal(t, ErrUserNotExist, err)
+
+	// 其他实例注册了这个用户
+	c.onInvalidate("123")
+	remote.EXPECT().Get(gomock.Any(), int64(123)).Return(domain.User{Id: 123}, nil)
+	u, err := c.Get(context.Background(), 123)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(123), u.Id)
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"testing"
+	"time"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/repository/cache/redismocks"
+)
+
+func TestRedisUserCache_Get(t *testing.T) {
+	testCases := []struct {
+		name string
+		val  string
+		err  error
+
+		wantUser domain.User
+		wantErr  error
+	}{
+		{name: "命中", val: `{"Id":123,"Nickname":"Tom"}`, wantUser: domain.User{Id: 123, Nickname: "Tom"}},
+		{name: "没有缓存", err: redis.Nil, wantErr: ErrKeyNotExist},
+		{name: "缓存了不存在", val: "", wantErr: ErrUserNotExist},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := redismocks.NewMockCmdable(ctrl)
+			res := redis.NewStringCmd(context.Background())
+			res.SetVal(tc.val)
+			res.SetErr(tc.err)
+			cmd.EXPECT().Get(gomock.Any(), "user:info:123").Return(res)
+			u, err := NewUserCache(cmd).Get(context.Background(), 123)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantUser, u)
+		})
+	}
+}
+
+func TestRedisUserCache_Set(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cmd := redismocks.NewMockCmdable(ctrl)
+	cmd.EXPECT().Set(gomock.Any(), "user:info:123", gomock.Any(), time.Minute*15).
+		DoAndReturn(func(ctx context.Context, key string, val any, exp time.Duration) *redis.StatusCmd {
+			// 密码不能进缓存
+			var u domain.User
+			require.NoError(t, json.Unmarshal(val.([]byte), &u))
+			assert.Equal(t, "", u.Password)
+			assert.Equal(t, "Tom", u.Nickname)
+			return redis.NewStatusCmd(ctx)
+		})
+	err := NewUserCache(cmd).Set(context.Background(), domain.User{Id: 123, Nickname: "Tom", Password: "hash"})
+	require.NoError(t, err)
+}
@@ -2,15 +2,22 @@ package repository
 
 import (
 	"context"
+	"webook_go/webook/internal/domain"
 	"webook_go/webook/internal/repository/cache"
 )
 
 var (
-	ErrCodeSendTooMany = cache.ErrCodeSendTooMany
+	ErrCodeSendTooMany     = cache.ErrCodeSendTooMany
+	ErrCodePhoneHourLimit  = cache.ErrCodePhoneHourLimit
+	ErrCodePhoneDayLimit   = cache.ErrCodePhoneDayLimit
+	ErrCodeIPLimit         = cache.ErrCodeIPLimit
+	ErrCodeDeviceLimit     = cache.ErrCodeDeviceLimit
+	ErrCodeBizLimit        = cache.ErrCodeBizLimit
+	ErrCodeCaptchaRequired = cache.ErrCodeCaptchaRequired
 )
 
 type CodeRepository interface {
-	Store(ctx context.Context, biz string, phone string, code string) error
+	Store(ctx context.Context, biz string, phone string, code string, meta domain.CodeSendMeta) error
 	Verify(ctx context.Context, biz, phone, inputCode string) (bool, error)
 }
 
@@ -24,8 +31,8 @@ func NewCodeRepository(c cache.CodeRedisCache) CodeRepository {
 	}
 }
 
-func (repo *CacheCodeRepository) Store(ctx context.Context, biz string, phone string, code string) error {
-	return repo.cache.Set(ctx, biz, phone, code)
+func (repo *CacheCodeRepository) Store(ctx context.Context, biz string, phone string, code string, meta domain.CodeSendMeta) error {
+	return repo.cache.Set(ctx, biz, phone, code, meta)
 }
 
 func (repo *CacheCodeRepository) Verify(ctx context.Context, biz, phone, inputCode string) (bool, error) {
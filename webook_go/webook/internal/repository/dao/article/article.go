@@ -6,26 +6,77 @@ import (
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"time"
+	"webook_go/webook/pkg/idgen"
 )
 
+// ErrArticleNotFound MongoDB 查不到的时候也转成这个，调用方不用关心读的是哪边
+var ErrArticleNotFound = gorm.ErrRecordNotFound
+
 type ArticleDAO interface {
 	Insert(ctx context.Context, art Article) (int64, error)
 	UpdateById(ctx context.Context, article Article) error
 	Sync(ctx context.Context, article Article) (int64, error)
 	Upsert(ctx context.Context, article PublishedArticle) error
 	SyncStatus(ctx context.Context, id int64, author int64, status uint8) error
+	// GetByAuthor 作者自己的文章，按照更新时间倒序
+	GetByAuthor(ctx context.Context, author int64, offset, limit int) ([]Article, error)
+	GetById(ctx context.Context, id int64) (Article, error)
+	GetPubById(ctx context.Context, id int64) (PublishedArticle, error)
+	// ListPubByUtime 线上库里面 utime 之前更新的文章，按照更新时间倒序
+	ListPubByUtime(ctx context.Context, utime time.Time, offset, limit int) ([]PublishedArticle, error)
+	// TransferAuthor 合并账号的时候把 from 的文章都转给 to，可以重复执行
+	TransferAuthor(ctx context.Context, from, to int64) error
+	// UnpublishAuthor 注销账号的时候，作者所有的文章都下线，可以重复执行
+	UnpublishAuthor(ctx context.Context, author int64) error
 }
 
 type GORMArticleDAO struct {
 	db *gorm.DB
+	// gen 为 nil 的时候用数据库自增主键
+	gen idgen.Generator
 }
 
-func NewGORMArticleDAO(db *gorm.DB) ArticleDAO {
+func NewGORMArticleDAO(db *gorm.DB, gen idgen.Generator) ArticleDAO {
 	return &GORMArticleDAO{
-		db: db,
+		db:  db,
+		gen: gen,
 	}
 }
 
+func (dao *GORMArticleDAO) GetByAuthor(ctx context.Context, author int64, offset, limit int) ([]Article, error) {
+	var arts []Article
+	err := dao.db.WithContext(ctx).
+		Where("author_id = ?", author).
+		Offset(offset).
+		Limit(limit).
+		Order("utime DESC").
+		Find(&arts).Error
+	return arts, err
+}
+
+func (dao *GORMArticleDAO) GetById(ctx context.Context, id int64) (Article, error) {
+	var art Article
+	err := dao.db.WithContext(ctx).Where("id = ?", id).First(&art).Error
+	return art, err
+}
+
+func (dao *GORMArticleDAO) GetPubById(ctx context.Context, id int64) (PublishedArticle, error) {
+	var art PublishedArticle
+	err := dao.db.WithContext(ctx).Where("id = ?", id).First(&art).Error
+	return art, err
+}
+
+func (dao *GORMArticleDAO) ListPubByUtime(ctx context.Context, utime time.Time, offset, limit int) ([]PublishedArticle, error) {
+	var res []PublishedArticle
+	err := dao.db.WithContext(ctx).
+		Where("utime < ?", utime.UnixMilli()).
+		Order("utime DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&res).Error
+	return res, err
+}
+
 func (dao *GORMArticleDAO) SyncStatus(ctx context.Context, id int64, author int64, status uint8) error {
 	now := time.Now().UnixMilli()
 	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
@@ -45,7 +96,7 @@ func (dao *GORMArticleDAO) SyncStatus(ctx context.Context, id int64, author int6
 			// 用 prometheus 打点，只要频繁出现，你就告警，然后手工介入排查
 			return fmt.Errorf("可能有人在搞你，误操作非自己的文章，uid:%d, aid:%d", author, id)
 		}
-		return tx.Model(&Article{}).
+		return tx.Model(&PublishedArticle{}).
 			Where("id = ?", id).
 			Updates(map[string]any{
 				"status": status,
@@ -54,6 +105,41 @@ func (dao *GORMArticleDAO) SyncStatus(ctx context.Context, id int64, author int6
 	})
 }
 
+func (dao *GORMArticleDAO) TransferAuthor(ctx context.Context, from, to int64) error {
+	return transferAuthor(dao.db.WithContext(ctx), from, to)
+}
+
+func (dao *GORMArticleDAO) UnpublishAuthor(ctx context.Context, author int64) error {
+	return unpublishAuthor(dao.db.WithContext(ctx), author)
+}
+
+// transferAuthor 制作库和线上库在一个事务里面改
+func transferAuthor(db *gorm.DB, from, to int64) error {
+	now := time.Now().UnixMilli()
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Article{}).Where("author_id = ?", from).
+			Updates(map[string]any{"author_id": to, "utime": now}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&PublishedArticle{}).Where("author_id = ?", from).
+			Updates(map[string]any{"author_id": to, "utime": now}).Error
+	})
+}
+
+func unpublishAuthor(db *gorm.DB, author int64) error {
+	now := time.Now().UnixMilli()
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Article{}).Where("author_id = ?", author).
+			Updates(map[string]any{"status": statusUnpublished, "utime": now}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&PublishedArticle{}).Where("author_id = ?", author).
+			Updates(map[string]any{"status": statusUnpublished, "utime": now}).Error
+	})
+}
+
 // Sync 是GORMArticleDAO结构体的方法，用于同步文章数据
 func (dao *GORMArticleDAO) Sync(ctx context.Context, art Article) (int64, error) {
 	// 先操作制作库（此时应该是表），后操作线上库（此时应该是表）
@@ -68,7 +154,7 @@ func (dao *GORMArticleDAO) Sync(ctx context.Context, art Article) (int64, error)
 	// 事务的执行逻辑被封装在闭包函数中
 	err := dao.db.Transaction(func(tx *gorm.DB) error {
 		var err error
-		txDAO := NewGORMArticleDAO(tx) // 创建一个新的GORMArticleDAO实例，用于在该事务中操作数据库
+		txDAO := NewGORMArticleDAO(tx, dao.gen) // 创建一个新的GORMArticleDAO实例，用于在该事务中操作数据库
 		if id > 0 {
 			err = txDAO.UpdateById(ctx, art)
 		} else {
@@ -77,6 +163,8 @@ func (dao *GORMArticleDAO) Sync(ctx context.Context, art Article) (int64, error)
 		if err != nil {
 			return err
 		}
+		// 线上库和制作库用同一个 ID
+		art.Id = id
 		// 操作线上库了，使用txDAO的Upsert方法插入或更新已发布的文章数据
 		return txDAO.Upsert(ctx, PublishedArticle{Article: art})
 	})
@@ -126,6 +214,14 @@ func (dao *GORMArticleDAO) Insert(ctx context.Context, art Article) (int64, erro
 	now := time.Now().UnixMilli()
 	art.Ctime = now
 	art.Utime = now
+	// 双写的时候用另一边已经生成好的 ID
+	if art.Id == 0 {
+		id, err := idgen.Next(dao.gen)
+		if err != nil {
+			return 0, err
+		}
+		art.Id = id
+	}
 	err := dao.db.WithContext(ctx).Create(&art).Error
 	return art.Id, err
 }
@@ -163,10 +259,10 @@ func (dao *GORMArticleDAO) UpdateById(ctx context.Context, art Article) error {
 // 执行 SELECT * FROM articles WHERE author_id = 123 ORDER BY ctime DESC
 // 比较两种索引的性能
 type Article struct {
-	Id int64 `gorm:"primaryKey,autoIncrement"`
+	Id int64 `gorm:"primaryKey,autoIncrement" bson:"id"`
 	// 长度 1024
-	Title   string `gorm:"type=varchar(1024)"`
-	Content string `gorm:"type=BLOB"`
+	Title   string `gorm:"type=varchar(1024)" bson:"title"`
+	Content string `gorm:"type=BLOB" bson:"content"`
 	// 如何设计索引
 	// 在帖子这里，什么样的查询场景
 	// 对于创作者来说，是不是看草稿箱，看到所有自己的文章？
@@ -180,7 +276,7 @@ type Article struct {
 	// 学学 Explain 命令
 
 	// - 在 author_id 上创建索引
-	AuthorId int64 `gorm:"index"`
+	AuthorId int64 `gorm:"index" bson:"author_id"`
 	//AuthorId int64 `gorm:"index=aid_ctime"`
 	//Ctime    int64 `gorm:"index=aid_ctime"`
 
@@ -188,7 +284,7 @@ type Article struct {
 	// WHERE status = xxx AND
 	// 在 status 上和别的列混在一起，创建一个联合索引
 	// 要看别的列究竟是什么列
-	Status uint8
-	Ctime  int64
-	Utime  int64
+	Status uint8 `bson:"status"`
+	Ctime  int64 `bson:"ctime"`
+	Utime  int64 `bson:"utime"`
 }
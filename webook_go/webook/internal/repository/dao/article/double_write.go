@@ -0,0 +1,180 @@
+package article
+
+import (
+	"context"
+	"time"
+	"webook_go/webook/pkg/logger"
+	"webook_go/webook/pkg/migrator"
+)
+
+// DoubleWriteDAO 迁移的时候同时写 src 和 dst，阶段每次调用的时候都会重新读，改了配置马上生效
+// 先写的那边失败了直接返回，后写的那边失败了只打日志，靠校验和修复兜底
+// 新建的文章用先写的那边生成的 ID，两边的 ID 是一样的，所以 src 和 dst 都要用 idgen 生成 ID
+type DoubleWriteDAO struct {
+	src     ArticleDAO
+	dst     ArticleDAO
+	pattern func() string
+	l       logger.LoggerV1
+}
+
+func NewDoubleWriteDAO(src, dst ArticleDAO, pattern func() string, l logger.LoggerV1) ArticleDAO {
+	return &DoubleWriteDAO{
+		src:     src,
+		dst:     dst,
+		pattern: pattern,
+		l:       l,
+	}
+}
+
+// order 按照阶段决定先写哪边，second 为 nil 代表只写一边
+func (d *DoubleWriteDAO) order() (first, second ArticleDAO, err error) {
+	p, err := migrator.ParsePattern(d.pattern())
+	if err != nil {
+		return nil, nil, err
+	}
+	switch p {
+	case migrator.PatternSrcFirst:
+		return d.src, d.dst, nil
+	case migrator.PatternDstFirst:
+		return d.dst, d.src, nil
+	case migrator.PatternDstOnly:
+		return d.dst, nil, nil
+	default:
+		return d.src, nil, nil
+	}
+}
+
+// write 先写 first，成功了再写 second
+func (d *DoubleWriteDAO) write(ctx context.Context, method string, id int64,
+	fn func(dao ArticleDAO) error) error {
+	first, second, err := d.order()
+	if err != nil {
+		return err
+	}
+	if err = fn(first); err != nil {
+		return err
+	}
+	if second != nil {
+		d.logSecondErr(method, id, fn(second))
+	}
+	return nil
+}
+
+func (d *DoubleWriteDAO) logSecondErr(method string, id int64, err error) {
+	if err != nil {
+		d.l.Error("双写的时候后写的那边失败了", logger.Error(err),
+			logger.String("method", method), logger.Int64("id", id))
+	}
+}
+
+func (d *DoubleWriteDAO) Insert(ctx context.Context, art Article) (int64, error) {
+	first, second, err := d.order()
+	if err != nil {
+		return 0, err
+	}
+	id, err := first.Insert(ctx, art)
+	if err != nil || second == nil {
+		return id, err
+	}
+	art.Id = id
+	_, err = second.Insert(ctx, art)
+	d.logSecondErr("Insert", id, err)
+	return id, nil
+}
+
+func (d *DoubleWriteDAO) UpdateById(ctx context.Context, art Article) error {
+	return d.write(ctx, "UpdateById", art.Id, func(dao ArticleDAO) error {
+		return dao.UpdateById(ctx, art)
+	})
+}
+
+func (d *DoubleWriteDAO) Sync(ctx context.Context, art Article) (int64, error) {
+	first, second, err := d.order()
+	if err != nil {
+		return 0, err
+	}
+	isNew := art.Id == 0
+	id, err := first.Sync(ctx, art)
+	if err != nil || second == nil {
+		return id, err
+	}
+	art.Id = id
+	if isNew {
+		// 带着 ID 调 Sync 会去更新，后写的那边还没有这篇文章，只能先插入再发表
+		err = insertAndPublish(ctx, second, art)
+	} else {
+		_, err = second.Sync(ctx, art)
+	}
+	d.logSecondErr("Sync", id, err)
+	return id, nil
+}
+
+func insertAndPublish(ctx context.Context, dao ArticleDAO, art Article) error {
+	if _, err := dao.Insert(ctx, art); err != nil {
+		return err
+	}
+	return dao.Upsert(ctx, PublishedArticle{Article: art})
+}
+
+func (d *DoubleWriteDAO) Upsert(ctx context.Context, art PublishedArticle) error {
+	return d.write(ctx, "Upsert", art.Id, func(dao ArticleDAO) error {
+		return dao.Upsert(ctx, art)
+	})
+}
+
+func (d *DoubleWriteDAO) SyncStatus(ctx context.Context, id int64, author int64, status uint8) error {
+	return d.write(ctx, "SyncStatus", id, func(dao ArticleDAO) error {
+		return dao.SyncStatus(ctx, id, author, status)
+	})
+}
+
+// TransferAuthor 合并账号改的是文章，也要双写，不然读切到 dst 之后作者还是旧的，校验的时候也会被改回去
+func (d *DoubleWriteDAO) TransferAuthor(ctx context.Context, from, to int64) error {
+	return d.write(ctx, "TransferAuthor", from, func(dao ArticleDAO) error {
+		return dao.TransferAuthor(ctx, from, to)
+	})
+}
+
+func (d *DoubleWriteDAO) UnpublishAuthor(ctx context.Context, author int64) error {
+	return d.write(ctx, "UnpublishAuthor", author, func(dao ArticleDAO) error {
+		return dao.UnpublishAuthor(ctx, author)
+	})
+}
+
+// reader 所有的读都走先写的那边，跟着阶段一起切
+func (d *DoubleWriteDAO) reader() (ArticleDAO, error) {
+	first, _, err := d.order()
+	return first, err
+}
+
+func (d *DoubleWriteDAO) GetByAuthor(ctx context.Context, author int64, offset, limit int) ([]Article, error) {
+	r, err := d.reader()
+	if err != nil {
+		return nil, err
+	}
+	return r.GetByAuthor(ctx, author, offset, limit)
+}
+
+func (d *DoubleWriteDAO) GetById(ctx context.Context, id int64) (Article, error) {
+	r, err := d.reader()
+	if err != nil {
+		return Article{}, err
+	}
+	return r.GetById(ctx, id)
+}
+
+func (d *DoubleWriteDAO) GetPubById(ctx context.Context, id int64) (PublishedArticle, error) {
+	r, err := d.reader()
+	if err != nil {
+		return PublishedArticle{}, err
+	}
+	return r.GetPubById(ctx, id)
+}
+
+func (d *DoubleWriteDAO) ListPubByUtime(ctx context.Context, utime time.Time, offset, limit int) ([]PublishedArticle, error) {
+	r, err := d.reader()
+	if err != nil {
+		return nil, err
+	}
+	return r.ListPubByUtime(ctx, utime, offset, limit)
+}
@@ -0,0 +1,216 @@
+package article_test
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"testing"
+	"time"
+	"webook_go/webook/internal/repository/dao/article"
+	artdaomocks "webook_go/webook/internal/repository/dao/article/mocks"
+	"webook_go/webook/pkg/logger"
+	"webook_go/webook/pkg/migrator"
+)
+
+func TestDoubleWriteDAO_Insert(t *testing.T) {
+	testCases := []struct {
+		name    string
+		pattern string
+		mock    func(ctrl *gomock.Controller) (article.ArticleDAO, article.ArticleDAO)
+
+		wantId  int64
+		wantErr error
+	}{
+		{
+			name:    "只写源表",
+			pattern: "",
+			mock: func(ctrl *gomock.Controller) (article.ArticleDAO, article.ArticleDAO) {
+				src := artdaomocks.NewMockArticleDAO(ctrl)
+				src.EXPECT().Insert(gomock.Any(), article.Article{Title: "标题"}).Return(int64(1), nil)
+				return src, artdaomocks.NewMockArticleDAO(ctrl)
+			},
+			wantId: 1,
+		},
+		{
+			name:    "先写源表，目标表用同一个 ID",
+			pattern: string(migrator.PatternSrcFirst),
+			mock: func(ctrl *gomock.Controller) (article.ArticleDAO, article.ArticleDAO) {
+				src := artdaomocks.NewMockArticleDAO(ctrl)
+				src.EXPECT().Insert(gomock.Any(), article.Article{Title: "标题"}).Return(int64(1), nil)
+				dst := artdaomocks.NewMockArticleDAO(ctrl)
+				dst.EXPECT().Insert(gomock.Any(), article.Article{Id: 1, Title: "标题"}).Return(int64(1), nil)
+				return src, dst
+			},
+			wantId: 1,
+		},
+		{
+			name:    "先写目标表，源表失败了不影响",
+			pattern: string(migrator.PatternDstFirst),
+			mock: func(ctrl *gomock.Controller) (article.ArticleDAO, article.ArticleDAO) {
+				dst := artdaomocks.NewMockArticleDAO(ctrl)
+				dst.EXPECT().Insert(gomock.Any(), article.Article{Title: "标题"}).Return(int64(2), nil)
+				src := artdaomocks.NewMockArticleDAO(ctrl)
+				src.EXPECT().Insert(gomock.Any(), article.Article{Id: 2, Title: "标题"}).
+					Return(int64(0), errors.New("mock db error"))
+				return src, dst
+			},
+			wantId: 2,
+		},
+		{
+			name:    "先写的失败了，不写另一边",
+			pattern: string(migrator.PatternSrcFirst),
+			mock: func(ctrl *gomock.Controller) (article.ArticleDAO, article.ArticleDAO) {
+				src := artdaomocks.NewMockArticleDAO(ctrl)
+				src.EXPECT().Insert(gomock.Any(), gomock.Any()).Return(int64(0), errors.New("mock db error"))
+				return src, artdaomocks.NewMockArticleDAO(ctrl)
+			},
+			wantErr: errors.New("mock db error"),
+		},
+		{
+			name:    "只写目标表",
+			pattern: string(migrator.PatternDstOnly),
+			mock: func(ctrl *gomock.Controller) (article.ArticleDAO, article.ArticleDAO) {
+				dst := artdaomocks.NewMockArticleDAO(ctrl)
+				dst.EXPECT().Insert(gomock.Any(), gomock.Any()).Return(int64(3), nil)
+				return artdaomocks.NewMockArticleDAO(ctrl), dst
+			},
+			wantId: 3,
+		},
+		{
+			name:    "配置错了",
+			pattern: "abc",
+			mock: func(ctrl *gomock.Controller) (article.ArticleDAO, article.ArticleDAO) {
+				return artdaomocks.NewMockArticleDAO(ctrl), artdaomocks.NewMockArticleDAO(ctrl)
+			},
+			wantErr: migrator.ErrUnknownPattern,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			src, dst := tc.mock(ctrl)
+			d := article.NewDoubleWriteDAO(src, dst, func() string {
+				return tc.pattern
+			}, &logger.NopLogger{})
+			id, err := d.Insert(context.Background(), article.Article{Title: "标题"})
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantId, id)
+		})
+	}
+}
+
+func TestDoubleWriteDAO_Sync(t *testing.T) {
+	testCases := []struct {
+		name    string
+		pattern string
+		art     article.Article
+		mock    func(ctrl *gomock.Controller) (article.ArticleDAO, article.ArticleDAO)
+
+		wantId int64
+	}{
+		{
+			name:    "新文章，目标表用同一个 ID 插入再发表",
+			pattern: string(migrator.PatternSrcFirst),
+			art:     article.Article{Title: "标题", AuthorId: 123},
+			mock: func(ctrl *gomock.Controller) (article.ArticleDAO, article.ArticleDAO) {
+				src := artdaomocks.NewMockArticleDAO(ctrl)
+				src.EXPECT().Sync(gomock.Any(), article.Article{Title: "标题", AuthorId: 123}).
+					Return(int64(1), nil)
+				dst := artdaomocks.NewMockArticleDAO(ctrl)
+				art := article.Article{Id: 1, Title: "标题", AuthorId: 123}
+				dst.EXPECT().Insert(gomock.Any(), art).Return(int64(1), nil)
+				dst.EXPECT().Upsert(gomock.Any(), article.PublishedArticle{Article: art}).Return(nil)
+				return src, dst
+			},
+			wantId: 1,
+		},
+		{
+			name:    "新文章，目标表插入失败了就不发表",
+			pattern: string(migrator.PatternDstFirst),
+			art:     article.Article{Title: "标题", AuthorId: 123},
+			mock: func(ctrl *gomock.Controller) (article.ArticleDAO, article.ArticleDAO) {
+				dst := artdaomocks.NewMockArticleDAO(ctrl)
+				dst.EXPECT().Sync(gomock.Any(), gomock.Any()).Return(int64(2), nil)
+				src := artdaomocks.NewMockArticleDAO(ctrl)
+				src.EXPECT().Insert(gomock.Any(), gomock.Any()).Return(int64(0), errors.New("mock db error"))
+				return src, dst
+			},
+			wantId: 2,
+		},
+		{
+			name:    "已有的文章两边都是 Sync",
+			pattern: string(migrator.PatternSrcFirst),
+			art:     article.Article{Id: 3, Title: "标题", AuthorId: 123},
+			mock: func(ctrl *gomock.Controller) (article.ArticleDAO, article.ArticleDAO) {
+				art := article.Article{Id: 3, Title: "标题", AuthorId: 123}
+				src := artdaomocks.NewMockArticleDAO(ctrl)
+				src.EXPECT().Sync(gomock.Any(), art).Return(int64(3), nil)
+				dst := artdaomocks.NewMockArticleDAO(ctrl)
+				dst.EXPECT().Sync(gomock.Any(), art).Return(int64(3), nil)
+				return src, dst
+			},
+			wantId: 3,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			src, dst := tc.mock(ctrl)
+			d := article.NewDoubleWriteDAO(src, dst, func() string {
+				return tc.pattern
+			}, &logger.NopLogger{})
+			id, err := d.Sync(context.Background(), tc.art)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantId, id)
+		})
+	}
+}
+
+func TestDoubleWriteDAO_Pattern(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	src := artdaomocks.NewMockArticleDAO(ctrl)
+	dst := artdaomocks.NewMockArticleDAO(ctrl)
+	pattern := string(migrator.PatternSrcFirst)
+	d := article.NewDoubleWriteDAO(src, dst, func() string {
+		return pattern
+	}, &logger.NopLogger{})
+
+	// 读先写的那边
+	src.EXPECT().GetByAuthor(gomock.Any(), int64(123), 0, 10).Return([]article.Article{{Id: 1}}, nil)
+	arts, err := d.GetByAuthor(context.Background(), 123, 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []article.Article{{Id: 1}}, arts)
+
+	// 改了配置马上切过去
+	pattern = string(migrator.PatternDstFirst)
+	dst.EXPECT().SyncStatus(gomock.Any(), int64(1), int64(123), uint8(2)).Return(nil)
+	src.EXPECT().SyncStatus(gomock.Any(), int64(1), int64(123), uint8(2)).Return(nil)
+	assert.NoError(t, d.SyncStatus(context.Background(), 1, 123, 2))
+	dst.EXPECT().GetByAuthor(gomock.Any(), int64(123), 0, 10).Return([]article.Article{{Id: 2}}, nil)
+	arts, err = d.GetByAuthor(context.Background(), 123, 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []article.Article{{Id: 2}}, arts)
+
+	// 其他的读也一样
+	dst.EXPECT().GetById(gomock.Any(), int64(2)).Return(article.Article{Id: 2}, nil)
+	art, err := d.GetById(context.Background(), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, article.Article{Id: 2}, art)
+	pattern = string(migrator.PatternSrcFirst)
+	src.EXPECT().GetPubById(gomock.Any(), int64(2)).Return(article.PublishedArticle{}, article.ErrArticleNotFound)
+	_, err = d.GetPubById(context.Background(), 2)
+	assert.Equal(t, article.ErrArticleNotFound, err)
+	pattern = string(migrator.PatternDstOnly)
+	now := time.Now()
+	dst.EXPECT().ListPubByUtime(gomock.Any(), now, 0, 10).
+		Return([]article.PublishedArticle{{Article: article.Article{Id: 2}}}, nil)
+	pubs, err := d.ListPubByUtime(context.Background(), now, 0, 10)
+	assert.NoError(t, err)
+	assert.Len(t, pubs, 1)
+}
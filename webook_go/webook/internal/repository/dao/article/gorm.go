@@ -2,11 +2,15 @@ package article
 
 import (
 	"context"
+	"errors"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"time"
 )
 
+// ErrPossibleIncorrectAuthor 要么 ID 是错的，要么作者不对
+var ErrPossibleIncorrectAuthor = errors.New("可能操作了非自己的文章")
+
 type GORMArticleDAOV1 struct {
 	db *gorm.DB
 }
@@ -52,7 +56,7 @@ func NewGORMArticleDAOV1(db *gorm.DB) ArticleDAO {
 	}
 }
 
-func (dao *GORMArticleDAOV1) SyncStatus(ctx context.Context, author, id int64, status uint8) error {
+func (dao *GORMArticleDAOV1) SyncStatus(ctx context.Context, id int64, author int64, status uint8) error {
 	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		res := tx.Model(&Article{}).
 			Where("id=? AND author_id = ?", id, author).
@@ -81,7 +85,7 @@ func (dao *GORMArticleDAOV1) Sync(ctx context.Context,
 	tx := dao.db.WithContext(ctx).Begin()
 	now := time.Now().UnixMilli()
 	defer tx.Rollback()
-	txDAO := NewGORMArticleDAO(tx)
+	txDAO := NewGORMArticleDAO(tx, nil)
 	var (
 		id  = art.Id
 		err error
@@ -95,7 +99,7 @@ func (dao *GORMArticleDAOV1) Sync(ctx context.Context,
 		return 0, err
 	}
 	art.Id = id
-	publishArt := PublishedArticleV1(art)
+	publishArt := PublishedArticle{Article: art}
 	publishArt.Utime = now
 	publishArt.Ctime = now
 	err = tx.Clauses(clause.OnConflict{
@@ -123,7 +127,7 @@ func (dao *GORMArticleDAOV1) SyncClosure(ctx context.Context,
 	err := dao.db.Transaction(func(tx *gorm.DB) error {
 		var err error
 		now := time.Now().UnixMilli()
-		txDAO := NewGORMArticleDAO(tx)
+		txDAO := NewGORMArticleDAO(tx, nil)
 		if id == 0 {
 			id, err = txDAO.Insert(ctx, art)
 		} else {
@@ -133,7 +137,7 @@ func (dao *GORMArticleDAOV1) SyncClosure(ctx context.Context,
 			return err
 		}
 		art.Id = id
-		publishArt := art
+		publishArt := PublishedArticle{Article: art}
 		publishArt.Utime = now
 		publishArt.Ctime = now
 		return tx.Clauses(clause.OnConflict{
@@ -149,6 +153,10 @@ func (dao *GORMArticleDAOV1) SyncClosure(ctx context.Context,
 	return id, err
 }
 
+func (dao *GORMArticleDAOV1) Upsert(ctx context.Context, art PublishedArticle) error {
+	return NewGORMArticleDAO(dao.db, nil).Upsert(ctx, art)
+}
+
 func (dao *GORMArticleDAOV1) Insert(ctx context.Context,
 	art Article) (int64, error) {
 	now := time.Now().UnixMilli()
@@ -180,3 +188,11 @@ func (dao *GORMArticleDAOV1) UpdateById(ctx context.Context,
 	}
 	return nil
 }
+
+func (dao *GORMArticleDAOV1) TransferAuthor(ctx context.Context, from, to int64) error {
+	return transferAuthor(dao.db.WithContext(ctx), from, to)
+}
+
+func (dao *GORMArticleDAOV1) UnpublishAuthor(ctx context.Context, author int64) error {
+	return unpublishAuthor(dao.db.WithContext(ctx), author)
+}
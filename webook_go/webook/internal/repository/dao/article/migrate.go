@@ -0,0 +1,120 @@
+package article
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"webook_go/webook/pkg/migrator"
+)
+
+// 从 MySQL 迁移到 MongoDB 的时候，制作库和线上库分开校验，线上库也用 Article 表示
+
+func (a Article) ID() int64 {
+	return a.Id
+}
+
+func (a Article) UpdateTime() int64 {
+	return a.Utime
+}
+
+// CompareTo 双写的时候两边的创建时间和更新时间是各自生成的，不比较
+func (a Article) CompareTo(dst migrator.Entity) bool {
+	art, ok := dst.(Article)
+	return ok && a.Id == art.Id && a.Title == art.Title && a.Content == art.Content &&
+		a.AuthorId == art.AuthorId && a.Status == art.Status
+}
+
+// GORMStore 校验和修复的时候读写 MySQL 里面的一张表
+type GORMStore struct {
+	db    *gorm.DB
+	table string
+}
+
+func NewGORMStore(db *gorm.DB, table string) migrator.Store[Article] {
+	return &GORMStore{
+		db:    db,
+		table: table,
+	}
+}
+
+func (s *GORMStore) FindByIds(ctx context.Context, ids []int64) ([]Article, error) {
+	var res []Article
+	err := s.db.WithContext(ctx).Table(s.table).Where("id IN ?", ids).Find(&res).Error
+	return res, err
+}
+
+func (s *GORMStore) ListById(ctx context.Context, afterId int64, limit int) ([]Article, error) {
+	var res []Article
+	err := s.db.WithContext(ctx).Table(s.table).Where("id > ?", afterId).
+		Order("id").Limit(limit).Find(&res).Error
+	return res, err
+}
+
+func (s *GORMStore) ListByUtime(ctx context.Context, utime int64, afterId int64, limit int) ([]Article, error) {
+	var res []Article
+	err := s.db.WithContext(ctx).Table(s.table).
+		Where("utime > ? OR (utime = ? AND id > ?)", utime, utime, afterId).
+		Order("utime, id").Limit(limit).Find(&res).Error
+	return res, err
+}
+
+func (s *GORMStore) Upsert(ctx context.Context, art Article) error {
+	return s.db.WithContext(ctx).Table(s.table).
+		Clauses(clause.OnConflict{UpdateAll: true}).Create(&art).Error
+}
+
+func (s *GORMStore) Delete(ctx context.Context, id int64) error {
+	return s.db.WithContext(ctx).Table(s.table).Where("id = ?", id).Delete(&Article{}).Error
+}
+
+// MongoStore 校验和修复的时候读写 MongoDB 里面的一个集合
+type MongoStore struct {
+	col *mongo.Collection
+}
+
+func NewMongoStore(col *mongo.Collection) migrator.Store[Article] {
+	return &MongoStore{col: col}
+}
+
+func (s *MongoStore) FindByIds(ctx context.Context, ids []int64) ([]Article, error) {
+	return s.find(ctx, bson.M{"id": bson.M{"$in": ids}}, options.Find())
+}
+
+func (s *MongoStore) ListById(ctx context.Context, afterId int64, limit int) ([]Article, error) {
+	opts := options.Find().SetSort(bson.D{bson.E{Key: "id", Value: 1}}).SetLimit(int64(limit))
+	return s.find(ctx, bson.M{"id": bson.M{"$gt": afterId}}, opts)
+}
+
+func (s *MongoStore) ListByUtime(ctx context.Context, utime int64, afterId int64, limit int) ([]Article, error) {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"utime": bson.M{"$gt": utime}},
+		bson.M{"utime": utime, "id": bson.M{"$gt": afterId}},
+	}}
+	opts := options.Find().
+		SetSort(bson.D{bson.E{Key: "utime", Value: 1}, bson.E{Key: "id", Value: 1}}).
+		SetLimit(int64(limit))
+	return s.find(ctx, filter, opts)
+}
+
+func (s *MongoStore) find(ctx context.Context, filter any, opts *options.FindOptions) ([]Article, error) {
+	cursor, err := s.col.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var res []Article
+	err = cursor.All(ctx, &res)
+	return res, err
+}
+
+func (s *MongoStore) Upsert(ctx context.Context, art Article) error {
+	_, err := s.col.ReplaceOne(ctx, bson.M{"id": art.Id}, art, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *MongoStore) Delete(ctx context.Context, id int64) error {
+	_, err := s.col.DeleteOne(ctx, bson.M{"id": id})
+	return err
+}
@@ -3,11 +3,12 @@ package article
 import (
 	"context"
 	"errors"
-	"github.com/bwmarrin/snowflake"
+	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"time"
+	"webook_go/webook/pkg/idgen"
 )
 
 type MongoDBDAO struct {
@@ -18,46 +19,94 @@ type MongoDBDAO struct {
 	col *mongo.Collection
 	// 代表的是线上库
 	liveCol *mongo.Collection
-	node    *snowflake.Node
+	// gen MongoDB 没有自增主键，一定要有
+	gen idgen.Generator
 }
 
 func (m *MongoDBDAO) ListPubByUtime(ctx context.Context, utime time.Time, offset int, limit int) ([]PublishedArticle, error) {
-	//TODO implement me
-	panic("implement me")
+	opts := options.Find().
+		SetSort(bson.D{bson.E{Key: "utime", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+	filter := bson.M{"utime": bson.M{"$lt": utime.UnixMilli()}}
+	cursor, err := m.liveCol.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var res []PublishedArticle
+	err = cursor.All(ctx, &res)
+	return res, err
 }
 
 func (m *MongoDBDAO) GetPubById(ctx context.Context, id int64) (PublishedArticle, error) {
-	//TODO implement me
-	panic("implement me")
+	var art PublishedArticle
+	err := m.liveCol.FindOne(ctx, bson.M{"id": id}).Decode(&art)
+	return art, m.notFound(err)
 }
 
-func (m *MongoDBDAO) Upsert(ctx context.Context, article PublishedArticle) error {
-	//TODO implement me
-	panic("implement me")
+func (m *MongoDBDAO) Upsert(ctx context.Context, art PublishedArticle) error {
+	now := time.Now().UnixMilli()
+	filter := bson.M{"id": art.Id}
+	update := bson.D{
+		bson.E{Key: "$set", Value: bson.M{
+			"title":     art.Title,
+			"content":   art.Content,
+			"author_id": art.AuthorId,
+			"status":    art.Status,
+			"utime":     now,
+		}},
+		bson.E{Key: "$setOnInsert", Value: bson.M{"ctime": now}},
+	}
+	_, err := m.liveCol.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
 }
 
 func (m *MongoDBDAO) GetByAuthor(ctx context.Context, author int64, offset, limit int) ([]Article, error) {
-	//TODO implement me
-	panic("implement me")
+	opts := options.Find().
+		SetSort(bson.D{bson.E{Key: "utime", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+	cursor, err := m.col.Find(ctx, bson.M{"author_id": author}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var res []Article
+	err = cursor.All(ctx, &res)
+	return res, err
 }
 
 func (m *MongoDBDAO) GetById(ctx context.Context, id int64) (Article, error) {
-	//TODO implement me
-	panic("implement me")
+	var art Article
+	err := m.col.FindOne(ctx, bson.M{"id": id}).Decode(&art)
+	return art, m.notFound(err)
+}
+
+// notFound 和 GORM 的实现返回一样的错误，双写切换读的那边的时候调用方感觉不到
+func (m *MongoDBDAO) notFound(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrArticleNotFound
+	}
+	return err
 }
 
 func (m *MongoDBDAO) Insert(ctx context.Context, art Article) (int64, error) {
 	now := time.Now().UnixMilli()
 	art.Ctime = now
 	art.Utime = now
-	id := m.node.Generate().Int64()
-	art.Id = id
+	// 双写的时候用另一边已经生成好的 ID
+	if art.Id == 0 {
+		id, err := m.gen.Next()
+		if err != nil {
+			return 0, err
+		}
+		art.Id = id
+	}
 	_, err := m.col.InsertOne(ctx, art)
 	if err != nil {
 		return 0, err
 	}
 	// 你没有 ID
-	return id, err
+	return art.Id, err
 }
 
 func (m *MongoDBDAO) UpdateById(ctx context.Context, art Article) error {
@@ -97,20 +146,43 @@ func (m *MongoDBDAO) Sync(ctx context.Context, art Article) (int64, error) {
 		return 0, err
 	}
 	// 操作线上库了, upsert 语义
-	// 更新语义
+	// $set 里面不能有 ctime，不然和 $setOnInsert 冲突
+	art.Id = id
+	return id, m.Upsert(ctx, PublishedArticle{Article: art})
+}
+
+func (m *MongoDBDAO) SyncStatus(ctx context.Context, id, author int64, status uint8) error {
 	now := time.Now().UnixMilli()
-	update := bson.E{"$set", art}
-	upsert := bson.E{"$setOnInsert", bson.D{bson.E{"ctime", now}}}
-	filter := bson.M{"id": art.Id}
-	_, err = m.liveCol.UpdateOne(ctx, filter,
-		bson.D{update, upsert},
-		options.Update().SetUpsert(true))
-	return id, err
+	update := bson.D{bson.E{Key: "$set", Value: bson.M{"status": status, "utime": now}}}
+	res, err := m.col.UpdateOne(ctx, bson.M{"id": id, "author_id": author}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("可能有人在搞你，误操作非自己的文章，uid:%d, aid:%d", author, id)
+	}
+	// 没有事务，线上库失败了重试就可以
+	_, err = m.liveCol.UpdateOne(ctx, bson.M{"id": id}, update)
+	return err
 }
 
-func (m *MongoDBDAO) SyncStatus(ctx context.Context, author, id int64, status uint8) error {
-	//TODO implement me
-	panic("implement me")
+// TransferAuthor 没有事务，制作库和线上库分别改，失败了重试就可以
+func (m *MongoDBDAO) TransferAuthor(ctx context.Context, from, to int64) error {
+	update := bson.D{bson.E{Key: "$set", Value: bson.M{"author_id": to, "utime": time.Now().UnixMilli()}}}
+	return m.updateAuthor(ctx, from, update)
+}
+
+func (m *MongoDBDAO) UnpublishAuthor(ctx context.Context, author int64) error {
+	update := bson.D{bson.E{Key: "$set", Value: bson.M{"status": statusUnpublished, "utime": time.Now().UnixMilli()}}}
+	return m.updateAuthor(ctx, author, update)
+}
+
+func (m *MongoDBDAO) updateAuthor(ctx context.Context, author int64, update bson.D) error {
+	if _, err := m.col.UpdateMany(ctx, bson.M{"author_id": author}, update); err != nil {
+		return err
+	}
+	_, err := m.liveCol.UpdateMany(ctx, bson.M{"author_id": author}, update)
+	return err
 }
 
 func InitCollections(db *mongo.Database) error {
@@ -138,10 +210,10 @@ func InitCollections(db *mongo.Database) error {
 	return err
 }
 
-func NewMongoDBDAO(db *mongo.Database, node *snowflake.Node) ArticleDAO {
+func NewMongoDBDAO(db *mongo.Database, gen idgen.Generator) ArticleDAO {
 	return &MongoDBDAO{
 		col:     db.Collection("articles"),
 		liveCol: db.Collection("published_articles"),
-		node:    node,
+		gen:     gen,
 	}
 }
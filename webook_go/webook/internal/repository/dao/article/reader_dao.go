@@ -11,8 +11,9 @@ type ReaderDAO interface {
 }
 
 // PublishedArticle 代表的是线上表
+// MongoDB 里面和 Article 存成一样的结构，不要嵌套
 type PublishedArticle struct {
-	Article
+	Article `bson:",inline"`
 }
 
 func NewReaderDAO(db *gorm.DB) ReaderDAO {
@@ -0,0 +1,299 @@
+package article
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"sort"
+	"time"
+	"webook_go/webook/pkg/idgen"
+	"webook_go/webook/pkg/sharding"
+)
+
+const (
+	articleTablePrefix   = "articles"
+	publishedTablePrefix = "published_articles"
+)
+
+// statusUnpublished 和 domain.ArticleStatusUnpublished 保持一致
+const statusUnpublished uint8 = 1
+
+// ShardingArticleDAO 文章按照作者 ID 分库分表，作者看自己的文章只需要查一张表
+// 制作库和线上库的分表在同一个库里面，序号也一样，所以发表还是可以用事务
+type ShardingArticleDAO struct {
+	sharding *sharding.Sharding
+	// gen 分表之后不能用自增主键了，一定要有
+	gen idgen.Generator
+}
+
+func NewShardingArticleDAO(s *sharding.Sharding, gen idgen.Generator) *ShardingArticleDAO {
+	return &ShardingArticleDAO{
+		sharding: s,
+		gen:      gen,
+	}
+}
+
+// InitShardingTables 在所有的库里面建好文章的分表
+func InitShardingTables(s *sharding.Sharding) error {
+	if err := s.AutoMigrate(articleTablePrefix, &Article{}); err != nil {
+		return err
+	}
+	return s.AutoMigrate(publishedTablePrefix, &PublishedArticle{})
+}
+
+// tables 作者的文章在哪个库，制作库和线上库的表名
+func (dao *ShardingArticleDAO) tables(author int64) (*gorm.DB, string, string) {
+	dst := dao.sharding.ShardInt(author)
+	return dao.sharding.DB(dst), dst.TableName(articleTablePrefix), dst.TableName(publishedTablePrefix)
+}
+
+func (dao *ShardingArticleDAO) Insert(ctx context.Context, art Article) (int64, error) {
+	db, arts, _ := dao.tables(art.AuthorId)
+	return dao.insert(ctx, db, arts, art)
+}
+
+func (dao *ShardingArticleDAO) insert(ctx context.Context, db *gorm.DB, table string, art Article) (int64, error) {
+	now := time.Now().UnixMilli()
+	art.Ctime = now
+	art.Utime = now
+	if art.Id == 0 {
+		id, err := dao.gen.Next()
+		if err != nil {
+			return 0, err
+		}
+		art.Id = id
+	}
+	err := db.WithContext(ctx).Table(table).Create(&art).Error
+	return art.Id, err
+}
+
+func (dao *ShardingArticleDAO) UpdateById(ctx context.Context, art Article) error {
+	db, arts, _ := dao.tables(art.AuthorId)
+	return dao.updateById(ctx, db, arts, art)
+}
+
+func (dao *ShardingArticleDAO) updateById(ctx context.Context, db *gorm.DB, table string, art Article) error {
+	res := db.WithContext(ctx).Table(table).Where("id = ? AND author_id = ?", art.Id, art.AuthorId).
+		Updates(map[string]any{
+			"title":   art.Title,
+			"content": art.Content,
+			"status":  art.Status,
+			"utime":   time.Now().UnixMilli(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("更新失败，可能是创作者非法 id %d, author_id %d", art.Id, art.AuthorId)
+	}
+	return nil
+}
+
+func (dao *ShardingArticleDAO) Sync(ctx context.Context, art Article) (int64, error) {
+	db, arts, pubs := dao.tables(art.AuthorId)
+	id := art.Id
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if id > 0 {
+			err = dao.updateById(ctx, tx, arts, art)
+		} else {
+			id, err = dao.insert(ctx, tx, arts, art)
+		}
+		if err != nil {
+			return err
+		}
+		art.Id = id
+		return dao.upsert(ctx, tx, pubs, PublishedArticle{Article: art})
+	})
+	return id, err
+}
+
+func (dao *ShardingArticleDAO) Upsert(ctx context.Context, art PublishedArticle) error {
+	db, _, pubs := dao.tables(art.AuthorId)
+	return dao.upsert(ctx, db, pubs, art)
+}
+
+func (dao *ShardingArticleDAO) upsert(ctx context.Context, db *gorm.DB, table string, art PublishedArticle) error {
+	now := time.Now().UnixMilli()
+	art.Ctime = now
+	art.Utime = now
+	return db.WithContext(ctx).Table(table).Clauses(clause.OnConflict{
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"title":   art.Title,
+			"content": art.Content,
+			"status":  art.Status,
+			"utime":   now,
+		}),
+	}).Create(&art).Error
+}
+
+func (dao *ShardingArticleDAO) SyncStatus(ctx context.Context, id int64, author int64, status uint8) error {
+	db, arts, pubs := dao.tables(author)
+	now := time.Now().UnixMilli()
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Table(arts).Where("id = ? AND author_id = ?", id, author).
+			Updates(map[string]any{
+				"status": status,
+				"utime":  now,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected != 1 {
+			return fmt.Errorf("可能有人在搞你，误操作非自己的文章，uid:%d, aid:%d", author, id)
+		}
+		return tx.Table(pubs).Where("id = ?", id).
+			Updates(map[string]any{
+				"status": status,
+				"utime":  now,
+			}).Error
+	})
+}
+
+func (dao *ShardingArticleDAO) GetByAuthor(ctx context.Context, author int64, offset, limit int) ([]Article, error) {
+	db, arts, _ := dao.tables(author)
+	var res []Article
+	err := db.WithContext(ctx).Table(arts).
+		Where("author_id = ?", author).
+		Offset(offset).
+		Limit(limit).
+		Order("utime DESC").
+		Find(&res).Error
+	return res, err
+}
+
+// GetById 不知道作者的时候只能查所有的分表
+func (dao *ShardingArticleDAO) GetById(ctx context.Context, id int64) (Article, error) {
+	res, err := sharding.Scatter(ctx, dao.sharding.All(), func(ctx context.Context, dst sharding.Dst) ([]Article, error) {
+		var arts []Article
+		err := dao.sharding.Table(dst, articleTablePrefix).WithContext(ctx).
+			Where("id = ?", id).Limit(1).Find(&arts).Error
+		return arts, err
+	})
+	if err != nil {
+		return Article{}, err
+	}
+	if len(res) == 0 {
+		return Article{}, ErrArticleNotFound
+	}
+	return res[0], nil
+}
+
+func (dao *ShardingArticleDAO) GetPubById(ctx context.Context, id int64) (PublishedArticle, error) {
+	res, err := sharding.Scatter(ctx, dao.sharding.All(), func(ctx context.Context, dst sharding.Dst) ([]PublishedArticle, error) {
+		var arts []PublishedArticle
+		err := dao.sharding.Table(dst, publishedTablePrefix).WithContext(ctx).
+			Where("id = ?", id).Limit(1).Find(&arts).Error
+		return arts, err
+	})
+	if err != nil {
+		return PublishedArticle{}, err
+	}
+	if len(res) == 0 {
+		return PublishedArticle{}, ErrArticleNotFound
+	}
+	return res[0], nil
+}
+
+// ListPubByUtime 每张分表都要查前 offset+limit 个，合在一起排序之后再分页
+func (dao *ShardingArticleDAO) ListPubByUtime(ctx context.Context, utime time.Time, offset, limit int) ([]PublishedArticle, error) {
+	res, err := sharding.Scatter(ctx, dao.sharding.All(), func(ctx context.Context, dst sharding.Dst) ([]PublishedArticle, error) {
+		var arts []PublishedArticle
+		err := dao.sharding.Table(dst, publishedTablePrefix).WithContext(ctx).
+			Where("utime < ?", utime.UnixMilli()).
+			Order("utime DESC").
+			Limit(offset + limit).
+			Find(&arts).Error
+		return arts, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Utime > res[j].Utime
+	})
+	if offset >= len(res) {
+		return nil, nil
+	}
+	res = res[offset:]
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+// TransferAuthor 合并账号的时候文章跟着走
+// 两个作者不在同一张分表的话，要把文章搬到新作者的分表里面：先写新的，再删旧的，可以重复执行
+func (dao *ShardingArticleDAO) TransferAuthor(ctx context.Context, from, to int64) error {
+	now := time.Now().UnixMilli()
+	srcDB, srcArts, srcPubs := dao.tables(from)
+	if dao.sharding.ShardInt(from) == dao.sharding.ShardInt(to) {
+		return srcDB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			err := tx.Table(srcArts).Where("author_id = ?", from).
+				Updates(map[string]any{"author_id": to, "utime": now}).Error
+			if err != nil {
+				return err
+			}
+			return tx.Table(srcPubs).Where("author_id = ?", from).
+				Updates(map[string]any{"author_id": to, "utime": now}).Error
+		})
+	}
+	dstDB, dstArts, dstPubs := dao.tables(to)
+	var arts []Article
+	if err := srcDB.WithContext(ctx).Table(srcArts).Where("author_id = ?", from).Find(&arts).Error; err != nil {
+		return err
+	}
+	var pubs []PublishedArticle
+	if err := srcDB.WithContext(ctx).Table(srcPubs).Where("author_id = ?", from).Find(&pubs).Error; err != nil {
+		return err
+	}
+	if len(arts) == 0 && len(pubs) == 0 {
+		return nil
+	}
+	for i := range arts {
+		arts[i].AuthorId, arts[i].Utime = to, now
+	}
+	for i := range pubs {
+		pubs[i].AuthorId, pubs[i].Utime = to, now
+	}
+	err := dstDB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 上一次搬了一半的，主键冲突直接覆盖
+		if len(arts) > 0 {
+			err := tx.Table(dstArts).Clauses(clause.OnConflict{UpdateAll: true}).Create(&arts).Error
+			if err != nil {
+				return err
+			}
+		}
+		if len(pubs) > 0 {
+			return tx.Table(dstPubs).Clauses(clause.OnConflict{UpdateAll: true}).Create(&pubs).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return srcDB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table(srcArts).Where("author_id = ?", from).Delete(&Article{}).Error; err != nil {
+			return err
+		}
+		return tx.Table(srcPubs).Where("author_id = ?", from).Delete(&PublishedArticle{}).Error
+	})
+}
+
+// UnpublishAuthor 注销账号的时候，作者所有的文章都下线
+func (dao *ShardingArticleDAO) UnpublishAuthor(ctx context.Context, author int64) error {
+	db, arts, pubs := dao.tables(author)
+	now := time.Now().UnixMilli()
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Table(arts).Where("author_id = ?", author).
+			Updates(map[string]any{"status": statusUnpublished, "utime": now}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Table(pubs).Where("author_id = ?", author).
+			Updates(map[string]any{"status": statusUnpublished, "utime": now}).Error
+	})
+}
+
+var _ ArticleDAO = (*ShardingArticleDAO)(nil)
@@ -0,0 +1,36 @@
+package dao
+
+import (
+	"context"
+	"gorm.io/gorm"
+)
+
+// AuditLogDAO 审计日志只能插入，不提供修改和删除
+type AuditLogDAO interface {
+	Insert(ctx context.Context, l AuditLog) error
+}
+
+type GORMAuditLogDAO struct {
+	db *gorm.DB
+}
+
+func NewAuditLogDAO(db *gorm.DB) AuditLogDAO {
+	return &GORMAuditLogDAO{
+		db: db,
+	}
+}
+
+func (dao *GORMAuditLogDAO) Insert(ctx context.Context, l AuditLog) error {
+	return dao.db.WithContext(ctx).Create(&l).Error
+}
+
+type AuditLog struct {
+	Id        int64  `gorm:"primaryKey,autoIncrement"`
+	Operator  int64  `gorm:"index"`
+	Action    string `gorm:"type:varchar(64)"`
+	TargetUid int64  `gorm:"index"`
+	Detail    string `gorm:"type:varchar(1024)"`
+	Result    string `gorm:"type:varchar(255)"`
+	IP        string `gorm:"type:varchar(64)"`
+	Ctime     int64
+}
@@ -0,0 +1,139 @@
+package dao
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"time"
+	"webook_go/webook/pkg/idgen"
+)
+
+var (
+	ErrIdentityDuplicate = errors.New("第三方账号已经绑定过了")
+	ErrIdentityNotFound  = gorm.ErrRecordNotFound
+)
+
+// IdentityDAO 第三方平台的账号，每个平台一行，不再往 users 表里面加字段
+type IdentityDAO interface {
+	FindByProvider(ctx context.Context, provider, subject string) (UserIdentity, error)
+	FindByUid(ctx context.Context, uid int64) ([]UserIdentity, error)
+	Insert(ctx context.Context, identity UserIdentity) error
+	// UpdateToken 每次登录或者刷新之后，保存第三方平台最新的 token
+	UpdateToken(ctx context.Context, identity UserIdentity) error
+	// FindExpiring 这些平台上 before 之前过期、还能刷新的，按照过期时间排序
+	FindExpiring(ctx context.Context, providers []string, before int64, limit int) ([]UserIdentity, error)
+	// Delete 解绑，没有绑定过返回 ErrIdentityNotFound
+	Delete(ctx context.Context, uid int64, provider string) error
+	// InsertWithUser 第一次用第三方登录，在一个事务里面创建用户和第三方账号，返回用户 ID
+	InsertWithUser(ctx context.Context, u User, identity UserIdentity) (int64, error)
+}
+
+type GORMIdentityDAO struct {
+	db *gorm.DB
+	// gen 第一次用第三方登录的时候生成用户 ID，和 GORMUserDAO 用同一个
+	gen idgen.Generator
+}
+
+func NewIdentityDAO(db *gorm.DB, gen idgen.Generator) IdentityDAO {
+	return &GORMIdentityDAO{
+		db:  db,
+		gen: gen,
+	}
+}
+
+func (dao *GORMIdentityDAO) FindByProvider(ctx context.Context, provider, subject string) (UserIdentity, error) {
+	var res UserIdentity
+	err := dao.db.WithContext(ctx).
+		Where("provider = ? AND subject = ?", provider, subject).
+		First(&res).Error
+	return res, err
+}
+
+func (dao *GORMIdentityDAO) FindByUid(ctx context.Context, uid int64) ([]UserIdentity, error) {
+	var res []UserIdentity
+	err := dao.db.WithContext(ctx).Where("uid = ?", uid).Find(&res).Error
+	return res, err
+}
+
+func (dao *GORMIdentityDAO) Insert(ctx context.Context, identity UserIdentity) error {
+	now := time.Now().UnixMilli()
+	identity.Ctime = now
+	identity.Utime = now
+	return dao.duplicateErr(dao.db.WithContext(ctx).Create(&identity).Error)
+}
+
+func (dao *GORMIdentityDAO) UpdateToken(ctx context.Context, identity UserIdentity) error {
+	return dao.db.WithContext(ctx).Model(&UserIdentity{}).
+		Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).
+		Updates(map[string]any{
+			"access_token":     identity.AccessToken,
+			"refresh_token":    identity.RefreshToken,
+			"token_expires_at": identity.TokenExpiresAt,
+			"utime":            time.Now().UnixMilli(),
+		}).Error
+}
+
+func (dao *GORMIdentityDAO) FindExpiring(ctx context.Context, providers []string,
+	before int64, limit int) ([]UserIdentity, error) {
+	var res []UserIdentity
+	err := dao.db.WithContext(ctx).
+		Where("provider IN ? AND token_expires_at > 0 AND token_expires_at < ? AND refresh_token <> ''",
+			providers, before).
+		Order("token_expires_at").Limit(limit).Find(&res).Error
+	return res, err
+}
+
+func (dao *GORMIdentityDAO) Delete(ctx context.Context, uid int64, provider string) error {
+	res := dao.db.WithContext(ctx).Where("uid = ? AND provider = ?", uid, provider).
+		Delete(&UserIdentity{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrIdentityNotFound
+	}
+	return nil
+}
+
+func (dao *GORMIdentityDAO) InsertWithUser(ctx context.Context, u User, identity UserIdentity) (int64, error) {
+	now := time.Now().UnixMilli()
+	u.Ctime, u.Utime = now, now
+	identity.Ctime, identity.Utime = now, now
+	id, err := idgen.Next(dao.gen)
+	if err != nil {
+		return 0, err
+	}
+	u.Id = id
+	err = dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&u).Error; err != nil {
+			return err
+		}
+		identity.Uid = u.Id
+		return tx.Create(&identity).Error
+	})
+	return u.Id, dao.duplicateErr(err)
+}
+
+func (dao *GORMIdentityDAO) duplicateErr(err error) error {
+	if isUniqueConflict(err) {
+		return ErrIdentityDuplicate
+	}
+	return err
+}
+
+type UserIdentity struct {
+	Id  int64 `gorm:"primaryKey,autoIncrement"`
+	Uid int64 `gorm:"index"`
+	// 同一个平台上的账号只能绑定一个用户
+	Provider string `gorm:"type:varchar(32);uniqueIndex:uk_provider_subject"`
+	Subject  string `gorm:"type:varchar(191);uniqueIndex:uk_provider_subject"`
+	UnionID  string `gorm:"type:varchar(191)"`
+	// 调用第三方平台接口用的，比如微信的 access_token 两个小时过期，refresh_token 三十天过期
+	AccessToken  string `gorm:"type:varchar(512)"`
+	RefreshToken string `gorm:"type:varchar(512)"`
+	// TokenExpiresAt 毫秒，0 代表不会过期
+	TokenExpiresAt int64 `gorm:"index"`
+
+	Ctime int64
+	Utime int64
+}
@@ -6,5 +6,6 @@ import (
 )
 
 func InitTables(db *gorm.DB) error {
-	return db.AutoMigrate(&User{}, &article.Article{}, &article.PublishedArticle{}) // 想新建表，就往后面加
+	return db.AutoMigrate(&User{}, &article.Article{}, &article.PublishedArticle{},
+		&UserTOTP{}, &TOTPRecoveryCode{}, &UserIdentity{}, &LoginLog{}, &AuditLog{}) // 想新建表，就往后面加
 }
@@ -0,0 +1,44 @@
+package dao
+
+import (
+	"context"
+	"gorm.io/gorm"
+)
+
+// LoginLogDAO 登录记录只会插入，不会修改
+type LoginLogDAO interface {
+	Insert(ctx context.Context, l LoginLog) error
+	// FindByUid 最近的在前面
+	FindByUid(ctx context.Context, uid int64, offset, limit int) ([]LoginLog, error)
+}
+
+type GORMLoginLogDAO struct {
+	db *gorm.DB
+}
+
+func NewLoginLogDAO(db *gorm.DB) LoginLogDAO {
+	return &GORMLoginLogDAO{
+		db: db,
+	}
+}
+
+func (dao *GORMLoginLogDAO) Insert(ctx context.Context, l LoginLog) error {
+	return dao.db.WithContext(ctx).Create(&l).Error
+}
+
+func (dao *GORMLoginLogDAO) FindByUid(ctx context.Context, uid int64, offset, limit int) ([]LoginLog, error) {
+	var res []LoginLog
+	err := dao.db.WithContext(ctx).Where("uid = ?", uid).
+		Order("ctime DESC").Offset(offset).Limit(limit).Find(&res).Error
+	return res, err
+}
+
+type LoginLog struct {
+	Id int64 `gorm:"primaryKey,autoIncrement"`
+	// 按照用户查最近的登录记录
+	Uid       int64  `gorm:"index:idx_uid_ctime"`
+	Method    string `gorm:"type:varchar(128)"`
+	IP        string `gorm:"type:varchar(64)"`
+	UserAgent string `gorm:"type:varchar(512)"`
+	Ctime     int64  `gorm:"index:idx_uid_ctime"`
+}
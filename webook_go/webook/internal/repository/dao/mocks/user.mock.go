@@ -10,6 +10,7 @@ package daomocks
 
 import (
 	context "context"
+	sql "database/sql"
 	reflect "reflect"
 	dao "webook_go/webook/internal/repository/dao"
 
@@ -39,6 +40,78 @@ func (m *MockUserDAO) EXPECT() *MockUserDAOMockRecorder {
 	return m.recorder
 }
 
+// Activate mocks base method.
+func (m *MockUserDAO) Activate(ctx context.Context, id int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Activate", ctx, id)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Activate indicates an expected call of Activate.
+func (mr *MockUserDAOMockRecorder) Activate(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Activate", reflect.TypeOf((*MockUserDAO)(nil).Activate), ctx, id)
+}
+
+// Anonymize mocks base method.
+func (m *MockUserDAO) Anonymize(ctx context.Context, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Anonymize", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Anonymize indicates an expected call of Anonymize.
+func (mr *MockUserDAOMockRecorder) Anonymize(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Anonymize", reflect.TypeOf((*MockUserDAO)(nil).Anonymize), ctx, id)
+}
+
+// CancelDeletion mocks base method.
+func (m *MockUserDAO) CancelDeletion(ctx context.Context, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelDeletion", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CancelDeletion indicates an expected call of CancelDeletion.
+func (mr *MockUserDAOMockRecorder) CancelDeletion(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelDeletion", reflect.TypeOf((*MockUserDAO)(nil).CancelDeletion), ctx, id)
+}
+
+// ClearWechat mocks base method.
+func (m *MockUserDAO) ClearWechat(ctx context.Context, id int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClearWechat", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ClearWechat indicates an expected call of ClearWechat.
+func (mr *MockUserDAOMockRecorder) ClearWechat(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClearWechat", reflect.TypeOf((*MockUserDAO)(nil).ClearWechat), ctx, id)
+}
+
+// FindBanned mocks base method.
+func (m *MockUserDAO) FindBanned(ctx context.Context, before int64, limit int) ([]dao.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindBanned", ctx, before, limit)
+	ret0, _ := ret[0].([]dao.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindBanned indicates an expected call of FindBanned.
+func (mr *MockUserDAOMockRecorder) FindBanned(ctx, before, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindBanned", reflect.TypeOf((*MockUserDAO)(nil).FindBanned), ctx, before, limit)
+}
+
 // FindByEmail mocks base method.
 func (m *MockUserDAO) FindByEmail(ctx context.Context, email string) (dao.User, error) {
 	m.ctrl.T.Helper()
@@ -84,6 +157,36 @@ func (mr *MockUserDAOMockRecorder) FindByPhone(ctx, phone any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindByPhone", reflect.TypeOf((*MockUserDAO)(nil).FindByPhone), ctx, phone)
 }
 
+// FindByWechat mocks base method.
+func (m *MockUserDAO) FindByWechat(ctx context.Context, openID string) (dao.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindByWechat", ctx, openID)
+	ret0, _ := ret[0].(dao.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindByWechat indicates an expected call of FindByWechat.
+func (mr *MockUserDAOMockRecorder) FindByWechat(ctx, openID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindByWechat", reflect.TypeOf((*MockUserDAO)(nil).FindByWechat), ctx, openID)
+}
+
+// FindDeletable mocks base method.
+func (m *MockUserDAO) FindDeletable(ctx context.Context, now int64, limit int) ([]dao.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindDeletable", ctx, now, limit)
+	ret0, _ := ret[0].([]dao.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindDeletable indicates an expected call of FindDeletable.
+func (mr *MockUserDAOMockRecorder) FindDeletable(ctx, now, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindDeletable", reflect.TypeOf((*MockUserDAO)(nil).FindDeletable), ctx, now, limit)
+}
+
 // Insert mocks base method.
 func (m *MockUserDAO) Insert(ctx context.Context, u dao.User) error {
 	m.ctrl.T.Helper()
@@ -98,6 +201,20 @@ func (mr *MockUserDAOMockRecorder) Insert(ctx, u any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Insert", reflect.TypeOf((*MockUserDAO)(nil).Insert), ctx, u)
 }
 
+// Merge mocks base method.
+func (m *MockUserDAO) Merge(ctx context.Context, from, to int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Merge", ctx, from, to)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Merge indicates an expected call of Merge.
+func (mr *MockUserDAOMockRecorder) Merge(ctx, from, to any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Merge", reflect.TypeOf((*MockUserDAO)(nil).Merge), ctx, from, to)
+}
+
 // Profile mocks base method.
 func (m *MockUserDAO) Profile(ctx context.Context, id int64) (dao.User, error) {
 	m.ctrl.T.Helper()
@@ -113,17 +230,101 @@ func (mr *MockUserDAOMockRecorder) Profile(ctx, id any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Profile", reflect.TypeOf((*MockUserDAO)(nil).Profile), ctx, id)
 }
 
-// Save mocks base method.
-func (m *MockUserDAO) Save(ctx context.Context, id int64, Nickname, Birthday, AboutMe string) (dao.User, error) {
+// RequestDeletion mocks base method.
+func (m *MockUserDAO) RequestDeletion(ctx context.Context, id, deleteAt int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RequestDeletion", ctx, id, deleteAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RequestDeletion indicates an expected call of RequestDeletion.
+func (mr *MockUserDAOMockRecorder) RequestDeletion(ctx, id, deleteAt any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequestDeletion", reflect.TypeOf((*MockUserDAO)(nil).RequestDeletion), ctx, id, deleteAt)
+}
+
+// UpdateBan mocks base method.
+func (m *MockUserDAO) UpdateBan(ctx context.Context, id, bannedAt int64, reason string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateBan", ctx, id, bannedAt, reason)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateBan indicates an expected call of UpdateBan.
+func (mr *MockUserDAOMockRecorder) UpdateBan(ctx, id, bannedAt, reason any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateBan", reflect.TypeOf((*MockUserDAO)(nil).UpdateBan), ctx, id, bannedAt, reason)
+}
+
+// UpdateEmail mocks base method.
+func (m *MockUserDAO) UpdateEmail(ctx context.Context, id int64, email sql.NullString) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateEmail", ctx, id, email)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateEmail indicates an expected call of UpdateEmail.
+func (mr *MockUserDAOMockRecorder) UpdateEmail(ctx, id, email any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateEmail", reflect.TypeOf((*MockUserDAO)(nil).UpdateEmail), ctx, id, email)
+}
+
+// UpdatePassword mocks base method.
+func (m *MockUserDAO) UpdatePassword(ctx context.Context, id int64, password string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePassword", ctx, id, password)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePassword indicates an expected call of UpdatePassword.
+func (mr *MockUserDAOMockRecorder) UpdatePassword(ctx, id, password any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePassword", reflect.TypeOf((*MockUserDAO)(nil).UpdatePassword), ctx, id, password)
+}
+
+// UpdatePhone mocks base method.
+func (m *MockUserDAO) UpdatePhone(ctx context.Context, id int64, phone sql.NullString) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePhone", ctx, id, phone)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePhone indicates an expected call of UpdatePhone.
+func (mr *MockUserDAOMockRecorder) UpdatePhone(ctx, id, phone any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePhone", reflect.TypeOf((*MockUserDAO)(nil).UpdatePhone), ctx, id, phone)
+}
+
+// UpdateProfile mocks base method.
+func (m *MockUserDAO) UpdateProfile(ctx context.Context, id int64, fields map[string]any) (dao.User, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Save", ctx, id, Nickname, Birthday, AboutMe)
+	ret := m.ctrl.Call(m, "UpdateProfile", ctx, id, fields)
 	ret0, _ := ret[0].(dao.User)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// Save indicates an expected call of Save.
-func (mr *MockUserDAOMockRecorder) Save(ctx, id, Nickname, Birthday, AboutMe any) *gomock.Call {
+// UpdateProfile indicates an expected call of UpdateProfile.
+func (mr *MockUserDAOMockRecorder) UpdateProfile(ctx, id, fields any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProfile", reflect.TypeOf((*MockUserDAO)(nil).UpdateProfile), ctx, id, fields)
+}
+
+// UpdateRoles mocks base method.
+func (m *MockUserDAO) UpdateRoles(ctx context.Context, id int64, roles string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateRoles", ctx, id, roles)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateRoles indicates an expected call of UpdateRoles.
+func (mr *MockUserDAOMockRecorder) UpdateRoles(ctx, id, roles any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockUserDAO)(nil).Save), ctx, id, Nickname, Birthday, AboutMe)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateRoles", reflect.TypeOf((*MockUserDAO)(nil).UpdateRoles), ctx, id, roles)
 }
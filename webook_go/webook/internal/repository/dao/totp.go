@@ -0,0 +1,146 @@
+package dao
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+var ErrTOTPNotFound = gorm.ErrRecordNotFound
+
+// TOTPDAO 两步验证的密钥和恢复码
+type TOTPDAO interface {
+	// SaveSecret 开始绑定，已经有密钥的话覆盖掉，并且回到未启用的状态
+	SaveSecret(ctx context.Context, uid int64, secret string) error
+	FindByUid(ctx context.Context, uid int64) (UserTOTP, error)
+	// Enable 启用两步验证，同时替换掉所有的恢复码
+	Enable(ctx context.Context, uid int64, codeHashes []string) error
+	// Delete 关闭两步验证，密钥和恢复码一起删掉
+	Delete(ctx context.Context, uid int64) error
+	// UseStep 记录用过的时间步，返回 false 代表这个时间步或者更新的已经用过了
+	UseStep(ctx context.Context, uid int64, step int64) (bool, error)
+	// UseRecoveryCode 恢复码只能用一次，返回 false 代表不存在或者已经用过了
+	UseRecoveryCode(ctx context.Context, uid int64, codeHash string) (bool, error)
+}
+
+type GORMTOTPDAO struct {
+	db *gorm.DB
+}
+
+func NewTOTPDAO(db *gorm.DB) TOTPDAO {
+	return &GORMTOTPDAO{
+		db: db,
+	}
+}
+
+func (dao *GORMTOTPDAO) SaveSecret(ctx context.Context, uid int64, secret string) error {
+	now := time.Now().UnixMilli()
+	return dao.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "uid"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"secret":    secret,
+			"enabled":   false,
+			"last_step": 0,
+			"utime":     now,
+		}),
+	}).Create(&UserTOTP{
+		Uid:    uid,
+		Secret: secret,
+		Ctime:  now,
+		Utime:  now,
+	}).Error
+}
+
+func (dao *GORMTOTPDAO) FindByUid(ctx context.Context, uid int64) (UserTOTP, error) {
+	var res UserTOTP
+	err := dao.db.WithContext(ctx).Where("uid = ?", uid).First(&res).Error
+	return res, err
+}
+
+func (dao *GORMTOTPDAO) Enable(ctx context.Context, uid int64, codeHashes []string) error {
+	now := time.Now().UnixMilli()
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&UserTOTP{}).Where("uid = ?", uid).
+			Updates(map[string]any{
+				"enabled": true,
+				"utime":   now,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrTOTPNotFound
+		}
+		err := tx.Where("uid = ?", uid).Delete(&TOTPRecoveryCode{}).Error
+		if err != nil {
+			return err
+		}
+		codes := make([]TOTPRecoveryCode, 0, len(codeHashes))
+		for _, h := range codeHashes {
+			codes = append(codes, TOTPRecoveryCode{
+				Uid:      uid,
+				CodeHash: h,
+				Ctime:    now,
+				Utime:    now,
+			})
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+func (dao *GORMTOTPDAO) Delete(ctx context.Context, uid int64) error {
+	return dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("uid = ?", uid).Delete(&TOTPRecoveryCode{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("uid = ?", uid).Delete(&UserTOTP{}).Error
+	})
+}
+
+func (dao *GORMTOTPDAO) UseStep(ctx context.Context, uid int64, step int64) (bool, error) {
+	// 条件更新，并发的两个请求用同一个验证码，只有一个能成功
+	res := dao.db.WithContext(ctx).Model(&UserTOTP{}).
+		Where("uid = ? AND last_step < ?", uid, step).
+		Updates(map[string]any{
+			"last_step": step,
+			"utime":     time.Now().UnixMilli(),
+		})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (dao *GORMTOTPDAO) UseRecoveryCode(ctx context.Context, uid int64, codeHash string) (bool, error) {
+	res := dao.db.WithContext(ctx).Model(&TOTPRecoveryCode{}).
+		Where("uid = ? AND code_hash = ? AND used = ?", uid, codeHash, false).
+		Updates(map[string]any{
+			"used":  true,
+			"utime": time.Now().UnixMilli(),
+		})
+	return res.RowsAffected > 0, res.Error
+}
+
+// UserTOTP 一个用户只有一个密钥
+type UserTOTP struct {
+	Id     int64 `gorm:"primaryKey,autoIncrement"`
+	Uid    int64 `gorm:"unique"`
+	Secret string
+	// 绑定的时候要先输入一次验证码确认，确认之后才启用
+	Enabled bool
+	// 最近一次用过的时间步，防止验证码被重放
+	LastStep int64
+
+	Ctime int64
+	Utime int64
+}
+
+// TOTPRecoveryCode 手机丢了的时候用恢复码登录，只存 SHA256 之后的值
+type TOTPRecoveryCode struct {
+	Id       int64  `gorm:"primaryKey,autoIncrement"`
+	Uid      int64  `gorm:"index:idx_uid_code"`
+	CodeHash string `gorm:"type:varchar(64);index:idx_uid_code"`
+	Used     bool
+
+	Ctime int64
+	Utime int64
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/go-sql-driver/mysql"
 	"gorm.io/gorm"
 	"time"
+	"webook_go/webook/pkg/idgen"
 )
 
 var (
@@ -15,36 +16,82 @@ var (
 )
 
 type UserDAO interface {
-	Save(ctx context.Context, id int64, Nickname, Birthday, AboutMe string) (User, error)
+	// UpdateProfile fields 是要更新的列，返回更新之后的整行
+	UpdateProfile(ctx context.Context, id int64, fields map[string]any) (User, error)
 	FindById(ctx context.Context, id int64) (User, error)
 	Profile(ctx context.Context, id int64) (User, error)
 	FindByEmail(ctx context.Context, email string) (User, error)
 	FindByPhone(ctx context.Context, phone string) (User, error)
 	Insert(ctx context.Context, u User) error
 	FindByWechat(ctx context.Context, openID string) (User, error)
+	// Activate 把待激活的账号改成正常状态，返回 false 代表账号不是待激活状态
+	Activate(ctx context.Context, id int64) (bool, error)
+	UpdatePassword(ctx context.Context, id int64, password string) error
+	UpdateRoles(ctx context.Context, id int64, roles string) error
+	// UpdatePhone 绑定手机号，phone 无效代表解绑，被别的账号用了返回 ErrUserDuplicate
+	UpdatePhone(ctx context.Context, id int64, phone sql.NullString) error
+	// UpdateEmail 和 UpdatePhone 一样
+	UpdateEmail(ctx context.Context, id int64, email sql.NullString) error
+	// ClearWechat 解绑以前存在 users 表里面的微信
+	ClearWechat(ctx context.Context, id int64) error
+	// Merge 把 from 的登录方式和文章都转到 to 上面，from 标记成已合并
+	Merge(ctx context.Context, from, to int64) error
+	// RequestDeletion 正常的账号才能申请注销，不是的话返回 ErrUserNotFound
+	RequestDeletion(ctx context.Context, id int64, deleteAt int64) error
+	// CancelDeletion 冷静期里面的账号才能撤销，不是的话返回 ErrUserNotFound
+	CancelDeletion(ctx context.Context, id int64) error
+	// FindDeletable 冷静期已经过了的账号
+	FindDeletable(ctx context.Context, now int64, limit int) ([]User, error)
+	// Anonymize 真正注销账号，已经撤销了的返回 ErrUserNotFound
+	Anonymize(ctx context.Context, id int64) error
+	// UpdateBan bannedAt 为 0 代表解封
+	UpdateBan(ctx context.Context, id int64, bannedAt int64, reason string) error
+	// FindBanned 封禁时间早于 before 的用户，最近封禁的在前面
+	FindBanned(ctx context.Context, before int64, limit int) ([]User, error)
+}
+
+// AuthorArticleDAO 合并、注销账号的时候通过它来改文章
+// 文章可能分片了，也可能在往 MongoDB 迁移，所以不能在用户的事务里面直接改 articles 表
+type AuthorArticleDAO interface {
+	// TransferAuthor 把 from 的文章都转给 to，可以重复执行
+	TransferAuthor(ctx context.Context, from, to int64) error
+	// UnpublishAuthor 作者所有的文章都下线
+	UnpublishAuthor(ctx context.Context, author int64) error
 }
 
 type GORMUserDAO struct {
 	db *gorm.DB
+	// gen 为 nil 的时候用数据库自增主键
+	gen  idgen.Generator
+	arts AuthorArticleDAO
 }
 
-func NewUserDAO(db *gorm.DB) UserDAO {
+func NewUserDAO(db *gorm.DB, gen idgen.Generator, arts AuthorArticleDAO) UserDAO {
 	return &GORMUserDAO{
-		db: db,
+		db:   db,
+		gen:  gen,
+		arts: arts,
 	}
 }
 
-// 编辑功能 Edit 插入新增字段
-func (dao *GORMUserDAO) Save(ctx context.Context, id int64, Nickname, Birthday, AboutMe string) (User, error) {
+// UpdateProfile 只更新传进来的列，并发修改不同的字段不会互相覆盖
+func (dao *GORMUserDAO) UpdateProfile(ctx context.Context, id int64, fields map[string]any) (User, error) {
 	var u User
-	err := dao.db.WithContext(ctx).Where("Id = ?", id).First(&u).Error
-	if err == nil {
-		u.Nickname = Nickname
-		u.Birthday = Birthday
-		u.AboutMe = AboutMe
-		dao.db.WithContext(ctx).Save(&u)
-		return u, err
-	}
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		updates := make(map[string]any, len(fields)+1)
+		for k, v := range fields {
+			updates[k] = v
+		}
+		updates["utime"] = time.Now().UnixMilli()
+		res := tx.Model(&User{}).Where("id = ?", id).Updates(updates)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrUserNotFound
+		}
+		return tx.Where("id = ?", id).First(&u).Error
+	})
 	return u, err
 }
 
@@ -54,6 +101,163 @@ func (dao *GORMUserDAO) FindByWechat(ctx context.Context, openID string) (User,
 	return u, err
 }
 
+func (dao *GORMUserDAO) Activate(ctx context.Context, id int64) (bool, error) {
+	res := dao.db.WithContext(ctx).Model(&User{}).
+		Where("id = ? AND status = ?", id, UserStatusPending).
+		Updates(map[string]any{
+			"status": UserStatusActive,
+			"utime":  time.Now().UnixMilli(),
+		})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (dao *GORMUserDAO) UpdatePassword(ctx context.Context, id int64, password string) error {
+	return dao.db.WithContext(ctx).Model(&User{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"password": password,
+			"utime":    time.Now().UnixMilli(),
+		}).Error
+}
+
+func (dao *GORMUserDAO) UpdateRoles(ctx context.Context, id int64, roles string) error {
+	res := dao.db.WithContext(ctx).Model(&User{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"roles": roles,
+			"utime": time.Now().UnixMilli(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (dao *GORMUserDAO) UpdateBan(ctx context.Context, id int64, bannedAt int64, reason string) error {
+	res := dao.db.WithContext(ctx).Model(&User{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"banned_at":  bannedAt,
+			"ban_reason": reason,
+			"utime":      time.Now().UnixMilli(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (dao *GORMUserDAO) FindBanned(ctx context.Context, before int64, limit int) ([]User, error) {
+	var res []User
+	err := dao.db.WithContext(ctx).
+		Where("banned_at > 0 AND banned_at < ?", before).
+		Order("banned_at DESC").Limit(limit).Find(&res).Error
+	return res, err
+}
+
+func (dao *GORMUserDAO) UpdatePhone(ctx context.Context, id int64, phone sql.NullString) error {
+	return dao.updateContact(ctx, id, "phone", phone)
+}
+
+func (dao *GORMUserDAO) UpdateEmail(ctx context.Context, id int64, email sql.NullString) error {
+	return dao.updateContact(ctx, id, "email", email)
+}
+
+func (dao *GORMUserDAO) updateContact(ctx context.Context, id int64, column string, val sql.NullString) error {
+	res := dao.db.WithContext(ctx).Model(&User{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			column:  val,
+			"utime": time.Now().UnixMilli(),
+		})
+	if isUniqueConflict(res.Error) {
+		return ErrUserDuplicate
+	}
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (dao *GORMUserDAO) ClearWechat(ctx context.Context, id int64) error {
+	return dao.db.WithContext(ctx).Model(&User{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"wechat_open_id":  sql.NullString{},
+			"wechat_union_id": sql.NullString{},
+			"utime":           time.Now().UnixMilli(),
+		}).Error
+}
+
+func (dao *GORMUserDAO) Merge(ctx context.Context, from, to int64) error {
+	now := time.Now().UnixMilli()
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var src, dst User
+		if err := tx.Where("id = ?", from).First(&src).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id = ?", to).First(&dst).Error; err != nil {
+			return err
+		}
+		// 目标账号已经有的保留目标账号的，没有的才从被合并的账号拿过来
+		moved := map[string]any{"utime": now}
+		if !dst.Phone.Valid && src.Phone.Valid {
+			moved["phone"] = src.Phone
+		}
+		if !dst.Email.Valid && src.Email.Valid {
+			moved["email"] = src.Email
+			// 被合并的账号有密码，目标账号没有的话，密码也跟着邮箱过来
+			if dst.Password == "" {
+				moved["password"] = src.Password
+			}
+		}
+		if !dst.WechatOpenID.Valid && src.WechatOpenID.Valid {
+			moved["wechat_open_id"] = src.WechatOpenID
+			moved["wechat_union_id"] = src.WechatUnionID
+		}
+		// 先清掉被合并的账号，不然会违反唯一索引
+		err := tx.Model(&User{}).Where("id = ? AND status <> ?", from, UserStatusMerged).
+			Updates(map[string]any{
+				"phone":           sql.NullString{},
+				"email":           sql.NullString{},
+				"wechat_open_id":  sql.NullString{},
+				"wechat_union_id": sql.NullString{},
+				"status":          UserStatusMerged,
+				"utime":           now,
+			}).Error
+		if err != nil {
+			return err
+		}
+		if err = tx.Model(&User{}).Where("id = ?", to).Updates(moved).Error; err != nil {
+			return err
+		}
+		err = tx.Model(&UserIdentity{}).Where("uid = ?", from).
+			Updates(map[string]any{"uid": to, "utime": now}).Error
+		if err != nil {
+			return err
+		}
+		// 两步验证是跟着账号走的，被合并的账号的就不要了
+		if err = tx.Where("uid = ?", from).Delete(&UserTOTP{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("uid = ?", from).Delete(&TOTPRecoveryCode{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	// 文章不在这个事务里面，失败了重试：被合并的账号已经清掉了，前面的都不会再改什么
+	return dao.arts.TransferAuthor(ctx, from, to)
+}
+
 func (dao *GORMUserDAO) FindById(ctx context.Context, id int64) (User, error) {
 	var u User
 	err := dao.db.WithContext(ctx).Where("`id` = ?", id).First(&u).Error
@@ -83,25 +287,54 @@ func (dao *GORMUserDAO) Insert(ctx context.Context, u User) error {
 	now := time.Now().UnixMilli()
 	u.Ctime = now
 	u.Utime = now
+	// 分库分表的时候调用方已经生成好了 ID
+	if u.Id == 0 {
+		id, err := idgen.Next(dao.gen)
+		if err != nil {
+			return err
+		}
+		u.Id = id
+	}
 	err := dao.db.WithContext(ctx).Create(&u).Error
+	if isUniqueConflict(err) {
+		// 邮箱冲突 or 手机号码冲突
+		return ErrUserDuplicate
+	}
+	return err
+}
+
+func isUniqueConflict(err error) bool {
 	if mysqlErr, ok := err.(*mysql.MySQLError); ok {
 		const uniqueConflictsErrNo uint16 = 1062 // 数据库唯一索引冲突
-		if mysqlErr.Number == 1062 {
-			// 邮箱冲突 or 手机号码冲突
-			return ErrUserDuplicate
-		}
+		return mysqlErr.Number == uniqueConflictsErrNo
 	}
-	return err
+	return false
 }
 
+const (
+	UserStatusActive uint8 = iota
+	UserStatusPending
+	// UserStatusMerged 已经合并到别的账号里面了，不能再登录
+	UserStatusMerged
+	// UserStatusDeleting 申请注销了，还在冷静期
+	UserStatusDeleting
+	// UserStatusDeleted 已经注销，个人信息都清掉了
+	UserStatusDeleted
+	// UserStatusPurging 分库分表的时候注销到一半，个人信息已经清掉了，不能再撤销，注销任务会接着做完
+	UserStatusPurging
+)
+
 type User struct {
 	Id       int64          `gorm:"primaryKey,autoIncrement"`
 	Email    sql.NullString `gorm:"unique"`
 	Password string
 	Nickname string
+	// Birthday 2006-01-02 格式，空字符串代表没有填
 	Birthday string
 	AboutMe  string
-	Phone    sql.NullString `gorm:"unique"`
+	// Avatar 头像的 URL，第三方登录注册的时候用第三方平台上的头像
+	Avatar string
+	Phone  sql.NullString `gorm:"unique"`
 	// 最大问题是，你要解引用，接引用就要判空
 	//Phone *string
 
@@ -119,6 +352,16 @@ type User struct {
 	WechatUnionID sql.NullString
 	WechatOpenID  sql.NullString `gorm:"unique"`
 
+	// 账号状态，0 是正常，1 是待激活，2 是已合并，3 是注销冷静期，4 是已注销
+	Status uint8
+	// DeleteAt 注销冷静期结束的时间，到了之后才真正删除
+	DeleteAt int64 `gorm:"index"`
+	// 角色，多个角色用逗号分隔，普通用户是空的
+	Roles string
+	// BannedAt 封禁的时间，0 代表没有被封禁
+	BannedAt  int64 `gorm:"index"`
+	BanReason string
+
 	Ctime int64
 	Utime int64
 }
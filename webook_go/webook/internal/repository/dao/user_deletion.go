@@ -0,0 +1,102 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"gorm.io/gorm"
+	"time"
+)
+
+func (dao *GORMUserDAO) RequestDeletion(ctx context.Context, id int64, deleteAt int64) error {
+	res := dao.db.WithContext(ctx).Model(&User{}).
+		Where("id = ? AND status = ?", id, UserStatusActive).
+		Updates(map[string]any{
+			"status":    UserStatusDeleting,
+			"delete_at": deleteAt,
+			"utime":     time.Now().UnixMilli(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (dao *GORMUserDAO) CancelDeletion(ctx context.Context, id int64) error {
+	res := dao.db.WithContext(ctx).Model(&User{}).
+		Where("id = ? AND status = ?", id, UserStatusDeleting).
+		Updates(map[string]any{
+			"status":    UserStatusActive,
+			"delete_at": 0,
+			"utime":     time.Now().UnixMilli(),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (dao *GORMUserDAO) FindDeletable(ctx context.Context, now int64, limit int) ([]User, error) {
+	var res []User
+	err := dao.db.WithContext(ctx).
+		// 注销到一半的也要查出来接着做
+		Where("status IN (?, ?) AND delete_at <= ?", UserStatusDeleting, UserStatusPurging, now).
+		Order("delete_at").Limit(limit).Find(&res).Error
+	return res, err
+}
+
+// Anonymize 清掉能识别出这个人的信息，但是保留这一行，不然文章之类的数据就找不到作者了
+// 文章全部下线，第三方账号和两步验证都删掉
+// 文章不在用户的事务里面，所以先改成 UserStatusPurging，文章都下线了才改成 UserStatusDeleted，
+// 中间失败了 FindDeletable 还能查到这个账号，注销任务下一轮接着做
+func (dao *GORMUserDAO) Anonymize(ctx context.Context, id int64) error {
+	now := time.Now().UnixMilli()
+	err := dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 带上状态，防止用户刚好在这个时候撤销了
+		res := tx.Model(&User{}).Where("id = ? AND status IN (?, ?)", id, UserStatusDeleting, UserStatusPurging).
+			Updates(map[string]any{
+				"email":           sql.NullString{},
+				"phone":           sql.NullString{},
+				"wechat_open_id":  sql.NullString{},
+				"wechat_union_id": sql.NullString{},
+				"password":        "",
+				"nickname":        "",
+				"birthday":        "",
+				"about_me":        "",
+				"avatar":          "",
+				"roles":           "",
+				"status":          UserStatusPurging,
+				"utime":           now,
+			})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrUserNotFound
+		}
+		if err := tx.Where("uid = ?", id).Delete(&UserIdentity{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("uid = ?", id).Delete(&UserTOTP{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("uid = ?", id).Delete(&TOTPRecoveryCode{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	if err = dao.arts.UnpublishAuthor(ctx, id); err != nil {
+		return err
+	}
+	return dao.db.WithContext(ctx).Model(&User{}).
+		Where("id = ? AND status = ?", id, UserStatusPurging).
+		Updates(map[string]any{
+			"status": UserStatusDeleted,
+			"utime":  time.Now().UnixMilli(),
+		}).Error
+}
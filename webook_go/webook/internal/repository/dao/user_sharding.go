@@ -0,0 +1,525 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"gorm.io/gorm"
+	"sort"
+	"time"
+	"webook_go/webook/internal/repository/dao/article"
+	"webook_go/webook/pkg/idgen"
+	"webook_go/webook/pkg/sharding"
+)
+
+const (
+	userTablePrefix   = "users"
+	lookupTablePrefix = "user_lookups"
+)
+
+// user_lookups 里面值的类型
+const (
+	lookupKindEmail  = "email"
+	lookupKindPhone  = "phone"
+	lookupKindWechat = "wechat"
+)
+
+// ShardingUserDAO users 表按照用户 ID 分库分表
+// 邮箱、手机号、微信不是分片键，先查 user_lookups 拿到用户 ID，user_lookups 按照值分片
+// 跨库没有事务：先占用 user_lookups 再写 users，失败了释放占用的。
+// 释放也失败的话 user_lookups 里面会留下脏数据：查的时候会和 users 里面的值比较，
+// 再次占用的时候发现原来的用户已经没有这个值了，就接管过来，见 claim
+// 第三方账号、两步验证这些表没有分片，还在 db 里面
+type ShardingUserDAO struct {
+	sharding *sharding.Sharding
+	db       *gorm.DB
+	// gen 分表之后不能用自增主键了，一定要有
+	gen  idgen.Generator
+	arts AuthorArticleDAO
+}
+
+func NewShardingUserDAO(s *sharding.Sharding, db *gorm.DB, gen idgen.Generator, arts AuthorArticleDAO) UserDAO {
+	return &ShardingUserDAO{
+		sharding: s,
+		db:       db,
+		gen:      gen,
+		arts:     arts,
+	}
+}
+
+// shard 只操作 users 一张表的方法，在分表上面复用 GORMUserDAO
+func (dao *ShardingUserDAO) shard(id int64) *GORMUserDAO {
+	return &GORMUserDAO{db: dao.sharding.Table(dao.sharding.ShardInt(id), userTablePrefix)}
+}
+
+func (dao *ShardingUserDAO) lookupTable(kind, value string) *gorm.DB {
+	return dao.sharding.Table(dao.sharding.ShardString(kind+":"+value), lookupTablePrefix)
+}
+
+// claimGrace 刚占用还没来得及写 users 的，在这段时间里面不当成脏数据
+const claimGrace = time.Minute
+
+// claim 占用邮箱、手机号，已经被自己占用了也算成功，被别人占用了返回 ErrUserDuplicate
+// 占用的用户已经没有这个值了，说明是没释放掉的脏数据，接管过来
+func (dao *ShardingUserDAO) claim(ctx context.Context, kind, value string, uid int64) error {
+	now := time.Now().UnixMilli()
+	err := dao.lookupTable(kind, value).WithContext(ctx).Create(&UserLookup{
+		Kind:  kind,
+		Value: value,
+		Uid:   uid,
+		Ctime: now,
+	}).Error
+	if !isUniqueConflict(err) {
+		return err
+	}
+	var cur UserLookup
+	err = dao.lookupTable(kind, value).WithContext(ctx).
+		Where("kind = ? AND value = ?", kind, value).First(&cur).Error
+	if err != nil {
+		return err
+	}
+	if cur.Uid == uid {
+		return nil
+	}
+	stale, err := dao.stale(ctx, cur, now)
+	if err != nil {
+		return err
+	}
+	if !stale {
+		return ErrUserDuplicate
+	}
+	// 带上原来的 uid，并发接管的只有一个能成功
+	res := dao.lookupTable(kind, value).WithContext(ctx).Model(&UserLookup{}).
+		Where("kind = ? AND value = ? AND uid = ?", kind, value, cur.Uid).
+		Updates(map[string]any{"uid": uid, "ctime": now})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrUserDuplicate
+	}
+	return nil
+}
+
+// stale 占用的用户不存在，或者已经没有这个值了
+func (dao *ShardingUserDAO) stale(ctx context.Context, l UserLookup, now int64) (bool, error) {
+	if now-l.Ctime < claimGrace.Milliseconds() {
+		return false, nil
+	}
+	u, err := dao.FindById(ctx, l.Uid)
+	if err == ErrUserNotFound {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, held := range dao.lookups(u) {
+		if held.Kind == l.Kind && held.Value == l.Value {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// release 只释放自己占用的
+func (dao *ShardingUserDAO) release(ctx context.Context, kind, value string, uid int64) error {
+	return dao.lookupTable(kind, value).WithContext(ctx).
+		Where("kind = ? AND value = ? AND uid = ?", kind, value, uid).
+		Delete(&UserLookup{}).Error
+}
+
+func (dao *ShardingUserDAO) lookup(ctx context.Context, kind, value string) (int64, error) {
+	var res UserLookup
+	err := dao.lookupTable(kind, value).WithContext(ctx).
+		Where("kind = ? AND value = ?", kind, value).First(&res).Error
+	return res.Uid, err
+}
+
+// lookups 这个用户占用了哪些值
+func (dao *ShardingUserDAO) lookups(u User) []UserLookup {
+	var res []UserLookup
+	if u.Email.Valid {
+		res = append(res, UserLookup{Kind: lookupKindEmail, Value: u.Email.String, Uid: u.Id})
+	}
+	if u.Phone.Valid {
+		res = append(res, UserLookup{Kind: lookupKindPhone, Value: u.Phone.String, Uid: u.Id})
+	}
+	if u.WechatOpenID.Valid {
+		res = append(res, UserLookup{Kind: lookupKindWechat, Value: u.WechatOpenID.String, Uid: u.Id})
+	}
+	return res
+}
+
+// releaseAll 释放失败了也不管，查的时候会校验
+func (dao *ShardingUserDAO) releaseAll(ctx context.Context, lookups []UserLookup) {
+	for _, l := range lookups {
+		_ = dao.release(ctx, l.Kind, l.Value, l.Uid)
+	}
+}
+
+func (dao *ShardingUserDAO) Insert(ctx context.Context, u User) error {
+	if u.Id == 0 {
+		id, err := dao.gen.Next()
+		if err != nil {
+			return err
+		}
+		u.Id = id
+	}
+	var claimed []UserLookup
+	for _, l := range dao.lookups(u) {
+		if err := dao.claim(ctx, l.Kind, l.Value, u.Id); err != nil {
+			dao.releaseAll(ctx, claimed)
+			return err
+		}
+		claimed = append(claimed, l)
+	}
+	err := dao.shard(u.Id).Insert(ctx, u)
+	if err != nil {
+		dao.releaseAll(ctx, claimed)
+	}
+	return err
+}
+
+func (dao *ShardingUserDAO) FindById(ctx context.Context, id int64) (User, error) {
+	return dao.shard(id).FindById(ctx, id)
+}
+
+func (dao *ShardingUserDAO) Profile(ctx context.Context, id int64) (User, error) {
+	return dao.shard(id).FindById(ctx, id)
+}
+
+func (dao *ShardingUserDAO) FindByEmail(ctx context.Context, email string) (User, error) {
+	return dao.findBy(ctx, lookupKindEmail, email, func(u User) sql.NullString { return u.Email })
+}
+
+func (dao *ShardingUserDAO) FindByPhone(ctx context.Context, phone string) (User, error) {
+	return dao.findBy(ctx, lookupKindPhone, phone, func(u User) sql.NullString { return u.Phone })
+}
+
+func (dao *ShardingUserDAO) FindByWechat(ctx context.Context, openID string) (User, error) {
+	return dao.findBy(ctx, lookupKindWechat, openID, func(u User) sql.NullString { return u.WechatOpenID })
+}
+
+func (dao *ShardingUserDAO) findBy(ctx context.Context, kind, value string,
+	field func(u User) sql.NullString) (User, error) {
+	uid, err := dao.lookup(ctx, kind, value)
+	if err != nil {
+		return User{}, err
+	}
+	u, err := dao.FindById(ctx, uid)
+	if err != nil {
+		return User{}, err
+	}
+	// user_lookups 里面可能有没释放掉的脏数据
+	if f := field(u); !f.Valid || f.String != value {
+		return User{}, ErrUserNotFound
+	}
+	return u, nil
+}
+
+func (dao *ShardingUserDAO) UpdateProfile(ctx context.Context, id int64, fields map[string]any) (User, error) {
+	return dao.shard(id).UpdateProfile(ctx, id, fields)
+}
+
+func (dao *ShardingUserDAO) Activate(ctx context.Context, id int64) (bool, error) {
+	return dao.shard(id).Activate(ctx, id)
+}
+
+func (dao *ShardingUserDAO) UpdatePassword(ctx context.Context, id int64, password string) error {
+	return dao.shard(id).UpdatePassword(ctx, id, password)
+}
+
+func (dao *ShardingUserDAO) UpdateRoles(ctx context.Context, id int64, roles string) error {
+	return dao.shard(id).UpdateRoles(ctx, id, roles)
+}
+
+func (dao *ShardingUserDAO) UpdateBan(ctx context.Context, id int64, bannedAt int64, reason string) error {
+	return dao.shard(id).UpdateBan(ctx, id, bannedAt, reason)
+}
+
+func (dao *ShardingUserDAO) RequestDeletion(ctx context.Context, id int64, deleteAt int64) error {
+	return dao.shard(id).RequestDeletion(ctx, id, deleteAt)
+}
+
+func (dao *ShardingUserDAO) CancelDeletion(ctx context.Context, id int64) error {
+	return dao.shard(id).CancelDeletion(ctx, id)
+}
+
+func (dao *ShardingUserDAO) UpdatePhone(ctx context.Context, id int64, phone sql.NullString) error {
+	return dao.updateLookup(ctx, id, lookupKindPhone, phone,
+		func(u User) sql.NullString { return u.Phone },
+		func(d *GORMUserDAO) error { return d.UpdatePhone(ctx, id, phone) })
+}
+
+func (dao *ShardingUserDAO) UpdateEmail(ctx context.Context, id int64, email sql.NullString) error {
+	return dao.updateLookup(ctx, id, lookupKindEmail, email,
+		func(u User) sql.NullString { return u.Email },
+		func(d *GORMUserDAO) error { return d.UpdateEmail(ctx, id, email) })
+}
+
+func (dao *ShardingUserDAO) ClearWechat(ctx context.Context, id int64) error {
+	return dao.updateLookup(ctx, id, lookupKindWechat, sql.NullString{},
+		func(u User) sql.NullString { return u.WechatOpenID },
+		func(d *GORMUserDAO) error { return d.ClearWechat(ctx, id) })
+}
+
+// updateLookup 修改非分片键：先占用新的，再改 users，最后释放旧的
+func (dao *ShardingUserDAO) updateLookup(ctx context.Context, id int64, kind string, val sql.NullString,
+	field func(u User) sql.NullString, update func(d *GORMUserDAO) error) error {
+	u, err := dao.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	old := field(u)
+	changed := old.Valid != val.Valid || old.String != val.String
+	if changed && val.Valid {
+		if err = dao.claim(ctx, kind, val.String, id); err != nil {
+			return err
+		}
+	}
+	if err = update(dao.shard(id)); err != nil {
+		if changed && val.Valid {
+			_ = dao.release(ctx, kind, val.String, id)
+		}
+		return err
+	}
+	if changed && old.Valid {
+		_ = dao.release(ctx, kind, old.String, id)
+	}
+	return nil
+}
+
+// Merge 和 GORMUserDAO.Merge 的结果一样，但是跨库没有事务
+// 每一步都可以重复执行，中间失败了重试就可以
+func (dao *ShardingUserDAO) Merge(ctx context.Context, from, to int64) error {
+	src, err := dao.FindById(ctx, from)
+	if err != nil {
+		return err
+	}
+	dst, err := dao.FindById(ctx, to)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UnixMilli()
+	moved := map[string]any{"utime": now}
+	var movedLookups []UserLookup
+	if !dst.Phone.Valid && src.Phone.Valid {
+		moved["phone"] = src.Phone
+		movedLookups = append(movedLookups, UserLookup{Kind: lookupKindPhone, Value: src.Phone.String})
+	}
+	if !dst.Email.Valid && src.Email.Valid {
+		moved["email"] = src.Email
+		if dst.Password == "" {
+			moved["password"] = src.Password
+		}
+		movedLookups = append(movedLookups, UserLookup{Kind: lookupKindEmail, Value: src.Email.String})
+	}
+	if !dst.WechatOpenID.Valid && src.WechatOpenID.Valid {
+		moved["wechat_open_id"] = src.WechatOpenID
+		moved["wechat_union_id"] = src.WechatUnionID
+		movedLookups = append(movedLookups, UserLookup{Kind: lookupKindWechat, Value: src.WechatOpenID.String})
+	}
+	// 先把 user_lookups 转给目标账号，这样不管哪一步失败，按照邮箱、手机号都查不到被合并的账号了
+	for _, l := range movedLookups {
+		// 刷新 ctime，目标账号还没写进去之前不会被当成脏数据接管
+		err = dao.lookupTable(l.Kind, l.Value).WithContext(ctx).Model(&UserLookup{}).
+			Where("kind = ? AND value = ? AND uid = ?", l.Kind, l.Value, from).
+			Updates(map[string]any{"uid": to, "ctime": now}).Error
+		if err != nil {
+			return err
+		}
+	}
+	cleared := map[string]any{
+		"phone":           sql.NullString{},
+		"email":           sql.NullString{},
+		"wechat_open_id":  sql.NullString{},
+		"wechat_union_id": sql.NullString{},
+		"status":          UserStatusMerged,
+		"utime":           now,
+	}
+	srcDst, dstDst := dao.sharding.ShardInt(from), dao.sharding.ShardInt(to)
+	if srcDst == dstDst {
+		// 在同一张表里面，唯一索引要求先清掉被合并的账号
+		err = dao.sharding.Table(srcDst, userTablePrefix).WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			err := tx.Model(&User{}).Where("id = ? AND status <> ?", from, UserStatusMerged).
+				Updates(cleared).Error
+			if err != nil {
+				return err
+			}
+			return tx.Model(&User{}).Where("id = ?", to).Updates(moved).Error
+		})
+	} else {
+		// 不在同一张表里面，先改目标账号，失败了被合并的账号还是完整的
+		err = dao.shard(to).db.WithContext(ctx).Model(&User{}).Where("id = ?", to).Updates(moved).Error
+		if err == nil {
+			err = dao.shard(from).db.WithContext(ctx).Model(&User{}).
+				Where("id = ? AND status <> ?", from, UserStatusMerged).Updates(cleared).Error
+		}
+	}
+	if err != nil {
+		return err
+	}
+	// 目标账号已经有了的，被合并的账号占用的就不要了
+	for _, l := range dao.lookups(src) {
+		_ = dao.release(ctx, l.Kind, l.Value, from)
+	}
+	err = dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&UserIdentity{}).Where("uid = ?", from).
+			Updates(map[string]any{"uid": to, "utime": now}).Error
+		if err != nil {
+			return err
+		}
+		if err = tx.Where("uid = ?", from).Delete(&UserTOTP{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("uid = ?", from).Delete(&TOTPRecoveryCode{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	return dao.arts.TransferAuthor(ctx, from, to)
+}
+
+func (dao *ShardingUserDAO) FindDeletable(ctx context.Context, now int64, limit int) ([]User, error) {
+	// 每张分表最多查 limit 个，合在一起之后再取最早的 limit 个
+	res, err := sharding.Scatter(ctx, dao.sharding.All(), func(ctx context.Context, dst sharding.Dst) ([]User, error) {
+		return (&GORMUserDAO{db: dao.sharding.Table(dst, userTablePrefix)}).FindDeletable(ctx, now, limit)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].DeleteAt < res[j].DeleteAt
+	})
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+// FindBanned 和 FindDeletable 一样，每张分表最多查 limit 个，合在一起之后再取最近的 limit 个
+func (dao *ShardingUserDAO) FindBanned(ctx context.Context, before int64, limit int) ([]User, error) {
+	res, err := sharding.Scatter(ctx, dao.sharding.All(), func(ctx context.Context, dst sharding.Dst) ([]User, error) {
+		return (&GORMUserDAO{db: dao.sharding.Table(dst, userTablePrefix)}).FindBanned(ctx, before, limit)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].BannedAt > res[j].BannedAt
+	})
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
+
+// Anonymize 和 GORMUserDAO.Anonymize 一样，但是跨库没有事务
+// 先把账号改成 UserStatusPurging 并且清掉个人信息，这之后就不能撤销了；
+// 后面每一步都可以重复执行，全部成功了才改成 UserStatusDeleted，
+// 中间失败了 FindDeletable 还能查到这个账号，注销任务下一轮接着做
+func (dao *ShardingUserDAO) Anonymize(ctx context.Context, id int64) error {
+	u, err := dao.FindById(ctx, id)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UnixMilli()
+	users := dao.shard(id).db
+	res := users.WithContext(ctx).Model(&User{}).
+		Where("id = ? AND status IN (?, ?)", id, UserStatusDeleting, UserStatusPurging).
+		Updates(map[string]any{
+			"email":           sql.NullString{},
+			"phone":           sql.NullString{},
+			"wechat_open_id":  sql.NullString{},
+			"wechat_union_id": sql.NullString{},
+			"password":        "",
+			"nickname":        "",
+			"birthday":        "",
+			"about_me":        "",
+			"avatar":          "",
+			"roles":           "",
+			"status":          UserStatusPurging,
+			"utime":           now,
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	// 上一轮已经清掉了的话 u 里面是空的，什么都不会释放，释放失败的查的时候会校验
+	dao.releaseAll(ctx, dao.lookups(u))
+	err = dao.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("uid = ?", id).Delete(&UserIdentity{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("uid = ?", id).Delete(&UserTOTP{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("uid = ?", id).Delete(&TOTPRecoveryCode{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	if err = dao.arts.UnpublishAuthor(ctx, id); err != nil {
+		return err
+	}
+	return users.WithContext(ctx).Model(&User{}).
+		Where("id = ? AND status = ?", id, UserStatusPurging).
+		Updates(map[string]any{
+			"status": UserStatusDeleted,
+			"utime":  time.Now().UnixMilli(),
+		}).Error
+}
+
+// InitShardingTables 在所有的库里面建好分表，没有分片的表还是用 InitTables
+func InitShardingTables(s *sharding.Sharding) error {
+	if err := s.AutoMigrate(userTablePrefix, &User{}); err != nil {
+		return err
+	}
+	if err := s.AutoMigrate(lookupTablePrefix, &UserLookup{}); err != nil {
+		return err
+	}
+	return article.InitShardingTables(s)
+}
+
+// ShardingIdentityDAO 第三方账号的表没有分片，但是 users 分片了，第一次登录不能再用一个事务
+// 先插入第三方账号占住，再创建用户，创建失败了删掉第三方账号
+type ShardingIdentityDAO struct {
+	IdentityDAO
+	users UserDAO
+	gen   idgen.Generator
+}
+
+func NewShardingIdentityDAO(db *gorm.DB, users UserDAO, gen idgen.Generator) IdentityDAO {
+	return &ShardingIdentityDAO{
+		IdentityDAO: NewIdentityDAO(db, gen),
+		users:       users,
+		gen:         gen,
+	}
+}
+
+func (dao *ShardingIdentityDAO) InsertWithUser(ctx context.Context, u User, identity UserIdentity) (int64, error) {
+	id, err := dao.gen.Next()
+	if err != nil {
+		return 0, err
+	}
+	u.Id = id
+	identity.Uid = id
+	if err = dao.Insert(ctx, identity); err != nil {
+		return 0, err
+	}
+	if err = dao.users.Insert(ctx, u); err != nil {
+		_ = dao.Delete(ctx, id, identity.Provider)
+		return 0, err
+	}
+	return id, nil
+}
+
+// UserLookup 分库分表之后按照邮箱、手机号、微信找用户 ID
+type UserLookup struct {
+	Id    int64  `gorm:"primaryKey,autoIncrement"`
+	Kind  string `gorm:"type:varchar(16);uniqueIndex:idx_kind_value"`
+	Value string `gorm:"type:varchar(128);uniqueIndex:idx_kind_value"`
+	Uid   int64
+	Ctime int64
+}
@@ -0,0 +1,305 @@
+package dao
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gormMysql "gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+	"webook_go/webook/pkg/sharding"
+)
+
+func TestShardingUserDAO_Insert(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(mock sqlmock.Sqlmock)
+
+		user    User
+		wantErr error
+	}{
+		{
+			name: "插入成功",
+			mock: func(mock sqlmock.Sqlmock) {
+				// 先占用邮箱，再写分表
+				mock.ExpectExec("INSERT INTO `user_lookups_0` .*").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("INSERT INTO `users_0` .*").
+					WillReturnResult(sqlmock.NewResult(123, 1))
+			},
+			user: User{Id: 123, Email: sql.NullString{String: "123@qq.com", Valid: true}},
+		},
+		{
+			name: "邮箱被别人占用了",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("INSERT INTO `user_lookups_0` .*").
+					WillReturnError(&mysql.MySQLError{Number: 1062})
+				mock.ExpectQuery("SELECT \\* FROM `user_lookups_0` WHERE kind = \\? AND value = \\?").
+					WithArgs("email", "123@qq.com").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "kind", "value", "uid", "ctime"}).
+						AddRow(1, "email", "123@qq.com", 456, 100))
+				mock.ExpectQuery("SELECT \\* FROM `users_0` WHERE `id` = \\?").
+					WithArgs(456).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(456, "123@qq.com"))
+			},
+			user:    User{Id: 123, Email: sql.NullString{String: "123@qq.com", Valid: true}},
+			wantErr: ErrUserDuplicate,
+		},
+		{
+			name: "别人刚占用，还没写分表",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("INSERT INTO `user_lookups_0` .*").
+					WillReturnError(&mysql.MySQLError{Number: 1062})
+				mock.ExpectQuery("SELECT \\* FROM `user_lookups_0` WHERE kind = \\? AND value = \\?").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "kind", "value", "uid", "ctime"}).
+						AddRow(1, "email", "123@qq.com", 456, time.Now().UnixMilli()))
+			},
+			user:    User{Id: 123, Email: sql.NullString{String: "123@qq.com", Valid: true}},
+			wantErr: ErrUserDuplicate,
+		},
+		{
+			name: "没释放掉的脏数据，接管过来",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("INSERT INTO `user_lookups_0` .*").
+					WillReturnError(&mysql.MySQLError{Number: 1062})
+				mock.ExpectQuery("SELECT \\* FROM `user_lookups_0` WHERE kind = \\? AND value = \\?").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "kind", "value", "uid", "ctime"}).
+						AddRow(1, "email", "123@qq.com", 456, 100))
+				// 原来的用户已经换了邮箱
+				mock.ExpectQuery("SELECT \\* FROM `users_0` WHERE `id` = \\?").
+					WithArgs(456).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(456, "456@qq.com"))
+				mock.ExpectExec("UPDATE `user_lookups_0` SET `ctime`=\\?,`uid`=\\? WHERE kind = \\? AND value = \\? AND uid = \\?").
+					WithArgs(sqlmock.AnyArg(), 123, "email", "123@qq.com", 456).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO `users_0` .*").
+					WillReturnResult(sqlmock.NewResult(123, 1))
+			},
+			user: User{Id: 123, Email: sql.NullString{String: "123@qq.com", Valid: true}},
+		},
+		{
+			name: "原来的用户不存在了，并发接管被别人抢先了",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("INSERT INTO `user_lookups_0` .*").
+					WillReturnError(&mysql.MySQLError{Number: 1062})
+				mock.ExpectQuery("SELECT \\* FROM `user_lookups_0` WHERE kind = \\? AND value = \\?").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "kind", "value", "uid", "ctime"}).
+						AddRow(1, "email", "123@qq.com", 456, 100))
+				mock.ExpectQuery("SELECT \\* FROM `users_0` WHERE `id` = \\?").
+					WithArgs(456).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectExec("UPDATE `user_lookups_0` SET .* WHERE kind = \\? AND value = \\? AND uid = \\?").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			user:    User{Id: 123, Email: sql.NullString{String: "123@qq.com", Valid: true}},
+			wantErr: ErrUserDuplicate,
+		},
+		{
+			name: "写分表失败，释放邮箱",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("INSERT INTO `user_lookups_0` .*").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("INSERT INTO `users_0` .*").
+					WillReturnError(&mysql.MySQLError{Number: 1062})
+				mock.ExpectExec("DELETE FROM `user_lookups_0` WHERE kind = \\? AND value = \\? AND uid = \\?").
+					WithArgs("email", "123@qq.com", 123).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			user:    User{Id: 123, Email: sql.NullString{String: "123@qq.com", Valid: true}},
+			wantErr: ErrUserDuplicate,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, mock := newTestShardingUserDAO(t)
+			tc.mock(mock)
+			err := d.Insert(context.Background(), tc.user)
+			assert.Equal(t, tc.wantErr, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestShardingUserDAO_FindByEmail(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(mock sqlmock.Sqlmock)
+
+		wantUser User
+		wantErr  error
+	}{
+		{
+			name: "查到了",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT \\* FROM `user_lookups_0` .*").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "kind", "value", "uid"}).
+						AddRow(1, "email", "123@qq.com", 123))
+				mock.ExpectQuery("SELECT \\* FROM `users_0` WHERE `id` = \\?").
+					WithArgs(123).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(123, "123@qq.com"))
+			},
+			wantUser: User{Id: 123, Email: sql.NullString{String: "123@qq.com", Valid: true}},
+		},
+		{
+			name: "没有释放掉的脏数据",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT \\* FROM `user_lookups_0` .*").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "kind", "value", "uid"}).
+						AddRow(1, "email", "123@qq.com", 123))
+				// 用户已经换了邮箱
+				mock.ExpectQuery("SELECT \\* FROM `users_0` .*").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow(123, "456@qq.com"))
+			},
+			wantErr: ErrUserNotFound,
+		},
+		{
+			name: "没有这个邮箱",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT \\* FROM `user_lookups_0` .*").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "kind", "value", "uid"}))
+			},
+			wantErr: ErrUserNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, mock := newTestShardingUserDAO(t)
+			tc.mock(mock)
+			u, err := d.FindByEmail(context.Background(), "123@qq.com")
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantUser, u)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestShardingUserDAO_Anonymize(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(mock sqlmock.Sqlmock)
+		// unpublishErr 下线文章的错误
+		unpublishErr error
+
+		wantErr error
+	}{
+		{
+			name: "注销成功",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT \\* FROM `users_0` .*").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(123, UserStatusDeleting))
+				mock.ExpectExec("UPDATE `users_0` SET .*`status`=\\?.* WHERE id = \\? AND status IN \\(\\?, \\?\\)").
+					WithArgs("", "", "", nil, "", "", nil, "",
+						UserStatusPurging, sqlmock.AnyArg(), nil, nil, 123, UserStatusDeleting, UserStatusPurging).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				expectDeleteUserAuth(mock)
+				// 全部成功了才改成已注销
+				mock.ExpectExec("UPDATE `users_0` SET `status`=\\?,`utime`=\\? WHERE id = \\? AND status = \\?").
+					WithArgs(UserStatusDeleted, sqlmock.AnyArg(), 123, UserStatusPurging).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name: "下线文章失败，还是注销中",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT \\* FROM `users_0` .*").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(123, UserStatusPurging))
+				mock.ExpectExec("UPDATE `users_0` SET .*").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				expectDeleteUserAuth(mock)
+			},
+			unpublishErr: errors.New("数据库错误"),
+			wantErr:      errors.New("数据库错误"),
+		},
+		{
+			name: "已经撤销了",
+			mock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT \\* FROM `users_0` .*").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(123, UserStatusActive))
+				mock.ExpectExec("UPDATE `users_0` SET .*").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantErr: ErrUserNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, mock := newTestShardingUserDAO(t)
+			d.(*ShardingUserDAO).arts = &stubAuthorArticleDAO{unpublishErr: tc.unpublishErr}
+			tc.mock(mock)
+			err := d.Anonymize(context.Background(), 123)
+			assert.Equal(t, tc.wantErr, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestShardingUserDAO_FindBanned(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	db, err := gorm.Open(gormMysql.New(gormMysql.Config{
+		Conn:                      mockDB,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	require.NoError(t, err)
+	// 两张分表是并发查的，顺序不确定
+	mock.MatchExpectationsInOrder(false)
+	mock.ExpectQuery("SELECT \\* FROM `users_0` WHERE banned_at > 0 AND banned_at < \\? ORDER BY banned_at DESC LIMIT 2").
+		WithArgs(5000).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "banned_at"}).AddRow(2, 4000).AddRow(4, 1000))
+	mock.ExpectQuery("SELECT \\* FROM `users_1` WHERE banned_at > 0 AND banned_at < \\? ORDER BY banned_at DESC LIMIT 2").
+		WithArgs(5000).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "banned_at"}).AddRow(1, 3000).AddRow(3, 2000))
+	d := NewShardingUserDAO(sharding.NewSharding([]*gorm.DB{db}, 2), db, nil, nil)
+
+	users, err := d.FindBanned(context.Background(), 5000, 2)
+	require.NoError(t, err)
+	// 合在一起之后取最近封禁的两个
+	assert.Equal(t, []User{{Id: 2, BannedAt: 4000}, {Id: 1, BannedAt: 3000}}, users)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func expectDeleteUserAuth(mock sqlmock.Sqlmock) {
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `user_identities` .*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM `user_totps` .*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM `totp_recovery_codes` .*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+}
+
+type stubAuthorArticleDAO struct {
+	unpublishErr error
+}
+
+func (s *stubAuthorArticleDAO) TransferAuthor(ctx context.Context, from, to int64) error {
+	return nil
+}
+
+func (s *stubAuthorArticleDAO) UnpublishAuthor(ctx context.Context, author int64) error {
+	return s.unpublishErr
+}
+
+// newTestShardingUserDAO 只有一个库一张表，表名是确定的
+func newTestShardingUserDAO(t *testing.T) (UserDAO, sqlmock.Sqlmock) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	db, err := gorm.Open(gormMysql.New(gormMysql.Config{
+		Conn:                      mockDB,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	require.NoError(t, err)
+	return NewShardingUserDAO(sharding.NewSharding([]*gorm.DB{db}, 1), db, nil, nil), mock
+}
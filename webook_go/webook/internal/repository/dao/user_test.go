@@ -8,9 +8,14 @@ import (
 	"github.com/go-sql-driver/mysql"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
 	gormMysql "gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"testing"
+	"webook_go/webook/internal/repository/dao/article"
+	artdaomocks "webook_go/webook/internal/repository/dao/article/mocks"
+	"webook_go/webook/pkg/logger"
+	"webook_go/webook/pkg/migrator"
 )
 
 func TestGORMUserDAO_Insert(t *testing.T) {
@@ -85,7 +90,7 @@ func TestGORMUserDAO_Insert(t *testing.T) {
 				DisableAutomaticPing:   true,
 				SkipDefaultTransaction: true,
 			})
-			d := NewUserDAO(db)
+			d := NewUserDAO(db, nil, nil)
 			u := tc.user
 			err = d.Insert(tc.ctx, u)
 			assert.Equal(t, tc.wantErr, err)
@@ -100,3 +105,136 @@ func TestGORMUserDAO_Insert(t *testing.T) {
 		// COMMIT;
 	}
 }
+
+func TestGORMUserDAO_UpdateProfile(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(t *testing.T) *sql.DB
+
+		wantUser User
+		wantErr  error
+	}{
+		{
+			name: "更新成功",
+			mock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectBegin()
+				// 只更新传进来的列，不会把整行写回去
+				mock.ExpectExec("UPDATE `users` SET `nickname`=\\?,`utime`=\\? WHERE id = \\?").
+					WithArgs("大明", sqlmock.AnyArg(), 123).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				rows := sqlmock.NewRows([]string{"id", "nickname", "about_me"}).
+					AddRow(123, "大明", "原来的")
+				mock.ExpectQuery("SELECT \\* FROM `users` WHERE id = \\?").WillReturnRows(rows)
+				mock.ExpectCommit()
+				return mockDB
+			},
+			wantUser: User{Id: 123, Nickname: "大明", AboutMe: "原来的"},
+		},
+		{
+			name: "用户不存在",
+			mock: func(t *testing.T) *sql.DB {
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE `users` .*").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+				return mockDB
+			},
+			wantErr: ErrUserNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, err := gorm.Open(gormMysql.New(gormMysql.Config{
+				Conn:                      tc.mock(t),
+				SkipInitializeWithVersion: true,
+			}), &gorm.Config{
+				DisableAutomaticPing:   true,
+				SkipDefaultTransaction: true,
+			})
+			require.NoError(t, err)
+			d := NewUserDAO(db, nil, nil)
+			u, err := d.UpdateProfile(context.Background(), 123, map[string]any{"nickname": "大明"})
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantUser, u)
+		})
+	}
+}
+
+// TestGORMUserDAO_DoubleWriteArticles 合并、注销账号的时候文章通过双写改，MongoDB 那边也要改到
+func TestGORMUserDAO_DoubleWriteArticles(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	db, err := gorm.Open(gormMysql.New(gormMysql.Config{
+		Conn:                      mockDB,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	require.NoError(t, err)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	src := artdaomocks.NewMockArticleDAO(ctrl)
+	dst := artdaomocks.NewMockArticleDAO(ctrl)
+	arts := article.NewDoubleWriteDAO(src, dst, func() string {
+		return string(migrator.PatternDstFirst)
+	}, &logger.NopLogger{})
+	d := NewUserDAO(db, nil, arts)
+
+	// 合并：用户的事务里面不改文章表，提交之后两边都转给新作者
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT \\* FROM `users` WHERE id = \\?").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "phone"}).AddRow(1, "15212345678"))
+	mock.ExpectQuery("SELECT \\* FROM `users` WHERE id = \\?").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectExec("UPDATE `users` SET .* WHERE id = \\? AND status <> \\?").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE `users` SET .* WHERE id = \\?").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE `user_identities` .*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM `user_totps` .*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM `totp_recovery_codes` .*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	gomock.InOrder(
+		dst.EXPECT().TransferAuthor(gomock.Any(), int64(1), int64(2)).Return(nil),
+		src.EXPECT().TransferAuthor(gomock.Any(), int64(1), int64(2)).Return(nil),
+	)
+	require.NoError(t, d.Merge(context.Background(), 1, 2))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// 注销：文章下线失败了还是注销中，下一轮接着做
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `users` SET .* WHERE id = \\? AND status IN \\(\\?, \\?\\)").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectDeleteUserAuthInTx(mock)
+	dst.EXPECT().UnpublishAuthor(gomock.Any(), int64(1)).Return(errors.New("mongo 错误"))
+	assert.Equal(t, errors.New("mongo 错误"), d.Anonymize(context.Background(), 1))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// 两边都下线了才改成已注销
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE `users` SET .* WHERE id = \\? AND status IN \\(\\?, \\?\\)").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectDeleteUserAuthInTx(mock)
+	gomock.InOrder(
+		dst.EXPECT().UnpublishAuthor(gomock.Any(), int64(1)).Return(nil),
+		src.EXPECT().UnpublishAuthor(gomock.Any(), int64(1)).Return(nil),
+	)
+	mock.ExpectExec("UPDATE `users` SET `status`=\\?,`utime`=\\? WHERE id = \\? AND status = \\?").
+		WithArgs(UserStatusDeleted, sqlmock.AnyArg(), 1, UserStatusPurging).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, d.Anonymize(context.Background(), 1))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// expectDeleteUserAuthInTx 和 expectDeleteUserAuth 一样，但是在外面已经开了的事务里面
+func expectDeleteUserAuthInTx(mock sqlmock.Sqlmock) {
+	mock.ExpectExec("DELETE FROM `user_identities` .*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM `user_totps` .*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM `totp_recovery_codes` .*").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+}
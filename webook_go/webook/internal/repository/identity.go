@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/repository/dao"
+)
+
+var (
+	ErrIdentityDuplicate = dao.ErrIdentityDuplicate
+	ErrIdentityNotFound  = dao.ErrIdentityNotFound
+)
+
+type IdentityRepository interface {
+	FindByProvider(ctx context.Context, provider, subject string) (domain.Identity, error)
+	FindByUid(ctx context.Context, uid int64) ([]domain.Identity, error)
+	Create(ctx context.Context, identity domain.Identity) error
+	UpdateToken(ctx context.Context, identity domain.Identity) error
+	// FindExpiring 这些平台上 before 之前过期、还有 refresh_token 的
+	FindExpiring(ctx context.Context, providers []string, before time.Time, limit int) ([]domain.Identity, error)
+	Delete(ctx context.Context, uid int64, provider string) error
+	// CreateWithUser 用第三方账号注册一个新用户，返回用户 ID
+	CreateWithUser(ctx context.Context, identity domain.Identity) (int64, error)
+}
+
+// GORMIdentityRepository 第三方账号只在登录的时候查一次，不需要缓存
+type GORMIdentityRepository struct {
+	dao dao.IdentityDAO
+}
+
+func NewIdentityRepository(dao dao.IdentityDAO) IdentityRepository {
+	return &GORMIdentityRepository{
+		dao: dao,
+	}
+}
+
+func (repo *GORMIdentityRepository) FindByProvider(ctx context.Context, provider, subject string) (domain.Identity, error) {
+	i, err := repo.dao.FindByProvider(ctx, provider, subject)
+	if err != nil {
+		return domain.Identity{}, err
+	}
+	return repo.toDomain(i), nil
+}
+
+func (repo *GORMIdentityRepository) FindByUid(ctx context.Context, uid int64) ([]domain.Identity, error) {
+	ids, err := repo.dao.FindByUid(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.Identity, 0, len(ids))
+	for _, i := range ids {
+		res = append(res, repo.toDomain(i))
+	}
+	return res, nil
+}
+
+func (repo *GORMIdentityRepository) Create(ctx context.Context, identity domain.Identity) error {
+	return repo.dao.Insert(ctx, repo.toEntity(identity))
+}
+
+func (repo *GORMIdentityRepository) UpdateToken(ctx context.Context, identity domain.Identity) error {
+	return repo.dao.UpdateToken(ctx, repo.toEntity(identity))
+}
+
+func (repo *GORMIdentityRepository) FindExpiring(ctx context.Context, providers []string,
+	before time.Time, limit int) ([]domain.Identity, error) {
+	ids, err := repo.dao.FindExpiring(ctx, providers, before.UnixMilli(), limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.Identity, 0, len(ids))
+	for _, i := range ids {
+		res = append(res, repo.toDomain(i))
+	}
+	return res, nil
+}
+
+func (repo *GORMIdentityRepository) Delete(ctx context.Context, uid int64, provider string) error {
+	return repo.dao.Delete(ctx, uid, provider)
+}
+
+func (repo *GORMIdentityRepository) CreateWithUser(ctx context.Context, identity domain.Identity) (int64, error) {
+	// 第三方给的邮箱不直接写进账号，不然会占掉别人的邮箱，绑定邮箱要自己验证
+	return repo.dao.InsertWithUser(ctx, dao.User{
+		Nickname: identity.Nickname,
+		Avatar:   identity.Avatar,
+	}, repo.toEntity(identity))
+}
+
+func (repo *GORMIdentityRepository) toDomain(i dao.UserIdentity) domain.Identity {
+	res := domain.Identity{
+		Uid:          i.Uid,
+		Provider:     i.Provider,
+		Subject:      i.Subject,
+		UnionID:      i.UnionID,
+		AccessToken:  i.AccessToken,
+		RefreshToken: i.RefreshToken,
+	}
+	if i.TokenExpiresAt > 0 {
+		res.TokenExpiresAt = time.UnixMilli(i.TokenExpiresAt)
+	}
+	return res
+}
+
+func (repo *GORMIdentityRepository) toEntity(i domain.Identity) dao.UserIdentity {
+	res := dao.UserIdentity{
+		Uid:          i.Uid,
+		Provider:     i.Provider,
+		Subject:      i.Subject,
+		UnionID:      i.UnionID,
+		AccessToken:  i.AccessToken,
+		RefreshToken: i.RefreshToken,
+	}
+	if !i.TokenExpiresAt.IsZero() {
+		res.TokenExpiresAt = i.TokenExpiresAt.UnixMilli()
+	}
+	return res
+}
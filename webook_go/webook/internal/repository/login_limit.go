@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"webook_go/webook/internal/repository/cache"
+)
+
+var (
+	ErrLoginLocked      = cache.ErrLoginLocked
+	ErrLoginTooFrequent = cache.ErrLoginTooFrequent
+	ErrLoginIPLimit     = cache.ErrLoginIPLimit
+)
+
+type LoginLimitRepository interface {
+	Attempt(ctx context.Context, account, ip string) error
+	Failed(ctx context.Context, account string) error
+	Succeeded(ctx context.Context, account, ip string) error
+	Reset(ctx context.Context, account string) error
+}
+
+type CacheLoginLimitRepository struct {
+	cache cache.LoginLimitCache
+}
+
+func NewLoginLimitRepository(c cache.LoginLimitCache) LoginLimitRepository {
+	return &CacheLoginLimitRepository{
+		cache: c,
+	}
+}
+
+func (repo *CacheLoginLimitRepository) Attempt(ctx context.Context, account, ip string) error {
+	return repo.cache.Attempt(ctx, account, ip)
+}
+
+func (repo *CacheLoginLimitRepository) Failed(ctx context.Context, account string) error {
+	return repo.cache.Failed(ctx, account)
+}
+
+func (repo *CacheLoginLimitRepository) Succeeded(ctx context.Context, account, ip string) error {
+	return repo.cache.Succeeded(ctx, account, ip)
+}
+
+func (repo *CacheLoginLimitRepository) Reset(ctx context.Context, account string) error {
+	return repo.cache.Reset(ctx, account)
+}
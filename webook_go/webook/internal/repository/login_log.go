@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/repository/dao"
+)
+
+type LoginLogRepository interface {
+	Create(ctx context.Context, l domain.LoginLog) error
+	FindByUid(ctx context.Context, uid int64, offset, limit int) ([]domain.LoginLog, error)
+}
+
+type GORMLoginLogRepository struct {
+	dao dao.LoginLogDAO
+}
+
+func NewLoginLogRepository(dao dao.LoginLogDAO) LoginLogRepository {
+	return &GORMLoginLogRepository{
+		dao: dao,
+	}
+}
+
+func (repo *GORMLoginLogRepository) Create(ctx context.Context, l domain.LoginLog) error {
+	return repo.dao.Insert(ctx, dao.LoginLog{
+		Uid:       l.Uid,
+		Method:    l.Method,
+		IP:        l.IP,
+		UserAgent: l.UserAgent,
+		Ctime:     l.Ctime.UnixMilli(),
+	})
+}
+
+func (repo *GORMLoginLogRepository) FindByUid(ctx context.Context, uid int64, offset, limit int) ([]domain.LoginLog, error) {
+	logs, err := repo.dao.FindByUid(ctx, uid, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.LoginLog, 0, len(logs))
+	for _, l := range logs {
+		res = append(res, domain.LoginLog{
+			Id:        l.Id,
+			Uid:       l.Uid,
+			Method:    l.Method,
+			IP:        l.IP,
+			UserAgent: l.UserAgent,
+			Ctime:     time.UnixMilli(l.Ctime),
+		})
+	}
+	return res, nil
+}
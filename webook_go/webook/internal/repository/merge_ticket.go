@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"context"
+	"webook_go/webook/internal/repository/cache"
+)
+
+var ErrMergeTicketInvalid = cache.ErrMergeTicketInvalid
+
+type MergeTicketRepository interface {
+	Set(ctx context.Context, ticket string, from, to int64) error
+	Take(ctx context.Context, ticket string) (from int64, to int64, err error)
+}
+
+type CacheMergeTicketRepository struct {
+	cache cache.MergeTicketCache
+}
+
+func NewMergeTicketRepository(c cache.MergeTicketCache) MergeTicketRepository {
+	return &CacheMergeTicketRepository{
+		cache: c,
+	}
+}
+
+func (repo *CacheMergeTicketRepository) Set(ctx context.Context, ticket string, from, to int64) error {
+	return repo.cache.Set(ctx, ticket, from, to)
+}
+
+func (repo *CacheMergeTicketRepository) Take(ctx context.Context, ticket string) (int64, int64, error) {
+	return repo.cache.Take(ctx, ticket)
+}
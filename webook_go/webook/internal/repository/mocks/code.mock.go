@@ -11,6 +11,7 @@ package repomocks
 import (
 	context "context"
 	reflect "reflect"
+	domain "webook_go/webook/internal/domain"
 
 	gomock "go.uber.org/mock/gomock"
 )
@@ -39,17 +40,17 @@ func (m *MockCodeRepository) EXPECT() *MockCodeRepositoryMockRecorder {
 }
 
 // Store mocks base method.
-func (m *MockCodeRepository) Store(ctx context.Context, biz, phone, code string) error {
+func (m *MockCodeRepository) Store(ctx context.Context, biz, phone, code string, meta domain.CodeSendMeta) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Store", ctx, biz, phone, code)
+	ret := m.ctrl.Call(m, "Store", ctx, biz, phone, code, meta)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Store indicates an expected call of Store.
-func (mr *MockCodeRepositoryMockRecorder) Store(ctx, biz, phone, code any) *gomock.Call {
+func (mr *MockCodeRepositoryMockRecorder) Store(ctx, biz, phone, code, meta any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Store", reflect.TypeOf((*MockCodeRepository)(nil).Store), ctx, biz, phone, code)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Store", reflect.TypeOf((*MockCodeRepository)(nil).Store), ctx, biz, phone, code, meta)
 }
 
 // Verify mocks base method.
@@ -0,0 +1,95 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: D:\gopath\src\webook_go\webook\internal\repository\login_limit.go
+//
+// Generated by this command:
+//
+//	mockgen.exe -source=D:\gopath\src\webook_go\webook\internal\repository\login_limit.go -package=repomocks -destination=D:\gopath\src\webook_go\webook\internal\repository\mocks\login_limit.mock.go
+//
+// Package repomocks is a generated GoMock package.
+package repomocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockLoginLimitRepository is a mock of LoginLimitRepository interface.
+type MockLoginLimitRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockLoginLimitRepositoryMockRecorder
+}
+
+// MockLoginLimitRepositoryMockRecorder is the mock recorder for MockLoginLimitRepository.
+type MockLoginLimitRepositoryMockRecorder struct {
+	mock *MockLoginLimitRepository
+}
+
+// NewMockLoginLimitRepository creates a new mock instance.
+func NewMockLoginLimitRepository(ctrl *gomock.Controller) *MockLoginLimitRepository {
+	mock := &MockLoginLimitRepository{ctrl: ctrl}
+	mock.recorder = &MockLoginLimitRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLoginLimitRepository) EXPECT() *MockLoginLimitRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Attempt mocks base method.
+func (m *MockLoginLimitRepository) Attempt(ctx context.Context, account, ip string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Attempt", ctx, account, ip)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Attempt indicates an expected call of Attempt.
+func (mr *MockLoginLimitRepositoryMockRecorder) Attempt(ctx, account, ip any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Attempt", reflect.TypeOf((*MockLoginLimitRepository)(nil).Attempt), ctx, account, ip)
+}
+
+// Failed mocks base method.
+func (m *MockLoginLimitRepository) Failed(ctx context.Context, account string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Failed", ctx, account)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Failed indicates an expected call of Failed.
+func (mr *MockLoginLimitRepositoryMockRecorder) Failed(ctx, account any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Failed", reflect.TypeOf((*MockLoginLimitRepository)(nil).Failed), ctx, account)
+}
+
+// Reset mocks base method.
+func (m *MockLoginLimitRepository) Reset(ctx context.Context, account string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reset", ctx, account)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Reset indicates an expected call of Reset.
+func (mr *MockLoginLimitRepositoryMockRecorder) Reset(ctx, account any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reset", reflect.TypeOf((*MockLoginLimitRepository)(nil).Reset), ctx, account)
+}
+
+// Succeeded mocks base method.
+func (m *MockLoginLimitRepository) Succeeded(ctx context.Context, account, ip string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Succeeded", ctx, account, ip)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Succeeded indicates an expected call of Succeeded.
+func (mr *MockLoginLimitRepositoryMockRecorder) Succeeded(ctx, account, ip any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Succeeded", reflect.TypeOf((*MockLoginLimitRepository)(nil).Succeeded), ctx, account, ip)
+}
@@ -0,0 +1,69 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: D:\gopath\src\webook_go\webook\internal\repository\login_log.go
+//
+// Generated by this command:
+//
+//	mockgen.exe -source=D:\gopath\src\webook_go\webook\internal\repository\login_log.go -package=repomocks -destination=D:\gopath\src\webook_go\webook\internal\repository\mocks\login_log.mock.go
+//
+// Package repomocks is a generated GoMock package.
+package repomocks
+
+import (
+	context "context"
+	reflect "reflect"
+	domain "webook_go/webook/internal/domain"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockLoginLogRepository is a mock of LoginLogRepository interface.
+type MockLoginLogRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockLoginLogRepositoryMockRecorder
+}
+
+// MockLoginLogRepositoryMockRecorder is the mock recorder for MockLoginLogRepository.
+type MockLoginLogRepositoryMockRecorder struct {
+	mock *MockLoginLogRepository
+}
+
+// NewMockLoginLogRepository creates a new mock instance.
+func NewMockLoginLogRepository(ctrl *gomock.Controller) *MockLoginLogRepository {
+	mock := &MockLoginLogRepository{ctrl: ctrl}
+	mock.recorder = &MockLoginLogRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLoginLogRepository) EXPECT() *MockLoginLogRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockLoginLogRepository) Create(ctx context.Context, l domain.LoginLog) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, l)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockLoginLogRepositoryMockRecorder) Create(ctx, l any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockLoginLogRepository)(nil).Create), ctx, l)
+}
+
+// FindByUid mocks base method.
+func (m *MockLoginLogRepository) FindByUid(ctx context.Context, uid int64, offset, limit int) ([]domain.LoginLog, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindByUid", ctx, uid, offset, limit)
+	ret0, _ := ret[0].([]domain.LoginLog)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindByUid indicates an expected call of FindByUid.
+func (mr *MockLoginLogRepositoryMockRecorder) FindByUid(ctx, uid, offset, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindByUid", reflect.TypeOf((*MockLoginLogRepository)(nil).FindByUid), ctx, uid, offset, limit)
+}
@@ -0,0 +1,69 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: D:\gopath\src\webook_go\webook\internal\repository\merge_ticket.go
+//
+// Generated by this command:
+//
+//	mockgen.exe -source=D:\gopath\src\webook_go\webook\internal\repository\merge_ticket.go -package=repomocks -destination=D:\gopath\src\webook_go\webook\internal\repository\mocks\merge_ticket.mock.go
+//
+// Package repomocks is a generated GoMock package.
+package repomocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockMergeTicketRepository is a mock of MergeTicketRepository interface.
+type MockMergeTicketRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockMergeTicketRepositoryMockRecorder
+}
+
+// MockMergeTicketRepositoryMockRecorder is the mock recorder for MockMergeTicketRepository.
+type MockMergeTicketRepositoryMockRecorder struct {
+	mock *MockMergeTicketRepository
+}
+
+// NewMockMergeTicketRepository creates a new mock instance.
+func NewMockMergeTicketRepository(ctrl *gomock.Controller) *MockMergeTicketRepository {
+	mock := &MockMergeTicketRepository{ctrl: ctrl}
+	mock.recorder = &MockMergeTicketRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMergeTicketRepository) EXPECT() *MockMergeTicketRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Set mocks base method.
+func (m *MockMergeTicketRepository) Set(ctx context.Context, ticket string, from, to int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Set", ctx, ticket, from, to)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Set indicates an expected call of Set.
+func (mr *MockMergeTicketRepositoryMockRecorder) Set(ctx, ticket, from, to any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockMergeTicketRepository)(nil).Set), ctx, ticket, from, to)
+}
+
+// Take mocks base method.
+func (m *MockMergeTicketRepository) Take(ctx context.Context, ticket string) (int64, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Take", ctx, ticket)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Take indicates an expected call of Take.
+func (mr *MockMergeTicketRepositoryMockRecorder) Take(ctx, ticket any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Take", reflect.TypeOf((*MockMergeTicketRepository)(nil).Take), ctx, ticket)
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/repository/dao"
+)
+
+var ErrTOTPNotFound = dao.ErrTOTPNotFound
+
+type TOTPRepository interface {
+	SaveSecret(ctx context.Context, uid int64, secret string) error
+	FindByUid(ctx context.Context, uid int64) (domain.TOTP, error)
+	Enable(ctx context.Context, uid int64, codeHashes []string) error
+	Delete(ctx context.Context, uid int64) error
+	UseStep(ctx context.Context, uid int64, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, uid int64, codeHash string) (bool, error)
+}
+
+// GORMTOTPRepository 两步验证只有登录的时候用，不需要缓存
+type GORMTOTPRepository struct {
+	dao dao.TOTPDAO
+}
+
+func NewTOTPRepository(dao dao.TOTPDAO) TOTPRepository {
+	return &GORMTOTPRepository{
+		dao: dao,
+	}
+}
+
+func (repo *GORMTOTPRepository) SaveSecret(ctx context.Context, uid int64, secret string) error {
+	return repo.dao.SaveSecret(ctx, uid, secret)
+}
+
+func (repo *GORMTOTPRepository) FindByUid(ctx context.Context, uid int64) (domain.TOTP, error) {
+	t, err := repo.dao.FindByUid(ctx, uid)
+	if err != nil {
+		return domain.TOTP{}, err
+	}
+	return domain.TOTP{
+		Uid:     t.Uid,
+		Secret:  t.Secret,
+		Enabled: t.Enabled,
+	}, nil
+}
+
+func (repo *GORMTOTPRepository) Enable(ctx context.Context, uid int64, codeHashes []string) error {
+	return repo.dao.Enable(ctx, uid, codeHashes)
+}
+
+func (repo *GORMTOTPRepository) Delete(ctx context.Context, uid int64) error {
+	return repo.dao.Delete(ctx, uid)
+}
+
+func (repo *GORMTOTPRepository) UseStep(ctx context.Context, uid int64, step int64) (bool, error) {
+	return repo.dao.UseStep(ctx, uid, step)
+}
+
+func (repo *GORMTOTPRepository) UseRecoveryCode(ctx context.Context, uid int64, codeHash string) (bool, error) {
+	return repo.dao.UseRecoveryCode(ctx, uid, codeHash)
+}
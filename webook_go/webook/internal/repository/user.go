@@ -3,36 +3,102 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/sync/singleflight"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 	"webook_go/webook/internal/domain"
 	"webook_go/webook/internal/repository/cache"
 	"webook_go/webook/internal/repository/dao"
+	"webook_go/webook/pkg/degrade"
+	"webook_go/webook/pkg/gormx"
 )
 
 var ErrUserDuplicate = dao.ErrUserDuplicate
 var ErrUserNotFound = dao.ErrUserNotFound
 var ErrCodeVerifyTooManyTimes = cache.ErrCodeVerifyTooManyTimes
 
+// ErrDegraded 系统降级了，比如 Redis 挂了之后，查数据库的请求太多了
+var ErrDegraded = errors.New("系统降级")
+
 type UserRepository interface {
 	FindById(ctx context.Context, id int64) (domain.User, error)
 	Create(ctx context.Context, u domain.User) error
 	FindByEmail(ctx context.Context, email string) (domain.User, error)
 	FindByPhone(ctx context.Context, phone string) (domain.User, error)
-	Edit(ctx context.Context, id int64, Nickname, Birthday, AboutMe string) (domain.User, error)
+	// UpdateProfile 只更新传了的字段，返回更新之后完整的用户信息
+	UpdateProfile(ctx context.Context, id int64, upd domain.ProfileUpdate) (domain.User, error)
 	Profile(ctx context.Context, id int64) (domain.User, error)
 	FindByWechat(ctx context.Context, openID string) (domain.User, error)
+	Activate(ctx context.Context, id int64) (bool, error)
+	// UpdatePassword password 是加密之后的
+	UpdatePassword(ctx context.Context, id int64, password string) error
+	UpdateRoles(ctx context.Context, id int64, roles []domain.Role) error
+	// UpdatePhone phone 为空代表解绑
+	UpdatePhone(ctx context.Context, id int64, phone string) error
+	// UpdateEmail email 为空代表解绑
+	UpdateEmail(ctx context.Context, id int64, email string) error
+	ClearWechat(ctx context.Context, id int64) error
+	// Merge 把 from 合并到 to 里面
+	Merge(ctx context.Context, from, to int64) error
+	// FindByIdWithPassword 不走缓存，要校验密码的时候用
+	FindByIdWithPassword(ctx context.Context, id int64) (domain.User, error)
+	// RequestDeletion 申请注销，到了 deleteAt 才真正删除
+	RequestDeletion(ctx context.Context, id int64, deleteAt time.Time) error
+	CancelDeletion(ctx context.Context, id int64) error
+	// FindDeletable 冷静期已经过了，可以真正删除的用户 ID
+	FindDeletable(ctx context.Context, now time.Time, limit int) ([]int64, error)
+	Anonymize(ctx context.Context, id int64) error
+	// UpdateBan bannedAt 为零值代表解封
+	UpdateBan(ctx context.Context, id int64, bannedAt time.Time, reason string) error
+	// FindBanned 封禁时间早于 before 的用户，最近封禁的在前面，不走缓存
+	FindBanned(ctx context.Context, before time.Time, limit int) ([]domain.User, error)
+}
+
+// UserCacheConfig 缓存和数据库一致性的配置
+type UserCacheConfig struct {
+	// DoubleDeleteDelay 延迟双删：更新数据库之后马上删一次缓存，过了这么久再删一次
+	// 防止并发的查询在两次操作之间把旧数据写回缓存，0 代表不开启
+	DoubleDeleteDelay time.Duration
+	// DegradeConcurrency Redis 不可用的时候，最多允许这么多个请求同时查数据库
+	// 超过的直接返回 ErrDegraded，不然所有请求都打到 MySQL 上会把它也打挂，0 代表不限制
+	DegradeConcurrency int64
+	// PrimaryAfterWrite 读写分离的时候，更新之后这么久里面查这个用户都走主库，防止从库延迟把旧数据写回缓存
+	// 只在本实例生效，别的实例靠延迟双删兜底，0 代表不开启
+	PrimaryAfterWrite time.Duration
 }
 
+// CacheUserRepository 用的是 cache-aside：
+// 读的时候缓存没有就查数据库再写缓存，写的时候先更新数据库再删缓存
+// FindById 返回的用户不带密码，要校验密码的只能用 FindByEmail 和 FindByPhone
 type CacheUserRepository struct {
 	dao   dao.UserDAO
 	cache cache.UserCache
+	cfg   UserCacheConfig
+	// sf 同一个用户缓存失效的时候，并发的请求只有一个会去查数据库
+	sf singleflight.Group
+	// fallback Redis 不可用的时候限制查数据库的并发，nil 代表不限制
+	fallback *semaphore.Weighted
+	// degraded 是不是本实例因为查数据库的请求太多打开了全局降级
+	degraded atomic.Bool
+	// recentWrites 最近更新过的用户 ID，值是到什么时候为止要读主库
+	recentWrites sync.Map
 }
 
-func NewUserRepository(dao dao.UserDAO, c cache.UserCache) UserRepository {
-	return &CacheUserRepository{
+func NewUserRepository(dao dao.UserDAO, c cache.UserCache, cfg UserCacheConfig) UserRepository {
+	r := &CacheUserRepository{
 		dao:   dao,
 		cache: c,
+		cfg:   cfg,
+	}
+	if cfg.DegradeConcurrency > 0 {
+		r.fallback = semaphore.NewWeighted(cfg.DegradeConcurrency)
 	}
+	return r
 }
 
 func (r *CacheUserRepository) FindByWechat(ctx context.Context, openID string) (domain.User, error) {
@@ -44,52 +110,222 @@ func (r *CacheUserRepository) FindByWechat(ctx context.Context, openID string) (
 }
 
 func (r *CacheUserRepository) FindById(ctx context.Context, id int64) (domain.User, error) {
-	// 先从 cache 里面找
-	// 再从 dao 里面找
-	// 注册后 domain.user 的值就是数据库的 User 的，所以 redis 直接返回 domain.User 就是有值的
-	// redis 就是缓存，有没有数据只有自己知道
 	u, err := r.cache.Get(ctx, id)
-	if err == nil {
-		// 必然有数据
+	switch err {
+	case nil:
+		r.restore()
 		return u, nil
+	case cache.ErrUserNotExist:
+		r.restore()
+		return domain.User{}, ErrUserNotFound
+	case cache.ErrKeyNotExist:
+		r.restore()
+	default:
+		// Redis 出问题了，限制一下查数据库的并发
+		return r.degradedLoad(id)
 	}
-	// 没这个数据
-	if err == cache.ErrKeyNotExist {
-		//去数据库里面加载
+	return r.doLoad(id, true)
+}
+
+// restore Redis 恢复了，关掉本实例打开的降级
+// 手动打开的降级不归这里管
+func (r *CacheUserRepository) restore() {
+	if r.degraded.CompareAndSwap(true, false) {
+		degrade.Set(false)
 	}
-	ue, err := r.dao.FindById(ctx, id)
+}
+
+// degradedLoad Redis 不可用的时候查数据库，也不回写缓存了
+func (r *CacheUserRepository) degradedLoad(id int64) (domain.User, error) {
+	if r.fallback != nil {
+		if !r.fallback.TryAcquire(1) {
+			// 数据库也快扛不住了，打开全局降级，让非核心的功能先停掉
+			if r.degraded.CompareAndSwap(false, true) {
+				degrade.Set(true)
+			}
+			return domain.User{}, ErrDegraded
+		}
+		defer r.fallback.Release(1)
+	}
+	return r.doLoad(id, false)
+}
+
+func (r *CacheUserRepository) doLoad(id int64, writeCache bool) (domain.User, error) {
+	key := r.sfKey(id)
+	if !writeCache {
+		// 和正常的查询分开，不然正常的查询会等着降级的结果
+		key = "degraded:" + key
+	}
+	val, err, _ := r.sf.Do(key, func() (any, error) {
+		return r.load(id, writeCache)
+	})
 	if err != nil {
 		return domain.User{}, err
 	}
+	return val.(domain.User), nil
+}
 
-	u = r.entityToDomain(ue)
-
-	//_ = r.cache.Set(ctx, u)
-	//if err != nil {
-	//	// 我这里怎么办？
-	//	// 打日志，做监控
-	//	//return domain.User{}, err
-	//}
-	go func() {
+// load 查数据库并且回写缓存
+// 是好几个请求共用的，不能用其中某一个请求的 ctx，不然它被取消了，其他请求也跟着失败
+func (r *CacheUserRepository) load(id int64, writeCache bool) (domain.User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	ue, err := r.dao.FindById(r.readCtx(ctx, id), id)
+	if err == dao.ErrUserNotFound {
+		if writeCache {
+			_ = r.cache.SetNotExist(ctx, id)
+		}
+		return domain.User{}, err
+	}
+	if err != nil {
+		return domain.User{}, err
+	}
+	u := r.entityToDomain(ue)
+	u.Password = ""
+	if writeCache {
+		// 写缓存失败了也没关系，下次再查数据库
 		_ = r.cache.Set(ctx, u)
-	}()
+	}
 	return u, nil
 }
 
+func (r *CacheUserRepository) sfKey(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+// readCtx 刚更新过的用户要读主库
+func (r *CacheUserRepository) readCtx(ctx context.Context, id int64) context.Context {
+	val, ok := r.recentWrites.Load(id)
+	if !ok {
+		return ctx
+	}
+	if time.Now().UnixMilli() > val.(int64) {
+		r.recentWrites.CompareAndDelete(id, val)
+		return ctx
+	}
+	return gormx.WithPrimary(ctx)
+}
+
+// invalidate 更新数据库之后调用，开启了延迟双删的话过一会再删一次
+func (r *CacheUserRepository) invalidate(ctx context.Context, ids ...int64) error {
+	if r.cfg.PrimaryAfterWrite > 0 {
+		deadline := time.Now().Add(r.cfg.PrimaryAfterWrite).UnixMilli()
+		for _, id := range ids {
+			r.recentWrites.Store(id, deadline)
+		}
+		// 过期了之后没有再查的也要删掉，不然会一直占着内存
+		time.AfterFunc(r.cfg.PrimaryAfterWrite, func() {
+			for _, id := range ids {
+				r.recentWrites.CompareAndDelete(id, deadline)
+			}
+		})
+	}
+	for _, id := range ids {
+		// 正在查数据库的那一次可能拿到的是旧数据，后面来的请求不要再等它了
+		r.sf.Forget(r.sfKey(id))
+		if err := r.cache.Delete(ctx, id); err != nil {
+			return err
+		}
+	}
+	if r.cfg.DoubleDeleteDelay > 0 {
+		time.AfterFunc(r.cfg.DoubleDeleteDelay, func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			for _, id := range ids {
+				_ = r.cache.Delete(ctx, id)
+			}
+		})
+	}
+	return nil
+}
+
+func (r *CacheUserRepository) Activate(ctx context.Context, id int64) (bool, error) {
+	ok, err := r.dao.Activate(ctx, id)
+	if err != nil || !ok {
+		return ok, err
+	}
+	// 缓存里面还是待激活的状态，删掉让下次查询重新加载
+	return true, r.invalidate(ctx, id)
+}
+
+func (r *CacheUserRepository) UpdatePassword(ctx context.Context, id int64, password string) error {
+	err := r.dao.UpdatePassword(ctx, id, password)
+	if err != nil {
+		return err
+	}
+	// 缓存里面没有密码，但是 utime 变了
+	return r.invalidate(ctx, id)
+}
+
+func (r *CacheUserRepository) UpdateRoles(ctx context.Context, id int64, roles []domain.Role) error {
+	err := r.dao.UpdateRoles(ctx, id, r.rolesToEntity(roles))
+	if err != nil {
+		return err
+	}
+	return r.invalidate(ctx, id)
+}
+
+func (r *CacheUserRepository) UpdatePhone(ctx context.Context, id int64, phone string) error {
+	err := r.dao.UpdatePhone(ctx, id, sql.NullString{String: phone, Valid: phone != ""})
+	if err != nil {
+		return err
+	}
+	return r.invalidate(ctx, id)
+}
+
+func (r *CacheUserRepository) UpdateEmail(ctx context.Context, id int64, email string) error {
+	err := r.dao.UpdateEmail(ctx, id, sql.NullString{String: email, Valid: email != ""})
+	if err != nil {
+		return err
+	}
+	return r.invalidate(ctx, id)
+}
+
+func (r *CacheUserRepository) ClearWechat(ctx context.Context, id int64) error {
+	err := r.dao.ClearWechat(ctx, id)
+	if err != nil {
+		return err
+	}
+	return r.invalidate(ctx, id)
+}
+
+func (r *CacheUserRepository) Merge(ctx context.Context, from, to int64) error {
+	err := r.dao.Merge(ctx, from, to)
+	if err != nil {
+		return err
+	}
+	// 两个账号的缓存都要删掉
+	return r.invalidate(ctx, from, to)
+}
+
 func (r *CacheUserRepository) Create(ctx context.Context, u domain.User) error {
 	return r.dao.Insert(ctx, r.domainToEntiy(u))
 }
 
-func (r *CacheUserRepository) Edit(ctx context.Context, id int64, Nickname, Birthday, AboutMe string) (domain.User, error) {
-	u, err := r.dao.Save(ctx, id, Nickname, Birthday, AboutMe)
+func (r *CacheUserRepository) UpdateProfile(ctx context.Context, id int64, upd domain.ProfileUpdate) (domain.User, error) {
+	fields := make(map[string]any, 4)
+	if upd.Nickname != nil {
+		fields["nickname"] = *upd.Nickname
+	}
+	if upd.Birthday != nil {
+		fields["birthday"] = r.birthdayToEntity(*upd.Birthday)
+	}
+	if upd.AboutMe != nil {
+		fields["about_me"] = *upd.AboutMe
+	}
+	if upd.Avatar != nil {
+		fields["avatar"] = *upd.Avatar
+	}
+	u, err := r.dao.UpdateProfile(ctx, id, fields)
 	if err != nil {
 		return domain.User{}, err
 	}
-	return domain.User{
-		Nickname: u.Nickname,
-		Birthday: u.Birthday,
-		AboutMe:  u.AboutMe,
-	}, nil
+	if err = r.invalidate(ctx, id); err != nil {
+		return domain.User{}, err
+	}
+	res := r.entityToDomain(u)
+	res.Password = ""
+	return res, nil
 }
 
 func (r *CacheUserRepository) Profile(ctx context.Context, id int64) (domain.User, error) {
@@ -116,21 +352,140 @@ func (r *CacheUserRepository) FindByPhone(ctx context.Context, phone string) (do
 	return r.entityToDomain(u), nil
 }
 
+func (r *CacheUserRepository) FindByIdWithPassword(ctx context.Context, id int64) (domain.User, error) {
+	// 刚改完密码马上校验的话，从库可能还是旧密码
+	u, err := r.dao.FindById(r.readCtx(ctx, id), id)
+	if err != nil {
+		return domain.User{}, err
+	}
+	return r.entityToDomain(u), nil
+}
+
+func (r *CacheUserRepository) RequestDeletion(ctx context.Context, id int64, deleteAt time.Time) error {
+	err := r.dao.RequestDeletion(ctx, id, deleteAt.UnixMilli())
+	if err != nil {
+		return err
+	}
+	return r.invalidate(ctx, id)
+}
+
+func (r *CacheUserRepository) CancelDeletion(ctx context.Context, id int64) error {
+	err := r.dao.CancelDeletion(ctx, id)
+	if err != nil {
+		return err
+	}
+	return r.invalidate(ctx, id)
+}
+
+func (r *CacheUserRepository) FindDeletable(ctx context.Context, now time.Time, limit int) ([]int64, error) {
+	users, err := r.dao.FindDeletable(ctx, now.UnixMilli(), limit)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(users))
+	for _, u := range users {
+		ids = append(ids, u.Id)
+	}
+	return ids, nil
+}
+
+func (r *CacheUserRepository) Anonymize(ctx context.Context, id int64) error {
+	err := r.dao.Anonymize(ctx, id)
+	if err != nil {
+		return err
+	}
+	return r.invalidate(ctx, id)
+}
+
+func (r *CacheUserRepository) UpdateBan(ctx context.Context, id int64, bannedAt time.Time, reason string) error {
+	var ts int64
+	if !bannedAt.IsZero() {
+		ts = bannedAt.UnixMilli()
+	}
+	err := r.dao.UpdateBan(ctx, id, ts, reason)
+	if err != nil {
+		return err
+	}
+	// 登录的中间件是通过缓存判断有没有被封禁的，一定要删掉
+	return r.invalidate(ctx, id)
+}
+
+func (r *CacheUserRepository) FindBanned(ctx context.Context, before time.Time, limit int) ([]domain.User, error) {
+	users, err := r.dao.FindBanned(ctx, before.UnixMilli(), limit)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]domain.User, 0, len(users))
+	for _, u := range users {
+		res = append(res, r.entityToDomain(u))
+	}
+	return res, nil
+}
+
 func (r *CacheUserRepository) entityToDomain(u dao.User) domain.User {
+	var deleteAt, bannedAt time.Time
+	if u.DeleteAt > 0 {
+		deleteAt = time.UnixMilli(u.DeleteAt)
+	}
+	if u.BannedAt > 0 {
+		bannedAt = time.UnixMilli(u.BannedAt)
+	}
 	return domain.User{
 		Id:       u.Id,
 		Email:    u.Email.String,
 		Password: u.Password,
 		Nickname: u.Nickname,
-		Birthday: u.Birthday,
+		Birthday: r.birthdayToDomain(u.Birthday),
 		AboutMe:  u.AboutMe,
+		Avatar:   u.Avatar,
 		Phone:    u.Phone.String,
 		WechatInfo: domain.WechatInfo{
 			UnionID: u.WechatUnionID.String,
 			OpenID:  u.WechatOpenID.String,
 		},
-		Ctime: time.UnixMilli(u.Ctime),
+		Status:    domain.UserStatus(u.Status),
+		Roles:     r.rolesToDomain(u.Roles),
+		DeleteAt:  deleteAt,
+		BannedAt:  bannedAt,
+		BanReason: u.BanReason,
+		Ctime:     time.UnixMilli(u.Ctime),
+	}
+}
+
+// birthdayToDomain 以前没有校验过格式，解析不了的当成没填
+func (r *CacheUserRepository) birthdayToDomain(birthday string) time.Time {
+	t, err := time.Parse(time.DateOnly, birthday)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+func (r *CacheUserRepository) birthdayToEntity(birthday time.Time) string {
+	if birthday.IsZero() {
+		return ""
+	}
+	return birthday.Format(time.DateOnly)
+}
+
+func (r *CacheUserRepository) rolesToDomain(roles string) []domain.Role {
+	if roles == "" {
+		return nil
+	}
+	segs := strings.Split(roles, ",")
+	res := make([]domain.Role, 0, len(segs))
+	for _, seg := range segs {
+		res = append(res, domain.Role(seg))
+	}
+	return res
+}
+
+func (r *CacheUserRepository) rolesToEntity(roles []domain.Role) string {
+	segs := make([]string, 0, len(roles))
+	for _, role := range roles {
+		segs = append(segs, string(role))
 	}
+	return strings.Join(segs, ",")
 }
 
 func (r *CacheUserRepository) domainToEntiy(u domain.User) dao.User {
@@ -147,8 +502,9 @@ func (r *CacheUserRepository) domainToEntiy(u domain.User) dao.User {
 		},
 		Password: u.Password,
 		Nickname: u.Nickname,
-		Birthday: u.Birthday,
+		Birthday: r.birthdayToEntity(u.Birthday),
 		AboutMe:  u.AboutMe,
+		Avatar:   u.Avatar,
 		WechatOpenID: sql.NullString{
 			String: u.WechatInfo.OpenID,
 			Valid:  u.WechatInfo.OpenID != "",
@@ -157,6 +513,8 @@ func (r *CacheUserRepository) domainToEntiy(u domain.User) dao.User {
 			String: u.WechatInfo.UnionID,
 			Valid:  u.WechatInfo.UnionID != "",
 		},
-		Ctime: u.Ctime.UnixMilli(),
+		Status: uint8(u.Status),
+		Roles:  r.rolesToEntity(u.Roles),
+		Ctime:  u.Ctime.UnixMilli(),
 	}
 }
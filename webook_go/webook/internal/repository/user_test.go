@@ -13,6 +13,8 @@ import (
 	cachemocks "webook_go/webook/internal/repository/cache/mocks"
 	"webook_go/webook/internal/repository/dao"
 	daomocks "webook_go/webook/internal/repository/dao/mocks"
+	"webook_go/webook/pkg/degrade"
+	"webook_go/webook/pkg/gormx"
 )
 
 func TestCacheUserRepository_FindById(t *testing.T) {
@@ -21,6 +23,7 @@ func TestCacheUserRepository_FindById(t *testing.T) {
 	// 你要去掉毫秒意外的部分
 	// 111ms
 	now = time.UnixMilli(now.UnixMilli())
+	birthday := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
 	testCase := []struct {
 		name string
 		mock func(ctrl *gomock.Controller) (dao.UserDAO, cache.UserCache)
@@ -46,7 +49,7 @@ func TestCacheUserRepository_FindById(t *testing.T) {
 					},
 					Password: "this is password",
 					Nickname: "nickname",
-					Birthday: "birthday",
+					Birthday: "1990-01-01",
 					AboutMe:  "aboutme",
 					Phone: sql.NullString{
 						String: "15214320235",
@@ -55,12 +58,12 @@ func TestCacheUserRepository_FindById(t *testing.T) {
 					Ctime: now.UnixMilli(),
 					Utime: now.UnixMilli(),
 				}, nil)
+				// 缓存里面不放密码
 				c.EXPECT().Set(gomock.Any(), domain.User{
 					Id:       123,
 					Email:    "123@qq.com",
-					Password: "this is password",
 					Nickname: "nickname",
-					Birthday: "birthday",
+					Birthday: birthday,
 					AboutMe:  "aboutme",
 					Phone:    "15214320235",
 					Ctime:    now}).Return(nil)
@@ -72,9 +75,8 @@ func TestCacheUserRepository_FindById(t *testing.T) {
 			wantUser: domain.User{
 				Id:       123,
 				Email:    "123@qq.com",
-				Password: "this is password",
 				Nickname: "nickname",
-				Birthday: "birthday",
+				Birthday: birthday,
 				AboutMe:  "aboutme",
 				Phone:    "15214320235",
 				Ctime:    now,
@@ -88,9 +90,8 @@ func TestCacheUserRepository_FindById(t *testing.T) {
 				c := cachemocks.NewMockUserCache(ctrl)
 				c.EXPECT().Get(gomock.Any(), int64(123)).Return(domain.User{Id: 123,
 					Email:    "123@qq.com",
-					Password: "this is password",
 					Nickname: "nickname",
-					Birthday: "birthday",
+					Birthday: birthday,
 					AboutMe:  "aboutme",
 					Phone:    "15214320235",
 					Ctime:    now}, nil)
@@ -103,9 +104,8 @@ func TestCacheUserRepository_FindById(t *testing.T) {
 			wantUser: domain.User{
 				Id:       123,
 				Email:    "123@qq.com",
-				Password: "this is password",
 				Nickname: "nickname",
-				Birthday: "birthday",
+				Birthday: birthday,
 				AboutMe:  "aboutme",
 				Phone:    "15214320235",
 				Ctime:    now,
@@ -128,6 +128,58 @@ func TestCacheUserRepository_FindById(t *testing.T) {
 			wantUser: domain.User{},
 			wantErr:  errors.New("mock db 错误"),
 		},
+		{
+			name: "用户不存在，写入空值缓存",
+			mock: func(ctrl *gomock.Controller) (dao.UserDAO, cache.UserCache) {
+				c := cachemocks.NewMockUserCache(ctrl)
+				c.EXPECT().Get(gomock.Any(), int64(123)).Return(domain.User{}, cache.ErrKeyNotExist)
+				d := daomocks.NewMockUserDAO(ctrl)
+				d.EXPECT().FindById(gomock.Any(), int64(123)).Return(dao.User{}, dao.ErrUserNotFound)
+				c.EXPECT().SetNotExist(gomock.Any(), int64(123)).Return(nil)
+				return d, c
+			},
+
+			ctx:      context.Background(),
+			id:       123,
+			wantUser: domain.User{},
+			wantErr:  ErrUserNotFound,
+		},
+		{
+			name: "命中空值缓存",
+			mock: func(ctrl *gomock.Controller) (dao.UserDAO, cache.UserCache) {
+				c := cachemocks.NewMockUserCache(ctrl)
+				c.EXPECT().Get(gomock.Any(), int64(123)).Return(domain.User{}, cache.ErrUserNotExist)
+				d := daomocks.NewMockUserDAO(ctrl)
+				return d, c
+			},
+
+			ctx:      context.Background(),
+			id:       123,
+			wantUser: domain.User{},
+			wantErr:  ErrUserNotFound,
+		},
+		{
+			name: "请求已经取消，依旧可以回写缓存",
+			mock: func(ctrl *gomock.Controller) (dao.UserDAO, cache.UserCache) {
+				c := cachemocks.NewMockUserCache(ctrl)
+				c.EXPECT().Get(gomock.Any(), int64(123)).Return(domain.User{}, cache.ErrKeyNotExist)
+				d := daomocks.NewMockUserDAO(ctrl)
+				d.EXPECT().FindById(gomock.Any(), int64(123)).
+					DoAndReturn(func(ctx context.Context, id int64) (dao.User, error) {
+						return dao.User{Id: id, Ctime: now.UnixMilli()}, ctx.Err()
+					})
+				c.EXPECT().Set(gomock.Any(), domain.User{Id: 123, Ctime: now}).Return(nil)
+				return d, c
+			},
+
+			ctx: func() context.Context {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx
+			}(),
+			id:       123,
+			wantUser: domain.User{Id: 123, Ctime: now},
+		},
 	}
 
 	for _, tc := range testCase {
@@ -135,12 +187,131 @@ func TestCacheUserRepository_FindById(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
 			ud, uc := tc.mock(ctrl)
-			repo := NewUserRepository(ud, uc)
+			repo := NewUserRepository(ud, uc, UserCacheConfig{})
 			u, err := repo.FindById(tc.ctx, tc.id)
 			assert.Equal(t, tc.wantErr, err)
 			assert.Equal(t, tc.wantUser, u)
-			time.Sleep(time.Second)
-			// 检测 testSignal
 		})
 	}
 }
+
+func TestCacheUserRepository_UpdateProfile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	d := daomocks.NewMockUserDAO(ctrl)
+	c := cachemocks.NewMockUserCache(ctrl)
+	nickname := "nickname"
+	birthday := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+	// 只更新传了的列
+	d.EXPECT().UpdateProfile(gomock.Any(), int64(123), map[string]any{
+		"nickname": "nickname",
+		"birthday": "1990-01-01",
+	}).Return(dao.User{Id: 123, Nickname: "nickname", Birthday: "1990-01-01",
+		AboutMe: "aboutme", Password: "hash"}, nil)
+	// 先删一次，延迟之后再删一次
+	deleted := make(chan struct{}, 2)
+	c.EXPECT().Delete(gomock.Any(), int64(123)).Times(2).
+		DoAndReturn(func(ctx context.Context, id int64) error {
+			deleted <- struct{}{}
+			return nil
+		})
+	repo := NewUserRepository(d, c, UserCacheConfig{DoubleDeleteDelay: time.Millisecond * 10})
+	u, err := repo.UpdateProfile(context.Background(), 123, domain.ProfileUpdate{
+		Nickname: &nickname,
+		Birthday: &birthday,
+	})
+	assert.NoError(t, err)
+	// 返回完整的用户信息，但是不带密码
+	assert.Equal(t, domain.User{Id: 123, Nickname: "nickname", Birthday: birthday,
+		AboutMe: "aboutme", Ctime: time.UnixMilli(0)}, u)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-deleted:
+		case <-time.After(time.Second):
+			t.Fatal("没有执行延迟双删")
+		}
+	}
+}
+
+func TestCacheUserRepository_FindByIdDegraded(t *testing.T) {
+	defer degrade.Set(false)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	d := daomocks.NewMockUserDAO(ctrl)
+	c := cachemocks.NewMockUserCache(ctrl)
+	redisErr := errors.New("redis 连不上")
+	c.EXPECT().Get(gomock.Any(), gomock.Any()).Return(domain.User{}, redisErr).Times(3)
+
+	// 第一个请求占着数据库不放
+	started := make(chan struct{})
+	release := make(chan struct{})
+	d.EXPECT().FindById(gomock.Any(), int64(123)).
+		DoAndReturn(func(ctx context.Context, id int64) (dao.User, error) {
+			close(started)
+			<-release
+			return dao.User{Id: id}, nil
+		})
+	repo := NewUserRepository(d, c, UserCacheConfig{DegradeConcurrency: 1})
+	done := make(chan error)
+	go func() {
+		// Redis 不可用的时候也不回写缓存
+		u, err := repo.FindById(context.Background(), 123)
+		assert.Equal(t, int64(123), u.Id)
+		done <- err
+	}()
+	<-started
+
+	// 超过并发限制了
+	_, err := repo.FindById(context.Background(), 456)
+	assert.Equal(t, ErrDegraded, err)
+	// 同时打开了全局降级
+	assert.True(t, degrade.Enabled())
+
+	close(release)
+	assert.NoError(t, <-done)
+
+	// 前面的请求结束了，又可以查了
+	d.EXPECT().FindById(gomock.Any(), int64(456)).Return(dao.User{}, dao.ErrUserNotFound)
+	_, err = repo.FindById(context.Background(), 456)
+	assert.Equal(t, ErrUserNotFound, err)
+	// Redis 还没恢复，降级不关
+	assert.True(t, degrade.Enabled())
+
+	// Redis 恢复了，关掉降级
+	c.EXPECT().Get(gomock.Any(), int64(456)).Return(domain.User{}, cache.ErrUserNotExist)
+	_, err = repo.FindById(context.Background(), 456)
+	assert.Equal(t, ErrUserNotFound, err)
+	assert.False(t, degrade.Enabled())
+}
+
+func TestCacheUserRepository_FindByIdAfterWrite(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	d := daomocks.NewMockUserDAO(ctrl)
+	c := cachemocks.NewMockUserCache(ctrl)
+	c.EXPECT().Delete(gomock.Any(), int64(123)).Return(nil)
+	c.EXPECT().Get(gomock.Any(), gomock.Any()).Return(domain.User{}, cache.ErrKeyNotExist).Times(2)
+	c.EXPECT().Set(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+	d.EXPECT().UpdatePassword(gomock.Any(), int64(123), "hash").Return(nil)
+	repo := NewUserRepository(d, c, UserCacheConfig{PrimaryAfterWrite: time.Minute})
+	err := repo.UpdatePassword(context.Background(), 123, "hash")
+	assert.NoError(t, err)
+
+	// 刚更新过的走主库
+	d.EXPECT().FindById(gomock.Any(), int64(123)).
+		DoAndReturn(func(ctx context.Context, id int64) (dao.User, error) {
+			assert.True(t, gormx.UsePrimary(ctx))
+			return dao.User{Id: id}, nil
+		})
+	_, err = repo.FindById(context.Background(), 123)
+	assert.NoError(t, err)
+
+	// 别的用户还是读从库
+	d.EXPECT().FindById(gomock.Any(), int64(456)).
+		DoAndReturn(func(ctx context.Context, id int64) (dao.User, error) {
+			assert.False(t, gormx.UsePrimary(ctx))
+			return dao.User{Id: id}, nil
+		})
+	_, err = repo.FindById(context.Background(), 456)
+	assert.NoError(t, err)
+}
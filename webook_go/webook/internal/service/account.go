@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"time"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/repository"
+	"webook_go/webook/internal/repository/article"
+	"webook_go/webook/pkg/logger"
+)
+
+var (
+	// ErrDeletionRequested 已经申请过注销了
+	ErrDeletionRequested = errors.New("已经申请注销")
+	// ErrDeletionNotRequested 没有申请注销，或者已经过了冷静期
+	ErrDeletionNotRequested = errors.New("没有申请注销")
+	// ErrAccountNotActive 待激活、已合并的账号不能注销
+	ErrAccountNotActive = errors.New("账号当前状态不能注销")
+)
+
+// exportArticleBatch 导出的时候每次查多少篇文章
+const exportArticleBatch = 100
+
+type AccountConfig struct {
+	// DeletionCooldown 申请注销之后的冷静期，冷静期里面可以撤销
+	DeletionCooldown time.Duration
+}
+
+// AccountService 注销账号和导出个人数据
+type AccountService interface {
+	// RequestDeletion 设置了密码的账号要校验密码，返回真正删除的时间
+	RequestDeletion(ctx context.Context, uid int64, password string) (time.Time, error)
+	CancelDeletion(ctx context.Context, uid int64) error
+	// PurgeDeleted 冷静期过了的账号真正注销，返回注销了的用户，调用方要清掉他们的登录态
+	PurgeDeleted(ctx context.Context, limit int) ([]int64, error)
+	// Export 个人资料、第三方账号和文章，不包括密码和第三方平台的 token
+	Export(ctx context.Context, uid int64) (domain.AccountExport, error)
+}
+
+type accountService struct {
+	userRepo     repository.UserRepository
+	identityRepo repository.IdentityRepository
+	artRepo      article.ArticleRepository
+	cfg          AccountConfig
+	l            logger.LoggerV1
+	now          func() time.Time
+}
+
+func NewAccountService(userRepo repository.UserRepository, identityRepo repository.IdentityRepository,
+	artRepo article.ArticleRepository, cfg AccountConfig, l logger.LoggerV1) AccountService {
+	return &accountService{
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+		artRepo:      artRepo,
+		cfg:          cfg,
+		l:            l,
+		now:          time.Now,
+	}
+}
+
+func (svc *accountService) RequestDeletion(ctx context.Context, uid int64, password string) (time.Time, error) {
+	u, err := svc.userRepo.FindByIdWithPassword(ctx, uid)
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch u.Status {
+	case domain.UserStatusActive:
+	case domain.UserStatusDeleting:
+		return u.DeleteAt, ErrDeletionRequested
+	default:
+		return time.Time{}, ErrAccountNotActive
+	}
+	// 只用手机号或者第三方登录的账号没有密码，能拿到 token 就够了
+	if u.Password != "" {
+		err = bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
+		if err != nil {
+			return time.Time{}, ErrInvalidUserOrPassword
+		}
+	}
+	deleteAt := svc.now().Add(svc.cfg.DeletionCooldown)
+	err = svc.userRepo.RequestDeletion(ctx, uid, deleteAt)
+	if err == repository.ErrUserNotFound {
+		// 并发修改了状态
+		return time.Time{}, ErrAccountNotActive
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return deleteAt, nil
+}
+
+func (svc *accountService) CancelDeletion(ctx context.Context, uid int64) error {
+	err := svc.userRepo.CancelDeletion(ctx, uid)
+	if err == repository.ErrUserNotFound {
+		return ErrDeletionNotRequested
+	}
+	return err
+}
+
+func (svc *accountService) PurgeDeleted(ctx context.Context, limit int) ([]int64, error) {
+	ids, err := svc.userRepo.FindDeletable(ctx, svc.now(), limit)
+	if err != nil {
+		return nil, err
+	}
+	purged := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		err = svc.userRepo.Anonymize(ctx, id)
+		switch err {
+		case nil:
+			purged = append(purged, id)
+		case repository.ErrUserNotFound:
+			// 刚好撤销了
+		default:
+			// 下一轮还会再试
+			svc.l.Error("注销账号失败", logger.Error(err), logger.Int64("uid", id))
+		}
+	}
+	return purged, nil
+}
+
+func (svc *accountService) Export(ctx context.Context, uid int64) (domain.AccountExport, error) {
+	u, err := svc.userRepo.FindById(ctx, uid)
+	if err != nil {
+		return domain.AccountExport{}, err
+	}
+	u.Password = ""
+	identities, err := svc.identityRepo.FindByUid(ctx, uid)
+	if err != nil {
+		return domain.AccountExport{}, err
+	}
+	for i := range identities {
+		// token 是我们代替用户调用第三方平台的凭证，不属于个人数据
+		identities[i].AccessToken = ""
+		identities[i].RefreshToken = ""
+		identities[i].TokenExpiresAt = time.Time{}
+	}
+	var arts []domain.Article
+	for offset := 0; ; offset += exportArticleBatch {
+		batch, err := svc.artRepo.ListByAuthor(ctx, uid, offset, exportArticleBatch)
+		if err != nil {
+			return domain.AccountExport{}, err
+		}
+		arts = append(arts, batch...)
+		if len(batch) < exportArticleBatch {
+			break
+		}
+	}
+	return domain.AccountExport{
+		User:       u,
+		Identities: identities,
+		Articles:   arts,
+		ExportedAt: svc.now(),
+	}, nil
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+	"time"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/repository"
+	artrepomocks "webook_go/webook/internal/repository/article/mocks"
+	repomocks "webook_go/webook/internal/repository/mocks"
+	"webook_go/webook/pkg/logger"
+)
+
+type accountMocks struct {
+	userRepo     *repomocks.MockUserRepository
+	identityRepo *repomocks.MockIdentityRepository
+	artRepo      *artrepomocks.MockArticleRepository
+}
+
+func newAccountService(ctrl *gomock.Controller, now time.Time) (*accountService, accountMocks) {
+	m := accountMocks{
+		userRepo:     repomocks.NewMockUserRepository(ctrl),
+		identityRepo: repomocks.NewMockIdentityRepository(ctrl),
+		artRepo:      artrepomocks.NewMockArticleRepository(ctrl),
+	}
+	svc := NewAccountService(m.userRepo, m.identityRepo, m.artRepo,
+		AccountConfig{DeletionCooldown: time.Hour * 24 * 7}, &logger.NopLogger{}).(*accountService)
+	svc.now = func() time.Time { return now }
+	return svc, m
+}
+
+func TestAccountService_RequestDeletion(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	hash, err := bcrypt.GenerateFromPassword([]byte("hello#world123"), bcrypt.MinCost)
+	require.NoError(t, err)
+	testCases := []struct {
+		name     string
+		mock     func(m accountMocks)
+		password string
+
+		wantDeleteAt time.Time
+		wantErr      error
+	}{
+		{
+			name: "申请成功",
+			mock: func(m accountMocks) {
+				m.userRepo.EXPECT().FindByIdWithPassword(gomock.Any(), int64(123)).
+					Return(domain.User{Id: 123, Password: string(hash)}, nil)
+				m.userRepo.EXPECT().RequestDeletion(gomock.Any(), int64(123), now.Add(time.Hour*24*7)).
+					Return(nil)
+			},
+			password:     "hello#world123",
+			wantDeleteAt: now.Add(time.Hour * 24 * 7),
+		},
+		{
+			name: "没有密码的账号",
+			mock: func(m accountMocks) {
+				m.userRepo.EXPECT().FindByIdWithPassword(gomock.Any(), int64(123)).
+					Return(domain.User{Id: 123, Phone: "15212345678"}, nil)
+				m.userRepo.EXPECT().RequestDeletion(gomock.Any(), int64(123), gomock.Any()).Return(nil)
+			},
+			wantDeleteAt: now.Add(time.Hour * 24 * 7),
+		},
+		{
+			name: "密码不对",
+			mock: func(m accountMocks) {
+				m.userRepo.EXPECT().FindByIdWithPassword(gomock.Any(), int64(123)).
+					Return(domain.User{Id: 123, Password: string(hash)}, nil)
+			},
+			password: "wrong",
+			wantErr:  ErrInvalidUserOrPassword,
+		},
+		{
+			name: "已经申请过了",
+			mock: func(m accountMocks) {
+				m.userRepo.EXPECT().FindByIdWithPassword(gomock.Any(), int64(123)).
+					Return(domain.User{Id: 123, Status: domain.UserStatusDeleting, DeleteAt: now}, nil)
+			},
+			wantDeleteAt: now,
+			wantErr:      ErrDeletionRequested,
+		},
+		{
+			name: "已合并的账号",
+			mock: func(m accountMocks) {
+				m.userRepo.EXPECT().FindByIdWithPassword(gomock.Any(), int64(123)).
+					Return(domain.User{Id: 123, Status: domain.UserStatusMerged}, nil)
+			},
+			wantErr: ErrAccountNotActive,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			svc, m := newAccountService(ctrl, now)
+			tc.mock(m)
+			deleteAt, err := svc.RequestDeletion(context.Background(), 123, tc.password)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantDeleteAt, deleteAt)
+		})
+	}
+}
+
+func TestAccountService_CancelDeletion(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	svc, m := newAccountService(ctrl, time.Now())
+	m.userRepo.EXPECT().CancelDeletion(gomock.Any(), int64(123)).Return(repository.ErrUserNotFound)
+	assert.Equal(t, ErrDeletionNotRequested, svc.CancelDeletion(context.Background(), 123))
+}
+
+func TestAccountService_PurgeDeleted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	now := time.UnixMilli(1700000000000)
+	svc, m := newAccountService(ctrl, now)
+	m.userRepo.EXPECT().FindDeletable(gomock.Any(), now, 10).Return([]int64{1, 2, 3}, nil)
+	m.userRepo.EXPECT().Anonymize(gomock.Any(), int64(1)).Return(nil)
+	// 刚好撤销了
+	m.userRepo.EXPECT().Anonymize(gomock.Any(), int64(2)).Return(repository.ErrUserNotFound)
+	// 失败了下一轮再试
+	m.userRepo.EXPECT().Anonymize(gomock.Any(), int64(3)).Return(errors.New("db 错误"))
+	ids, err := svc.PurgeDeleted(context.Background(), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1}, ids)
+}
+
+func TestAccountService_Export(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	now := time.UnixMilli(1700000000000)
+	svc, m := newAccountService(ctrl, now)
+	m.userRepo.EXPECT().FindById(gomock.Any(), int64(123)).
+		Return(domain.User{Id: 123, Nickname: "大明"}, nil)
+	m.identityRepo.EXPECT().FindByUid(gomock.Any(), int64(123)).
+		Return([]domain.Identity{{Uid: 123, Provider: "github", Subject: "1",
+			AccessToken: "at", RefreshToken: "rt", TokenExpiresAt: now}}, nil)
+	// 分批查，直到不满一批
+	full := make([]domain.Article, exportArticleBatch)
+	m.artRepo.EXPECT().ListByAuthor(gomock.Any(), int64(123), 0, exportArticleBatch).Return(full, nil)
+	m.artRepo.EXPECT().ListByAuthor(gomock.Any(), int64(123), exportArticleBatch, exportArticleBatch).
+		Return([]domain.Article{{Id: 1}}, nil)
+
+	res, err := svc.Export(context.Background(), 123)
+	require.NoError(t, err)
+	assert.Equal(t, domain.User{Id: 123, Nickname: "大明"}, res.User)
+	// 不导出第三方平台的 token
+	assert.Equal(t, []domain.Identity{{Uid: 123, Provider: "github", Subject: "1"}}, res.Identities)
+	assert.Len(t, res.Articles, exportArticleBatch+1)
+	assert.Equal(t, now, res.ExportedAt)
+}
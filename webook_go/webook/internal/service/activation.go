@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"net/url"
+	"time"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/repository"
+	"webook_go/webook/internal/service/email"
+	"webook_go/webook/pkg/logger"
+)
+
+var ErrInvalidActivationToken = errors.New("激活链接无效或者已经过期")
+
+// bizActivation 发送激活邮件借用了验证码的发送限制，所以也要有自己的 biz
+const bizActivation = "activation"
+
+type ActivationConfig struct {
+	// Key 激活链接的签名密钥
+	Key string
+	// URL 激活接口的地址，token 会作为查询参数拼在后面
+	URL string
+	// Expiration 激活链接的有效期
+	Expiration time.Duration
+}
+
+type ActivationClaims struct {
+	Uid   int64
+	Email string
+	jwt.RegisteredClaims
+}
+
+// ActivationService 邮箱注册之后的账号激活
+type ActivationService interface {
+	// Send 发送激活邮件，注册和重新发送都走这里
+	Send(ctx context.Context, email string, meta domain.CodeSendMeta) error
+	// Activate 校验激活链接里面的 token，激活账号
+	Activate(ctx context.Context, token string) error
+}
+
+type activationService struct {
+	repo     repository.UserRepository
+	codeRepo repository.CodeRepository
+	emailSvc email.Service
+	cfg      ActivationConfig
+	l        logger.LoggerV1
+}
+
+func NewActivationService(repo repository.UserRepository, codeRepo repository.CodeRepository,
+	emailSvc email.Service, cfg ActivationConfig, l logger.LoggerV1) ActivationService {
+	return &activationService{
+		repo:     repo,
+		codeRepo: codeRepo,
+		emailSvc: emailSvc,
+		cfg:      cfg,
+		l:        l,
+	}
+}
+
+func (svc *activationService) Send(ctx context.Context, addr string, meta domain.CodeSendMeta) error {
+	// 先过一遍发送限制，这里存进去的验证码不会被用到，只是为了复用验证码的各层限制
+	// 放在查询用户之前，不管邮箱有没有注册都会计数
+	err := svc.codeRepo.Store(ctx, bizActivation, addr, generateCode(), meta)
+	if err != nil {
+		return err
+	}
+	u, err := svc.repo.FindByEmail(ctx, addr)
+	if err == repository.ErrUserNotFound {
+		// 不告诉调用方邮箱有没有注册
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if u.Status != domain.UserStatusPending {
+		return nil
+	}
+	link, err := svc.link(u)
+	if err != nil {
+		return err
+	}
+	subject, content, err := email.Render(email.TplActivation, map[string]any{
+		"Link":  link,
+		"Hours": int(svc.cfg.Expiration.Hours()),
+	})
+	if err != nil {
+		return err
+	}
+	err = svc.emailSvc.Send(ctx, subject, content, addr)
+	if err != nil {
+		err = fmt.Errorf("发送激活邮件出现异常 %w", err)
+	}
+	return err
+}
+
+// link 生成带签名的激活链接，签名里面带上了邮箱，换绑邮箱之后旧的链接就失效了
+func (svc *activationService) link(u domain.User) (string, error) {
+	claims := ActivationClaims{
+		Uid:   u.Id,
+		Email: u.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(svc.cfg.Expiration)),
+		},
+	}
+	tokenStr, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(svc.cfg.Key))
+	if err != nil {
+		return "", err
+	}
+	link, err := url.Parse(svc.cfg.URL)
+	if err != nil {
+		return "", err
+	}
+	query := link.Query()
+	query.Set("token", tokenStr)
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
+
+func (svc *activationService) Activate(ctx context.Context, tokenStr string) error {
+	var claims ActivationClaims
+	token, err := jwt.ParseWithClaims(tokenStr, &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(svc.cfg.Key), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid {
+		return ErrInvalidActivationToken
+	}
+	u, err := svc.repo.FindById(ctx, claims.Uid)
+	if err == repository.ErrUserNotFound {
+		return ErrInvalidActivationToken
+	}
+	if err != nil {
+		return err
+	}
+	if u.Email != claims.Email {
+		return ErrInvalidActivationToken
+	}
+	if u.Status == domain.UserStatusActive {
+		// 重复点击激活链接，直接当成成功
+		return nil
+	}
+	_, err = svc.repo.Activate(ctx, u.Id)
+	return err
+}
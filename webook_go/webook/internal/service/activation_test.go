@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/repository"
+	repomocks "webook_go/webook/internal/repository/mocks"
+	"webook_go/webook/internal/service/email/memory"
+	"webook_go/webook/pkg/logger"
+)
+
+var testActivationCfg = ActivationConfig{
+	Key:        "test-key",
+	URL:        "http://localhost:8080/users/activate",
+	Expiration: time.Hour * 24,
+}
+
+func TestActivationService_Send(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) (repository.UserRepository, repository.CodeRepository)
+
+		wantErr  error
+		wantSent bool
+	}{
+		{
+			name: "发送成功",
+			mock: func(ctrl *gomock.Controller) (repository.UserRepository, repository.CodeRepository) {
+				codeRepo := repomocks.NewMockCodeRepository(ctrl)
+				codeRepo.EXPECT().Store(gomock.Any(), bizActivation, "123@qq.com",
+					gomock.Any(), gomock.Any()).Return(nil)
+				repo := repomocks.NewMockUserRepository(ctrl)
+				repo.EXPECT().FindByEmail(gomock.Any(), "123@qq.com").Return(domain.User{
+					Id:     123,
+					Email:  "123@qq.com",
+					Status: domain.UserStatusPending,
+				}, nil)
+				return repo, codeRepo
+			},
+			wantSent: true,
+		},
+		{
+			name: "发送太频繁",
+			mock: func(ctrl *gomock.Controller) (repository.UserRepository, repository.CodeRepository) {
+				codeRepo := repomocks.NewMockCodeRepository(ctrl)
+				codeRepo.EXPECT().Store(gomock.Any(), bizActivation, "123@qq.com",
+					gomock.Any(), gomock.Any()).Return(ErrCodeSendTooMany)
+				return repomocks.NewMockUserRepository(ctrl), codeRepo
+			},
+			wantErr: ErrCodeSendTooMany,
+		},
+		{
+			name: "邮箱没有注册",
+			mock: func(ctrl *gomock.Controller) (repository.UserRepository, repository.CodeRepository) {
+				codeRepo := repomocks.NewMockCodeRepository(ctrl)
+				codeRepo.EXPECT().Store(gomock.Any(), bizActivation, "123@qq.com",
+					gomock.Any(), gomock.Any()).Return(nil)
+				repo := repomocks.NewMockUserRepository(ctrl)
+				repo.EXPECT().FindByEmail(gomock.Any(), "123@qq.com").
+					Return(domain.User{}, repository.ErrUserNotFound)
+				return repo, codeRepo
+			},
+		},
+		{
+			name: "已经激活过了",
+			mock: func(ctrl *gomock.Controller) (repository.UserRepository, repository.CodeRepository) {
+				codeRepo := repomocks.NewMockCodeRepository(ctrl)
+				codeRepo.EXPECT().Store(gomock.Any(), bizActivation, "123@qq.com",
+					gomock.Any(), gomock.Any()).Return(nil)
+				repo := repomocks.NewMockUserRepository(ctrl)
+				repo.EXPECT().FindByEmail(gomock.Any(), "123@qq.com").Return(domain.User{
+					Id:     123,
+					Email:  "123@qq.com",
+					Status: domain.UserStatusActive,
+				}, nil)
+				return repo, codeRepo
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repo, codeRepo := tc.mock(ctrl)
+			emailSvc := memory.NewService()
+			svc := NewActivationService(repo, codeRepo, emailSvc, testActivationCfg, &logger.NopLogger{})
+			err := svc.Send(context.Background(), "123@qq.com", domain.CodeSendMeta{})
+			assert.Equal(t, tc.wantErr, err)
+			msgs := emailSvc.Messages()
+			if !tc.wantSent {
+				assert.Empty(t, msgs)
+				return
+			}
+			require.Len(t, msgs, 1)
+			assert.Equal(t, []string{"123@qq.com"}, msgs[0].To)
+			assert.Contains(t, msgs[0].Content, testActivationCfg.URL+"?token=")
+		})
+	}
+}
+
+func TestActivationService_Activate(t *testing.T) {
+	pending := domain.User{
+		Id:     123,
+		Email:  "123@qq.com",
+		Status: domain.UserStatusPending,
+	}
+	expiredCfg := testActivationCfg
+	expiredCfg.Expiration = -time.Minute
+	otherKeyCfg := testActivationCfg
+	otherKeyCfg.Key = "other-key"
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) repository.UserRepository
+		// 签发 token 用的配置
+		cfg  ActivationConfig
+		user domain.User
+
+		wantErr error
+	}{
+		{
+			name: "激活成功",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				repo := repomocks.NewMockUserRepository(ctrl)
+				repo.EXPECT().FindById(gomock.Any(), int64(123)).Return(pending, nil)
+				repo.EXPECT().Activate(gomock.Any(), int64(123)).Return(true, nil)
+				return repo
+			},
+			cfg:  testActivationCfg,
+			user: pending,
+		},
+		{
+			name: "重复激活",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				repo := repomocks.NewMockUserRepository(ctrl)
+				u := pending
+				u.Status = domain.UserStatusActive
+				repo.EXPECT().FindById(gomock.Any(), int64(123)).Return(u, nil)
+				return repo
+			},
+			cfg:  testActivationCfg,
+			user: pending,
+		},
+		{
+			name: "链接过期",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				return repomocks.NewMockUserRepository(ctrl)
+			},
+			cfg:     expiredCfg,
+			user:    pending,
+			wantErr: ErrInvalidActivationToken,
+		},
+		{
+			name: "签名不对",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				return repomocks.NewMockUserRepository(ctrl)
+			},
+			cfg:     otherKeyCfg,
+			user:    pending,
+			wantErr: ErrInvalidActivationToken,
+		},
+		{
+			name: "邮箱已经换了",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				repo := repomocks.NewMockUserRepository(ctrl)
+				u := pending
+				u.Email = "456@qq.com"
+				repo.EXPECT().FindById(gomock.Any(), int64(123)).Return(u, nil)
+				return repo
+			},
+			cfg:     testActivationCfg,
+			user:    pending,
+			wantErr: ErrInvalidActivationToken,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			signer := &activationService{cfg: tc.cfg}
+			link, err := signer.link(tc.user)
+			require.NoError(t, err)
+			parsed, err := url.Parse(link)
+			require.NoError(t, err)
+
+			svc := NewActivationService(tc.mock(ctrl), nil, nil, testActivationCfg, &logger.NopLogger{})
+			err = svc.Activate(context.Background(), parsed.Query().Get("token"))
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
+
+func TestActivationService_LinkInEmail(t *testing.T) {
+	// 模板里面的链接要能直接拿来激活
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	codeRepo := repomocks.NewMockCodeRepository(ctrl)
+	codeRepo.EXPECT().Store(gomock.Any(), bizActivation, "123@qq.com",
+		gomock.Any(), gomock.Any()).Return(nil)
+	repo := repomocks.NewMockUserRepository(ctrl)
+	u := domain.User{Id: 123, Email: "123@qq.com", Status: domain.UserStatusPending}
+	repo.EXPECT().FindByEmail(gomock.Any(), "123@qq.com").Return(u, nil)
+	repo.EXPECT().FindById(gomock.Any(), int64(123)).Return(u, nil)
+	repo.EXPECT().Activate(gomock.Any(), int64(123)).Return(true, nil)
+	emailSvc := memory.NewService()
+	svc := NewActivationService(repo, codeRepo, emailSvc, testActivationCfg, &logger.NopLogger{})
+
+	require.NoError(t, svc.Send(context.Background(), "123@qq.com", domain.CodeSendMeta{}))
+	msgs := emailSvc.Messages()
+	require.Len(t, msgs, 1)
+	matches := regexp.MustCompile(`href="([^"]+)"`).FindStringSubmatch(msgs[0].Content)
+	require.Len(t, matches, 2)
+	// html/template 会把 & 之类的转义掉，这里只有一个参数，直接解析就可以
+	link, err := url.Parse(matches[1])
+	require.NoError(t, err)
+	assert.NoError(t, svc.Activate(context.Background(), link.Query().Get("token")))
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"time"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/repository"
+)
+
+// AdminService 管理后台对用户的操作，调用方要先校验过权限
+type AdminService interface {
+	// SearchUsers 每个条件都单独查一次，结果去重，条件都是空的返回空
+	SearchUsers(ctx context.Context, q domain.UserQuery) ([]domain.User, error)
+	Ban(ctx context.Context, uid int64, reason string) error
+	Unban(ctx context.Context, uid int64) error
+	// ListBanned 封禁时间早于 before 的用户，最近封禁的在前面
+	ListBanned(ctx context.Context, before time.Time, limit int) ([]domain.User, error)
+	// LoginHistory 最近的登录记录在前面
+	LoginHistory(ctx context.Context, uid int64, offset, limit int) ([]domain.LoginLog, error)
+	// Audit 记录管理员的操作
+	Audit(ctx context.Context, log domain.AuditLog) error
+}
+
+type adminService struct {
+	userRepo     repository.UserRepository
+	loginLogRepo repository.LoginLogRepository
+	auditRepo    repository.AuditLogRepository
+	now          func() time.Time
+}
+
+func NewAdminService(userRepo repository.UserRepository, loginLogRepo repository.LoginLogRepository,
+	auditRepo repository.AuditLogRepository) AdminService {
+	return &adminService{
+		userRepo:     userRepo,
+		loginLogRepo: loginLogRepo,
+		auditRepo:    auditRepo,
+		now:          time.Now,
+	}
+}
+
+func (svc *adminService) SearchUsers(ctx context.Context, q domain.UserQuery) ([]domain.User, error) {
+	var finders []func() (domain.User, error)
+	if q.Id > 0 {
+		finders = append(finders, func() (domain.User, error) {
+			return svc.userRepo.FindById(ctx, q.Id)
+		})
+	}
+	if q.Email != "" {
+		finders = append(finders, func() (domain.User, error) {
+			return svc.userRepo.FindByEmail(ctx, q.Email)
+		})
+	}
+	if q.Phone != "" {
+		finders = append(finders, func() (domain.User, error) {
+			return svc.userRepo.FindByPhone(ctx, q.Phone)
+		})
+	}
+	res := make([]domain.User, 0, len(finders))
+	seen := make(map[int64]struct{}, len(finders))
+	for _, find := range finders {
+		u, err := find()
+		if err == repository.ErrUserNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[u.Id]; ok {
+			continue
+		}
+		seen[u.Id] = struct{}{}
+		// 管理员也不需要看到密码
+		u.Password = ""
+		res = append(res, u)
+	}
+	return res, nil
+}
+
+func (svc *adminService) Ban(ctx context.Context, uid int64, reason string) error {
+	return svc.userRepo.UpdateBan(ctx, uid, svc.now(), reason)
+}
+
+func (svc *adminService) Unban(ctx context.Context, uid int64) error {
+	return svc.userRepo.UpdateBan(ctx, uid, time.Time{}, "")
+}
+
+func (svc *adminService) ListBanned(ctx context.Context, before time.Time, limit int) ([]domain.User, error) {
+	users, err := svc.userRepo.FindBanned(ctx, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range users {
+		users[i].Password = ""
+	}
+	return users, nil
+}
+
+func (svc *adminService) LoginHistory(ctx context.Context, uid int64, offset, limit int) ([]domain.LoginLog, error) {
+	return svc.loginLogRepo.FindByUid(ctx, uid, offset, limit)
+}
+
+func (svc *adminService) Audit(ctx context.Context, log domain.AuditLog) error {
+	if log.Ctime.IsZero() {
+		log.Ctime = svc.now()
+	}
+	return svc.auditRepo.Create(ctx, log)
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"testing"
+	"time"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/repository"
+	repomocks "webook_go/webook/internal/repository/mocks"
+)
+
+func TestAdminService_SearchUsers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	userRepo := repomocks.NewMockUserRepository(ctrl)
+	svc := NewAdminService(userRepo, repomocks.NewMockLoginLogRepository(ctrl),
+		repomocks.NewMockAuditLogRepository(ctrl))
+	userRepo.EXPECT().FindById(gomock.Any(), int64(123)).
+		Return(domain.User{Id: 123, Email: "123@qq.com"}, nil)
+	// 和按 id 查到的是同一个人
+	userRepo.EXPECT().FindByEmail(gomock.Any(), "123@qq.com").
+		Return(domain.User{Id: 123, Email: "123@qq.com", Password: "hash"}, nil)
+	userRepo.EXPECT().FindByPhone(gomock.Any(), "15212345678").
+		Return(domain.User{}, repository.ErrUserNotFound)
+
+	users, err := svc.SearchUsers(context.Background(), domain.UserQuery{
+		Id: 123, Email: "123@qq.com", Phone: "15212345678",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []domain.User{{Id: 123, Email: "123@qq.com"}}, users)
+}
+
+func TestAdminService_Ban(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	now := time.UnixMilli(1700000000000)
+	userRepo := repomocks.NewMockUserRepository(ctrl)
+	auditRepo := repomocks.NewMockAuditLogRepository(ctrl)
+	svc := NewAdminService(userRepo, repomocks.NewMockLoginLogRepository(ctrl), auditRepo).(*adminService)
+	svc.now = func() time.Time { return now }
+
+	userRepo.EXPECT().UpdateBan(gomock.Any(), int64(123), now, "发广告").Return(nil)
+	userRepo.EXPECT().UpdateBan(gomock.Any(), int64(123), time.Time{}, "").Return(nil)
+	auditRepo.EXPECT().Create(gomock.Any(), domain.AuditLog{
+		Operator: 1, Action: domain.AuditActionBanUser, TargetUid: 123, Detail: "发广告", Ctime: now,
+	}).Return(nil)
+
+	assert.NoError(t, svc.Ban(context.Background(), 123, "发广告"))
+	assert.NoError(t, svc.Unban(context.Background(), 123))
+	assert.NoError(t, svc.Audit(context.Background(), domain.AuditLog{
+		Operator: 1, Action: domain.AuditActionBanUser, TargetUid: 123, Detail: "发广告",
+	}))
+}
+
+func TestAdminService_ListBanned(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	before := time.UnixMilli(1700000000000)
+	userRepo := repomocks.NewMockUserRepository(ctrl)
+	svc := NewAdminService(userRepo, repomocks.NewMockLoginLogRepository(ctrl),
+		repomocks.NewMockAuditLogRepository(ctrl))
+	userRepo.EXPECT().FindBanned(gomock.Any(), before, 10).
+		Return([]domain.User{{Id: 123, Password: "hash", BanReason: "发广告"}}, nil)
+
+	users, err := svc.ListBanned(context.Background(), before, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.User{{Id: 123, BanReason: "发广告"}}, users)
+}
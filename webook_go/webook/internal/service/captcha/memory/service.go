@@ -0,0 +1,15 @@
+package memory
+
+import "context"
+
+// Service 测试用的，只要有票据就算通过
+type Service struct {
+}
+
+func NewService() *Service {
+	return &Service{}
+}
+
+func (s *Service) Verify(ctx context.Context, ticket string, ip string) (bool, error) {
+	return ticket != "", nil
+}
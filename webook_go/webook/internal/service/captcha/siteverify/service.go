@@ -0,0 +1,65 @@
+package siteverify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Config Cloudflare Turnstile、hCaptcha 和 reCAPTCHA 的校验接口是一样的，换一个 URL 就可以
+type Config struct {
+	URL    string
+	Secret string
+}
+
+// Service 拿着前端的票据去服务商那里确认
+type Service struct {
+	cfg    Config
+	client *http.Client
+}
+
+func NewService(cfg Config, client *http.Client) *Service {
+	return &Service{
+		cfg:    cfg,
+		client: client,
+	}
+}
+
+type verifyResult struct {
+	Success    bool     `json:"success"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+func (s *Service) Verify(ctx context.Context, ticket string, ip string) (bool, error) {
+	if ticket == "" {
+		return false, nil
+	}
+	form := url.Values{}
+	form.Set("secret", s.cfg.Secret)
+	form.Set("response", ticket)
+	if ip != "" {
+		form.Set("remoteip", ip)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("校验图形验证码失败，状态码 %d", resp.StatusCode)
+	}
+	var res verifyResult
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return false, err
+	}
+	// 票据不对或者过期了是正常的校验不通过，不是系统错误
+	return res.Success, nil
+}
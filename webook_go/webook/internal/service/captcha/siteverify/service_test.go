@@ -0,0 +1,47 @@
+package siteverify
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestService_Verify(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "my-secret", r.PostForm.Get("secret"))
+		assert.Equal(t, "1.2.3.4", r.PostForm.Get("remoteip"))
+		switch r.PostForm.Get("response") {
+		case "ok":
+			_, _ = w.Write([]byte(`{"success":true}`))
+		case "boom":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			_, _ = w.Write([]byte(`{"success":false,"error-codes":["invalid-input-response"]}`))
+		}
+	}))
+	defer server.Close()
+
+	svc := NewService(Config{URL: server.URL, Secret: "my-secret"}, server.Client())
+	testCases := []struct {
+		name    string
+		ticket  string
+		wantOk  bool
+		wantErr bool
+	}{
+		{name: "校验通过", ticket: "ok", wantOk: true},
+		{name: "票据不对", ticket: "bad"},
+		{name: "没有票据", ticket: ""},
+		{name: "服务商出错", ticket: "boom", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ok, err := svc.Verify(context.Background(), tc.ticket, "1.2.3.4")
+			assert.Equal(t, tc.wantErr, err != nil)
+			assert.Equal(t, tc.wantOk, ok)
+		})
+	}
+}
@@ -0,0 +1,10 @@
+package captcha
+
+import "context"
+
+// Service 图形验证码（滑块、点选之类的）的校验
+// 前端完成验证之后拿到一个票据，后端拿着票据找验证码服务商确认
+type Service interface {
+	// Verify ip 是用户的 IP，服务商一般会要求票据和 IP 绑定
+	Verify(ctx context.Context, ticket string, ip string) (bool, error)
+}
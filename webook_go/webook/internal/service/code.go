@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"go.uber.org/atomic"
 	"math/rand"
+	"webook_go/webook/internal/domain"
 	"webook_go/webook/internal/repository"
 	"webook_go/webook/internal/service/sms"
 )
@@ -13,10 +14,17 @@ var codeTplId atomic.String = atomic.String{}
 var (
 	ErrCodeSendTooMany        = repository.ErrCodeSendTooMany
 	ErrCodeVerifyTooManyTimes = repository.ErrCodeVerifyTooManyTimes
+	ErrCodePhoneHourLimit     = repository.ErrCodePhoneHourLimit
+	ErrCodePhoneDayLimit      = repository.ErrCodePhoneDayLimit
+	ErrCodeIPLimit            = repository.ErrCodeIPLimit
+	ErrCodeDeviceLimit        = repository.ErrCodeDeviceLimit
+	ErrCodeBizLimit           = repository.ErrCodeBizLimit
+	ErrCodeCaptchaRequired    = repository.ErrCodeCaptchaRequired
 )
 
 type CodeService interface {
-	Send(ctx context.Context, biz string, phone string) error
+	// Send meta 是请求的来源，用来做防刷限制
+	Send(ctx context.Context, biz string, phone string, meta domain.CodeSendMeta) error
 	Verify(ctx context.Context, biz string, phone string, inputCode string) (bool, error)
 }
 
@@ -33,11 +41,11 @@ func NewCodeService(repo repository.CodeRepository, smsSvc sms.Service) CodeServ
 }
 
 // Send 发验证码，我需要什么参数？
-func (svc *codeService) Send(ctx context.Context, biz string, phone string) error { // biz 区别业务场景
+func (svc *codeService) Send(ctx context.Context, biz string, phone string, meta domain.CodeSendMeta) error { // biz 区别业务场景
 	// 生成一个验证码
-	code := svc.generateCode()
-	// 塞进去 redis
-	err := svc.repo.Store(ctx, biz, phone, code)
+	code := generateCode()
+	// 塞进去 redis，顺便检查各种发送限制
+	err := svc.repo.Store(ctx, biz, phone, code, meta)
 	if err != nil {
 		// 有问题
 		return err
@@ -67,7 +75,7 @@ func (svc *codeService) Verify(ctx context.Context, biz string, phone string, in
 }
 
 // 生成一个验证码
-func (svc *codeService) generateCode() string {
+func generateCode() string {
 	// 六位数，num 在 0, 999999 之间，包含 0 和 999999
 	num := rand.Intn(1000000)
 	// 不够六位的，加上前导 0
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/repository"
+	"webook_go/webook/internal/service/email"
+)
+
+// EmailCodeService 通过邮件发送验证码
+// 和 CodeService 共用验证码的缓存、发送限制以及验证次数的逻辑，只是渠道不一样
+type EmailCodeService interface {
+	CodeService
+}
+
+// 不同业务用的邮件模板
+var emailCodeTpls = map[string]string{
+	"login_email":          email.TplLoginCode,
+	"signup_email":         email.TplSignUpCode,
+	"reset_password_email": email.TplResetPasswordCode,
+	"unlock_email":         email.TplUnlockCode,
+	"bind_email":           email.TplBindEmailCode,
+}
+
+type emailCodeService struct {
+	repo     repository.CodeRepository
+	emailSvc email.Service
+}
+
+func NewEmailCodeService(repo repository.CodeRepository, emailSvc email.Service) EmailCodeService {
+	return &emailCodeService{
+		repo:     repo,
+		emailSvc: emailSvc,
+	}
+}
+
+// Send 这里的 addr 就是邮箱，存储的时候和手机号用的是同一套 key
+// 所以不同渠道的 biz 不能重复
+func (svc *emailCodeService) Send(ctx context.Context, biz string, addr string, meta domain.CodeSendMeta) error {
+	tpl, ok := emailCodeTpls[biz]
+	if !ok {
+		return fmt.Errorf("未知的邮件验证码业务 %s", biz)
+	}
+	code := generateCode()
+	subject, content, err := email.Render(tpl, map[string]any{
+		"Code": code,
+		// 和验证码的过期时间保持一致
+		"Minutes": 10,
+	})
+	if err != nil {
+		return err
+	}
+	err = svc.repo.Store(ctx, biz, addr, code, meta)
+	if err != nil {
+		return err
+	}
+	err = svc.emailSvc.Send(ctx, subject, content, addr)
+	if err != nil {
+		err = fmt.Errorf("发送邮件出现异常 %w", err)
+	}
+	return err
+}
+
+func (svc *emailCodeService) Verify(ctx context.Context, biz string, addr string, inputCode string) (bool, error) {
+	return svc.repo.Verify(ctx, biz, addr, inputCode)
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"testing"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/repository"
+	repomocks "webook_go/webook/internal/repository/mocks"
+	"webook_go/webook/internal/service/email/memory"
+)
+
+func TestEmailCodeService_Send(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) repository.CodeRepository
+
+		biz string
+
+		wantErr     error
+		wantSubject string
+	}{
+		{
+			name: "发送成功",
+			mock: func(ctrl *gomock.Controller) repository.CodeRepository {
+				repo := repomocks.NewMockCodeRepository(ctrl)
+				repo.EXPECT().Store(gomock.Any(), "login_email", "123@qq.com",
+					gomock.Any(), domain.CodeSendMeta{IP: "127.0.0.1"}).Return(nil)
+				return repo
+			},
+			biz:         "login_email",
+			wantSubject: "【小微书】登录验证码",
+		},
+		{
+			name: "发送太频繁",
+			mock: func(ctrl *gomock.Controller) repository.CodeRepository {
+				repo := repomocks.NewMockCodeRepository(ctrl)
+				repo.EXPECT().Store(gomock.Any(), "login_email", "123@qq.com",
+					gomock.Any(), gomock.Any()).Return(ErrCodeSendTooMany)
+				return repo
+			},
+			biz:     "login_email",
+			wantErr: ErrCodeSendTooMany,
+		},
+		{
+			name: "未知业务",
+			mock: func(ctrl *gomock.Controller) repository.CodeRepository {
+				return repomocks.NewMockCodeRepository(ctrl)
+			},
+			biz:     "unknown",
+			wantErr: errors.New("未知的邮件验证码业务 unknown"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			emailSvc := memory.NewService()
+			svc := NewEmailCodeService(tc.mock(ctrl), emailSvc)
+			err := svc.Send(context.Background(), tc.biz, "123@qq.com",
+				domain.CodeSendMeta{IP: "127.0.0.1"})
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				assert.Empty(t, emailSvc.Messages())
+				return
+			}
+			msgs := emailSvc.Messages()
+			assert.Len(t, msgs, 1)
+			assert.Equal(t, []string{"123@qq.com"}, msgs[0].To)
+			assert.Equal(t, tc.wantSubject, msgs[0].Subject)
+		})
+	}
+}
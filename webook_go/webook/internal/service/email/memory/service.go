@@ -0,0 +1,42 @@
+package memory
+
+import (
+	"context"
+	"sync"
+)
+
+// Service 把邮件记在内存里面，测试和本地开发用
+type Service struct {
+	mutex sync.Mutex
+	msgs  []Message
+}
+
+type Message struct {
+	To      []string
+	Subject string
+	Content string
+}
+
+func NewService() *Service {
+	return &Service{}
+}
+
+func (s *Service) Send(ctx context.Context, subject, content string, to ...string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.msgs = append(s.msgs, Message{
+		To:      to,
+		Subject: subject,
+		Content: content,
+	})
+	return nil
+}
+
+// Messages 已经发送的邮件
+func (s *Service) Messages() []Message {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	res := make([]Message, len(s.msgs))
+	copy(res, s.msgs)
+	return res
+}
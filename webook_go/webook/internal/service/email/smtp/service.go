@@ -0,0 +1,125 @@
+package smtp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	// From 发件人，不配置的话就用 Username
+	From string
+}
+
+type Service struct {
+	addr string
+	host string
+	from string
+	auth smtp.Auth
+}
+
+func NewService(cfg Config) *Service {
+	from := cfg.From
+	if from == "" {
+		from = cfg.Username
+	}
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+	return &Service{
+		addr: net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		host: cfg.Host,
+		from: from,
+		auth: auth,
+	}
+}
+
+// Send 和 smtp.SendMail 的流程一样，只不过支持了 ctx 超时控制
+// 服务端支持 STARTTLS 的时候会升级成加密连接
+func (s *Service) Send(ctx context.Context, subject, content string, to ...string) error {
+	if len(to) == 0 {
+		return errors.New("收件人不能为空")
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	if ddl, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(ddl)
+	} else {
+		_ = conn.SetDeadline(time.Now().Add(time.Minute))
+	}
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return err
+		}
+	}
+	if s.auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("SMTP 服务器不支持 AUTH")
+		}
+		if err = c.Auth(s.auth); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(s.from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err = c.Rcpt(addr); err != nil {
+			return fmt.Errorf("收件人 %s 有误 %w", addr, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(s.message(subject, content, to)); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// message 拼装邮件内容，标题和正文可能有中文，都要编码
+func (s *Service) message(subject, content string, to []string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("From: " + s.from + "\r\n")
+	buf.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	buf.WriteString("Subject: " + mime.BEncoding.Encode("UTF-8", subject) + "\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n")
+	buf.WriteString("\r\n")
+	encoded := base64.StdEncoding.EncodeToString([]byte(content))
+	// 每行不能超过 76 个字符
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+	return buf.Bytes()
+}
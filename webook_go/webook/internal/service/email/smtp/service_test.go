@@ -0,0 +1,212 @@
+package smtp
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mime"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestService_Send(t *testing.T) {
+	testCases := []struct {
+		name string
+		// 本地 SMTP 服务器是否要求认证
+		requireAuth bool
+		cfg         func(port int) Config
+		to          []string
+
+		wantErr  bool
+		wantFrom string
+		wantAuth string
+	}{
+		{
+			name: "发送成功",
+			cfg: func(port int) Config {
+				return Config{Host: "127.0.0.1", Port: port, From: "noreply@webook.com"}
+			},
+			to:       []string{"123@qq.com"},
+			wantFrom: "noreply@webook.com",
+		},
+		{
+			name:        "带认证",
+			requireAuth: true,
+			cfg: func(port int) Config {
+				return Config{Host: "127.0.0.1", Port: port,
+					Username: "webook@webook.com", Password: "123456"}
+			},
+			to:       []string{"123@qq.com", "456@qq.com"},
+			wantFrom: "webook@webook.com",
+			wantAuth: "\x00webook@webook.com\x00123456",
+		},
+		{
+			name: "服务器不支持认证",
+			cfg: func(port int) Config {
+				return Config{Host: "127.0.0.1", Port: port,
+					Username: "webook@webook.com", Password: "123456"}
+			},
+			to:      []string{"123@qq.com"},
+			wantErr: true,
+		},
+		{
+			name: "没有收件人",
+			cfg: func(port int) Config {
+				return Config{Host: "127.0.0.1", Port: port}
+			},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newFakeSMTPServer(t, tc.requireAuth)
+			svc := NewService(tc.cfg(srv.port()))
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+			err := svc.Send(ctx, "【小微书】登录验证码", "<p>验证码是 123456</p>", tc.to...)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			got := srv.received()
+			assert.Equal(t, tc.wantFrom, got.from)
+			assert.Equal(t, tc.to, got.rcpts)
+			assert.Equal(t, tc.wantAuth, got.auth)
+			msg, err := mail.ReadMessage(strings.NewReader(got.data))
+			require.NoError(t, err)
+			subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+			require.NoError(t, err)
+			assert.Equal(t, "【小微书】登录验证码", subject)
+			body, err := base64.StdEncoding.DecodeString(
+				strings.ReplaceAll(readAll(t, msg), "\r\n", ""))
+			require.NoError(t, err)
+			assert.Equal(t, "<p>验证码是 123456</p>", string(body))
+		})
+	}
+}
+
+func readAll(t *testing.T, msg *mail.Message) string {
+	var sb strings.Builder
+	sc := bufio.NewScanner(msg.Body)
+	for sc.Scan() {
+		sb.WriteString(sc.Text())
+	}
+	require.NoError(t, sc.Err())
+	return sb.String()
+}
+
+type fakeMail struct {
+	from  string
+	rcpts []string
+	auth  string
+	data  string
+}
+
+// fakeSMTPServer 本地的 SMTP 服务器，只实现了发信需要的那几个命令
+type fakeSMTPServer struct {
+	ln          net.Listener
+	requireAuth bool
+	mutex       sync.Mutex
+	mail        fakeMail
+	done        chan struct{}
+}
+
+func newFakeSMTPServer(t *testing.T, requireAuth bool) *fakeSMTPServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &fakeSMTPServer{ln: ln, requireAuth: requireAuth, done: make(chan struct{})}
+	t.Cleanup(func() {
+		_ = ln.Close()
+	})
+	go s.serve()
+	return s
+}
+
+func (s *fakeSMTPServer) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTPServer) received() fakeMail {
+	select {
+	case <-s.done:
+	case <-time.After(time.Second * 5):
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.mail
+}
+
+func (s *fakeSMTPServer) serve() {
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	defer close(s.done)
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		_, _ = conn.Write([]byte(line + "\r\n"))
+	}
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		s.mutex.Lock()
+		switch cmd {
+		case "EHLO", "HELO":
+			if s.requireAuth {
+				reply("250-localhost")
+				reply("250 AUTH PLAIN")
+			} else {
+				reply("250 localhost")
+			}
+		case "AUTH":
+			// AUTH PLAIN base64(\x00user\x00password)
+			parts := strings.Fields(line)
+			decoded, _ := base64.StdEncoding.DecodeString(parts[len(parts)-1])
+			s.mail.auth = string(decoded)
+			reply("235 OK")
+		case "MAIL":
+			s.mail.from = strings.Trim(strings.TrimPrefix(line, "MAIL FROM:"), "<>")
+			reply("250 OK")
+		case "RCPT":
+			s.mail.rcpts = append(s.mail.rcpts, strings.Trim(strings.TrimPrefix(line, "RCPT TO:"), "<>"))
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var sb strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					s.mutex.Unlock()
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				sb.WriteString(l)
+			}
+			s.mail.data = sb.String()
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			s.mutex.Unlock()
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+		s.mutex.Unlock()
+	}
+}
@@ -0,0 +1,48 @@
+package email
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+)
+
+// 模板的名字，和 templates 目录下的文件名对应
+const (
+	// TplLoginCode 邮箱登录验证码
+	TplLoginCode = "login_code"
+	// TplSignUpCode 注册验证码
+	TplSignUpCode = "signup_code"
+	// TplActivation 注册之后的激活邮件
+	TplActivation = "activation"
+	// TplResetPasswordCode 重置密码验证码
+	TplResetPasswordCode = "reset_password_code"
+	// TplUnlockCode 登录失败太多次被锁定之后的解锁验证码
+	TplUnlockCode = "unlock_code"
+	// TplBindEmailCode 登录之后绑定邮箱的验证码
+	TplBindEmailCode = "bind_email_code"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+// 每个模板文件里面都要定义 subject 和 body 两部分
+var templates = template.Must(template.ParseFS(templateFS, "templates/*.tmpl"))
+
+// Render 渲染模板，返回邮件的标题和正文
+func Render(tpl string, data any) (subject string, content string, err error) {
+	t := templates.Lookup(tpl + ".tmpl")
+	if t == nil {
+		return "", "", fmt.Errorf("邮件模板 %s 不存在", tpl)
+	}
+	var buf bytes.Buffer
+	if err = t.ExecuteTemplate(&buf, tpl+".subject", data); err != nil {
+		return "", "", err
+	}
+	subject = buf.String()
+	buf.Reset()
+	if err = t.ExecuteTemplate(&buf, tpl+".body", data); err != nil {
+		return "", "", err
+	}
+	return subject, buf.String(), nil
+}
@@ -0,0 +1,25 @@
+package email
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	subject, content, err := Render(TplLoginCode, map[string]any{
+		"Code":    "123456",
+		"Minutes": 10,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "【小微书】登录验证码", subject)
+	assert.Contains(t, content, "<b>123456</b>")
+	assert.Contains(t, content, "10 分钟内有效")
+
+	subject, _, err = Render(TplSignUpCode, map[string]any{"Code": "123456"})
+	require.NoError(t, err)
+	assert.Equal(t, "【小微书】注册验证码", subject)
+
+	_, _, err = Render("not_exist", nil)
+	assert.Error(t, err)
+}
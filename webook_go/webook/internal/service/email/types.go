@@ -0,0 +1,9 @@
+package email
+
+import "context"
+
+// Service 邮件渠道，和 sms.Service 是对等的
+// content 是已经渲染好的 HTML 正文
+type Service interface {
+	Send(ctx context.Context, subject, content string, to ...string) error
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"time"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/repository"
+	"webook_go/webook/internal/service/oauth2"
+	"webook_go/webook/pkg/degrade"
+	"webook_go/webook/pkg/logger"
+)
+
+// tokenRefreshAhead 快过期的时候就提前刷新，免得拿出去用的时候刚好过期
+const tokenRefreshAhead = time.Minute * 5
+
+// IdentityService 第三方登录，所有平台共用
+type IdentityService interface {
+	// FindOrCreate 根据第三方账号找到用户，第一次登录的话新建一个用户
+	FindOrCreate(ctx context.Context, identity domain.Identity) (domain.User, error)
+	// AccessToken 调用第三方平台接口用的 token，过期了会用 refresh_token 刷新
+	// refresh_token 也过期了返回 oauth2.ErrTokenExpired，要让用户重新授权
+	AccessToken(ctx context.Context, uid int64, provider string) (string, error)
+	// RefreshExpiring 后台提前刷新快过期的 access_token，一次最多 limit 个
+	// 这样调用第三方平台接口的时候拿到的基本都是有效的，refresh_token 过期了的会被清掉
+	RefreshExpiring(ctx context.Context, limit int) error
+}
+
+type identityService struct {
+	repo     repository.IdentityRepository
+	userRepo repository.UserRepository
+	// refreshers 支持刷新 access_token 的平台
+	refreshers map[string]oauth2.TokenRefresher
+	now        func() time.Time
+	l          logger.LoggerV1
+}
+
+func NewIdentityService(repo repository.IdentityRepository, userRepo repository.UserRepository,
+	providers []oauth2.Provider, l logger.LoggerV1) IdentityService {
+	refreshers := make(map[string]oauth2.TokenRefresher, len(providers))
+	for _, p := range providers {
+		if r, ok := p.(oauth2.TokenRefresher); ok {
+			refreshers[p.Name()] = r
+		}
+	}
+	return &identityService{
+		repo:       repo,
+		userRepo:   userRepo,
+		refreshers: refreshers,
+		now:        time.Now,
+		l:          l,
+	}
+}
+
+func (svc *identityService) FindOrCreate(ctx context.Context, identity domain.Identity) (domain.User, error) {
+	u, err := svc.findOrCreate(ctx, identity)
+	if err == nil && u.Banned() {
+		return domain.User{}, ErrUserBanned
+	}
+	return u, err
+}
+
+func (svc *identityService) findOrCreate(ctx context.Context, identity domain.Identity) (domain.User, error) {
+	found, err := svc.repo.FindByProvider(ctx, identity.Provider, identity.Subject)
+	if err == nil {
+		if identity.AccessToken != "" {
+			identity.Uid = found.Uid
+			// 保存失败不影响登录，下次用的时候会刷新或者让用户重新授权
+			if err = svc.repo.UpdateToken(ctx, identity); err != nil {
+				svc.l.Error("保存第三方平台 token 失败", logger.Error(err),
+					logger.String("provider", identity.Provider))
+			}
+		}
+		return svc.userRepo.FindById(ctx, found.Uid)
+	}
+	if err != repository.ErrIdentityNotFound {
+		return domain.User{}, err
+	}
+
+	// 以前微信的 openid 是存在 users 表里面的，找到了就补一条第三方账号
+	if identity.Provider == domain.IdentityProviderWechat {
+		u, err := svc.userRepo.FindByWechat(ctx, identity.Subject)
+		if err == nil {
+			identity.Uid = u.Id
+			err = svc.repo.Create(ctx, identity)
+			if err != nil && err != repository.ErrIdentityDuplicate {
+				// 补不上也不影响这一次登录，下一次还会走到这里
+				svc.l.Error("迁移微信账号失败", logger.Error(err), logger.Int64("uid", u.Id))
+			}
+			return u, nil
+		}
+		if err != repository.ErrUserNotFound {
+			return domain.User{}, err
+		}
+	}
+
+	// 和手机号登录一样，降级的时候不注册新用户
+	if degrade.Enabled() {
+		return domain.User{}, ErrDegraded
+	}
+	uid, err := svc.repo.CreateWithUser(ctx, identity)
+	if err == repository.ErrIdentityDuplicate {
+		// 并发登录，另外一个请求已经创建好了
+		found, err = svc.repo.FindByProvider(ctx, identity.Provider, identity.Subject)
+		if err != nil {
+			return domain.User{}, err
+		}
+		uid = found.Uid
+	} else if err != nil {
+		return domain.User{}, err
+	}
+	return svc.userRepo.FindById(ctx, uid)
+}
+
+func (svc *identityService) AccessToken(ctx context.Context, uid int64, provider string) (string, error) {
+	identities, err := svc.repo.FindByUid(ctx, uid)
+	if err != nil {
+		return "", err
+	}
+	var identity domain.Identity
+	for _, i := range identities {
+		if i.Provider == provider {
+			identity = i
+			break
+		}
+	}
+	// 老数据里面没有存 token，也要重新授权
+	if identity.AccessToken == "" {
+		return "", oauth2.ErrTokenExpired
+	}
+	if identity.TokenExpiresAt.IsZero() || svc.now().Add(tokenRefreshAhead).Before(identity.TokenExpiresAt) {
+		return identity.AccessToken, nil
+	}
+	return svc.refresh(ctx, identity)
+}
+
+func (svc *identityService) RefreshExpiring(ctx context.Context, limit int) error {
+	if len(svc.refreshers) == 0 {
+		return nil
+	}
+	providers := make([]string, 0, len(svc.refreshers))
+	for p := range svc.refreshers {
+		providers = append(providers, p)
+	}
+	identities, err := svc.repo.FindExpiring(ctx, providers, svc.now().Add(tokenRefreshAhead), limit)
+	if err != nil {
+		return err
+	}
+	for _, identity := range identities {
+		// 一个失败了不影响别的，下一轮还会查出来
+		if _, err = svc.refresh(ctx, identity); err != nil {
+			svc.l.Error("刷新第三方平台 token 失败", logger.Error(err),
+				logger.Int64("uid", identity.Uid), logger.String("provider", identity.Provider))
+		}
+	}
+	return nil
+}
+
+// refresh 用 refresh_token 换新的 access_token 并保存
+func (svc *identityService) refresh(ctx context.Context, identity domain.Identity) (string, error) {
+	refresher, ok := svc.refreshers[identity.Provider]
+	if !ok {
+		return "", oauth2.ErrRefreshUnsupported
+	}
+	token, err := refresher.Refresh(ctx, identity)
+	if err == oauth2.ErrTokenExpired {
+		// refresh_token 也过期了，清掉，不然每一轮都会查出来，用户重新授权之后会再存
+		identity.AccessToken, identity.RefreshToken, identity.TokenExpiresAt = "", "", time.Time{}
+		if er := svc.repo.UpdateToken(ctx, identity); er != nil {
+			svc.l.Error("清除过期的 token 失败", logger.Error(er), logger.Int64("uid", identity.Uid))
+		}
+		return "", err
+	}
+	if err != nil {
+		return "", err
+	}
+	identity.AccessToken = token.AccessToken
+	identity.TokenExpiresAt = token.TokenExpiresAt
+	// 微信刷新的时候 refresh_token 不变，有的平台会换一个新的
+	if token.RefreshToken != "" {
+		identity.RefreshToken = token.RefreshToken
+	}
+	if err = svc.repo.UpdateToken(ctx, identity); err != nil {
+		// 新的 token 已经拿到了，这次还能用
+		svc.l.Error("保存刷新后的 token 失败", logger.Error(err), logger.Int64("uid", identity.Uid))
+	}
+	return identity.AccessToken, nil
+}
@@ -0,0 +1,291 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"testing"
+	"time"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/repository"
+	repomocks "webook_go/webook/internal/repository/mocks"
+	"webook_go/webook/internal/service/oauth2"
+	"webook_go/webook/pkg/logger"
+)
+
+func TestIdentityService_FindOrCreate(t *testing.T) {
+	github := domain.Identity{Provider: domain.IdentityProviderGithub, Subject: "12345", Nickname: "octocat"}
+	wechat := domain.Identity{Provider: domain.IdentityProviderWechat, Subject: "openid", UnionID: "unionid"}
+	testCases := []struct {
+		name     string
+		mock     func(ctrl *gomock.Controller) (repository.IdentityRepository, repository.UserRepository)
+		identity domain.Identity
+
+		wantUser domain.User
+		wantErr  error
+	}{
+		{
+			name: "已经绑定过",
+			mock: func(ctrl *gomock.Controller) (repository.IdentityRepository, repository.UserRepository) {
+				repo := repomocks.NewMockIdentityRepository(ctrl)
+				repo.EXPECT().FindByProvider(gomock.Any(), "github", "12345").
+					Return(domain.Identity{Uid: 123, Provider: "github", Subject: "12345"}, nil)
+				userRepo := repomocks.NewMockUserRepository(ctrl)
+				userRepo.EXPECT().FindById(gomock.Any(), int64(123)).Return(domain.User{Id: 123}, nil)
+				return repo, userRepo
+			},
+			identity: github,
+			wantUser: domain.User{Id: 123},
+		},
+		{
+			name: "被封禁了",
+			mock: func(ctrl *gomock.Controller) (repository.IdentityRepository, repository.UserRepository) {
+				repo := repomocks.NewMockIdentityRepository(ctrl)
+				repo.EXPECT().FindByProvider(gomock.Any(), "github", "12345").
+					Return(domain.Identity{Uid: 123, Provider: "github", Subject: "12345"}, nil)
+				userRepo := repomocks.NewMockUserRepository(ctrl)
+				userRepo.EXPECT().FindById(gomock.Any(), int64(123)).
+					Return(domain.User{Id: 123, BannedAt: time.UnixMilli(100)}, nil)
+				return repo, userRepo
+			},
+			identity: github,
+			wantErr:  ErrUserBanned,
+		},
+		{
+			name: "登录的时候更新 token",
+			mock: func(ctrl *gomock.Controller) (repository.IdentityRepository, repository.UserRepository) {
+				repo := repomocks.NewMockIdentityRepository(ctrl)
+				repo.EXPECT().FindByProvider(gomock.Any(), "wechat", "openid").
+					Return(domain.Identity{Uid: 100, Provider: "wechat", Subject: "openid"}, nil)
+				repo.EXPECT().UpdateToken(gomock.Any(), domain.Identity{
+					Uid: 100, Provider: "wechat", Subject: "openid", AccessToken: "access",
+				}).Return(nil)
+				userRepo := repomocks.NewMockUserRepository(ctrl)
+				userRepo.EXPECT().FindById(gomock.Any(), int64(100)).Return(domain.User{Id: 100}, nil)
+				return repo, userRepo
+			},
+			identity: domain.Identity{Provider: "wechat", Subject: "openid", AccessToken: "access"},
+			wantUser: domain.User{Id: 100},
+		},
+		{
+			name: "第一次登录，新建用户",
+			mock: func(ctrl *gomock.Controller) (repository.IdentityRepository, repository.UserRepository) {
+				repo := repomocks.NewMockIdentityRepository(ctrl)
+				repo.EXPECT().FindByProvider(gomock.Any(), "github", "12345").
+					Return(domain.Identity{}, repository.ErrIdentityNotFound)
+				repo.EXPECT().CreateWithUser(gomock.Any(), github).Return(int64(124), nil)
+				userRepo := repomocks.NewMockUserRepository(ctrl)
+				userRepo.EXPECT().FindById(gomock.Any(), int64(124)).
+					Return(domain.User{Id: 124, Nickname: "octocat"}, nil)
+				return repo, userRepo
+			},
+			identity: github,
+			wantUser: domain.User{Id: 124, Nickname: "octocat"},
+		},
+		{
+			name: "并发登录，另一个请求已经创建了",
+			mock: func(ctrl *gomock.Controller) (repository.IdentityRepository, repository.UserRepository) {
+				repo := repomocks.NewMockIdentityRepository(ctrl)
+				gomock.InOrder(
+					repo.EXPECT().FindByProvider(gomock.Any(), "github", "12345").
+						Return(domain.Identity{}, repository.ErrIdentityNotFound),
+					repo.EXPECT().CreateWithUser(gomock.Any(), github).
+						Return(int64(0), repository.ErrIdentityDuplicate),
+					repo.EXPECT().FindByProvider(gomock.Any(), "github", "12345").
+						Return(domain.Identity{Uid: 125}, nil),
+				)
+				userRepo := repomocks.NewMockUserRepository(ctrl)
+				userRepo.EXPECT().FindById(gomock.Any(), int64(125)).Return(domain.User{Id: 125}, nil)
+				return repo, userRepo
+			},
+			identity: github,
+			wantUser: domain.User{Id: 125},
+		},
+		{
+			name: "以前用微信登录过，迁移过来",
+			mock: func(ctrl *gomock.Controller) (repository.IdentityRepository, repository.UserRepository) {
+				repo := repomocks.NewMockIdentityRepository(ctrl)
+				repo.EXPECT().FindByProvider(gomock.Any(), "wechat", "openid").
+					Return(domain.Identity{}, repository.ErrIdentityNotFound)
+				migrated := wechat
+				migrated.Uid = 100
+				repo.EXPECT().Create(gomock.Any(), migrated).Return(nil)
+				userRepo := repomocks.NewMockUserRepository(ctrl)
+				userRepo.EXPECT().FindByWechat(gomock.Any(), "openid").Return(domain.User{Id: 100}, nil)
+				return repo, userRepo
+			},
+			identity: wechat,
+			wantUser: domain.User{Id: 100},
+		},
+		{
+			name: "微信第一次登录",
+			mock: func(ctrl *gomock.Controller) (repository.IdentityRepository, repository.UserRepository) {
+				repo := repomocks.NewMockIdentityRepository(ctrl)
+				repo.EXPECT().FindByProvider(gomock.Any(), "wechat", "openid").
+					Return(domain.Identity{}, repository.ErrIdentityNotFound)
+				repo.EXPECT().CreateWithUser(gomock.Any(), wechat).Return(int64(126), nil)
+				userRepo := repomocks.NewMockUserRepository(ctrl)
+				userRepo.EXPECT().FindByWechat(gomock.Any(), "openid").
+					Return(domain.User{}, repository.ErrUserNotFound)
+				userRepo.EXPECT().FindById(gomock.Any(), int64(126)).Return(domain.User{Id: 126}, nil)
+				return repo, userRepo
+			},
+			identity: wechat,
+			wantUser: domain.User{Id: 126},
+		},
+		{
+			name: "查询失败",
+			mock: func(ctrl *gomock.Controller) (repository.IdentityRepository, repository.UserRepository) {
+				repo := repomocks.NewMockIdentityRepository(ctrl)
+				repo.EXPECT().FindByProvider(gomock.Any(), "github", "12345").
+					Return(domain.Identity{}, errors.New("db 错误"))
+				return repo, repomocks.NewMockUserRepository(ctrl)
+			},
+			identity: github,
+			wantErr:  errors.New("db 错误"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repo, userRepo := tc.mock(ctrl)
+			svc := NewIdentityService(repo, userRepo, nil, &logger.NopLogger{})
+			u, err := svc.FindOrCreate(context.Background(), tc.identity)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantUser, u)
+		})
+	}
+}
+
+// fakeRefresher 只实现了刷新 token
+type fakeRefresher struct {
+	oauth2.Provider
+	token domain.Identity
+	err   error
+}
+
+func (f *fakeRefresher) Name() string {
+	return domain.IdentityProviderWechat
+}
+
+func (f *fakeRefresher) Refresh(ctx context.Context, identity domain.Identity) (domain.Identity, error) {
+	return f.token, f.err
+}
+
+func TestIdentityService_AccessToken(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	stored := domain.Identity{
+		Uid: 123, Provider: "wechat", Subject: "openid",
+		AccessToken: "access-1", RefreshToken: "refresh-1",
+	}
+	testCases := []struct {
+		name      string
+		expiresAt time.Time
+		refresher *fakeRefresher
+		mock      func(repo *repomocks.MockIdentityRepository)
+
+		wantToken string
+		wantErr   error
+	}{
+		{
+			name:      "没有过期",
+			expiresAt: now.Add(time.Hour),
+			wantToken: "access-1",
+		},
+		{
+			name:      "快过期了，刷新",
+			expiresAt: now.Add(time.Minute),
+			refresher: &fakeRefresher{token: domain.Identity{
+				AccessToken: "access-2", TokenExpiresAt: now.Add(time.Hour * 2),
+			}},
+			mock: func(repo *repomocks.MockIdentityRepository) {
+				refreshed := stored
+				refreshed.AccessToken = "access-2"
+				refreshed.TokenExpiresAt = now.Add(time.Hour * 2)
+				repo.EXPECT().UpdateToken(gomock.Any(), refreshed).Return(nil)
+			},
+			wantToken: "access-2",
+		},
+		{
+			name:      "refresh_token 也过期了",
+			expiresAt: now.Add(-time.Minute),
+			refresher: &fakeRefresher{err: oauth2.ErrTokenExpired},
+			mock: func(repo *repomocks.MockIdentityRepository) {
+				// 清掉，用户重新授权之前不会再刷新
+				cleared := stored
+				cleared.AccessToken, cleared.RefreshToken = "", ""
+				repo.EXPECT().UpdateToken(gomock.Any(), cleared).Return(nil)
+			},
+			wantErr: oauth2.ErrTokenExpired,
+		},
+		{
+			name:      "不支持刷新",
+			expiresAt: now.Add(-time.Minute),
+			wantErr:   oauth2.ErrRefreshUnsupported,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repo := repomocks.NewMockIdentityRepository(ctrl)
+			identity := stored
+			identity.TokenExpiresAt = tc.expiresAt
+			repo.EXPECT().FindByUid(gomock.Any(), int64(123)).Return([]domain.Identity{identity}, nil)
+			if tc.mock != nil {
+				tc.mock(repo)
+			}
+			var providers []oauth2.Provider
+			if tc.refresher != nil {
+				providers = append(providers, tc.refresher)
+			}
+			svc := NewIdentityService(repo, repomocks.NewMockUserRepository(ctrl), providers,
+				&logger.NopLogger{}).(*identityService)
+			svc.now = func() time.Time {
+				return now
+			}
+			token, err := svc.AccessToken(context.Background(), 123, "wechat")
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantToken, token)
+		})
+	}
+}
+
+func TestIdentityService_RefreshExpiring(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := repomocks.NewMockIdentityRepository(ctrl)
+	refresher := &fakeRefresher{token: domain.Identity{
+		AccessToken: "access-2", TokenExpiresAt: now.Add(time.Hour * 2),
+	}}
+	svc := NewIdentityService(repo, repomocks.NewMockUserRepository(ctrl), []oauth2.Provider{refresher},
+		&logger.NopLogger{}).(*identityService)
+	svc.now = func() time.Time {
+		return now
+	}
+	expiring := domain.Identity{
+		Uid: 123, Provider: "wechat", Subject: "openid",
+		AccessToken: "access-1", RefreshToken: "refresh-1", TokenExpiresAt: now.Add(time.Minute),
+	}
+	// 只查支持刷新的平台，提前 tokenRefreshAhead 刷新
+	repo.EXPECT().FindExpiring(gomock.Any(), []string{"wechat"}, now.Add(tokenRefreshAhead), 100).
+		Return([]domain.Identity{expiring}, nil)
+	refreshed := expiring
+	refreshed.AccessToken = "access-2"
+	refreshed.TokenExpiresAt = now.Add(time.Hour * 2)
+	repo.EXPECT().UpdateToken(gomock.Any(), refreshed).Return(nil)
+	assert.NoError(t, svc.RefreshExpiring(context.Background(), 100))
+
+	// 刷新失败了只打日志，不影响别的
+	refresher.err = errors.New("网络错误")
+	repo.EXPECT().FindExpiring(gomock.Any(), []string{"wechat"}, now.Add(tokenRefreshAhead), 100).
+		Return([]domain.Identity{expiring}, nil)
+	assert.NoError(t, svc.RefreshExpiring(context.Background(), 100))
+
+	// 没有支持刷新的平台，什么都不查
+	svc = NewIdentityService(repo, repomocks.NewMockUserRepository(ctrl), nil, &logger.NopLogger{}).(*identityService)
+	assert.NoError(t, svc.RefreshExpiring(context.Background(), 100))
+}
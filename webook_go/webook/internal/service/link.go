@@ -0,0 +1,262 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/repository"
+)
+
+var (
+	// ErrLinkConflict 要绑定的手机号、邮箱或者第三方账号属于另外一个账号，可以用合并凭证合并
+	ErrLinkConflict = errors.New("已经绑定了其他账号")
+	// ErrAlreadyLinked 同一个平台只能绑定一个第三方账号，要换的话先解绑
+	ErrAlreadyLinked = errors.New("已经绑定过这个平台的账号了")
+	ErrNotLinked     = errors.New("没有绑定")
+	// ErrLastLoginMethod 解绑之后就没办法登录了
+	ErrLastLoginMethod    = errors.New("至少要保留一种登录方式")
+	ErrMergeTicketInvalid = repository.ErrMergeTicketInvalid
+)
+
+// 解绑的时候用的类型，第三方账号用平台的名字
+const (
+	LinkPhone = "phone"
+	LinkEmail = "email"
+)
+
+// LinkService 登录之后绑定、解绑手机号、邮箱和第三方账号，冲突的时候合并账号
+// 手机号和邮箱的验证码在调用之前就要校验过
+type LinkService interface {
+	Links(ctx context.Context, uid int64) (domain.AccountLinks, error)
+	// BindPhone 冲突的时候返回 ErrLinkConflict 和合并凭证
+	BindPhone(ctx context.Context, uid int64, phone string) (string, error)
+	BindEmail(ctx context.Context, uid int64, email string) (string, error)
+	// BindIdentity identity 是第三方登录换回来的，已经证明了用户拥有这个账号
+	BindIdentity(ctx context.Context, uid int64, identity domain.Identity) (string, error)
+	// Unbind kind 是 phone、email 或者第三方平台的名字
+	Unbind(ctx context.Context, uid int64, kind string) error
+	// Merge 用合并凭证把另外一个账号合并到 uid 里面，返回被合并的账号
+	Merge(ctx context.Context, uid int64, ticket string) (int64, error)
+}
+
+type linkService struct {
+	userRepo     repository.UserRepository
+	identityRepo repository.IdentityRepository
+	ticketRepo   repository.MergeTicketRepository
+}
+
+func NewLinkService(userRepo repository.UserRepository, identityRepo repository.IdentityRepository,
+	ticketRepo repository.MergeTicketRepository) LinkService {
+	return &linkService{
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+		ticketRepo:   ticketRepo,
+	}
+}
+
+func (svc *linkService) Links(ctx context.Context, uid int64) (domain.AccountLinks, error) {
+	u, identities, err := svc.find(ctx, uid)
+	if err != nil {
+		return domain.AccountLinks{}, err
+	}
+	res := domain.AccountLinks{
+		Phone: u.Phone,
+		Email: u.Email,
+	}
+	for _, i := range identities {
+		res.Providers = append(res.Providers, i.Provider)
+	}
+	return res, nil
+}
+
+func (svc *linkService) BindPhone(ctx context.Context, uid int64, phone string) (string, error) {
+	return svc.bindContact(ctx, uid, phone, svc.userRepo.FindByPhone, svc.userRepo.UpdatePhone)
+}
+
+func (svc *linkService) BindEmail(ctx context.Context, uid int64, email string) (string, error) {
+	return svc.bindContact(ctx, uid, email, svc.userRepo.FindByEmail, svc.userRepo.UpdateEmail)
+}
+
+// bindContact 手机号和邮箱的逻辑是一样的，已经绑定过的话直接换成新的
+func (svc *linkService) bindContact(ctx context.Context, uid int64, val string,
+	find func(ctx context.Context, val string) (domain.User, error),
+	update func(ctx context.Context, id int64, val string) error) (string, error) {
+	owner, err := find(ctx, val)
+	switch err {
+	case nil:
+		if owner.Id == uid {
+			return "", nil
+		}
+		return svc.conflict(ctx, owner.Id, uid)
+	case repository.ErrUserNotFound:
+	default:
+		return "", err
+	}
+	err = update(ctx, uid, val)
+	if err == repository.ErrUserDuplicate {
+		// 并发绑定，被别的账号抢先了
+		owner, err = find(ctx, val)
+		if err != nil {
+			return "", err
+		}
+		return svc.conflict(ctx, owner.Id, uid)
+	}
+	return "", err
+}
+
+func (svc *linkService) BindIdentity(ctx context.Context, uid int64, identity domain.Identity) (string, error) {
+	owner, err := svc.identityOwner(ctx, identity)
+	if err != nil {
+		return "", err
+	}
+	if owner == uid {
+		return "", nil
+	}
+	if owner != 0 {
+		return svc.conflict(ctx, owner, uid)
+	}
+	_, identities, err := svc.find(ctx, uid)
+	if err != nil {
+		return "", err
+	}
+	if svc.hasProvider(identities, identity.Provider) {
+		return "", ErrAlreadyLinked
+	}
+	identity.Uid = uid
+	err = svc.identityRepo.Create(ctx, identity)
+	if err == repository.ErrIdentityDuplicate {
+		owner, err = svc.identityOwner(ctx, identity)
+		if err != nil {
+			return "", err
+		}
+		return svc.conflict(ctx, owner, uid)
+	}
+	return "", err
+}
+
+func (svc *linkService) Unbind(ctx context.Context, uid int64, kind string) error {
+	u, identities, err := svc.find(ctx, uid)
+	if err != nil {
+		return err
+	}
+	// 能登录的方式，解绑之后至少还要剩一个
+	methods := len(identities)
+	if u.Phone != "" {
+		methods++
+	}
+	if u.Email != "" {
+		methods++
+	}
+	switch kind {
+	case LinkPhone:
+		if u.Phone == "" {
+			return ErrNotLinked
+		}
+	case LinkEmail:
+		if u.Email == "" {
+			return ErrNotLinked
+		}
+	default:
+		if !svc.hasProvider(identities, kind) {
+			return ErrNotLinked
+		}
+	}
+	if methods <= 1 {
+		return ErrLastLoginMethod
+	}
+	switch kind {
+	case LinkPhone:
+		return svc.userRepo.UpdatePhone(ctx, uid, "")
+	case LinkEmail:
+		return svc.userRepo.UpdateEmail(ctx, uid, "")
+	}
+	if kind == domain.IdentityProviderWechat && u.WechatInfo.OpenID != "" {
+		err = svc.userRepo.ClearWechat(ctx, uid)
+		if err != nil {
+			return err
+		}
+	}
+	err = svc.identityRepo.Delete(ctx, uid, kind)
+	if err == repository.ErrIdentityNotFound {
+		// 只有 users 表里面的老数据
+		return nil
+	}
+	return err
+}
+
+func (svc *linkService) Merge(ctx context.Context, uid int64, ticket string) (int64, error) {
+	from, to, err := svc.ticketRepo.Take(ctx, ticket)
+	if err != nil {
+		return 0, err
+	}
+	// 凭证是发给当前账号的，不能拿别人的来用，也不能让别人用掉
+	if to != uid {
+		_ = svc.ticketRepo.Set(ctx, ticket, from, to)
+		return 0, ErrMergeTicketInvalid
+	}
+	err = svc.userRepo.Merge(ctx, from, to)
+	if err != nil {
+		// 合并到一半失败了，冲突可能已经没有了，不会再发新的凭证，放回去让用户重试
+		_ = svc.ticketRepo.Set(ctx, ticket, from, to)
+	}
+	return from, err
+}
+
+// find 返回用户和他绑定的第三方账号，以前存在 users 表里面的微信也算上
+func (svc *linkService) find(ctx context.Context, uid int64) (domain.User, []domain.Identity, error) {
+	u, err := svc.userRepo.FindById(ctx, uid)
+	if err != nil {
+		return domain.User{}, nil, err
+	}
+	identities, err := svc.identityRepo.FindByUid(ctx, uid)
+	if err != nil {
+		return domain.User{}, nil, err
+	}
+	if u.WechatInfo.OpenID != "" && !svc.hasProvider(identities, domain.IdentityProviderWechat) {
+		identities = append(identities, domain.Identity{
+			Uid:      uid,
+			Provider: domain.IdentityProviderWechat,
+			Subject:  u.WechatInfo.OpenID,
+			UnionID:  u.WechatInfo.UnionID,
+		})
+	}
+	return u, identities, nil
+}
+
+func (svc *linkService) hasProvider(identities []domain.Identity, provider string) bool {
+	for _, i := range identities {
+		if i.Provider == provider {
+			return true
+		}
+	}
+	return false
+}
+
+// identityOwner 第三方账号属于哪个用户，没有绑定过返回 0
+func (svc *linkService) identityOwner(ctx context.Context, identity domain.Identity) (int64, error) {
+	found, err := svc.identityRepo.FindByProvider(ctx, identity.Provider, identity.Subject)
+	if err == nil {
+		return found.Uid, nil
+	}
+	if err != repository.ErrIdentityNotFound {
+		return 0, err
+	}
+	if identity.Provider != domain.IdentityProviderWechat {
+		return 0, nil
+	}
+	u, err := svc.userRepo.FindByWechat(ctx, identity.Subject)
+	if err == repository.ErrUserNotFound {
+		return 0, nil
+	}
+	return u.Id, err
+}
+
+func (svc *linkService) conflict(ctx context.Context, from, to int64) (string, error) {
+	ticket := uuid.New().String()
+	err := svc.ticketRepo.Set(ctx, ticket, from, to)
+	if err != nil {
+		return "", err
+	}
+	return ticket, ErrLinkConflict
+}
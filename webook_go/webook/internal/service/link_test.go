@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"testing"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/repository"
+	repomocks "webook_go/webook/internal/repository/mocks"
+)
+
+type linkMocks struct {
+	userRepo     *repomocks.MockUserRepository
+	identityRepo *repomocks.MockIdentityRepository
+	ticketRepo   *repomocks.MockMergeTicketRepository
+}
+
+func newLinkMocks(ctrl *gomock.Controller) linkMocks {
+	return linkMocks{
+		userRepo:     repomocks.NewMockUserRepository(ctrl),
+		identityRepo: repomocks.NewMockIdentityRepository(ctrl),
+		ticketRepo:   repomocks.NewMockMergeTicketRepository(ctrl),
+	}
+}
+
+func TestLinkService_BindPhone(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(m linkMocks)
+
+		wantTicket bool
+		wantErr    error
+	}{
+		{
+			name: "绑定成功",
+			mock: func(m linkMocks) {
+				m.userRepo.EXPECT().FindByPhone(gomock.Any(), "15212345678").
+					Return(domain.User{}, repository.ErrUserNotFound)
+				m.userRepo.EXPECT().UpdatePhone(gomock.Any(), int64(123), "15212345678").Return(nil)
+			},
+		},
+		{
+			name: "已经是自己的了",
+			mock: func(m linkMocks) {
+				m.userRepo.EXPECT().FindByPhone(gomock.Any(), "15212345678").
+					Return(domain.User{Id: 123}, nil)
+			},
+		},
+		{
+			name: "属于另外一个账号",
+			mock: func(m linkMocks) {
+				m.userRepo.EXPECT().FindByPhone(gomock.Any(), "15212345678").
+					Return(domain.User{Id: 456}, nil)
+				m.ticketRepo.EXPECT().Set(gomock.Any(), gomock.Any(), int64(456), int64(123)).Return(nil)
+			},
+			wantTicket: true,
+			wantErr:    ErrLinkConflict,
+		},
+		{
+			name: "并发绑定被抢了",
+			mock: func(m linkMocks) {
+				gomock.InOrder(
+					m.userRepo.EXPECT().FindByPhone(gomock.Any(), "15212345678").
+						Return(domain.User{}, repository.ErrUserNotFound),
+					m.userRepo.EXPECT().UpdatePhone(gomock.Any(), int64(123), "15212345678").
+						Return(repository.ErrUserDuplicate),
+					m.userRepo.EXPECT().FindByPhone(gomock.Any(), "15212345678").
+						Return(domain.User{Id: 456}, nil),
+				)
+				m.ticketRepo.EXPECT().Set(gomock.Any(), gomock.Any(), int64(456), int64(123)).Return(nil)
+			},
+			wantTicket: true,
+			wantErr:    ErrLinkConflict,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			m := newLinkMocks(ctrl)
+			tc.mock(m)
+			svc := NewLinkService(m.userRepo, m.identityRepo, m.ticketRepo)
+			ticket, err := svc.BindPhone(context.Background(), 123, "15212345678")
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantTicket, ticket != "")
+		})
+	}
+}
+
+func TestLinkService_BindIdentity(t *testing.T) {
+	wechat := domain.Identity{Provider: domain.IdentityProviderWechat, Subject: "openid"}
+	testCases := []struct {
+		name string
+		mock func(m linkMocks)
+
+		wantTicket bool
+		wantErr    error
+	}{
+		{
+			name: "绑定成功",
+			mock: func(m linkMocks) {
+				m.identityRepo.EXPECT().FindByProvider(gomock.Any(), "wechat", "openid").
+					Return(domain.Identity{}, repository.ErrIdentityNotFound)
+				m.userRepo.EXPECT().FindByWechat(gomock.Any(), "openid").
+					Return(domain.User{}, repository.ErrUserNotFound)
+				m.userRepo.EXPECT().FindById(gomock.Any(), int64(123)).Return(domain.User{Id: 123}, nil)
+				m.identityRepo.EXPECT().FindByUid(gomock.Any(), int64(123)).Return(nil, nil)
+				m.identityRepo.EXPECT().Create(gomock.Any(), domain.Identity{
+					Uid: 123, Provider: "wechat", Subject: "openid",
+				}).Return(nil)
+			},
+		},
+		{
+			name: "以前用微信登录过的另外一个账号",
+			mock: func(m linkMocks) {
+				m.identityRepo.EXPECT().FindByProvider(gomock.Any(), "wechat", "openid").
+					Return(domain.Identity{}, repository.ErrIdentityNotFound)
+				m.userRepo.EXPECT().FindByWechat(gomock.Any(), "openid").
+					Return(domain.User{Id: 456}, nil)
+				m.ticketRepo.EXPECT().Set(gomock.Any(), gomock.Any(), int64(456), int64(123)).Return(nil)
+			},
+			wantTicket: true,
+			wantErr:    ErrLinkConflict,
+		},
+		{
+			name: "已经绑定了别的微信",
+			mock: func(m linkMocks) {
+				m.identityRepo.EXPECT().FindByProvider(gomock.Any(), "wechat", "openid").
+					Return(domain.Identity{}, repository.ErrIdentityNotFound)
+				m.userRepo.EXPECT().FindByWechat(gomock.Any(), "openid").
+					Return(domain.User{}, repository.ErrUserNotFound)
+				m.userRepo.EXPECT().FindById(gomock.Any(), int64(123)).Return(domain.User{
+					Id: 123, WechatInfo: domain.WechatInfo{OpenID: "other"},
+				}, nil)
+				m.identityRepo.EXPECT().FindByUid(gomock.Any(), int64(123)).Return(nil, nil)
+			},
+			wantErr: ErrAlreadyLinked,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			m := newLinkMocks(ctrl)
+			tc.mock(m)
+			svc := NewLinkService(m.userRepo, m.identityRepo, m.ticketRepo)
+			ticket, err := svc.BindIdentity(context.Background(), 123, wechat)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantTicket, ticket != "")
+		})
+	}
+}
+
+func TestLinkService_Unbind(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(m linkMocks)
+		kind string
+
+		wantErr error
+	}{
+		{
+			name: "解绑手机号",
+			mock: func(m linkMocks) {
+				m.userRepo.EXPECT().FindById(gomock.Any(), int64(123)).
+					Return(domain.User{Id: 123, Phone: "15212345678", Email: "123@qq.com"}, nil)
+				m.identityRepo.EXPECT().FindByUid(gomock.Any(), int64(123)).Return(nil, nil)
+				m.userRepo.EXPECT().UpdatePhone(gomock.Any(), int64(123), "").Return(nil)
+			},
+			kind: LinkPhone,
+		},
+		{
+			name: "只剩一种登录方式",
+			mock: func(m linkMocks) {
+				m.userRepo.EXPECT().FindById(gomock.Any(), int64(123)).
+					Return(domain.User{Id: 123, Phone: "15212345678"}, nil)
+				m.identityRepo.EXPECT().FindByUid(gomock.Any(), int64(123)).Return(nil, nil)
+			},
+			kind:    LinkPhone,
+			wantErr: ErrLastLoginMethod,
+		},
+		{
+			name: "没有绑定",
+			mock: func(m linkMocks) {
+				m.userRepo.EXPECT().FindById(gomock.Any(), int64(123)).
+					Return(domain.User{Id: 123, Phone: "15212345678"}, nil)
+				m.identityRepo.EXPECT().FindByUid(gomock.Any(), int64(123)).Return(nil, nil)
+			},
+			kind:    domain.IdentityProviderGithub,
+			wantErr: ErrNotLinked,
+		},
+		{
+			name: "解绑老数据里面的微信",
+			mock: func(m linkMocks) {
+				m.userRepo.EXPECT().FindById(gomock.Any(), int64(123)).Return(domain.User{
+					Id: 123, Phone: "15212345678", WechatInfo: domain.WechatInfo{OpenID: "openid"},
+				}, nil)
+				m.identityRepo.EXPECT().FindByUid(gomock.Any(), int64(123)).Return(nil, nil)
+				m.userRepo.EXPECT().ClearWechat(gomock.Any(), int64(123)).Return(nil)
+				m.identityRepo.EXPECT().Delete(gomock.Any(), int64(123), "wechat").
+					Return(repository.ErrIdentityNotFound)
+			},
+			kind: domain.IdentityProviderWechat,
+		},
+		{
+			name: "解绑 GitHub",
+			mock: func(m linkMocks) {
+				m.userRepo.EXPECT().FindById(gomock.Any(), int64(123)).
+					Return(domain.User{Id: 123, Email: "123@qq.com"}, nil)
+				m.identityRepo.EXPECT().FindByUid(gomock.Any(), int64(123)).
+					Return([]domain.Identity{{Uid: 123, Provider: "github", Subject: "1"}}, nil)
+				m.identityRepo.EXPECT().Delete(gomock.Any(), int64(123), "github").Return(nil)
+			},
+			kind: domain.IdentityProviderGithub,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			m := newLinkMocks(ctrl)
+			tc.mock(m)
+			svc := NewLinkService(m.userRepo, m.identityRepo, m.ticketRepo)
+			err := svc.Unbind(context.Background(), 123, tc.kind)
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
+
+func TestLinkService_Merge(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(m linkMocks)
+
+		wantFrom int64
+		wantErr  error
+	}{
+		{
+			name: "合并成功",
+			mock: func(m linkMocks) {
+				m.ticketRepo.EXPECT().Take(gomock.Any(), "ticket").Return(int64(456), int64(123), nil)
+				m.userRepo.EXPECT().Merge(gomock.Any(), int64(456), int64(123)).Return(nil)
+			},
+			wantFrom: 456,
+		},
+		{
+			name: "凭证不是发给当前账号的",
+			mock: func(m linkMocks) {
+				m.ticketRepo.EXPECT().Take(gomock.Any(), "ticket").Return(int64(456), int64(789), nil)
+				m.ticketRepo.EXPECT().Set(gomock.Any(), "ticket", int64(456), int64(789)).Return(nil)
+			},
+			wantErr: ErrMergeTicketInvalid,
+		},
+		{
+			name: "合并失败，凭证放回去可以重试",
+			mock: func(m linkMocks) {
+				m.ticketRepo.EXPECT().Take(gomock.Any(), "ticket").Return(int64(456), int64(123), nil)
+				m.userRepo.EXPECT().Merge(gomock.Any(), int64(456), int64(123)).Return(errors.New("数据库错误"))
+				m.ticketRepo.EXPECT().Set(gomock.Any(), "ticket", int64(456), int64(123)).Return(nil)
+			},
+			wantFrom: 456,
+			wantErr:  errors.New("数据库错误"),
+		},
+		{
+			name: "凭证过期",
+			mock: func(m linkMocks) {
+				m.ticketRepo.EXPECT().Take(gomock.Any(), "ticket").
+					Return(int64(0), int64(0), repository.ErrMergeTicketInvalid)
+			},
+			wantErr: ErrMergeTicketInvalid,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			m := newLinkMocks(ctrl)
+			tc.mock(m)
+			svc := NewLinkService(m.userRepo, m.identityRepo, m.ticketRepo)
+			from, err := svc.Merge(context.Background(), 123, "ticket")
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantFrom, from)
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/repository"
+)
+
+var (
+	ErrLoginLocked      = repository.ErrLoginLocked
+	ErrLoginTooFrequent = repository.ErrLoginTooFrequent
+	ErrLoginIPLimit     = repository.ErrLoginIPLimit
+
+	ErrUnknownUnlockChannel = errors.New("未知的解锁方式")
+)
+
+// 解锁验证码的渠道
+const (
+	UnlockChannelEmail = "email"
+	UnlockChannelSMS   = "sms"
+)
+
+// 解锁验证码的 biz，短信和邮件各用一个
+const (
+	bizUnlock      = "unlock"
+	bizUnlockEmail = "unlock_email"
+)
+
+// LoginLimitService 密码登录的防暴力破解
+type LoginLimitService interface {
+	// Attempt 校验密码之前调用，检查通过的话先把这一次当作失败计数，并发的请求不能绕过限制
+	Attempt(ctx context.Context, email, ip string) error
+	// Failed 密码不对的时候调用，这一次导致账号被锁定的话返回 ErrLoginLocked
+	Failed(ctx context.Context, email string) error
+	// Succeeded 登录成功之后清掉失败次数，回滚 Attempt 的计数
+	Succeeded(ctx context.Context, email, ip string) error
+	// Reset 用别的方式证明了是本人，比如重置了密码，清掉失败次数和锁定
+	Reset(ctx context.Context, email string) error
+	// SendUnlockCode 往账号绑定的邮箱或者手机发送解锁验证码
+	// 账号不存在或者没有绑定手机的时候什么也不做，不告诉调用方
+	SendUnlockCode(ctx context.Context, email, channel string, meta domain.CodeSendMeta) error
+	// Unlock 验证码正确的话解锁，返回 false 代表验证码不对
+	Unlock(ctx context.Context, email, channel, code string) (bool, error)
+}
+
+type loginLimitService struct {
+	repo         repository.LoginLimitRepository
+	userRepo     repository.UserRepository
+	codeSvc      CodeService
+	emailCodeSvc EmailCodeService
+}
+
+func NewLoginLimitService(repo repository.LoginLimitRepository, userRepo repository.UserRepository,
+	codeSvc CodeService, emailCodeSvc EmailCodeService) LoginLimitService {
+	return &loginLimitService{
+		repo:         repo,
+		userRepo:     userRepo,
+		codeSvc:      codeSvc,
+		emailCodeSvc: emailCodeSvc,
+	}
+}
+
+func (svc *loginLimitService) Attempt(ctx context.Context, email, ip string) error {
+	return svc.repo.Attempt(ctx, email, ip)
+}
+
+func (svc *loginLimitService) Failed(ctx context.Context, email string) error {
+	return svc.repo.Failed(ctx, email)
+}
+
+func (svc *loginLimitService) Succeeded(ctx context.Context, email, ip string) error {
+	return svc.repo.Succeeded(ctx, email, ip)
+}
+
+func (svc *loginLimitService) Reset(ctx context.Context, email string) error {
+	return svc.repo.Reset(ctx, email)
+}
+
+func (svc *loginLimitService) SendUnlockCode(ctx context.Context, email, channel string,
+	meta domain.CodeSendMeta) error {
+	codeSvc, biz, err := svc.channel(channel)
+	if err != nil {
+		return err
+	}
+	target, err := svc.target(ctx, email, channel)
+	if err != nil || target == "" {
+		return err
+	}
+	return codeSvc.Send(ctx, biz, target, meta)
+}
+
+func (svc *loginLimitService) Unlock(ctx context.Context, email, channel, code string) (bool, error) {
+	codeSvc, biz, err := svc.channel(channel)
+	if err != nil {
+		return false, err
+	}
+	target, err := svc.target(ctx, email, channel)
+	if err != nil || target == "" {
+		return false, err
+	}
+	ok, err := codeSvc.Verify(ctx, biz, target, code)
+	if err != nil || !ok {
+		return false, err
+	}
+	return true, svc.repo.Reset(ctx, email)
+}
+
+func (svc *loginLimitService) channel(channel string) (CodeService, string, error) {
+	switch channel {
+	case UnlockChannelEmail:
+		return svc.emailCodeSvc, bizUnlockEmail, nil
+	case UnlockChannelSMS:
+		return svc.codeSvc, bizUnlock, nil
+	default:
+		return nil, "", ErrUnknownUnlockChannel
+	}
+}
+
+// target 验证码发到哪里，账号不存在的时候返回空字符串
+func (svc *loginLimitService) target(ctx context.Context, email, channel string) (string, error) {
+	u, err := svc.userRepo.FindByEmail(ctx, email)
+	if err == repository.ErrUserNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if channel == UnlockChannelSMS {
+		return u.Phone, nil
+	}
+	return u.Email, nil
+}
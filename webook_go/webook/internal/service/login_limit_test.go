@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"testing"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/repository"
+	repomocks "webook_go/webook/internal/repository/mocks"
+	svcmocks "webook_go/webook/internal/service/mocks"
+)
+
+func TestLoginLimitService_Unlock(t *testing.T) {
+	u := domain.User{Id: 123, Email: "123@qq.com", Phone: "15212345678"}
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) (repository.LoginLimitRepository, repository.UserRepository,
+			CodeService, EmailCodeService)
+		channel string
+
+		wantOk  bool
+		wantErr error
+	}{
+		{
+			name: "邮件解锁",
+			mock: func(ctrl *gomock.Controller) (repository.LoginLimitRepository, repository.UserRepository,
+				CodeService, EmailCodeService) {
+				userRepo := repomocks.NewMockUserRepository(ctrl)
+				userRepo.EXPECT().FindByEmail(gomock.Any(), "123@qq.com").Return(u, nil)
+				emailCodeSvc := svcmocks.NewMockEmailCodeService(ctrl)
+				emailCodeSvc.EXPECT().Verify(gomock.Any(), bizUnlockEmail, "123@qq.com", "123456").
+					Return(true, nil)
+				repo := repomocks.NewMockLoginLimitRepository(ctrl)
+				repo.EXPECT().Reset(gomock.Any(), "123@qq.com").Return(nil)
+				return repo, userRepo, svcmocks.NewMockCodeService(ctrl), emailCodeSvc
+			},
+			channel: UnlockChannelEmail,
+			wantOk:  true,
+		},
+		{
+			name: "短信解锁，发到绑定的手机",
+			mock: func(ctrl *gomock.Controller) (repository.LoginLimitRepository, repository.UserRepository,
+				CodeService, EmailCodeService) {
+				userRepo := repomocks.NewMockUserRepository(ctrl)
+				userRepo.EXPECT().FindByEmail(gomock.Any(), "123@qq.com").Return(u, nil)
+				codeSvc := svcmocks.NewMockCodeService(ctrl)
+				codeSvc.EXPECT().Verify(gomock.Any(), bizUnlock, "15212345678", "123456").
+					Return(true, nil)
+				repo := repomocks.NewMockLoginLimitRepository(ctrl)
+				repo.EXPECT().Reset(gomock.Any(), "123@qq.com").Return(nil)
+				return repo, userRepo, codeSvc, svcmocks.NewMockEmailCodeService(ctrl)
+			},
+			channel: UnlockChannelSMS,
+			wantOk:  true,
+		},
+		{
+			name: "验证码不对",
+			mock: func(ctrl *gomock.Controller) (repository.LoginLimitRepository, repository.UserRepository,
+				CodeService, EmailCodeService) {
+				userRepo := repomocks.NewMockUserRepository(ctrl)
+				userRepo.EXPECT().FindByEmail(gomock.Any(), "123@qq.com").Return(u, nil)
+				emailCodeSvc := svcmocks.NewMockEmailCodeService(ctrl)
+				emailCodeSvc.EXPECT().Verify(gomock.Any(), bizUnlockEmail, "123@qq.com", "123456").
+					Return(false, nil)
+				return repomocks.NewMockLoginLimitRepository(ctrl), userRepo,
+					svcmocks.NewMockCodeService(ctrl), emailCodeSvc
+			},
+			channel: UnlockChannelEmail,
+		},
+		{
+			name: "账号不存在",
+			mock: func(ctrl *gomock.Controller) (repository.LoginLimitRepository, repository.UserRepository,
+				CodeService, EmailCodeService) {
+				userRepo := repomocks.NewMockUserRepository(ctrl)
+				userRepo.EXPECT().FindByEmail(gomock.Any(), "123@qq.com").
+					Return(domain.User{}, repository.ErrUserNotFound)
+				return repomocks.NewMockLoginLimitRepository(ctrl), userRepo,
+					svcmocks.NewMockCodeService(ctrl), svcmocks.NewMockEmailCodeService(ctrl)
+			},
+			channel: UnlockChannelEmail,
+		},
+		{
+			name: "没有绑定手机",
+			mock: func(ctrl *gomock.Controller) (repository.LoginLimitRepository, repository.UserRepository,
+				CodeService, EmailCodeService) {
+				userRepo := repomocks.NewMockUserRepository(ctrl)
+				userRepo.EXPECT().FindByEmail(gomock.Any(), "123@qq.com").
+					Return(domain.User{Id: 123, Email: "123@qq.com"}, nil)
+				return repomocks.NewMockLoginLimitRepository(ctrl), userRepo,
+					svcmocks.NewMockCodeService(ctrl), svcmocks.NewMockEmailCodeService(ctrl)
+			},
+			channel: UnlockChannelSMS,
+		},
+		{
+			name: "未知的渠道",
+			mock: func(ctrl *gomock.Controller) (repository.LoginLimitRepository, repository.UserRepository,
+				CodeService, EmailCodeService) {
+				return repomocks.NewMockLoginLimitRepository(ctrl), repomocks.NewMockUserRepository(ctrl),
+					svcmocks.NewMockCodeService(ctrl), svcmocks.NewMockEmailCodeService(ctrl)
+			},
+			channel: "wechat",
+			wantErr: ErrUnknownUnlockChannel,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repo, userRepo, codeSvc, emailCodeSvc := tc.mock(ctrl)
+			svc := NewLoginLimitService(repo, userRepo, codeSvc, emailCodeSvc)
+			ok, err := svc.Unlock(context.Background(), "123@qq.com", tc.channel, "123456")
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantOk, ok)
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"context"
+	"time"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/repository"
+)
+
+// LoginLogService 记录每一次成功的登录，管理员排查问题的时候用
+type LoginLogService interface {
+	Record(ctx context.Context, log domain.LoginLog) error
+}
+
+type loginLogService struct {
+	repo repository.LoginLogRepository
+	now  func() time.Time
+}
+
+func NewLoginLogService(repo repository.LoginLogRepository) LoginLogService {
+	return &loginLogService{
+		repo: repo,
+		now:  time.Now,
+	}
+}
+
+func (svc *loginLogService) Record(ctx context.Context, log domain.LoginLog) error {
+	if log.Ctime.IsZero() {
+		log.Ctime = svc.now()
+	}
+	return svc.repo.Create(ctx, log)
+}
@@ -0,0 +1,68 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: D:\gopath\src\webook_go\webook\internal\service\activation.go
+//
+// Generated by this command:
+//
+//	mockgen.exe -source=D:\gopath\src\webook_go\webook\internal\service\activation.go -package=svcmocks -destination=D:\gopath\src\webook_go\webook\internal\service\mocks\activation.mock.go
+//
+// Package svcmocks is a generated GoMock package.
+package svcmocks
+
+import (
+	context "context"
+	reflect "reflect"
+	domain "webook_go/webook/internal/domain"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockActivationService is a mock of ActivationService interface.
+type MockActivationService struct {
+	ctrl     *gomock.Controller
+	recorder *MockActivationServiceMockRecorder
+}
+
+// MockActivationServiceMockRecorder is the mock recorder for MockActivationService.
+type MockActivationServiceMockRecorder struct {
+	mock *MockActivationService
+}
+
+// NewMockActivationService creates a new mock instance.
+func NewMockActivationService(ctrl *gomock.Controller) *MockActivationService {
+	mock := &MockActivationService{ctrl: ctrl}
+	mock.recorder = &MockActivationServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockActivationService) EXPECT() *MockActivationServiceMockRecorder {
+	return m.recorder
+}
+
+// Activate mocks base method.
+func (m *MockActivationService) Activate(ctx context.Context, token string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Activate", ctx, token)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Activate indicates an expected call of Activate.
+func (mr *MockActivationServiceMockRecorder) Activate(ctx, token any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Activate", reflect.TypeOf((*MockActivationService)(nil).Activate), ctx, token)
+}
+
+// Send mocks base method.
+func (m *MockActivationService) Send(ctx context.Context, email string, meta domain.CodeSendMeta) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Send", ctx, email, meta)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Send indicates an expected call of Send.
+func (mr *MockActivationServiceMockRecorder) Send(ctx, email, meta any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Send", reflect.TypeOf((*MockActivationService)(nil).Send), ctx, email, meta)
+}
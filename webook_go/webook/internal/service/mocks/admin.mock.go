@@ -0,0 +1,128 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: D:\gopath\src\webook_go\webook\internal\service\admin.go
+//
+// Generated by this command:
+//
+//	mockgen.exe -source=D:\gopath\src\webook_go\webook\internal\service\admin.go -package=svcmocks -destination=D:\gopath\src\webook_go\webook\internal\service\mocks\admin.mock.go
+//
+// Package svcmocks is a generated GoMock package.
+package svcmocks
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+	domain "webook_go/webook/internal/domain"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockAdminService is a mock of AdminService interface.
+type MockAdminService struct {
+	ctrl     *gomock.Controller
+	recorder *MockAdminServiceMockRecorder
+}
+
+// MockAdminServiceMockRecorder is the mock recorder for MockAdminService.
+type MockAdminServiceMockRecorder struct {
+	mock *MockAdminService
+}
+
+// NewMockAdminService creates a new mock instance.
+func NewMockAdminService(ctrl *gomock.Controller) *MockAdminService {
+	mock := &MockAdminService{ctrl: ctrl}
+	mock.recorder = &MockAdminServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAdminService) EXPECT() *MockAdminServiceMockRecorder {
+	return m.recorder
+}
+
+// Audit mocks base method.
+func (m *MockAdminService) Audit(ctx context.Context, log domain.AuditLog) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Audit", ctx, log)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Audit indicates an expected call of Audit.
+func (mr *MockAdminServiceMockRecorder) Audit(ctx, log any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Audit", reflect.TypeOf((*MockAdminService)(nil).Audit), ctx, log)
+}
+
+// Ban mocks base method.
+func (m *MockAdminService) Ban(ctx context.Context, uid int64, reason string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ban", ctx, uid, reason)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ban indicates an expected call of Ban.
+func (mr *MockAdminServiceMockRecorder) Ban(ctx, uid, reason any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ban", reflect.TypeOf((*MockAdminService)(nil).Ban), ctx, uid, reason)
+}
+
+// ListBanned mocks base method.
+func (m *MockAdminService) ListBanned(ctx context.Context, before time.Time, limit int) ([]domain.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListBanned", ctx, before, limit)
+	ret0, _ := ret[0].([]domain.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListBanned indicates an expected call of ListBanned.
+func (mr *MockAdminServiceMockRecorder) ListBanned(ctx, before, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListBanned", reflect.TypeOf((*MockAdminService)(nil).ListBanned), ctx, before, limit)
+}
+
+// LoginHistory mocks base method.
+func (m *MockAdminService) LoginHistory(ctx context.Context, uid int64, offset, limit int) ([]domain.LoginLog, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LoginHistory", ctx, uid, offset, limit)
+	ret0, _ := ret[0].([]domain.LoginLog)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LoginHistory indicates an expected call of LoginHistory.
+func (mr *MockAdminServiceMockRecorder) LoginHistory(ctx, uid, offset, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoginHistory", reflect.TypeOf((*MockAdminService)(nil).LoginHistory), ctx, uid, offset, limit)
+}
+
+// SearchUsers mocks base method.
+func (m *MockAdminService) SearchUsers(ctx context.Context, q domain.UserQuery) ([]domain.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchUsers", ctx, q)
+	ret0, _ := ret[0].([]domain.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchUsers indicates an expected call of SearchUsers.
+func (mr *MockAdminServiceMockRecorder) SearchUsers(ctx, q any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchUsers", reflect.TypeOf((*MockAdminService)(nil).SearchUsers), ctx, q)
+}
+
+// Unban mocks base method.
+func (m *MockAdminService) Unban(ctx context.Context, uid int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unban", ctx, uid)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Unban indicates an expected call of Unban.
+func (mr *MockAdminServiceMockRecorder) Unban(ctx, uid any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unban", reflect.TypeOf((*MockAdminService)(nil).Unban), ctx, uid)
+}
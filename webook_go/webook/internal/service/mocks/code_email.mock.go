@@ -0,0 +1,69 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: D:\gopath\src\webook_go\webook\internal\service\code_email.go
+//
+// Generated by this command:
+//
+//	mockgen.exe -source=D:\gopath\src\webook_go\webook\internal\service\code_email.go -package=svcmocks -destination=D:\gopath\src\webook_go\webook\internal\service\mocks\code_email.mock.go
+//
+// Package svcmocks is a generated GoMock package.
+package svcmocks
+
+import (
+	context "context"
+	reflect "reflect"
+	domain "webook_go/webook/internal/domain"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockEmailCodeService is a mock of EmailCodeService interface.
+type MockEmailCodeService struct {
+	ctrl     *gomock.Controller
+	recorder *MockEmailCodeServiceMockRecorder
+}
+
+// MockEmailCodeServiceMockRecorder is the mock recorder for MockEmailCodeService.
+type MockEmailCodeServiceMockRecorder struct {
+	mock *MockEmailCodeService
+}
+
+// NewMockEmailCodeService creates a new mock instance.
+func NewMockEmailCodeService(ctrl *gomock.Controller) *MockEmailCodeService {
+	mock := &MockEmailCodeService{ctrl: ctrl}
+	mock.recorder = &MockEmailCodeServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockEmailCodeService) EXPECT() *MockEmailCodeServiceMockRecorder {
+	return m.recorder
+}
+
+// Send mocks base method.
+func (m *MockEmailCodeService) Send(ctx context.Context, biz, phone string, meta domain.CodeSendMeta) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Send", ctx, biz, phone, meta)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Send indicates an expected call of Send.
+func (mr *MockEmailCodeServiceMockRecorder) Send(ctx, biz, phone, meta any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Send", reflect.TypeOf((*MockEmailCodeService)(nil).Send), ctx, biz, phone, meta)
+}
+
+// Verify mocks base method.
+func (m *MockEmailCodeService) Verify(ctx context.Context, biz, phone, inputCode string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Verify", ctx, biz, phone, inputCode)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Verify indicates an expected call of Verify.
+func (mr *MockEmailCodeServiceMockRecorder) Verify(ctx, biz, phone, inputCode any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Verify", reflect.TypeOf((*MockEmailCodeService)(nil).Verify), ctx, biz, phone, inputCode)
+}
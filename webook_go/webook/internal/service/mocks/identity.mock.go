@@ -0,0 +1,84 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: D:\gopath\src\webook_go\webook\internal\service\identity.go
+//
+// Generated by this command:
+//
+//	mockgen.exe -source=D:\gopath\src\webook_go\webook\internal\service\identity.go -package=svcmocks -destination=D:\gopath\src\webook_go\webook\internal\service\mocks\identity.mock.go
+//
+// Package svcmocks is a generated GoMock package.
+package svcmocks
+
+import (
+	context "context"
+	reflect "reflect"
+	domain "webook_go/webook/internal/domain"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockIdentityService is a mock of IdentityService interface.
+type MockIdentityService struct {
+	ctrl     *gomock.Controller
+	recorder *MockIdentityServiceMockRecorder
+}
+
+// MockIdentityServiceMockRecorder is the mock recorder for MockIdentityService.
+type MockIdentityServiceMockRecorder struct {
+	mock *MockIdentityService
+}
+
+// NewMockIdentityService creates a new mock instance.
+func NewMockIdentityService(ctrl *gomock.Controller) *MockIdentityService {
+	mock := &MockIdentityService{ctrl: ctrl}
+	mock.recorder = &MockIdentityServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockIdentityService) EXPECT() *MockIdentityServiceMockRecorder {
+	return m.recorder
+}
+
+// AccessToken mocks base method.
+func (m *MockIdentityService) AccessToken(ctx context.Context, uid int64, provider string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AccessToken", ctx, uid, provider)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AccessToken indicates an expected call of AccessToken.
+func (mr *MockIdentityServiceMockRecorder) AccessToken(ctx, uid, provider any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AccessToken", reflect.TypeOf((*MockIdentityService)(nil).AccessToken), ctx, uid, provider)
+}
+
+// FindOrCreate mocks base method.
+func (m *MockIdentityService) FindOrCreate(ctx context.Context, identity domain.Identity) (domain.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindOrCreate", ctx, identity)
+	ret0, _ := ret[0].(domain.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindOrCreate indicates an expected call of FindOrCreate.
+func (mr *MockIdentityServiceMockRecorder) FindOrCreate(ctx, identity any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindOrCreate", reflect.TypeOf((*MockIdentityService)(nil).FindOrCreate), ctx, identity)
+}
+
+// RefreshExpiring mocks base method.
+func (m *MockIdentityService) RefreshExpiring(ctx context.Context, limit int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RefreshExpiring", ctx, limit)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RefreshExpiring indicates an expected call of RefreshExpiring.
+func (mr *MockIdentityServiceMockRecorder) RefreshExpiring(ctx, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefreshExpiring", reflect.TypeOf((*MockIdentityService)(nil).RefreshExpiring), ctx, limit)
+}
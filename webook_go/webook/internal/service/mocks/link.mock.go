@@ -0,0 +1,129 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: D:\gopath\src\webook_go\webook\internal\service\link.go
+//
+// Generated by this command:
+//
+//	mockgen.exe -source=D:\gopath\src\webook_go\webook\internal\service\link.go -package=svcmocks -destination=D:\gopath\src\webook_go\webook\internal\service\mocks\link.mock.go
+//
+// Package svcmocks is a generated GoMock package.
+package svcmocks
+
+import (
+	context "context"
+	reflect "reflect"
+	domain "webook_go/webook/internal/domain"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockLinkService is a mock of LinkService interface.
+type MockLinkService struct {
+	ctrl     *gomock.Controller
+	recorder *MockLinkServiceMockRecorder
+}
+
+// MockLinkServiceMockRecorder is the mock recorder for MockLinkService.
+type MockLinkServiceMockRecorder struct {
+	mock *MockLinkService
+}
+
+// NewMockLinkService creates a new mock instance.
+func NewMockLinkService(ctrl *gomock.Controller) *MockLinkService {
+	mock := &MockLinkService{ctrl: ctrl}
+	mock.recorder = &MockLinkServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLinkService) EXPECT() *MockLinkServiceMockRecorder {
+	return m.recorder
+}
+
+// BindEmail mocks base method.
+func (m *MockLinkService) BindEmail(ctx context.Context, uid int64, email string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BindEmail", ctx, uid, email)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BindEmail indicates an expected call of BindEmail.
+func (mr *MockLinkServiceMockRecorder) BindEmail(ctx, uid, email any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BindEmail", reflect.TypeOf((*MockLinkService)(nil).BindEmail), ctx, uid, email)
+}
+
+// BindIdentity mocks base method.
+func (m *MockLinkService) BindIdentity(ctx context.Context, uid int64, identity domain.Identity) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BindIdentity", ctx, uid, identity)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BindIdentity indicates an expected call of BindIdentity.
+func (mr *MockLinkServiceMockRecorder) BindIdentity(ctx, uid, identity any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BindIdentity", reflect.TypeOf((*MockLinkService)(nil).BindIdentity), ctx, uid, identity)
+}
+
+// BindPhone mocks base method.
+func (m *MockLinkService) BindPhone(ctx context.Context, uid int64, phone string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BindPhone", ctx, uid, phone)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BindPhone indicates an expected call of BindPhone.
+func (mr *MockLinkServiceMockRecorder) BindPhone(ctx, uid, phone any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BindPhone", reflect.TypeOf((*MockLinkService)(nil).BindPhone), ctx, uid, phone)
+}
+
+// Links mocks base method.
+func (m *MockLinkService) Links(ctx context.Context, uid int64) (domain.AccountLinks, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Links", ctx, uid)
+	ret0, _ := ret[0].(domain.AccountLinks)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Links indicates an expected call of Links.
+func (mr *MockLinkServiceMockRecorder) Links(ctx, uid any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Links", reflect.TypeOf((*MockLinkService)(nil).Links), ctx, uid)
+}
+
+// Merge mocks base method.
+func (m *MockLinkService) Merge(ctx context.Context, uid int64, ticket string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Merge", ctx, uid, ticket)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Merge indicates an expected call of Merge.
+func (mr *MockLinkServiceMockRecorder) Merge(ctx, uid, ticket any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Merge", reflect.TypeOf((*MockLinkService)(nil).Merge), ctx, uid, ticket)
+}
+
+// Unbind mocks base method.
+func (m *MockLinkService) Unbind(ctx context.Context, uid int64, kind string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unbind", ctx, uid, kind)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Unbind indicates an expected call of Unbind.
+func (mr *MockLinkServiceMockRecorder) Unbind(ctx, uid, kind any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unbind", reflect.TypeOf((*MockLinkService)(nil).Unbind), ctx, uid, kind)
+}
@@ -0,0 +1,125 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: D:\gopath\src\webook_go\webook\internal\service\login_limit.go
+//
+// Generated by this command:
+//
+//	mockgen.exe -source=D:\gopath\src\webook_go\webook\internal\service\login_limit.go -package=svcmocks -destination=D:\gopath\src\webook_go\webook\internal\service\mocks\login_limit.mock.go
+//
+// Package svcmocks is a generated GoMock package.
+package svcmocks
+
+import (
+	context "context"
+	reflect "reflect"
+	domain "webook_go/webook/internal/domain"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockLoginLimitService is a mock of LoginLimitService interface.
+type MockLoginLimitService struct {
+	ctrl     *gomock.Controller
+	recorder *MockLoginLimitServiceMockRecorder
+}
+
+// MockLoginLimitServiceMockRecorder is the mock recorder for MockLoginLimitService.
+type MockLoginLimitServiceMockRecorder struct {
+	mock *MockLoginLimitService
+}
+
+// NewMockLoginLimitService creates a new mock instance.
+func NewMockLoginLimitService(ctrl *gomock.Controller) *MockLoginLimitService {
+	mock := &MockLoginLimitService{ctrl: ctrl}
+	mock.recorder = &MockLoginLimitServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLoginLimitService) EXPECT() *MockLoginLimitServiceMockRecorder {
+	return m.recorder
+}
+
+// Attempt mocks base method.
+func (m *MockLoginLimitService) Attempt(ctx context.Context, email, ip string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Attempt", ctx, email, ip)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Attempt indicates an expected call of Attempt.
+func (mr *MockLoginLimitServiceMockRecorder) Attempt(ctx, email, ip any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Attempt", reflect.TypeOf((*MockLoginLimitService)(nil).Attempt), ctx, email, ip)
+}
+
+// Failed mocks base method.
+func (m *MockLoginLimitService) Failed(ctx context.Context, email string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Failed", ctx, email)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Failed indicates an expected call of Failed.
+func (mr *MockLoginLimitServiceMockRecorder) Failed(ctx, email any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Failed", reflect.TypeOf((*MockLoginLimitService)(nil).Failed), ctx, email)
+}
+
+// Reset mocks base method.
+func (m *MockLoginLimitService) Reset(ctx context.Context, email string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reset", ctx, email)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Reset indicates an expected call of Reset.
+func (mr *MockLoginLimitServiceMockRecorder) Reset(ctx, email any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reset", reflect.TypeOf((*MockLoginLimitService)(nil).Reset), ctx, email)
+}
+
+// SendUnlockCode mocks base method.
+func (m *MockLoginLimitService) SendUnlockCode(ctx context.Context, email, channel string, meta domain.CodeSendMeta) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendUnlockCode", ctx, email, channel, meta)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendUnlockCode indicates an expected call of SendUnlockCode.
+func (mr *MockLoginLimitServiceMockRecorder) SendUnlockCode(ctx, email, channel, meta any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendUnlockCode", reflect.TypeOf((*MockLoginLimitService)(nil).SendUnlockCode), ctx, email, channel, meta)
+}
+
+// Succeeded mocks base method.
+func (m *MockLoginLimitService) Succeeded(ctx context.Context, email, ip string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Succeeded", ctx, email, ip)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Succeeded indicates an expected call of Succeeded.
+func (mr *MockLoginLimitServiceMockRecorder) Succeeded(ctx, email, ip any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Succeeded", reflect.TypeOf((*MockLoginLimitService)(nil).Succeeded), ctx, email, ip)
+}
+
+// Unlock mocks base method.
+func (m *MockLoginLimitService) Unlock(ctx context.Context, email, channel, code string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unlock", ctx, email, channel, code)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Unlock indicates an expected call of Unlock.
+func (mr *MockLoginLimitServiceMockRecorder) Unlock(ctx, email, channel, code any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unlock", reflect.TypeOf((*MockLoginLimitService)(nil).Unlock), ctx, email, channel, code)
+}
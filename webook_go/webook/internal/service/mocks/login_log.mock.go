@@ -0,0 +1,54 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: D:\gopath\src\webook_go\webook\internal\service\login_log.go
+//
+// Generated by this command:
+//
+//	mockgen.exe -source=D:\gopath\src\webook_go\webook\internal\service\login_log.go -package=svcmocks -destination=D:\gopath\src\webook_go\webook\internal\service\mocks\login_log.mock.go
+//
+// Package svcmocks is a generated GoMock package.
+package svcmocks
+
+import (
+	context "context"
+	reflect "reflect"
+	domain "webook_go/webook/internal/domain"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockLoginLogService is a mock of LoginLogService interface.
+type MockLoginLogService struct {
+	ctrl     *gomock.Controller
+	recorder *MockLoginLogServiceMockRecorder
+}
+
+// MockLoginLogServiceMockRecorder is the mock recorder for MockLoginLogService.
+type MockLoginLogServiceMockRecorder struct {
+	mock *MockLoginLogService
+}
+
+// NewMockLoginLogService creates a new mock instance.
+func NewMockLoginLogService(ctrl *gomock.Controller) *MockLoginLogService {
+	mock := &MockLoginLogService{ctrl: ctrl}
+	mock.recorder = &MockLoginLogServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLoginLogService) EXPECT() *MockLoginLogServiceMockRecorder {
+	return m.recorder
+}
+
+// Record mocks base method.
+func (m *MockLoginLogService) Record(ctx context.Context, log domain.LoginLog) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Record", ctx, log)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Record indicates an expected call of Record.
+func (mr *MockLoginLogServiceMockRecorder) Record(ctx, log any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Record", reflect.TypeOf((*MockLoginLogService)(nil).Record), ctx, log)
+}
@@ -0,0 +1,113 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: D:\gopath\src\webook_go\webook\internal\service\totp.go
+//
+// Generated by this command:
+//
+//	mockgen.exe -source=D:\gopath\src\webook_go\webook\internal\service\totp.go -package=svcmocks -destination=D:\gopath\src\webook_go\webook\internal\service\mocks\totp.mock.go
+//
+// Package svcmocks is a generated GoMock package.
+package svcmocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockTOTPService is a mock of TOTPService interface.
+type MockTOTPService struct {
+	ctrl     *gomock.Controller
+	recorder *MockTOTPServiceMockRecorder
+}
+
+// MockTOTPServiceMockRecorder is the mock recorder for MockTOTPService.
+type MockTOTPServiceMockRecorder struct {
+	mock *MockTOTPService
+}
+
+// NewMockTOTPService creates a new mock instance.
+func NewMockTOTPService(ctrl *gomock.Controller) *MockTOTPService {
+	mock := &MockTOTPService{ctrl: ctrl}
+	mock.recorder = &MockTOTPServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTOTPService) EXPECT() *MockTOTPServiceMockRecorder {
+	return m.recorder
+}
+
+// Disable mocks base method.
+func (m *MockTOTPService) Disable(ctx context.Context, uid int64, code string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Disable", ctx, uid, code)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Disable indicates an expected call of Disable.
+func (mr *MockTOTPServiceMockRecorder) Disable(ctx, uid, code any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Disable", reflect.TypeOf((*MockTOTPService)(nil).Disable), ctx, uid, code)
+}
+
+// Enable mocks base method.
+func (m *MockTOTPService) Enable(ctx context.Context, uid int64, code string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Enable", ctx, uid, code)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Enable indicates an expected call of Enable.
+func (mr *MockTOTPServiceMockRecorder) Enable(ctx, uid, code any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Enable", reflect.TypeOf((*MockTOTPService)(nil).Enable), ctx, uid, code)
+}
+
+// Enabled mocks base method.
+func (m *MockTOTPService) Enabled(ctx context.Context, uid int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Enabled", ctx, uid)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Enabled indicates an expected call of Enabled.
+func (mr *MockTOTPServiceMockRecorder) Enabled(ctx, uid any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Enabled", reflect.TypeOf((*MockTOTPService)(nil).Enabled), ctx, uid)
+}
+
+// Setup mocks base method.
+func (m *MockTOTPService) Setup(ctx context.Context, uid int64) (string, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Setup", ctx, uid)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Setup indicates an expected call of Setup.
+func (mr *MockTOTPServiceMockRecorder) Setup(ctx, uid any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Setup", reflect.TypeOf((*MockTOTPService)(nil).Setup), ctx, uid)
+}
+
+// Verify mocks base method.
+func (m *MockTOTPService) Verify(ctx context.Context, uid int64, code string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Verify", ctx, uid, code)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Verify indicates an expected call of Verify.
+func (mr *MockTOTPServiceMockRecorder) Verify(ctx, uid, code any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Verify", reflect.TypeOf((*MockTOTPService)(nil).Verify), ctx, uid, code)
+}
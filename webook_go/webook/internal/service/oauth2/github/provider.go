@@ -0,0 +1,128 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/service/oauth2"
+)
+
+type Config struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURI  string
+}
+
+// Provider GitHub 登录，支持 PKCE
+type Provider struct {
+	cfg    Config
+	client *http.Client
+	// 测试的时候换成 httptest 的地址
+	authEndpoint  string
+	tokenEndpoint string
+	apiEndpoint   string
+}
+
+func NewProvider(cfg Config, client *http.Client) *Provider {
+	return &Provider{
+		cfg:           cfg,
+		client:        client,
+		authEndpoint:  "https://github.com/login/oauth/authorize",
+		tokenEndpoint: "https://github.com/login/oauth/access_token",
+		apiEndpoint:   "https://api.github.com",
+	}
+}
+
+func (p *Provider) Name() string {
+	return domain.IdentityProviderGithub
+}
+
+func (p *Provider) AuthURL(ctx context.Context, params oauth2.AuthParams) (string, error) {
+	query := url.Values{}
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.cfg.RedirectURI)
+	query.Set("scope", "read:user user:email")
+	query.Set("state", params.State)
+	if params.CodeChallenge != "" {
+		query.Set("code_challenge", params.CodeChallenge)
+		query.Set("code_challenge_method", "S256")
+	}
+	return p.authEndpoint + "?" + query.Encode(), nil
+}
+
+func (p *Provider) Exchange(ctx context.Context, params oauth2.ExchangeParams) (domain.Identity, error) {
+	token, err := p.accessToken(ctx, params)
+	if err != nil {
+		return domain.Identity{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.apiEndpoint+"/user", nil)
+	if err != nil {
+		return domain.Identity{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	var u userResult
+	err = oauth2.DoJSON(p.client, req, &u)
+	if err != nil {
+		return domain.Identity{}, fmt.Errorf("获取 GitHub 用户信息失败 %w", err)
+	}
+	nickname := u.Name
+	if nickname == "" {
+		nickname = u.Login
+	}
+	return domain.Identity{
+		Provider: p.Name(),
+		// login 是可以改的，只能用 id
+		Subject:  strconv.FormatInt(u.Id, 10),
+		Email:    u.Email,
+		Nickname: nickname,
+		Avatar:   u.AvatarURL,
+	}, nil
+}
+
+func (p *Provider) accessToken(ctx context.Context, params oauth2.ExchangeParams) (string, error) {
+	form := url.Values{}
+	form.Set("client_id", p.cfg.ClientID)
+	form.Set("client_secret", p.cfg.ClientSecret)
+	form.Set("code", params.Code)
+	form.Set("redirect_uri", p.cfg.RedirectURI)
+	if params.CodeVerifier != "" {
+		form.Set("code_verifier", params.CodeVerifier)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenEndpoint,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var res tokenResult
+	err = oauth2.DoJSON(p.client, req, &res)
+	if err != nil {
+		return "", fmt.Errorf("GitHub 换取 access_token 失败 %w", err)
+	}
+	// GitHub 出错的时候 HTTP 状态码也是 200
+	if res.Error == "bad_verification_code" {
+		return "", oauth2.ErrInvalidCode
+	}
+	if res.Error != "" || res.AccessToken == "" {
+		return "", fmt.Errorf("GitHub 返回错误 %s: %s", res.Error, res.ErrorDescription)
+	}
+	return res.AccessToken, nil
+}
+
+type tokenResult struct {
+	AccessToken      string `json:"access_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+type userResult struct {
+	Id        int64  `json:"id"`
+	Login     string `json:"login"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	AvatarURL string `json:"avatar_url"`
+}
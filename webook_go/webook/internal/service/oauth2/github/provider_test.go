@@ -0,0 +1,93 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/service/oauth2"
+)
+
+// newTestServer 模拟 GitHub，只有 good-code 配合 good-verifier 是有效的
+func newTestServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "client-id", r.PostForm.Get("client_id"))
+		assert.Equal(t, "client-secret", r.PostForm.Get("client_secret"))
+		if r.PostForm.Get("code") != "good-code" || r.PostForm.Get("code_verifier") != "good-verifier" {
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "bad_verification_code"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"access_token": "gho_token"})
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer gho_token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"id":         12345,
+			"login":      "octocat",
+			"avatar_url": "https://avatars.githubusercontent.com/u/12345",
+		})
+	})
+	return httptest.NewServer(mux)
+}
+
+func newTestProvider(server *httptest.Server) *Provider {
+	p := NewProvider(Config{
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		RedirectURI:  "http://localhost:8080/oauth2/github/callback",
+	}, server.Client())
+	p.tokenEndpoint = server.URL + "/login/oauth/access_token"
+	p.apiEndpoint = server.URL
+	return p
+}
+
+func TestProvider_AuthURL(t *testing.T) {
+	p := NewProvider(Config{ClientID: "client-id", RedirectURI: "http://localhost/cb"}, http.DefaultClient)
+	authURL, err := p.AuthURL(context.Background(), oauth2.AuthParams{
+		State:         "state",
+		CodeChallenge: "challenge",
+	})
+	require.NoError(t, err)
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	assert.Equal(t, "github.com", u.Host)
+	assert.Equal(t, "state", u.Query().Get("state"))
+	assert.Equal(t, "http://localhost/cb", u.Query().Get("redirect_uri"))
+	assert.Equal(t, "challenge", u.Query().Get("code_challenge"))
+	assert.Equal(t, "S256", u.Query().Get("code_challenge_method"))
+}
+
+func TestProvider_Exchange(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	p := newTestProvider(server)
+
+	identity, err := p.Exchange(context.Background(), oauth2.ExchangeParams{
+		Code:         "good-code",
+		CodeVerifier: "good-verifier",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, domain.Identity{
+		Provider: "github",
+		Subject:  "12345",
+		Nickname: "octocat",
+		Avatar:   "https://avatars.githubusercontent.com/u/12345",
+	}, identity)
+
+	// PKCE 的 verifier 不对
+	_, err = p.Exchange(context.Background(), oauth2.ExchangeParams{
+		Code:         "good-code",
+		CodeVerifier: "bad-verifier",
+	})
+	assert.Equal(t, oauth2.ErrInvalidCode, err)
+}
@@ -0,0 +1,47 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+)
+
+// maxBodySize 第三方平台的响应都很小，防止对方返回一个超大的响应
+const maxBodySize = 1 << 20
+
+// HTTPError 第三方平台返回了非 2xx 的响应
+type HTTPError struct {
+	Host       string
+	StatusCode int
+	Body       []byte
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%s 返回了 HTTP %d: %s", e.Host, e.StatusCode, e.Body)
+}
+
+// DoJSON 发请求并且把 JSON 响应解析到 v 里面，非 2xx 的响应当成错误
+func DoJSON(client *http.Client, req *http.Request, v any) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+			return fmt.Errorf("%w: %v", ErrTimeout, err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &HTTPError{Host: req.URL.Host, StatusCode: resp.StatusCode, Body: body}
+	}
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,226 @@
+// Package oidc 通用的 OpenID Connect 登录，通过 discovery 拿到各个地址，用 JWKS 校验 ID token
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/service/oauth2"
+)
+
+var ErrInvalidIDToken = errors.New("ID token 无效")
+
+// jwksRefreshInterval 遇到不认识的 kid 会重新拉 JWKS，但是不能太频繁
+const jwksRefreshInterval = time.Minute
+
+type Config struct {
+	// Name 路由和存储身份的时候用的名字，比如 google
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURI  string
+	// Scopes 不配置的话就是 openid email profile
+	Scopes []string
+}
+
+type Provider struct {
+	cfg    Config
+	client *http.Client
+	now    func() time.Time
+
+	mu   sync.Mutex
+	meta *metadata
+	// keys kid 到公钥
+	keys          map[string]any
+	keysFetchedAt time.Time
+}
+
+func NewProvider(cfg Config, client *http.Client) *Provider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &Provider{
+		cfg:    cfg,
+		client: client,
+		now:    time.Now,
+	}
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+func (p *Provider) AuthURL(ctx context.Context, params oauth2.AuthParams) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.cfg.RedirectURI)
+	query.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	query.Set("state", params.State)
+	query.Set("nonce", params.Nonce)
+	if params.CodeChallenge != "" {
+		query.Set("code_challenge", params.CodeChallenge)
+		query.Set("code_challenge_method", "S256")
+	}
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + query.Encode(), nil
+}
+
+func (p *Provider) Exchange(ctx context.Context, params oauth2.ExchangeParams) (domain.Identity, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return domain.Identity{}, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", params.Code)
+	form.Set("redirect_uri", p.cfg.RedirectURI)
+	form.Set("client_id", p.cfg.ClientID)
+	form.Set("client_secret", p.cfg.ClientSecret)
+	if params.CodeVerifier != "" {
+		form.Set("code_verifier", params.CodeVerifier)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return domain.Identity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var res tokenResult
+	err = oauth2.DoJSON(p.client, req, &res)
+	var httpErr *oauth2.HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusBadRequest &&
+		strings.Contains(string(httpErr.Body), "invalid_grant") {
+		return domain.Identity{}, oauth2.ErrInvalidCode
+	}
+	if err != nil {
+		return domain.Identity{}, fmt.Errorf("%s 换取 token 失败 %w", p.cfg.Name, err)
+	}
+	claims, err := p.verifyIDToken(ctx, meta, res.IDToken, params.Nonce)
+	if err != nil {
+		return domain.Identity{}, err
+	}
+	identity := domain.Identity{
+		Provider: p.cfg.Name,
+		Subject:  claims.Subject,
+		Nickname: claims.Name,
+		Avatar:   claims.Picture,
+	}
+	// 没有验证过的邮箱不能用，不然别人可以用你的邮箱注册一个第三方账号来登录
+	if claims.EmailVerified {
+		identity.Email = claims.Email
+	}
+	return identity, nil
+}
+
+type tokenResult struct {
+	IDToken string `json:"id_token"`
+}
+
+type idTokenClaims struct {
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	Picture       string `json:"picture"`
+	jwt.RegisteredClaims
+}
+
+func (p *Provider) verifyIDToken(ctx context.Context, meta *metadata, idToken, nonce string) (*idTokenClaims, error) {
+	var claims idTokenClaims
+	token, err := jwt.ParseWithClaims(idToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, meta, kid)
+	},
+		// 不接受 none 和 HMAC，防止被伪造
+		jwt.WithValidMethods([]string{"RS256", "ES256"}),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(p.now))
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("%w %v", ErrInvalidIDToken, err)
+	}
+	if claims.Nonce != nonce || claims.Subject == "" {
+		return nil, ErrInvalidIDToken
+	}
+	return &claims, nil
+}
+
+// key 找不到 kid 的时候，可能是对方轮换了密钥，重新拉一次 JWKS
+func (p *Provider) key(ctx context.Context, meta *metadata, kid string) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if p.keys != nil && p.now().Sub(p.keysFetchedAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("未知的 kid %s", kid)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, meta.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set jwkSet
+	err = oauth2.DoJSON(p.client, req, &set)
+	if err != nil {
+		return nil, fmt.Errorf("获取 %s 的 JWKS 失败 %w", p.cfg.Name, err)
+	}
+	p.keys = set.publicKeys()
+	p.keysFetchedAt = p.now()
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("未知的 kid %s", kid)
+	}
+	return key, nil
+}
+
+// metadata 第一次用的时候才去拉 discovery，失败了下一次会重试
+func (p *Provider) metadata(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+	target := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	var meta metadata
+	err = oauth2.DoJSON(p.client, req, &meta)
+	if err != nil {
+		return nil, fmt.Errorf("获取 %s 的 discovery 失败 %w", p.cfg.Name, err)
+	}
+	// 防止 discovery 被篡改，指向别人的 issuer
+	if meta.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("%s 的 issuer 不匹配 %s", p.cfg.Name, meta.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("%s 的 discovery 不完整", p.cfg.Name)
+	}
+	p.meta = &meta
+	return p.meta, nil
+}
@@ -0,0 +1,248 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/service/oauth2"
+)
+
+// testIssuer 模拟一个 OIDC 提供方，token 接口返回的 ID token 由 claims 决定
+type testIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+	// jwksCalls 统计 JWKS 被拉了几次
+	jwksCalls int
+	claims    func(issuer string) jwt.MapClaims
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ti := &testIssuer{key: key, kid: "key-1"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 ti.server.URL,
+			"authorization_endpoint": ti.server.URL + "/authorize",
+			"token_endpoint":         ti.server.URL + "/token",
+			"jwks_uri":               ti.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		ti.jwksCalls++
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": ti.kid,
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(ti.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(ti.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		if r.PostForm.Get("code") != "good-code" || r.PostForm.Get("code_verifier") != "good-verifier" {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, ti.claims(ti.server.URL))
+		token.Header["kid"] = ti.kid
+		idToken, err := token.SignedString(ti.key)
+		require.NoError(t, err)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "access",
+			"id_token":     idToken,
+		})
+	})
+	ti.server = httptest.NewServer(mux)
+	ti.claims = func(issuer string) jwt.MapClaims {
+		return validClaims(issuer)
+	}
+	return ti
+}
+
+func validClaims(issuer string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            issuer,
+		"aud":            "client-id",
+		"sub":            "user-1",
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"nonce":          "nonce",
+		"email":          "a@qq.com",
+		"email_verified": true,
+		"name":           "Tom",
+	}
+}
+
+func (ti *testIssuer) provider() *Provider {
+	return NewProvider(Config{
+		Name:         "test",
+		Issuer:       ti.server.URL,
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		RedirectURI:  "http://localhost:8080/oauth2/test/callback",
+	}, ti.server.Client())
+}
+
+func TestProvider_AuthURL(t *testing.T) {
+	ti := newTestIssuer(t)
+	defer ti.server.Close()
+	authURL, err := ti.provider().AuthURL(context.Background(), oauth2.AuthParams{
+		State:         "state",
+		Nonce:         "nonce",
+		CodeChallenge: "challenge",
+	})
+	require.NoError(t, err)
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	assert.Equal(t, "/authorize", u.Path)
+	assert.Equal(t, "openid email profile", u.Query().Get("scope"))
+	assert.Equal(t, "nonce", u.Query().Get("nonce"))
+	assert.Equal(t, "challenge", u.Query().Get("code_challenge"))
+}
+
+func TestProvider_Exchange(t *testing.T) {
+	testCases := []struct {
+		name   string
+		claims func(issuer string) jwt.MapClaims
+		params oauth2.ExchangeParams
+
+		wantIdentity domain.Identity
+		wantErr      error
+	}{
+		{
+			name: "成功",
+			params: oauth2.ExchangeParams{
+				Code: "good-code", CodeVerifier: "good-verifier", Nonce: "nonce",
+			},
+			wantIdentity: domain.Identity{
+				Provider: "test",
+				Subject:  "user-1",
+				Email:    "a@qq.com",
+				Nickname: "Tom",
+			},
+		},
+		{
+			name: "邮箱没有验证过",
+			claims: func(issuer string) jwt.MapClaims {
+				c := validClaims(issuer)
+				c["email_verified"] = false
+				return c
+			},
+			params: oauth2.ExchangeParams{
+				Code: "good-code", CodeVerifier: "good-verifier", Nonce: "nonce",
+			},
+			wantIdentity: domain.Identity{
+				Provider: "test",
+				Subject:  "user-1",
+				Nickname: "Tom",
+			},
+		},
+		{
+			name: "授权码无效",
+			params: oauth2.ExchangeParams{
+				Code: "bad-code", CodeVerifier: "good-verifier", Nonce: "nonce",
+			},
+			wantErr: oauth2.ErrInvalidCode,
+		},
+		{
+			name: "nonce 不对",
+			params: oauth2.ExchangeParams{
+				Code: "good-code", CodeVerifier: "good-verifier", Nonce: "other",
+			},
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name: "aud 不对",
+			claims: func(issuer string) jwt.MapClaims {
+				c := validClaims(issuer)
+				c["aud"] = "other-client"
+				return c
+			},
+			params: oauth2.ExchangeParams{
+				Code: "good-code", CodeVerifier: "good-verifier", Nonce: "nonce",
+			},
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name: "iss 不对",
+			claims: func(issuer string) jwt.MapClaims {
+				c := validClaims(issuer)
+				c["iss"] = "https://evil.com"
+				return c
+			},
+			params: oauth2.ExchangeParams{
+				Code: "good-code", CodeVerifier: "good-verifier", Nonce: "nonce",
+			},
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name: "过期",
+			claims: func(issuer string) jwt.MapClaims {
+				c := validClaims(issuer)
+				c["exp"] = time.Now().Add(-time.Minute).Unix()
+				return c
+			},
+			params: oauth2.ExchangeParams{
+				Code: "good-code", CodeVerifier: "good-verifier", Nonce: "nonce",
+			},
+			wantErr: ErrInvalidIDToken,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ti := newTestIssuer(t)
+			defer ti.server.Close()
+			if tc.claims != nil {
+				ti.claims = tc.claims
+			}
+			identity, err := ti.provider().Exchange(context.Background(), tc.params)
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantIdentity, identity)
+		})
+	}
+}
+
+func TestProvider_KeyRotation(t *testing.T) {
+	ti := newTestIssuer(t)
+	defer ti.server.Close()
+	p := ti.provider()
+	params := oauth2.ExchangeParams{Code: "good-code", CodeVerifier: "good-verifier", Nonce: "nonce"}
+
+	_, err := p.Exchange(context.Background(), params)
+	require.NoError(t, err)
+	_, err = p.Exchange(context.Background(), params)
+	require.NoError(t, err)
+	// 缓存了公钥，只拉一次
+	assert.Equal(t, 1, ti.jwksCalls)
+
+	// 对方轮换了密钥，kid 不认识，刚拉过不会马上重新拉
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ti.key, ti.kid = key, "key-2"
+	_, err = p.Exchange(context.Background(), params)
+	assert.ErrorIs(t, err, ErrInvalidIDToken)
+	assert.Equal(t, 1, ti.jwksCalls)
+
+	// 过了刷新间隔之后会重新拉
+	p.keysFetchedAt = p.keysFetchedAt.Add(-jwksRefreshInterval)
+	_, err = p.Exchange(context.Background(), params)
+	require.NoError(t, err)
+	assert.Equal(t, 2, ti.jwksCalls)
+}
@@ -0,0 +1,23 @@
+package oauth2
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestS256Challenge(t *testing.T) {
+	// RFC 7636 附录 B 的例子
+	assert.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+		S256Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"))
+}
+
+func TestRandomString(t *testing.T) {
+	a, err := RandomString()
+	require.NoError(t, err)
+	b, err := RandomString()
+	require.NoError(t, err)
+	// 43 个字符正好在 PKCE 要求的 43~128 之间
+	assert.Len(t, a, 43)
+	assert.NotEqual(t, a, b)
+}
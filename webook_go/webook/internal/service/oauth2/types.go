@@ -0,0 +1,51 @@
+// Package oauth2 第三方登录，每个平台实现一个 Provider
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"webook_go/webook/internal/domain"
+)
+
+var (
+	ErrInvalidCode = errors.New("授权码无效或者已经过期")
+	// ErrTimeout 调用第三方平台超时，可以让用户重试
+	ErrTimeout = errors.New("第三方平台响应超时")
+	// ErrUnavailable 第三方平台繁忙或者限流了
+	ErrUnavailable = errors.New("第三方平台暂时不可用")
+	// ErrTokenExpired access_token 和 refresh_token 都过期了，只能让用户重新授权
+	ErrTokenExpired = errors.New("第三方平台的授权已经过期")
+	// ErrRefreshUnsupported 这个平台的 access_token 不能刷新
+	ErrRefreshUnsupported = errors.New("不支持刷新 access_token")
+)
+
+// AuthParams 构造授权链接的参数
+type AuthParams struct {
+	// State 防止 CSRF，回调的时候原样带回来
+	State string
+	// Nonce OIDC 用的，会出现在 ID token 里面，防止 ID token 被重放
+	Nonce string
+	// CodeChallenge PKCE 的 S256 challenge，不支持 PKCE 的平台会忽略
+	CodeChallenge string
+}
+
+// ExchangeParams 用授权码换用户信息的参数
+type ExchangeParams struct {
+	Code         string
+	CodeVerifier string
+	Nonce        string
+}
+
+// TokenRefresher access_token 会过期的平台实现，用 refresh_token 换一个新的
+// 返回的 Identity 只有 token 相关的字段
+type TokenRefresher interface {
+	Refresh(ctx context.Context, identity domain.Identity) (domain.Identity, error)
+}
+
+type Provider interface {
+	// Name 路由里面的名字，也是存储身份的时候用的 provider
+	Name() string
+	AuthURL(ctx context.Context, p AuthParams) (string, error)
+	// Exchange 用授权码换取用户在第三方平台上的身份，返回的 Identity 没有 Uid
+	Exchange(ctx context.Context, p ExchangeParams) (domain.Identity, error)
+}
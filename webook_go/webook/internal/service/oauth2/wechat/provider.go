@@ -0,0 +1,66 @@
+package wechat
+
+import (
+	"context"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/service/oauth2"
+	"webook_go/webook/pkg/logger"
+)
+
+// Provider 把微信扫码登录适配成 oauth2.Provider，微信不支持 PKCE 和 nonce
+type Provider struct {
+	svc Service
+	l   logger.LoggerV1
+}
+
+func NewProvider(svc Service, l logger.LoggerV1) *Provider {
+	return &Provider{svc: svc, l: l}
+}
+
+func (p *Provider) Name() string {
+	return domain.IdentityProviderWechat
+}
+
+func (p *Provider) AuthURL(ctx context.Context, params oauth2.AuthParams) (string, error) {
+	return p.svc.AuthURL(ctx, params.State)
+}
+
+func (p *Provider) Exchange(ctx context.Context, params oauth2.ExchangeParams) (domain.Identity, error) {
+	token, err := p.svc.VerifyCode(ctx, params.Code)
+	if err != nil {
+		return domain.Identity{}, err
+	}
+	identity := domain.Identity{
+		Provider: p.Name(),
+		// 同一个用户在不同的应用下 openid 不一样，unionid 才是一样的
+		Subject:        token.OpenID,
+		UnionID:        token.UnionID,
+		AccessToken:    token.AccessToken,
+		RefreshToken:   token.RefreshToken,
+		TokenExpiresAt: token.ExpiresAt,
+	}
+	info, err := p.svc.UserInfo(ctx, token.AccessToken, token.OpenID)
+	if err != nil {
+		// 拿不到昵称和头像也可以登录
+		p.l.Warn("获取微信用户信息失败", logger.Error(err))
+		return identity, nil
+	}
+	identity.Nickname = info.Nickname
+	identity.Avatar = info.Avatar
+	if identity.UnionID == "" {
+		identity.UnionID = info.UnionID
+	}
+	return identity, nil
+}
+
+func (p *Provider) Refresh(ctx context.Context, identity domain.Identity) (domain.Identity, error) {
+	token, err := p.svc.RefreshToken(ctx, identity.RefreshToken)
+	if err != nil {
+		return domain.Identity{}, err
+	}
+	return domain.Identity{
+		AccessToken:    token.AccessToken,
+		RefreshToken:   token.RefreshToken,
+		TokenExpiresAt: token.ExpiresAt,
+	}, nil
+}
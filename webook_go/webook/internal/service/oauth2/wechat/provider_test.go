@@ -0,0 +1,170 @@
+package wechat
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/service/oauth2"
+	"webook_go/webook/pkg/logger"
+)
+
+var testNow = time.UnixMilli(1700000000000)
+
+// newTestServer 模拟 api.weixin.qq.com，不同的 code 触发不同的响应
+func newTestServer(t *testing.T) *httptest.Server {
+	writeJSON := func(w http.ResponseWriter, v any) {
+		_ = json.NewEncoder(w).Encode(v)
+	}
+	token := map[string]any{
+		"access_token":  "access-1",
+		"expires_in":    7200,
+		"refresh_token": "refresh-1",
+		"openid":        "openid",
+		"scope":         "snsapi_login",
+		"unionid":       "unionid",
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sns/oauth2/access_token", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		assert.Equal(t, "app-id", q.Get("appid"))
+		assert.Equal(t, "app-secret", q.Get("secret"))
+		switch q.Get("code") {
+		case "good-code", "no-userinfo":
+			res := map[string]any{}
+			for k, v := range token {
+				res[k] = v
+			}
+			if q.Get("code") == "no-userinfo" {
+				res["access_token"] = "no-userinfo"
+			}
+			writeJSON(w, res)
+		case "used-code":
+			writeJSON(w, map[string]any{"errcode": 40163, "errmsg": "code been used"})
+		case "busy":
+			writeJSON(w, map[string]any{"errcode": -1, "errmsg": "system error"})
+		case "slow":
+			time.Sleep(time.Millisecond * 200)
+			writeJSON(w, token)
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	})
+	mux.HandleFunc("/sns/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("access_token") != "access-1" {
+			writeJSON(w, map[string]any{"errcode": 40001, "errmsg": "invalid credential"})
+			return
+		}
+		writeJSON(w, map[string]any{
+			"openid":     "openid",
+			"nickname":   "小明",
+			"headimgurl": "https://thirdwx.qlogo.cn/avatar",
+			"unionid":    "unionid",
+		})
+	})
+	mux.HandleFunc("/sns/oauth2/refresh_token", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("refresh_token") != "refresh-1" {
+			writeJSON(w, map[string]any{"errcode": 42002, "errmsg": "refresh_token expired"})
+			return
+		}
+		writeJSON(w, map[string]any{
+			"access_token":  "access-2",
+			"expires_in":    7200,
+			"refresh_token": "refresh-1",
+			"openid":        "openid",
+		})
+	})
+	return httptest.NewServer(mux)
+}
+
+func newTestProvider(server *httptest.Server) *Provider {
+	client := server.Client()
+	client.Timeout = time.Millisecond * 100
+	svc := NewService("app-id", "app-secret", "https://meoying.com/oauth2/wechat/callback",
+		client, &logger.NopLogger{}).(*service)
+	svc.apiEndpoint = server.URL
+	svc.now = func() time.Time {
+		return testNow
+	}
+	return NewProvider(svc, &logger.NopLogger{})
+}
+
+func TestProvider_Exchange(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	p := newTestProvider(server)
+
+	testCases := []struct {
+		name string
+		code string
+
+		wantIdentity domain.Identity
+		wantErr      error
+	}{
+		{
+			name: "成功",
+			code: "good-code",
+			wantIdentity: domain.Identity{
+				Provider:       "wechat",
+				Subject:        "openid",
+				UnionID:        "unionid",
+				AccessToken:    "access-1",
+				RefreshToken:   "refresh-1",
+				TokenExpiresAt: testNow.Add(time.Hour * 2),
+				Nickname:       "小明",
+				Avatar:         "https://thirdwx.qlogo.cn/avatar",
+			},
+		},
+		{
+			name: "拿不到用户信息也能登录",
+			code: "no-userinfo",
+			wantIdentity: domain.Identity{
+				Provider:       "wechat",
+				Subject:        "openid",
+				UnionID:        "unionid",
+				AccessToken:    "no-userinfo",
+				RefreshToken:   "refresh-1",
+				TokenExpiresAt: testNow.Add(time.Hour * 2),
+			},
+		},
+		{name: "授权码用过了", code: "used-code", wantErr: oauth2.ErrInvalidCode},
+		{name: "微信繁忙", code: "busy", wantErr: oauth2.ErrUnavailable},
+		{name: "超时", code: "slow", wantErr: oauth2.ErrTimeout},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			identity, err := p.Exchange(context.Background(), oauth2.ExchangeParams{Code: tc.code})
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.wantIdentity, identity)
+		})
+	}
+
+	// HTTP 状态码不对
+	_, err := p.Exchange(context.Background(), oauth2.ExchangeParams{Code: "other"})
+	var httpErr *oauth2.HTTPError
+	require.ErrorAs(t, err, &httpErr)
+	assert.Equal(t, http.StatusBadGateway, httpErr.StatusCode)
+}
+
+func TestProvider_Refresh(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	p := newTestProvider(server)
+
+	identity, err := p.Refresh(context.Background(), domain.Identity{RefreshToken: "refresh-1"})
+	require.NoError(t, err)
+	assert.Equal(t, domain.Identity{
+		AccessToken:    "access-2",
+		RefreshToken:   "refresh-1",
+		TokenExpiresAt: testNow.Add(time.Hour * 2),
+	}, identity)
+
+	// refresh_token 也过期了，只能重新扫码
+	_, err = p.Refresh(context.Background(), domain.Identity{RefreshToken: "expired"})
+	assert.ErrorIs(t, err, oauth2.ErrTokenExpired)
+}
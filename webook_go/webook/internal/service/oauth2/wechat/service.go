@@ -2,85 +2,208 @@ package wechat
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"go.uber.org/zap"
 	"net/http"
 	"net/url"
-	"webook_go/webook/internal/domain"
+	"time"
+	"webook_go/webook/internal/service/oauth2"
 	"webook_go/webook/pkg/logger"
 )
 
-var redirectURI = url.PathEscape("https://meoying.com/oauth2/wechat/callback")
+// 微信的错误码，https://developers.weixin.qq.com/doc/oplatform/Return_codes/Return_code_descriptions_new.html
+const (
+	errCodeBusy                = -1
+	errCodeInvalidAccessToken  = 40001
+	errCodeInvalidCode         = 40029
+	errCodeInvalidRefreshToken = 40030
+	errCodeCodeBeenUsed        = 40163
+	errCodeAccessTokenExpired  = 42001
+	errCodeRefreshTokenExpired = 42002
+	errCodeRateLimited         = 45011
+)
 
 type Service interface {
 	AuthURL(ctx context.Context, state string) (string, error)
-	VerifyCode(ctx context.Context, code string) (domain.WechatInfo, error)
+	// VerifyCode 用授权码换 access_token，顺便拿到 openid 和 unionid
+	VerifyCode(ctx context.Context, code string) (Token, error)
+	// RefreshToken access_token 两个小时就过期了，用 refresh_token 换一个新的
+	RefreshToken(ctx context.Context, refreshToken string) (Token, error)
+	// UserInfo 拿昵称和头像
+	UserInfo(ctx context.Context, accessToken, openID string) (UserInfo, error)
+}
+
+// Token 微信返回的授权信息
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+	OpenID       string
+	UnionID      string
+}
+
+type UserInfo struct {
+	OpenID   string
+	UnionID  string
+	Nickname string
+	Avatar   string
+}
+
+// APIError 微信返回的错误，HTTP 状态码都是 200
+type APIError struct {
+	Code int64
+	Msg  string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("微信返回错误响应，错误码: %d, 错误信息: %s", e.Code, e.Msg)
+}
+
+// Unwrap 常见的错误码翻译成 oauth2 包里面的错误，方便上层统一处理
+func (e *APIError) Unwrap() error {
+	switch e.Code {
+	case errCodeInvalidCode, errCodeCodeBeenUsed:
+		return oauth2.ErrInvalidCode
+	case errCodeInvalidAccessToken, errCodeAccessTokenExpired,
+		errCodeInvalidRefreshToken, errCodeRefreshTokenExpired:
+		return oauth2.ErrTokenExpired
+	case errCodeBusy, errCodeRateLimited:
+		return oauth2.ErrUnavailable
+	default:
+		return nil
+	}
 }
 
 type service struct {
-	appId     string
-	appSecret string
-	client    *http.Client
-	l         logger.LoggerV1
+	appId       string
+	appSecret   string
+	redirectURI string
+	client      *http.Client
+	// apiEndpoint 测试的时候换成 httptest 的地址
+	apiEndpoint string
+	now         func() time.Time
+	l           logger.LoggerV1
 }
 
-func NewService(appId string, appSecret string, l logger.LoggerV1) Service {
+// NewService redirectURI 要和微信开放平台上配置的回调域名一致
+// client 要设置超时，微信慢的时候不能把请求一直挂着
+func NewService(appId string, appSecret string, redirectURI string,
+	client *http.Client, l logger.LoggerV1) Service {
 	return &service{
-		appId:     appId,
-		appSecret: appSecret,
-		client:    http.DefaultClient,
-		l:         l,
+		appId:       appId,
+		appSecret:   appSecret,
+		redirectURI: redirectURI,
+		client:      client,
+		apiEndpoint: "https://api.weixin.qq.com",
+		now:         time.Now,
+		l:           l,
 	}
 }
 
-func (s *service) VerifyCode(ctx context.Context, code string) (domain.WechatInfo, error) {
-	const targetPattern = "https://api.weixin.qq.com/sns/oauth2/access_token?appid=%s&secret=%s&code=%s&grant_type=authorization_code"
-	target := fmt.Sprintf(targetPattern, s.appId, s.appSecret, code)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil) // 这种不会产生复制
+func (s *service) VerifyCode(ctx context.Context, code string) (Token, error) {
+	query := url.Values{}
+	query.Set("appid", s.appId)
+	query.Set("secret", s.appSecret)
+	query.Set("code", code)
+	query.Set("grant_type", "authorization_code")
+	return s.token(ctx, "/sns/oauth2/access_token", query)
+}
+
+func (s *service) RefreshToken(ctx context.Context, refreshToken string) (Token, error) {
+	query := url.Values{}
+	query.Set("appid", s.appId)
+	query.Set("grant_type", "refresh_token")
+	query.Set("refresh_token", refreshToken)
+	return s.token(ctx, "/sns/oauth2/refresh_token", query)
+}
+
+func (s *service) token(ctx context.Context, path string, query url.Values) (Token, error) {
+	var res tokenResult
+	err := s.get(ctx, path, query, &res)
 	if err != nil {
-		return domain.WechatInfo{}, err
+		return Token{}, err
 	}
-	resp, err := s.client.Do(req)
-	if err != nil {
-		return domain.WechatInfo{}, err
+	if res.AccessToken == "" || res.OpenID == "" {
+		return Token{}, errors.New("微信返回的 access_token 或者 openid 是空的")
 	}
+	s.l.Debug("调用微信，拿到用户信息", logger.String("unionID", res.UnionID),
+		logger.String("openID", res.OpenID))
+	return Token{
+		AccessToken:  res.AccessToken,
+		RefreshToken: res.RefreshToken,
+		ExpiresAt:    s.now().Add(time.Duration(res.ExpiresIn) * time.Second),
+		OpenID:       res.OpenID,
+		UnionID:      res.UnionID,
+	}, nil
+}
 
-	// 读取响应，只读一遍
-	decoder := json.NewDecoder(resp.Body)
-	var res Result
-	err = decoder.Decode(&res)
+func (s *service) UserInfo(ctx context.Context, accessToken, openID string) (UserInfo, error) {
+	query := url.Values{}
+	query.Set("access_token", accessToken)
+	query.Set("openid", openID)
+	var res userInfoResult
+	err := s.get(ctx, "/sns/userinfo", query, &res)
 	if err != nil {
-		return domain.WechatInfo{}, err
-	}
-
-	if res.ErrCode != 0 {
-		return domain.WechatInfo{}, fmt.Errorf("微信返回错误响应，错误码: %d, 错误信息: %s", res.ErrCode, res.ErrMsg)
+		return UserInfo{}, err
 	}
+	return UserInfo{
+		OpenID:   res.OpenID,
+		UnionID:  res.UnionID,
+		Nickname: res.Nickname,
+		Avatar:   res.HeadImgURL,
+	}, nil
+}
 
-	zap.L().Info("调用微信，拿到用户信息", zap.String("unionID", res.UnionID),
-		zap.String("openID", res.OpenID))
+// apiResult 所有接口出错的时候都是这两个字段
+type apiResult interface {
+	apiError() error
+}
 
-	return domain.WechatInfo{
-		OpenID:  res.OpenID,
-		UnionID: res.UnionID,
-	}, nil
+func (s *service) get(ctx context.Context, path string, query url.Values, res apiResult) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		s.apiEndpoint+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	err = oauth2.DoJSON(s.client, req, res)
+	if err != nil {
+		return fmt.Errorf("调用微信 %s 失败 %w", path, err)
+	}
+	return res.apiError()
 }
 
 func (s *service) AuthURL(ctx context.Context, state string) (string, error) {
 	const urlPattern = "https://open.weixin.qq.com/connect/qrconnect?appid=%s&redirect_uri=%s&response_type=code&scope=snsapi_login&state=%s#wechat_redirect"
-	return fmt.Sprintf(urlPattern, s.appId, redirectURI, state), nil
+	return fmt.Sprintf(urlPattern, s.appId, url.QueryEscape(s.redirectURI), url.QueryEscape(state)), nil
 }
 
-type Result struct {
+type errResult struct {
 	ErrCode int64  `json:"errcode"`
 	ErrMsg  string `json:"errmsg"`
+}
+
+func (r errResult) apiError() error {
+	if r.ErrCode == 0 {
+		return nil
+	}
+	return &APIError{Code: r.ErrCode, Msg: r.ErrMsg}
+}
 
+type tokenResult struct {
+	errResult
 	AccessToken  string `json:"access_token"`
-	ExpireIn     string `json:"expire_in"`
+	ExpiresIn    int64  `json:"expires_in"`
 	RefreshToken string `json:"refresh_token"`
 
 	OpenID  string `json:"openid"`
 	Scope   string `json:"scope"`
 	UnionID string `json:"unionid"`
 }
+
+type userInfoResult struct {
+	errResult
+	OpenID     string `json:"openid"`
+	Nickname   string `json:"nickname"`
+	HeadImgURL string `json:"headimgurl"`
+	UnionID    string `json:"unionid"`
+}
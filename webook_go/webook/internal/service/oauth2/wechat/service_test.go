@@ -5,8 +5,10 @@ package wechat
 import (
 	"context"
 	"github.com/stretchr/testify/require"
+	"net/http"
 	"os"
 	"testing"
+	"webook_go/webook/pkg/logger"
 )
 
 // 手动跑的，提前验证代码
@@ -19,8 +21,9 @@ func Test_service_manual_VerifyCode(t *testing.T) {
 	if !ok {
 		panic("没有找到环境变量 WECHAT_APP_SECRET")
 	}
-	svc := NewService(appId, appKey)
-	res, err := svc.VerifyCode(context.Background(), "xxxx", "state")
+	svc := NewService(appId, appKey, "https://meoying.com/oauth2/wechat/callback",
+		http.DefaultClient, &logger.NopLogger{})
+	res, err := svc.VerifyCode(context.Background(), "xxxx")
 	require.NoError(t, err)
 	t.Log(res)
 }
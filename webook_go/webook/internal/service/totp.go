@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"webook_go/webook/internal/repository"
+	"webook_go/webook/pkg/totp"
+)
+
+var (
+	ErrTOTPAlreadyEnabled = errors.New("已经开启了两步验证")
+	ErrTOTPNotEnabled     = errors.New("没有开启两步验证")
+	ErrInvalidTOTPCode    = errors.New("两步验证的验证码不对")
+)
+
+// recoveryCodeCount 每次启用生成多少个恢复码
+const recoveryCodeCount = 10
+
+type TOTPConfig struct {
+	// Issuer 在 App 里面显示的名字
+	Issuer string
+}
+
+// TOTPService 基于 TOTP 的两步验证
+type TOTPService interface {
+	// Setup 生成新的密钥，返回密钥和给 App 扫码用的 otpauth 链接，这个时候还没有启用
+	Setup(ctx context.Context, uid int64) (secret string, uri string, err error)
+	// Enable 输入 App 上的验证码确认绑定，返回恢复码，恢复码只会展示这一次
+	Enable(ctx context.Context, uid int64, code string) ([]string, error)
+	// Disable 关闭两步验证，需要验证码或者恢复码
+	Disable(ctx context.Context, uid int64, code string) error
+	Enabled(ctx context.Context, uid int64) (bool, error)
+	// Verify 登录的第二步，验证码和恢复码都可以
+	Verify(ctx context.Context, uid int64, code string) error
+}
+
+type totpService struct {
+	repo     repository.TOTPRepository
+	userRepo repository.UserRepository
+	cfg      TOTPConfig
+	now      func() time.Time
+}
+
+func NewTOTPService(repo repository.TOTPRepository, userRepo repository.UserRepository, cfg TOTPConfig) TOTPService {
+	return &totpService{
+		repo:     repo,
+		userRepo: userRepo,
+		cfg:      cfg,
+		now:      time.Now,
+	}
+}
+
+func (svc *totpService) Setup(ctx context.Context, uid int64) (string, string, error) {
+	t, err := svc.repo.FindByUid(ctx, uid)
+	switch {
+	case err == nil && t.Enabled:
+		// 要换手机的话，先关掉再重新绑定
+		return "", "", ErrTOTPAlreadyEnabled
+	case err != nil && err != repository.ErrTOTPNotFound:
+		return "", "", err
+	}
+	u, err := svc.userRepo.FindById(ctx, uid)
+	if err != nil {
+		return "", "", err
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	err = svc.repo.SaveSecret(ctx, uid, secret)
+	if err != nil {
+		return "", "", err
+	}
+	// App 里面用来区分账号的名字
+	account := u.Email
+	if account == "" {
+		account = u.Phone
+	}
+	if account == "" {
+		account = strconv.FormatInt(uid, 10)
+	}
+	return secret, totp.URI(svc.cfg.Issuer, account, secret), nil
+}
+
+func (svc *totpService) Enable(ctx context.Context, uid int64, code string) ([]string, error) {
+	t, err := svc.repo.FindByUid(ctx, uid)
+	if err == repository.ErrTOTPNotFound {
+		return nil, ErrTOTPNotEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.Enabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	if err = svc.verifyCode(ctx, uid, t.Secret, code); err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		c, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, c)
+		hashes = append(hashes, hashRecoveryCode(c))
+	}
+	err = svc.repo.Enable(ctx, uid, hashes)
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (svc *totpService) Disable(ctx context.Context, uid int64, code string) error {
+	err := svc.Verify(ctx, uid, code)
+	if err != nil {
+		return err
+	}
+	return svc.repo.Delete(ctx, uid)
+}
+
+func (svc *totpService) Enabled(ctx context.Context, uid int64) (bool, error) {
+	t, err := svc.repo.FindByUid(ctx, uid)
+	if err == repository.ErrTOTPNotFound {
+		return false, nil
+	}
+	return t.Enabled, err
+}
+
+func (svc *totpService) Verify(ctx context.Context, uid int64, code string) error {
+	t, err := svc.repo.FindByUid(ctx, uid)
+	if err == repository.ErrTOTPNotFound {
+		return ErrTOTPNotEnabled
+	}
+	if err != nil {
+		return err
+	}
+	if !t.Enabled {
+		return ErrTOTPNotEnabled
+	}
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		return svc.verifyCode(ctx, uid, t.Secret, code)
+	}
+	ok, err := svc.repo.UseRecoveryCode(ctx, uid, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidTOTPCode
+	}
+	return nil
+}
+
+// verifyCode 校验 App 上的验证码，同一个验证码只能用一次
+func (svc *totpService) verifyCode(ctx context.Context, uid int64, secret, code string) error {
+	step, ok := totp.Validate(secret, code, svc.now())
+	if !ok {
+		return ErrInvalidTOTPCode
+	}
+	ok, err := svc.repo.UseStep(ctx, uid, step)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// 已经用过了，可能是被人偷看到了
+		return ErrInvalidTOTPCode
+	}
+	return nil
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateRecoveryCode 格式是 xxxxx-xxxxx，50 位的随机数
+func generateRecoveryCode() (string, error) {
+	buf := make([]byte, 7)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	s := strings.ToLower(recoveryEncoding.EncodeToString(buf))[:10]
+	return s[:5] + "-" + s[5:], nil
+}
+
+// hashRecoveryCode 恢复码本身是高熵的随机数，用 SHA256 就够了，也方便直接按照哈希值查询
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
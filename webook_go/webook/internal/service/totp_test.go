@@ -0,0 +1,234 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/url"
+	"testing"
+	"time"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/repository"
+	repomocks "webook_go/webook/internal/repository/mocks"
+	"webook_go/webook/pkg/totp"
+)
+
+const testTOTPSecret = "JBSWY3DPEHPK3PXP"
+
+func newTestTOTPService(repo repository.TOTPRepository, userRepo repository.UserRepository,
+	now time.Time) *totpService {
+	svc := NewTOTPService(repo, userRepo, TOTPConfig{Issuer: "webook"}).(*totpService)
+	svc.now = func() time.Time {
+		return now
+	}
+	return svc
+}
+
+func TestTOTPService_Setup(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) (repository.TOTPRepository, repository.UserRepository)
+
+		wantAccount string
+		wantErr     error
+	}{
+		{
+			name: "第一次绑定",
+			mock: func(ctrl *gomock.Controller) (repository.TOTPRepository, repository.UserRepository) {
+				repo := repomocks.NewMockTOTPRepository(ctrl)
+				repo.EXPECT().FindByUid(gomock.Any(), int64(123)).
+					Return(domain.TOTP{}, repository.ErrTOTPNotFound)
+				repo.EXPECT().SaveSecret(gomock.Any(), int64(123), gomock.Any()).Return(nil)
+				userRepo := repomocks.NewMockUserRepository(ctrl)
+				userRepo.EXPECT().FindById(gomock.Any(), int64(123)).
+					Return(domain.User{Id: 123, Email: "123@qq.com"}, nil)
+				return repo, userRepo
+			},
+			wantAccount: "123@qq.com",
+		},
+		{
+			name: "没有确认，重新绑定",
+			mock: func(ctrl *gomock.Controller) (repository.TOTPRepository, repository.UserRepository) {
+				repo := repomocks.NewMockTOTPRepository(ctrl)
+				repo.EXPECT().FindByUid(gomock.Any(), int64(123)).
+					Return(domain.TOTP{Uid: 123, Secret: testTOTPSecret}, nil)
+				repo.EXPECT().SaveSecret(gomock.Any(), int64(123), gomock.Any()).Return(nil)
+				userRepo := repomocks.NewMockUserRepository(ctrl)
+				userRepo.EXPECT().FindById(gomock.Any(), int64(123)).
+					Return(domain.User{Id: 123, Phone: "15212345678"}, nil)
+				return repo, userRepo
+			},
+			wantAccount: "15212345678",
+		},
+		{
+			name: "已经启用了",
+			mock: func(ctrl *gomock.Controller) (repository.TOTPRepository, repository.UserRepository) {
+				repo := repomocks.NewMockTOTPRepository(ctrl)
+				repo.EXPECT().FindByUid(gomock.Any(), int64(123)).
+					Return(domain.TOTP{Uid: 123, Secret: testTOTPSecret, Enabled: true}, nil)
+				return repo, repomocks.NewMockUserRepository(ctrl)
+			},
+			wantErr: ErrTOTPAlreadyEnabled,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repo, userRepo := tc.mock(ctrl)
+			svc := newTestTOTPService(repo, userRepo, time.Now())
+			secret, uri, err := svc.Setup(context.Background(), 123)
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			u, err := url.Parse(uri)
+			require.NoError(t, err)
+			assert.Equal(t, "/webook:"+tc.wantAccount, u.Path)
+			assert.Equal(t, secret, u.Query().Get("secret"))
+		})
+	}
+}
+
+func TestTOTPService_Enable(t *testing.T) {
+	now := time.Now()
+	code, err := totp.Code(testTOTPSecret, totp.Step(now))
+	require.NoError(t, err)
+	pending := domain.TOTP{Uid: 123, Secret: testTOTPSecret}
+
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) repository.TOTPRepository
+		code string
+
+		wantErr error
+	}{
+		{
+			name: "确认成功",
+			mock: func(ctrl *gomock.Controller) repository.TOTPRepository {
+				repo := repomocks.NewMockTOTPRepository(ctrl)
+				repo.EXPECT().FindByUid(gomock.Any(), int64(123)).Return(pending, nil)
+				repo.EXPECT().UseStep(gomock.Any(), int64(123), totp.Step(now)).Return(true, nil)
+				repo.EXPECT().Enable(gomock.Any(), int64(123), gomock.Len(recoveryCodeCount)).Return(nil)
+				return repo
+			},
+			code: code,
+		},
+		{
+			name: "验证码不对",
+			mock: func(ctrl *gomock.Controller) repository.TOTPRepository {
+				repo := repomocks.NewMockTOTPRepository(ctrl)
+				repo.EXPECT().FindByUid(gomock.Any(), int64(123)).Return(pending, nil)
+				return repo
+			},
+			code:    "000000",
+			wantErr: ErrInvalidTOTPCode,
+		},
+		{
+			name: "还没有绑定",
+			mock: func(ctrl *gomock.Controller) repository.TOTPRepository {
+				repo := repomocks.NewMockTOTPRepository(ctrl)
+				repo.EXPECT().FindByUid(gomock.Any(), int64(123)).
+					Return(domain.TOTP{}, repository.ErrTOTPNotFound)
+				return repo
+			},
+			code:    code,
+			wantErr: ErrTOTPNotEnabled,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			svc := newTestTOTPService(tc.mock(ctrl), nil, now)
+			codes, err := svc.Enable(context.Background(), 123, tc.code)
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			require.Len(t, codes, recoveryCodeCount)
+			assert.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, codes[0])
+		})
+	}
+}
+
+func TestTOTPService_Verify(t *testing.T) {
+	now := time.Now()
+	code, err := totp.Code(testTOTPSecret, totp.Step(now))
+	require.NoError(t, err)
+	enabled := domain.TOTP{Uid: 123, Secret: testTOTPSecret, Enabled: true}
+
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) repository.TOTPRepository
+		code string
+
+		wantErr error
+	}{
+		{
+			name: "验证码",
+			mock: func(ctrl *gomock.Controller) repository.TOTPRepository {
+				repo := repomocks.NewMockTOTPRepository(ctrl)
+				repo.EXPECT().FindByUid(gomock.Any(), int64(123)).Return(enabled, nil)
+				repo.EXPECT().UseStep(gomock.Any(), int64(123), totp.Step(now)).Return(true, nil)
+				return repo
+			},
+			code: code,
+		},
+		{
+			name: "验证码重复使用",
+			mock: func(ctrl *gomock.Controller) repository.TOTPRepository {
+				repo := repomocks.NewMockTOTPRepository(ctrl)
+				repo.EXPECT().FindByUid(gomock.Any(), int64(123)).Return(enabled, nil)
+				repo.EXPECT().UseStep(gomock.Any(), int64(123), totp.Step(now)).Return(false, nil)
+				return repo
+			},
+			code:    code,
+			wantErr: ErrInvalidTOTPCode,
+		},
+		{
+			name: "恢复码，大小写和横线都不影响",
+			mock: func(ctrl *gomock.Controller) repository.TOTPRepository {
+				repo := repomocks.NewMockTOTPRepository(ctrl)
+				repo.EXPECT().FindByUid(gomock.Any(), int64(123)).Return(enabled, nil)
+				repo.EXPECT().UseRecoveryCode(gomock.Any(), int64(123), hashRecoveryCode("abcde-fghij")).
+					Return(true, nil)
+				return repo
+			},
+			code: "ABCDEFGHIJ",
+		},
+		{
+			name: "恢复码已经用过了",
+			mock: func(ctrl *gomock.Controller) repository.TOTPRepository {
+				repo := repomocks.NewMockTOTPRepository(ctrl)
+				repo.EXPECT().FindByUid(gomock.Any(), int64(123)).Return(enabled, nil)
+				repo.EXPECT().UseRecoveryCode(gomock.Any(), int64(123), hashRecoveryCode("abcde-fghij")).
+					Return(false, nil)
+				return repo
+			},
+			code:    "abcde-fghij",
+			wantErr: ErrInvalidTOTPCode,
+		},
+		{
+			name: "没有启用",
+			mock: func(ctrl *gomock.Controller) repository.TOTPRepository {
+				repo := repomocks.NewMockTOTPRepository(ctrl)
+				repo.EXPECT().FindByUid(gomock.Any(), int64(123)).
+					Return(domain.TOTP{Uid: 123, Secret: testTOTPSecret}, nil)
+				return repo
+			},
+			code:    code,
+			wantErr: ErrTOTPNotEnabled,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			svc := newTestTOTPService(tc.mock(ctrl), nil, now)
+			err := svc.Verify(context.Background(), 123, tc.code)
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
@@ -4,28 +4,73 @@ import (
 	"context"
 	"errors"
 	"golang.org/x/crypto/bcrypt"
+	"net/url"
+	"time"
+	"unicode/utf8"
 	"webook_go/webook/internal/domain"
 	"webook_go/webook/internal/repository"
 	"webook_go/webook/internal/repository/cache"
+	"webook_go/webook/pkg/degrade"
+	"webook_go/webook/pkg/gormx"
 	"webook_go/webook/pkg/logger"
 )
 
 var ErrUserDuplicateEmail = repository.ErrUserDuplicate
+var ErrUserNotFound = repository.ErrUserNotFound
+
+// ErrDegraded 系统降级了，调用方应该提示用户稍后再试，而不是当成系统错误
+var ErrDegraded = repository.ErrDegraded
 var ErrInvalidUserOrPassword = errors.New("账号/邮箱或密码不对")
 
+// ErrUnknownRole 分配了一个不存在的角色
+var ErrUnknownRole = errors.New("未知的角色")
+
+// ErrUserNotActivated 密码是对的，但是账号还没有通过邮件激活
+var ErrUserNotActivated = errors.New("账号未激活")
+
+// ErrUserBanned 账号被管理员封禁了
+var ErrUserBanned = errors.New("账号已被封禁")
+
+// 修改个人资料的校验错误
+var (
+	ErrNicknameTooLong = errors.New("昵称过长")
+	ErrAboutMeTooLong  = errors.New("个人简介过长")
+	ErrInvalidBirthday = errors.New("生日不对")
+	ErrInvalidAvatar   = errors.New("头像链接不对")
+)
+
+const (
+	maxNicknameLen = 24
+	maxAboutMeLen  = 1024
+	maxAvatarLen   = 1024
+)
+
 type UserService interface {
 	SignUp(ctx context.Context, u domain.User) error
 	Login(ctx context.Context, email, password string) (domain.User, error)
-	Edit(ctx context.Context, id int64, Nickname, Birthday, AboutMe string) (domain.User, error)
+	// UpdateProfile 修改个人资料，返回修改之后完整的用户信息
+	UpdateProfile(ctx context.Context, id int64, upd domain.ProfileUpdate) (domain.User, error)
 	FindOrCreate(ctx context.Context, Phone string) (domain.User, error)
+	// FindOrCreateByEmail 邮箱验证码登录，邮箱没有注册过的话就直接注册
+	// 还没激活的账号顺便激活，收到了验证码和点了激活链接一样能证明邮箱是自己的
+	FindOrCreateByEmail(ctx context.Context, email string) (domain.User, error)
 	Profile(ctx context.Context, id int64) (domain.User, error)
 	FindOrCreateByWechat(ctx context.Context, wechatInfo domain.WechatInfo) (domain.User, error)
+	// ResetPasswordByEmail 和 ResetPasswordByPhone 用于忘记密码，调用方要先校验过验证码
+	ResetPasswordByEmail(ctx context.Context, email, password string) (domain.User, error)
+	ResetPasswordByPhone(ctx context.Context, phone, password string) (domain.User, error)
+	// UpdateRoles 覆盖用户的角色，传空的就是取消所有角色
+	UpdateRoles(ctx context.Context, id int64, roles []domain.Role) error
+	// Banned 登录校验的时候用，走缓存
+	Banned(ctx context.Context, id int64) (bool, error)
 }
 
 type userService struct {
 	repo  repository.UserRepository
 	cache cache.CodeRedisCache
 	l     logger.LoggerV1
+	// now 方便测试
+	now func() time.Time
 }
 
 func NewUserService(repo repository.UserRepository, c cache.CodeRedisCache, l logger.LoggerV1) UserService {
@@ -33,6 +78,7 @@ func NewUserService(repo repository.UserRepository, c cache.CodeRedisCache, l lo
 		repo:  repo,
 		cache: c,
 		l:     l,
+		now:   time.Now,
 	}
 }
 
@@ -43,6 +89,8 @@ func (svc *userService) SignUp(ctx context.Context, u domain.User) error { // 
 		return err
 	}
 	u.Password = string(hash)
+	// 邮箱注册的账号要点了激活链接之后才能登录
+	u.Status = domain.UserStatusPending
 	// 然后就是，存起来
 	return svc.repo.Create(ctx, u)
 }
@@ -60,15 +108,103 @@ func (svc *userService) Login(ctx context.Context, email, password string) (doma
 	if err != nil {
 		return domain.User{}, ErrInvalidUserOrPassword
 	}
+	// 密码校验通过之后再判断，避免别人借此探测邮箱有没有注册
+	if u.Status == domain.UserStatusPending {
+		return domain.User{}, ErrUserNotActivated
+	}
+	if u.Banned() {
+		return domain.User{}, ErrUserBanned
+	}
 	return u, nil
 }
 
-func (svc *userService) Edit(ctx context.Context, id int64, Nickname, Birthday, AboutMe string) (domain.User, error) {
-	u, err := svc.repo.Edit(ctx, id, Nickname, Birthday, AboutMe)
+func (svc *userService) Banned(ctx context.Context, id int64) (bool, error) {
+	u, err := svc.repo.FindById(ctx, id)
+	if err == repository.ErrUserNotFound {
+		return false, nil
+	}
 	if err != nil {
-		return domain.User{}, errors.New("请注册账号")
+		return false, err
 	}
-	return u, nil
+	return u.Banned(), nil
+}
+
+// checkBanned 已经注册过的用户登录之前，看看有没有被封禁
+func (svc *userService) checkBanned(u domain.User, err error) (domain.User, error) {
+	if err == nil && u.Banned() {
+		return domain.User{}, ErrUserBanned
+	}
+	return u, err
+}
+
+func (svc *userService) ResetPasswordByEmail(ctx context.Context, email, password string) (domain.User, error) {
+	u, err := svc.repo.FindByEmail(ctx, email)
+	if err != nil {
+		return domain.User{}, err
+	}
+	return u, svc.resetPassword(ctx, u.Id, password)
+}
+
+func (svc *userService) ResetPasswordByPhone(ctx context.Context, phone, password string) (domain.User, error) {
+	u, err := svc.repo.FindByPhone(ctx, phone)
+	if err != nil {
+		return domain.User{}, err
+	}
+	return u, svc.resetPassword(ctx, u.Id, password)
+}
+
+func (svc *userService) resetPassword(ctx context.Context, id int64, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return svc.repo.UpdatePassword(ctx, id, string(hash))
+}
+
+func (svc *userService) UpdateRoles(ctx context.Context, id int64, roles []domain.Role) error {
+	for _, r := range roles {
+		if !r.Valid() {
+			return ErrUnknownRole
+		}
+	}
+	return svc.repo.UpdateRoles(ctx, id, roles)
+}
+
+func (svc *userService) UpdateProfile(ctx context.Context, id int64, upd domain.ProfileUpdate) (domain.User, error) {
+	if err := svc.validateProfile(upd); err != nil {
+		return domain.User{}, err
+	}
+	if upd.Empty() {
+		// 什么都没改，直接返回现在的
+		return svc.repo.FindById(ctx, id)
+	}
+	return svc.repo.UpdateProfile(ctx, id, upd)
+}
+
+func (svc *userService) validateProfile(upd domain.ProfileUpdate) error {
+	// 按字符算，不是按字节算，不然中文昵称只能有 8 个字
+	if upd.Nickname != nil && utf8.RuneCountInString(*upd.Nickname) > maxNicknameLen {
+		return ErrNicknameTooLong
+	}
+	if upd.AboutMe != nil && utf8.RuneCountInString(*upd.AboutMe) > maxAboutMeLen {
+		return ErrAboutMeTooLong
+	}
+	if upd.Birthday != nil && !upd.Birthday.IsZero() {
+		b := *upd.Birthday
+		if b.Year() < 1900 || b.After(svc.now()) {
+			return ErrInvalidBirthday
+		}
+	}
+	if upd.Avatar != nil && *upd.Avatar != "" {
+		if len(*upd.Avatar) > maxAvatarLen {
+			return ErrInvalidAvatar
+		}
+		u, err := url.Parse(*upd.Avatar)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return ErrInvalidAvatar
+		}
+	}
+	return nil
 }
 
 func (svc *userService) FindOrCreate(ctx context.Context, Phone string) (domain.User, error) {
@@ -79,14 +215,14 @@ func (svc *userService) FindOrCreate(ctx context.Context, Phone string) (domain.
 		// 这个叫做快路径
 		// nil 会进来这里
 		// 不为 ErrUserNotFound 的也会进来这里
-		return u, err
+		return svc.checkBanned(u, err)
 	}
 	// 这里，把 phone 脱敏之后打出来
 	//zap.L().Info("用户未注册", zap.String("phone", Phone))
 	svc.l.Info("用户未注册", logger.String("phone", Phone))
 	// 在系统资源不足，触发降级之后，不执行慢路径了。相当于优先服务已经注册的用户
-	if ctx.Value("降级") == "true" {
-		return domain.User{}, errors.New("系统降级了")
+	if degrade.Enabled() {
+		return domain.User{}, ErrDegraded
 	}
 	// 这个叫做慢路径
 	// 你明确知道，没有这个用户
@@ -94,32 +230,62 @@ func (svc *userService) FindOrCreate(ctx context.Context, Phone string) (domain.
 		Phone: Phone,
 	}
 	err = svc.repo.Create(ctx, u)
-	if err != nil || err != repository.ErrUserDuplicate {
+	if err != nil && err != repository.ErrUserDuplicate {
 		return u, err
 	}
-	// 因为这里会遇到主从延迟的问题
-	return svc.repo.FindByPhone(ctx, Phone)
+	// 要么创建成功了，要么并发注册了，都重新查一遍拿到 id
+	// 刚写进去从库可能还没有同步过来，要读主库
+	return svc.repo.FindByPhone(gormx.WithPrimary(ctx), Phone)
+}
+
+func (svc *userService) FindOrCreateByEmail(ctx context.Context, email string) (domain.User, error) {
+	u, err := svc.repo.FindByEmail(ctx, email)
+	if err != repository.ErrUserNotFound {
+		u, err = svc.checkBanned(u, err)
+		if err != nil || u.Status != domain.UserStatusPending {
+			return u, err
+		}
+		if _, err = svc.repo.Activate(ctx, u.Id); err != nil {
+			return domain.User{}, err
+		}
+		u.Status = domain.UserStatusActive
+		return u, nil
+	}
+	svc.l.Info("用户未注册", logger.String("email", email))
+	if degrade.Enabled() {
+		return domain.User{}, ErrDegraded
+	}
+	// 通过验证码登录的，没有密码
+	u = domain.User{
+		Email: email,
+	}
+	err = svc.repo.Create(ctx, u)
+	if err != nil && err != repository.ErrUserDuplicate {
+		return u, err
+	}
+	// 要么创建成功了，要么并发注册了，都重新查一遍拿到 id
+	return svc.repo.FindByEmail(gormx.WithPrimary(ctx), email)
 }
 
 func (svc *userService) FindOrCreateByWechat(ctx context.Context, info domain.WechatInfo) (domain.User, error) {
 	u, err := svc.repo.FindByWechat(ctx, info.OpenID)
 	// 要判断，是否有这个用户
 	if err != repository.ErrUserNotFound {
-		return u, err
+		return svc.checkBanned(u, err)
 	}
 
-	if ctx.Value("降级") == "true" {
-		return domain.User{}, errors.New("系统降级了")
+	if degrade.Enabled() {
+		return domain.User{}, ErrDegraded
 	}
 	u = domain.User{
 		WechatInfo: info,
 	}
 	err = svc.repo.Create(ctx, u)
-	if err != nil || err != repository.ErrUserDuplicate {
+	if err != nil && err != repository.ErrUserDuplicate {
 		return u, err
 	}
-	// 因为这里会遇到主从延迟的问题
-	return svc.repo.FindByWechat(ctx, info.OpenID)
+	// 和手机号一样，重新查主库拿到 id
+	return svc.repo.FindByWechat(gormx.WithPrimary(ctx), info.OpenID)
 }
 
 func (svc *userService) Profile(ctx context.Context, id int64) (domain.User, error) {
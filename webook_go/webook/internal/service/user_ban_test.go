@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+	"time"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/repository"
+	repomocks "webook_go/webook/internal/repository/mocks"
+	"webook_go/webook/pkg/logger"
+)
+
+func TestUserService_LoginBanned(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	hash, err := bcrypt.GenerateFromPassword([]byte("hello#world123"), bcrypt.MinCost)
+	require.NoError(t, err)
+	repo := repomocks.NewMockUserRepository(ctrl)
+	banned := domain.User{Id: 123, Password: string(hash), BannedAt: time.UnixMilli(100)}
+	repo.EXPECT().FindByEmail(gomock.Any(), "123@qq.com").Return(banned, nil).Times(2)
+	repo.EXPECT().FindByPhone(gomock.Any(), "15212345678").Return(banned, nil)
+	svc := NewUserService(repo, nil, &logger.NopLogger{})
+
+	_, err = svc.Login(context.Background(), "123@qq.com", "hello#world123")
+	assert.Equal(t, ErrUserBanned, err)
+	_, err = svc.FindOrCreateByEmail(context.Background(), "123@qq.com")
+	assert.Equal(t, ErrUserBanned, err)
+	_, err = svc.FindOrCreate(context.Background(), "15212345678")
+	assert.Equal(t, ErrUserBanned, err)
+}
+
+func TestUserService_Banned(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(repo *repomocks.MockUserRepository)
+
+		wantBanned bool
+		wantErr    error
+	}{
+		{
+			name: "被封禁了",
+			mock: func(repo *repomocks.MockUserRepository) {
+				repo.EXPECT().FindById(gomock.Any(), int64(123)).
+					Return(domain.User{Id: 123, BannedAt: time.UnixMilli(100)}, nil)
+			},
+			wantBanned: true,
+		},
+		{
+			name: "正常的用户",
+			mock: func(repo *repomocks.MockUserRepository) {
+				repo.EXPECT().FindById(gomock.Any(), int64(123)).Return(domain.User{Id: 123}, nil)
+			},
+		},
+		{
+			name: "用户不存在",
+			mock: func(repo *repomocks.MockUserRepository) {
+				repo.EXPECT().FindById(gomock.Any(), int64(123)).
+					Return(domain.User{}, repository.ErrUserNotFound)
+			},
+		},
+		{
+			name: "查询出错",
+			mock: func(repo *repomocks.MockUserRepository) {
+				repo.EXPECT().FindById(gomock.Any(), int64(123)).
+					Return(domain.User{}, errors.New("redis 错误"))
+			},
+			wantErr: errors.New("redis 错误"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repo := repomocks.NewMockUserRepository(ctrl)
+			tc.mock(repo)
+			svc := NewUserService(repo, nil, &logger.NopLogger{})
+			banned, err := svc.Banned(context.Background(), 123)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantBanned, banned)
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"testing"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/repository"
+	repomocks "webook_go/webook/internal/repository/mocks"
+	"webook_go/webook/pkg/gormx"
+	"webook_go/webook/pkg/logger"
+)
+
+// primaryCtx 重新查询的时候一定要读主库
+func primaryCtx() gomock.Matcher {
+	return gomock.Cond(func(x any) bool {
+		ctx, ok := x.(context.Context)
+		return ok && gormx.UsePrimary(ctx)
+	})
+}
+
+func TestUserService_FindOrCreate(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(repo *repomocks.MockUserRepository)
+
+		wantUser domain.User
+		wantErr  error
+	}{
+		{
+			name: "已经注册过了",
+			mock: func(repo *repomocks.MockUserRepository) {
+				repo.EXPECT().FindByPhone(gomock.Any(), "15212345678").
+					Return(domain.User{Id: 123, Phone: "15212345678"}, nil)
+			},
+			wantUser: domain.User{Id: 123, Phone: "15212345678"},
+		},
+		{
+			name: "新用户，创建之后查主库拿到 id",
+			mock: func(repo *repomocks.MockUserRepository) {
+				repo.EXPECT().FindByPhone(gomock.Any(), "15212345678").
+					Return(domain.User{}, repository.ErrUserNotFound)
+				repo.EXPECT().Create(gomock.Any(), domain.User{Phone: "15212345678"}).Return(nil)
+				repo.EXPECT().FindByPhone(primaryCtx(), "15212345678").
+					Return(domain.User{Id: 123, Phone: "15212345678"}, nil)
+			},
+			wantUser: domain.User{Id: 123, Phone: "15212345678"},
+		},
+		{
+			name: "并发注册了",
+			mock: func(repo *repomocks.MockUserRepository) {
+				repo.EXPECT().FindByPhone(gomock.Any(), "15212345678").
+					Return(domain.User{}, repository.ErrUserNotFound)
+				repo.EXPECT().Create(gomock.Any(), domain.User{Phone: "15212345678"}).
+					Return(repository.ErrUserDuplicate)
+				repo.EXPECT().FindByPhone(primaryCtx(), "15212345678").
+					Return(domain.User{Id: 124, Phone: "15212345678"}, nil)
+			},
+			wantUser: domain.User{Id: 124, Phone: "15212345678"},
+		},
+		{
+			name: "创建失败",
+			mock: func(repo *repomocks.MockUserRepository) {
+				repo.EXPECT().FindByPhone(gomock.Any(), "15212345678").
+					Return(domain.User{}, repository.ErrUserNotFound)
+				repo.EXPECT().Create(gomock.Any(), domain.User{Phone: "15212345678"}).
+					Return(errors.New("数据库错误"))
+			},
+			wantErr: errors.New("数据库错误"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repo := repomocks.NewMockUserRepository(ctrl)
+			tc.mock(repo)
+			svc := NewUserService(repo, nil, &logger.NopLogger{})
+			u, err := svc.FindOrCreate(context.Background(), "15212345678")
+			assert.Equal(t, tc.wantErr, err)
+			if err == nil {
+				assert.NotZero(t, u.Id)
+				assert.Equal(t, tc.wantUser, u)
+			}
+		})
+	}
+}
+
+func TestUserService_FindOrCreateByWechat(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	info := domain.WechatInfo{OpenID: "open-id", UnionID: "union-id"}
+	repo := repomocks.NewMockUserRepository(ctrl)
+	repo.EXPECT().FindByWechat(gomock.Any(), "open-id").Return(domain.User{}, repository.ErrUserNotFound)
+	repo.EXPECT().Create(gomock.Any(), domain.User{WechatInfo: info}).Return(nil)
+	repo.EXPECT().FindByWechat(primaryCtx(), "open-id").Return(domain.User{Id: 123, WechatInfo: info}, nil)
+	svc := NewUserService(repo, nil, &logger.NopLogger{})
+
+	u, err := svc.FindOrCreateByWechat(context.Background(), info)
+	assert.NoError(t, err)
+	assert.NotZero(t, u.Id)
+	assert.Equal(t, int64(123), u.Id)
+}
+
+func TestUserService_FindOrCreateByEmail(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(repo *repomocks.MockUserRepository)
+
+		wantUser domain.User
+		wantErr  error
+	}{
+		{
+			name: "还没激活的，验证码登录顺便激活",
+			mock: func(repo *repomocks.MockUserRepository) {
+				repo.EXPECT().FindByEmail(gomock.Any(), "123@qq.com").
+					Return(domain.User{Id: 123, Email: "123@qq.com", Status: domain.UserStatusPending}, nil)
+				repo.EXPECT().Activate(gomock.Any(), int64(123)).Return(true, nil)
+			},
+			wantUser: domain.User{Id: 123, Email: "123@qq.com", Status: domain.UserStatusActive},
+		},
+		{
+			name: "激活失败",
+			mock: func(repo *repomocks.MockUserRepository) {
+				repo.EXPECT().FindByEmail(gomock.Any(), "123@qq.com").
+					Return(domain.User{Id: 123, Email: "123@qq.com", Status: domain.UserStatusPending}, nil)
+				repo.EXPECT().Activate(gomock.Any(), int64(123)).Return(false, errors.New("数据库错误"))
+			},
+			wantErr: errors.New("数据库错误"),
+		},
+		{
+			name: "新用户，创建之后查主库拿到 id",
+			mock: func(repo *repomocks.MockUserRepository) {
+				repo.EXPECT().FindByEmail(gomock.Any(), "123@qq.com").
+					Return(domain.User{}, repository.ErrUserNotFound)
+				repo.EXPECT().Create(gomock.Any(), domain.User{Email: "123@qq.com"}).Return(nil)
+				repo.EXPECT().FindByEmail(primaryCtx(), "123@qq.com").
+					Return(domain.User{Id: 123, Email: "123@qq.com"}, nil)
+			},
+			wantUser: domain.User{Id: 123, Email: "123@qq.com"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			repo := repomocks.NewMockUserRepository(ctrl)
+			tc.mock(repo)
+			svc := NewUserService(repo, nil, &logger.NopLogger{})
+			u, err := svc.FindOrCreateByEmail(context.Background(), "123@qq.com")
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantUser, u)
+		})
+	}
+}
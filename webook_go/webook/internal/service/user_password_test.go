@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/repository"
+	repomocks "webook_go/webook/internal/repository/mocks"
+	"webook_go/webook/pkg/logger"
+)
+
+func TestUserService_ResetPassword(t *testing.T) {
+	// 校验存进去的是新密码加密之后的结果
+	hashOf := func(password string) gomock.Matcher {
+		return gomock.Cond(func(x any) bool {
+			hash, ok := x.(string)
+			return ok && bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+		})
+	}
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) repository.UserRepository
+
+		byEmail bool
+
+		wantUser domain.User
+		wantErr  error
+	}{
+		{
+			name: "邮箱重置成功",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				repo := repomocks.NewMockUserRepository(ctrl)
+				repo.EXPECT().FindByEmail(gomock.Any(), "123@qq.com").
+					Return(domain.User{Id: 123, Email: "123@qq.com"}, nil)
+				repo.EXPECT().UpdatePassword(gomock.Any(), int64(123), hashOf("hello#world123")).
+					Return(nil)
+				return repo
+			},
+			byEmail:  true,
+			wantUser: domain.User{Id: 123, Email: "123@qq.com"},
+		},
+		{
+			name: "手机号重置成功",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				repo := repomocks.NewMockUserRepository(ctrl)
+				repo.EXPECT().FindByPhone(gomock.Any(), "15212345678").
+					Return(domain.User{Id: 123, Phone: "15212345678"}, nil)
+				repo.EXPECT().UpdatePassword(gomock.Any(), int64(123), hashOf("hello#world123")).
+					Return(nil)
+				return repo
+			},
+			wantUser: domain.User{Id: 123, Phone: "15212345678"},
+		},
+		{
+			name: "账号不存在",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				repo := repomocks.NewMockUserRepository(ctrl)
+				repo.EXPECT().FindByPhone(gomock.Any(), "15212345678").
+					Return(domain.User{}, repository.ErrUserNotFound)
+				return repo
+			},
+			wantErr: ErrUserNotFound,
+		},
+		{
+			name: "更新失败",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				repo := repomocks.NewMockUserRepository(ctrl)
+				repo.EXPECT().FindByPhone(gomock.Any(), "15212345678").
+					Return(domain.User{Id: 123, Phone: "15212345678"}, nil)
+				repo.EXPECT().UpdatePassword(gomock.Any(), int64(123), gomock.Any()).
+					Return(errors.New("mock db 错误"))
+				return repo
+			},
+			wantUser: domain.User{Id: 123, Phone: "15212345678"},
+			wantErr:  errors.New("mock db 错误"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			svc := NewUserService(tc.mock(ctrl), nil, &logger.NopLogger{})
+			var (
+				u   domain.User
+				err error
+			)
+			if tc.byEmail {
+				u, err = svc.ResetPasswordByEmail(context.Background(), "123@qq.com", "hello#world123")
+			} else {
+				u, err = svc.ResetPasswordByPhone(context.Background(), "15212345678", "hello#world123")
+			}
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantUser, u)
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"strings"
+	"testing"
+	"time"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/repository"
+	repomocks "webook_go/webook/internal/repository/mocks"
+	"webook_go/webook/pkg/logger"
+)
+
+func TestUserService_UpdateProfile(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	ptr := func(s string) *string { return &s }
+	date := func(y int, m time.Month, d int) *time.Time {
+		t := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) repository.UserRepository
+		upd  domain.ProfileUpdate
+
+		wantUser domain.User
+		wantErr  error
+	}{
+		{
+			name: "只改昵称",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				repo := repomocks.NewMockUserRepository(ctrl)
+				repo.EXPECT().UpdateProfile(gomock.Any(), int64(123),
+					domain.ProfileUpdate{Nickname: ptr("大明")}).
+					Return(domain.User{Id: 123, Nickname: "大明", AboutMe: "原来的"}, nil)
+				return repo
+			},
+			upd:      domain.ProfileUpdate{Nickname: ptr("大明")},
+			wantUser: domain.User{Id: 123, Nickname: "大明", AboutMe: "原来的"},
+		},
+		{
+			name: "清空生日和头像",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				repo := repomocks.NewMockUserRepository(ctrl)
+				repo.EXPECT().UpdateProfile(gomock.Any(), int64(123), gomock.Any()).
+					Return(domain.User{Id: 123}, nil)
+				return repo
+			},
+			upd:      domain.ProfileUpdate{Birthday: &time.Time{}, Avatar: ptr("")},
+			wantUser: domain.User{Id: 123},
+		},
+		{
+			name: "什么都没改",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				repo := repomocks.NewMockUserRepository(ctrl)
+				repo.EXPECT().FindById(gomock.Any(), int64(123)).Return(domain.User{Id: 123}, nil)
+				return repo
+			},
+			wantUser: domain.User{Id: 123},
+		},
+		{
+			name: "中文昵称按字符算",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				repo := repomocks.NewMockUserRepository(ctrl)
+				repo.EXPECT().UpdateProfile(gomock.Any(), int64(123), gomock.Any()).
+					Return(domain.User{Id: 123}, nil)
+				return repo
+			},
+			upd:      domain.ProfileUpdate{Nickname: ptr(strings.Repeat("明", 24))},
+			wantUser: domain.User{Id: 123},
+		},
+		{
+			name: "昵称过长",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				return repomocks.NewMockUserRepository(ctrl)
+			},
+			upd:     domain.ProfileUpdate{Nickname: ptr(strings.Repeat("明", 25))},
+			wantErr: ErrNicknameTooLong,
+		},
+		{
+			name: "简介过长",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				return repomocks.NewMockUserRepository(ctrl)
+			},
+			upd:     domain.ProfileUpdate{AboutMe: ptr(strings.Repeat("a", 1025))},
+			wantErr: ErrAboutMeTooLong,
+		},
+		{
+			name: "生日在未来",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				return repomocks.NewMockUserRepository(ctrl)
+			},
+			upd:     domain.ProfileUpdate{Birthday: date(2024, 6, 2)},
+			wantErr: ErrInvalidBirthday,
+		},
+		{
+			name: "生日太早",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				return repomocks.NewMockUserRepository(ctrl)
+			},
+			upd:     domain.ProfileUpdate{Birthday: date(1899, 12, 31)},
+			wantErr: ErrInvalidBirthday,
+		},
+		{
+			name: "头像不是 http 链接",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				return repomocks.NewMockUserRepository(ctrl)
+			},
+			upd:     domain.ProfileUpdate{Avatar: ptr("javascript:alert(1)")},
+			wantErr: ErrInvalidAvatar,
+		},
+		{
+			name: "用户不存在",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				repo := repomocks.NewMockUserRepository(ctrl)
+				repo.EXPECT().UpdateProfile(gomock.Any(), int64(123), gomock.Any()).
+					Return(domain.User{}, repository.ErrUserNotFound)
+				return repo
+			},
+			upd:     domain.ProfileUpdate{Avatar: ptr("https://cdn.webook.com/a.png")},
+			wantErr: ErrUserNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			svc := NewUserService(tc.mock(ctrl), nil, &logger.NopLogger{}).(*userService)
+			svc.now = func() time.Time { return now }
+			u, err := svc.UpdateProfile(context.Background(), 123, tc.upd)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantUser, u)
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"testing"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/repository"
+	repomocks "webook_go/webook/internal/repository/mocks"
+	"webook_go/webook/pkg/logger"
+)
+
+func TestUserService_UpdateRoles(t *testing.T) {
+	testCases := []struct {
+		name  string
+		mock  func(ctrl *gomock.Controller) repository.UserRepository
+		roles []domain.Role
+
+		wantErr error
+	}{
+		{
+			name: "设置成管理员",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				repo := repomocks.NewMockUserRepository(ctrl)
+				repo.EXPECT().UpdateRoles(gomock.Any(), int64(123), []domain.Role{domain.RoleAdmin}).
+					Return(nil)
+				return repo
+			},
+			roles: []domain.Role{domain.RoleAdmin},
+		},
+		{
+			name: "取消所有角色",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				repo := repomocks.NewMockUserRepository(ctrl)
+				repo.EXPECT().UpdateRoles(gomock.Any(), int64(123), []domain.Role{}).
+					Return(nil)
+				return repo
+			},
+			roles: []domain.Role{},
+		},
+		{
+			name: "未知的角色",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				return repomocks.NewMockUserRepository(ctrl)
+			},
+			roles:   []domain.Role{domain.RoleAdmin, "root"},
+			wantErr: ErrUnknownRole,
+		},
+		{
+			name: "用户不存在",
+			mock: func(ctrl *gomock.Controller) repository.UserRepository {
+				repo := repomocks.NewMockUserRepository(ctrl)
+				repo.EXPECT().UpdateRoles(gomock.Any(), int64(123), []domain.Role{domain.RoleAdmin}).
+					Return(repository.ErrUserNotFound)
+				return repo
+			},
+			roles:   []domain.Role{domain.RoleAdmin},
+			wantErr: ErrUserNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			svc := NewUserService(tc.mock(ctrl), nil, &logger.NopLogger{})
+			err := svc.UpdateRoles(context.Background(), 123, tc.roles)
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+}
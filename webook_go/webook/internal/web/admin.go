@@ -0,0 +1,435 @@
+package web
+
+import (
+	"expvar"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/service"
+	ijwt "webook_go/webook/internal/web/jwt"
+	"webook_go/webook/internal/web/middleware"
+	"webook_go/webook/pkg/logger"
+)
+
+var _ handler = (*AdminHandler)(nil)
+
+// maxLoginHistoryLimit 一次最多查多少条登录记录
+const maxLoginHistoryLimit = 100
+
+// maxBannedListLimit 一次最多查多少个被封禁的用户，每张分表都要查这么多
+const maxBannedListLimit = 100
+
+// AdminHandler 管理后台的接口，每个接口都要声明需要的权限
+// 所有的操作都会记审计日志，查看用户信息也算
+type AdminHandler struct {
+	svc      service.UserService
+	adminSvc service.AdminService
+	jwtHdl   ijwt.Handler
+	rbac     *middleware.RBACMiddlewareBuilder
+	l        logger.LoggerV1
+}
+
+func NewAdminHandler(svc service.UserService, adminSvc service.AdminService,
+	jwtHdl ijwt.Handler, l logger.LoggerV1) *AdminHandler {
+	return &AdminHandler{
+		svc:      svc,
+		adminSvc: adminSvc,
+		jwtHdl:   jwtHdl,
+		rbac:     middleware.NewRBACMiddlewareBuilder(),
+		l:        l,
+	}
+}
+
+func (h *AdminHandler) RegisterRoutes(server *gin.Engine) {
+	ag := server.Group("/admin")
+	ag.POST("/users/roles", h.rbac.Require(domain.PermUserRole), h.UpdateRoles)
+	ag.POST("/users/search", h.rbac.Require(domain.PermUserView), h.SearchUsers)
+	ag.POST("/users/ban", h.rbac.Require(domain.PermUserBan), h.Ban)
+	ag.POST("/users/unban", h.rbac.Require(domain.PermUserBan), h.Unban)
+	ag.POST("/users/banned", h.rbac.Require(domain.PermUserView), h.ListBanned)
+	ag.POST("/users/logout", h.rbac.Require(domain.PermUserLogout), h.Logout)
+	ag.POST("/users/login_history", h.rbac.Require(domain.PermUserView), h.LoginHistory)
+	// expvar 里面有缓存命中率这些运行状态，不能公开
+	ag.GET("/debug/vars", h.rbac.Require(domain.PermSystemView), gin.WrapH(expvar.Handler()))
+}
+
+// UpdateRoles 覆盖用户的角色
+func (h *AdminHandler) UpdateRoles(ctx *gin.Context) {
+	type Req struct {
+		Uid   int64    `json:"uid"`
+		Roles []string `json:"roles"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	detail := strings.Join(req.Roles, ",")
+	roles := make([]domain.Role, 0, len(req.Roles))
+	for _, r := range req.Roles {
+		roles = append(roles, domain.Role(r))
+	}
+	err := h.svc.UpdateRoles(ctx, req.Uid, roles)
+	if err == service.ErrUnknownRole {
+		h.fail(ctx, domain.AuditActionUpdateRoles, req.Uid, detail, Result{
+			Code: 4,
+			Msg:  "未知的角色",
+		})
+		return
+	}
+	if !h.handleUserErr(ctx, domain.AuditActionUpdateRoles, req.Uid, detail, err, "修改角色失败") {
+		return
+	}
+	h.audit(ctx, domain.AuditActionUpdateRoles, req.Uid, detail, domain.AuditResultSuccess)
+	// 角色是放在 token 里面的，让用户重新登录才能生效
+	err = h.jwtHdl.ClearUserSessions(ctx, req.Uid)
+	if err != nil {
+		// 角色已经改了，只是旧的 token 还要等过期
+		h.l.Error("清除用户会话失败", logger.Error(err), logger.Int64("uid", req.Uid))
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Msg: "修改成功",
+	})
+}
+
+// SearchUsers 按照 id、邮箱、手机号精确查找，邮箱和手机号是脱敏之后返回的
+func (h *AdminHandler) SearchUsers(ctx *gin.Context) {
+	type Req struct {
+		Id    int64  `json:"id"`
+		Email string `json:"email"`
+		Phone string `json:"phone"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	q := domain.UserQuery{
+		Id:    req.Id,
+		Email: strings.TrimSpace(req.Email),
+		Phone: strings.TrimSpace(req.Phone),
+	}
+	// 搜索条件本身就是个人信息，审计日志里面也要脱敏
+	detail := fmt.Sprintf("email=%s phone=%s", maskEmail(q.Email), maskPhone(q.Phone))
+	if q.Empty() {
+		h.fail(ctx, domain.AuditActionSearchUser, req.Id, detail, Result{
+			Code: 4,
+			Msg:  "至少要有一个搜索条件",
+		})
+		return
+	}
+	users, err := h.adminSvc.SearchUsers(ctx, q)
+	if err != nil {
+		h.fail(ctx, domain.AuditActionSearchUser, req.Id, detail, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		h.l.Error("搜索用户失败", logger.Error(err))
+		return
+	}
+	if len(users) == 0 {
+		h.audit(ctx, domain.AuditActionSearchUser, req.Id, detail, domain.AuditResultSuccess)
+	}
+	res := make([]AdminUserVO, 0, len(users))
+	for _, u := range users {
+		// 按照邮箱、手机号搜的时候也要能按照用户查到谁看过他的信息
+		h.audit(ctx, domain.AuditActionSearchUser, u.Id, detail, domain.AuditResultSuccess)
+		res = append(res, newAdminUserVO(u))
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Data: res,
+	})
+}
+
+// ListBanned 被封禁的用户，最近封禁的在前面
+// 按照封禁时间翻页，before 传上一页最后一个的 bannedAt，第一页不传
+func (h *AdminHandler) ListBanned(ctx *gin.Context) {
+	type Req struct {
+		Before int64 `json:"before"`
+		Limit  int   `json:"limit"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	detail := fmt.Sprintf("before=%d limit=%d", req.Before, req.Limit)
+	if req.Before < 0 || req.Limit <= 0 || req.Limit > maxBannedListLimit {
+		h.fail(ctx, domain.AuditActionListBanned, 0, detail, Result{
+			Code: 4,
+			Msg:  "分页参数不对",
+		})
+		return
+	}
+	before := time.Now()
+	if req.Before > 0 {
+		before = time.UnixMilli(req.Before)
+	}
+	users, err := h.adminSvc.ListBanned(ctx, before, req.Limit)
+	if err != nil {
+		h.fail(ctx, domain.AuditActionListBanned, 0, detail, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		h.l.Error("查询被封禁的用户失败", logger.Error(err))
+		return
+	}
+	h.audit(ctx, domain.AuditActionListBanned, 0, detail, domain.AuditResultSuccess)
+	res := make([]AdminUserVO, 0, len(users))
+	for _, u := range users {
+		res = append(res, newAdminUserVO(u))
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Data: res,
+	})
+}
+
+// Ban 封禁之后马上踢下线，之后也不能再登录
+func (h *AdminHandler) Ban(ctx *gin.Context) {
+	type Req struct {
+		Uid    int64  `json:"uid"`
+		Reason string `json:"reason"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		h.fail(ctx, domain.AuditActionBanUser, req.Uid, req.Reason, Result{
+			Code: 4,
+			Msg:  "请填写封禁原因",
+		})
+		return
+	}
+	if !h.checkTarget(ctx, domain.AuditActionBanUser, req.Uid, req.Reason) {
+		return
+	}
+	err := h.adminSvc.Ban(ctx, req.Uid, req.Reason)
+	if !h.handleUserErr(ctx, domain.AuditActionBanUser, req.Uid, req.Reason, err, "封禁用户失败") {
+		return
+	}
+	h.audit(ctx, domain.AuditActionBanUser, req.Uid, req.Reason, domain.AuditResultSuccess)
+	if err = h.jwtHdl.ClearUserSessions(ctx, req.Uid); err != nil {
+		// 登录校验的时候还会检查有没有被封禁
+		h.l.Error("清除被封禁用户的会话失败", logger.Error(err), logger.Int64("uid", req.Uid))
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Msg: "封禁成功",
+	})
+}
+
+func (h *AdminHandler) Unban(ctx *gin.Context) {
+	type Req struct {
+		Uid int64 `json:"uid"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	err := h.adminSvc.Unban(ctx, req.Uid)
+	if !h.handleUserErr(ctx, domain.AuditActionUnbanUser, req.Uid, "", err, "解封用户失败") {
+		return
+	}
+	h.audit(ctx, domain.AuditActionUnbanUser, req.Uid, "", domain.AuditResultSuccess)
+	ctx.JSON(http.StatusOK, Result{
+		Msg: "解封成功",
+	})
+}
+
+// Logout 把用户所有的设备都踢下线，用户还可以重新登录
+func (h *AdminHandler) Logout(ctx *gin.Context) {
+	type Req struct {
+		Uid int64 `json:"uid"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	if !h.checkTarget(ctx, domain.AuditActionLogoutUser, req.Uid, "") {
+		return
+	}
+	err := h.jwtHdl.ClearUserSessions(ctx, req.Uid)
+	if err != nil {
+		h.fail(ctx, domain.AuditActionLogoutUser, req.Uid, "", Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		h.l.Error("踢用户下线失败", logger.Error(err), logger.Int64("uid", req.Uid))
+		return
+	}
+	h.audit(ctx, domain.AuditActionLogoutUser, req.Uid, "", domain.AuditResultSuccess)
+	ctx.JSON(http.StatusOK, Result{
+		Msg: "已下线",
+	})
+}
+
+func (h *AdminHandler) LoginHistory(ctx *gin.Context) {
+	type Req struct {
+		Uid    int64 `json:"uid"`
+		Offset int   `json:"offset"`
+		Limit  int   `json:"limit"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	detail := fmt.Sprintf("offset=%d limit=%d", req.Offset, req.Limit)
+	if req.Offset < 0 || req.Limit <= 0 || req.Limit > maxLoginHistoryLimit {
+		h.fail(ctx, domain.AuditActionLoginHistory, req.Uid, detail, Result{
+			Code: 4,
+			Msg:  "分页参数不对",
+		})
+		return
+	}
+	logs, err := h.adminSvc.LoginHistory(ctx, req.Uid, req.Offset, req.Limit)
+	if err != nil {
+		h.fail(ctx, domain.AuditActionLoginHistory, req.Uid, detail, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		h.l.Error("查询登录记录失败", logger.Error(err), logger.Int64("uid", req.Uid))
+		return
+	}
+	h.audit(ctx, domain.AuditActionLoginHistory, req.Uid, detail, domain.AuditResultSuccess)
+	res := make([]LoginLogVO, 0, len(logs))
+	for _, l := range logs {
+		res = append(res, LoginLogVO{
+			Method:    l.Method,
+			IP:        l.IP,
+			UserAgent: l.UserAgent,
+			Ctime:     l.Ctime.UnixMilli(),
+		})
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Data: res,
+	})
+}
+
+// checkTarget 管理员不能封禁、踢掉自己，不然就没人能解封了
+func (h *AdminHandler) checkTarget(ctx *gin.Context, action domain.AuditAction, uid int64, detail string) bool {
+	if uid == h.operator(ctx) {
+		h.fail(ctx, action, uid, detail, Result{
+			Code: 4,
+			Msg:  "不能操作自己的账号",
+		})
+		return false
+	}
+	return true
+}
+
+// handleUserErr 处理修改用户的错误，返回 true 代表成功了
+func (h *AdminHandler) handleUserErr(ctx *gin.Context, action domain.AuditAction, uid int64, detail string,
+	err error, msg string) bool {
+	switch err {
+	case nil:
+		return true
+	case service.ErrUserNotFound:
+		h.fail(ctx, action, uid, detail, Result{
+			Code: 4,
+			Msg:  "用户不存在",
+		})
+	default:
+		h.fail(ctx, action, uid, detail, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		h.l.Error(msg, logger.Error(err), logger.Int64("uid", uid))
+	}
+	return false
+}
+
+func (h *AdminHandler) operator(ctx *gin.Context) int64 {
+	// RBAC 中间件已经校验过 claims 了
+	claims, _ := ctx.MustGet("claims").(*ijwt.UserClaims)
+	if claims == nil {
+		return 0
+	}
+	return claims.Id
+}
+
+// fail 操作失败了，或者被拒绝了，也要记审计日志，不然看不到谁尝试过
+// 结果记的是返回给管理员的提示，具体的错误在日志里面
+func (h *AdminHandler) fail(ctx *gin.Context, action domain.AuditAction, target int64, detail string, res Result) {
+	ctx.JSON(http.StatusOK, res)
+	h.audit(ctx, action, target, detail, res.Msg)
+}
+
+// audit 记审计日志失败只打日志，不影响操作本身
+func (h *AdminHandler) audit(ctx *gin.Context, action domain.AuditAction, target int64, detail, result string) {
+	operator := h.operator(ctx)
+	err := h.adminSvc.Audit(ctx, domain.AuditLog{
+		Operator:  operator,
+		Action:    action,
+		TargetUid: target,
+		Detail:    detail,
+		Result:    result,
+		IP:        ctx.ClientIP(),
+	})
+	if err != nil {
+		h.l.Error("记录审计日志失败", logger.Error(err),
+			logger.Int64("operator", operator),
+			logger.String("action", string(action)),
+			logger.Int64("target", target))
+	}
+}
+
+// AdminUserVO 管理后台看到的用户，邮箱和手机号脱敏
+type AdminUserVO struct {
+	Id        int64    `json:"id"`
+	Email     string   `json:"email"`
+	Phone     string   `json:"phone"`
+	Nickname  string   `json:"nickname"`
+	Status    uint8    `json:"status"`
+	Roles     []string `json:"roles"`
+	Banned    bool     `json:"banned"`
+	BannedAt  int64    `json:"bannedAt,omitempty"`
+	BanReason string   `json:"banReason,omitempty"`
+	Ctime     int64    `json:"ctime"`
+}
+
+func newAdminUserVO(u domain.User) AdminUserVO {
+	vo := AdminUserVO{
+		Id:        u.Id,
+		Email:     maskEmail(u.Email),
+		Phone:     maskPhone(u.Phone),
+		Nickname:  u.Nickname,
+		Status:    uint8(u.Status),
+		Roles:     u.RoleNames(),
+		Banned:    u.Banned(),
+		BanReason: u.BanReason,
+		Ctime:     u.Ctime.UnixMilli(),
+	}
+	if u.Banned() {
+		vo.BannedAt = u.BannedAt.UnixMilli()
+	}
+	return vo
+}
+
+type LoginLogVO struct {
+	Method    string `json:"method"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"userAgent"`
+	Ctime     int64  `json:"ctime"`
+}
+
+// maskPhone 152****5678，太短的全部打码
+func maskPhone(phone string) string {
+	if phone == "" {
+		return ""
+	}
+	if len(phone) < 7 {
+		return strings.Repeat("*", len(phone))
+	}
+	return phone[:3] + strings.Repeat("*", len(phone)-7) + phone[len(phone)-4:]
+}
+
+// maskEmail a***@qq.com，只留第一个字符和域名
+func maskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return maskPhone(email)
+	}
+	_, size := utf8.DecodeRuneInString(email)
+	return email[:size] + "***" + email[at:]
+}
@@ -0,0 +1,202 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/service"
+	svcmocks "webook_go/webook/internal/service/mocks"
+	ijwt "webook_go/webook/internal/web/jwt"
+	jwtmocks "webook_go/webook/internal/web/jwt/mocks"
+	"webook_go/webook/pkg/logger"
+)
+
+func TestAdminHandler_Ban(t *testing.T) {
+	testCases := []struct {
+		name    string
+		mock    func(ctrl *gomock.Controller) (service.AdminService, ijwt.Handler)
+		reqBody string
+
+		wantRes Result
+	}{
+		{
+			name: "封禁成功，踢下线",
+			mock: func(ctrl *gomock.Controller) (service.AdminService, ijwt.Handler) {
+				adminSvc := svcmocks.NewMockAdminService(ctrl)
+				adminSvc.EXPECT().Ban(gomock.Any(), int64(456), "发广告").Return(nil)
+				expectAudit(adminSvc, domain.AuditActionBanUser, 456, "发广告", domain.AuditResultSuccess)
+				jwtHdl := jwtmocks.NewMockHandler(ctrl)
+				jwtHdl.EXPECT().ClearUserSessions(gomock.Any(), int64(456)).Return(nil)
+				return adminSvc, jwtHdl
+			},
+			reqBody: `{"uid":456,"reason":"发广告"}`,
+			wantRes: Result{Msg: "封禁成功"},
+		},
+		{
+			name: "没有填原因",
+			mock: func(ctrl *gomock.Controller) (service.AdminService, ijwt.Handler) {
+				adminSvc := svcmocks.NewMockAdminService(ctrl)
+				expectAudit(adminSvc, domain.AuditActionBanUser, 456, " ", "请填写封禁原因")
+				return adminSvc, jwtmocks.NewMockHandler(ctrl)
+			},
+			reqBody: `{"uid":456,"reason":" "}`,
+			wantRes: Result{Code: 4, Msg: "请填写封禁原因"},
+		},
+		{
+			name: "不能封禁自己",
+			mock: func(ctrl *gomock.Controller) (service.AdminService, ijwt.Handler) {
+				adminSvc := svcmocks.NewMockAdminService(ctrl)
+				expectAudit(adminSvc, domain.AuditActionBanUser, 123, "发广告", "不能操作自己的账号")
+				return adminSvc, jwtmocks.NewMockHandler(ctrl)
+			},
+			reqBody: `{"uid":123,"reason":"发广告"}`,
+			wantRes: Result{Code: 4, Msg: "不能操作自己的账号"},
+		},
+		{
+			name: "用户不存在",
+			mock: func(ctrl *gomock.Controller) (service.AdminService, ijwt.Handler) {
+				adminSvc := svcmocks.NewMockAdminService(ctrl)
+				adminSvc.EXPECT().Ban(gomock.Any(), int64(456), "发广告").Return(service.ErrUserNotFound)
+				expectAudit(adminSvc, domain.AuditActionBanUser, 456, "发广告", "用户不存在")
+				return adminSvc, jwtmocks.NewMockHandler(ctrl)
+			},
+			reqBody: `{"uid":456,"reason":"发广告"}`,
+			wantRes: Result{Code: 4, Msg: "用户不存在"},
+		},
+		{
+			name: "封禁失败",
+			mock: func(ctrl *gomock.Controller) (service.AdminService, ijwt.Handler) {
+				adminSvc := svcmocks.NewMockAdminService(ctrl)
+				adminSvc.EXPECT().Ban(gomock.Any(), int64(456), "发广告").Return(errors.New("数据库错误"))
+				expectAudit(adminSvc, domain.AuditActionBanUser, 456, "发广告", "系统错误")
+				return adminSvc, jwtmocks.NewMockHandler(ctrl)
+			},
+			reqBody: `{"uid":456,"reason":"发广告"}`,
+			wantRes: Result{Code: 5, Msg: "系统错误"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			adminSvc, jwtHdl := tc.mock(ctrl)
+			h := NewAdminHandler(nil, adminSvc, jwtHdl, &logger.NopLogger{})
+
+			res := doAdminRequest(t, h, "/admin/users/ban", tc.reqBody)
+			assert.Equal(t, tc.wantRes, res)
+		})
+	}
+}
+
+func TestAdminHandler_Logout(t *testing.T) {
+	testCases := []struct {
+		name    string
+		mock    func(ctrl *gomock.Controller) (service.AdminService, ijwt.Handler)
+		reqBody string
+
+		wantRes Result
+	}{
+		{
+			name: "踢下线",
+			mock: func(ctrl *gomock.Controller) (service.AdminService, ijwt.Handler) {
+				adminSvc := svcmocks.NewMockAdminService(ctrl)
+				expectAudit(adminSvc, domain.AuditActionLogoutUser, 456, "", domain.AuditResultSuccess)
+				jwtHdl := jwtmocks.NewMockHandler(ctrl)
+				jwtHdl.EXPECT().ClearUserSessions(gomock.Any(), int64(456)).Return(nil)
+				return adminSvc, jwtHdl
+			},
+			reqBody: `{"uid":456}`,
+			wantRes: Result{Msg: "已下线"},
+		},
+		{
+			name: "不能踢自己",
+			mock: func(ctrl *gomock.Controller) (service.AdminService, ijwt.Handler) {
+				adminSvc := svcmocks.NewMockAdminService(ctrl)
+				expectAudit(adminSvc, domain.AuditActionLogoutUser, 123, "", "不能操作自己的账号")
+				return adminSvc, jwtmocks.NewMockHandler(ctrl)
+			},
+			reqBody: `{"uid":123}`,
+			wantRes: Result{Code: 4, Msg: "不能操作自己的账号"},
+		},
+		{
+			name: "下线失败",
+			mock: func(ctrl *gomock.Controller) (service.AdminService, ijwt.Handler) {
+				adminSvc := svcmocks.NewMockAdminService(ctrl)
+				expectAudit(adminSvc, domain.AuditActionLogoutUser, 456, "", "系统错误")
+				jwtHdl := jwtmocks.NewMockHandler(ctrl)
+				jwtHdl.EXPECT().ClearUserSessions(gomock.Any(), int64(456)).Return(errors.New("redis 错误"))
+				return adminSvc, jwtHdl
+			},
+			reqBody: `{"uid":456}`,
+			wantRes: Result{Code: 5, Msg: "系统错误"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			adminSvc, jwtHdl := tc.mock(ctrl)
+			h := NewAdminHandler(nil, adminSvc, jwtHdl, &logger.NopLogger{})
+
+			res := doAdminRequest(t, h, "/admin/users/logout", tc.reqBody)
+			assert.Equal(t, tc.wantRes, res)
+		})
+	}
+}
+
+func TestAdminHandler_SearchUsers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	adminSvc := svcmocks.NewMockAdminService(ctrl)
+	adminSvc.EXPECT().SearchUsers(gomock.Any(), domain.UserQuery{Phone: "15212345678"}).
+		Return([]domain.User{{Id: 456, Phone: "15212345678"}}, nil)
+	// 按照手机号搜的，审计日志里面记的是搜到的用户
+	expectAudit(adminSvc, domain.AuditActionSearchUser, 456, "email= phone=152****5678", domain.AuditResultSuccess)
+	h := NewAdminHandler(nil, adminSvc, jwtmocks.NewMockHandler(ctrl), &logger.NopLogger{})
+
+	res := doAdminRequest(t, h, "/admin/users/search", `{"phone":"15212345678"}`)
+	assert.Equal(t, 0, res.Code)
+}
+
+func expectAudit(adminSvc *svcmocks.MockAdminService, action domain.AuditAction,
+	target int64, detail, result string) {
+	adminSvc.EXPECT().Audit(gomock.Any(), domain.AuditLog{
+		Operator:  123,
+		Action:    action,
+		TargetUid: target,
+		Detail:    detail,
+		Result:    result,
+		IP:        "192.0.2.1",
+	}).Return(nil)
+}
+
+// doAdminRequest 以管理员 123 的身份调用接口
+func doAdminRequest(t *testing.T, h *AdminHandler, path, body string) Result {
+	server := gin.New()
+	server.Use(func(ctx *gin.Context) {
+		ctx.Set("claims", &ijwt.UserClaims{
+			Id:    123,
+			Roles: []string{string(domain.RoleAdmin)},
+		})
+	})
+	h.RegisterRoutes(server)
+	req, err := http.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = "192.0.2.1:1234"
+	resp := httptest.NewRecorder()
+	server.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var res Result
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	return res
+}
@@ -78,16 +78,17 @@ func TestArticleHandler_Publish(t *testing.T) {
 			},
 		},
 	}
-	server := gin.Default()
-	server.Use(func(ctx *gin.Context) {
-		ctx.Set("claims", &ijwt.UserClaims{
-			Id: 123,
-		})
-	})
 	for _, tc := range testCase {
 		t.Run(tc.name, func(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			defer ctrl.Finish()
+			// 每个用例一个 server，不然路由会重复注册
+			server := gin.Default()
+			server.Use(func(ctx *gin.Context) {
+				ctx.Set("claims", &ijwt.UserClaims{
+					Id: 123,
+				})
+			})
 			// 用不上 codeSvc
 			h := NewArticleHandler(tc.mock(ctrl), &logger.NopLogger{})
 			h.RegisterRoutes(server)
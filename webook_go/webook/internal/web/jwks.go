@@ -0,0 +1,31 @@
+package web
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	ijwt "webook_go/webook/internal/web/jwt"
+)
+
+var _ handler = (*JWKSHandler)(nil)
+
+// JWKSHandler 公开 access_token 的公钥，其他内部服务可以自己校验 webook 的 token
+type JWKSHandler struct {
+	jwtHdl ijwt.Handler
+}
+
+func NewJWKSHandler(jwtHdl ijwt.Handler) *JWKSHandler {
+	return &JWKSHandler{
+		jwtHdl: jwtHdl,
+	}
+}
+
+func (h *JWKSHandler) RegisterRoutes(server *gin.Engine) {
+	server.GET("/.well-known/jwks.json", h.JWKS)
+}
+
+// JWKS 用的是 HS512 的话，这里是空的，因为对称密钥不能公开
+func (h *JWKSHandler) JWKS(ctx *gin.Context) {
+	// 公钥变化不频繁，允许缓存一会
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, h.jwtHdl.JWKS())
+}
@@ -0,0 +1,57 @@
+package jwt
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"github.com/google/uuid"
+	"time"
+)
+
+var ErrChallengeInvalid = errors.New("两步验证已经过期，请重新登录")
+
+//go:embed lua/check_challenge.lua
+var luaCheckChallenge string
+
+const (
+	// challengeExpiration 密码校验通过之后，要在这个时间内输入两步验证的验证码
+	challengeExpiration = time.Minute * 5
+	// challengeMaxAttempts 一个挑战最多输错几次，超过了要重新输密码
+	challengeMaxAttempts = 5
+)
+
+// CreateChallenge 密码校验通过，但是开启了两步验证，先发一个挑战，这个时候还没有登录
+func (h *RedisJWTHandler) CreateChallenge(ctx context.Context, uid int64) (string, error) {
+	token := uuid.New().String()
+	key := h.challengeKey(token)
+	pipe := h.cmd.TxPipeline()
+	pipe.HSet(ctx, key, "uid", uid, "attempts", 0)
+	pipe.Expire(ctx, key, challengeExpiration)
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// CheckChallenge 返回挑战对应的用户，每调用一次都算是一次尝试
+func (h *RedisJWTHandler) CheckChallenge(ctx context.Context, token string) (int64, error) {
+	uid, err := h.cmd.Eval(ctx, luaCheckChallenge, []string{h.challengeKey(token)},
+		challengeMaxAttempts).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if uid <= 0 {
+		return 0, ErrChallengeInvalid
+	}
+	return uid, nil
+}
+
+// DeleteChallenge 两步验证通过之后，挑战就不能再用了
+func (h *RedisJWTHandler) DeleteChallenge(ctx context.Context, token string) error {
+	return h.cmd.Del(ctx, h.challengeKey(token)).Err()
+}
+
+func (h *RedisJWTHandler) challengeKey(token string) string {
+	return "users:2fa:challenge:" + token
+}
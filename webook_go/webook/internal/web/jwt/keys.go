@@ -0,0 +1,215 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+)
+
+var ErrUnknownKid = errors.New("未知的 kid")
+
+// KeyConfig 一把签名的密钥
+type KeyConfig struct {
+	// Kid 放在 token 的 header 里面，校验的时候用来找密钥
+	Kid string
+	// Alg 签名算法，支持 HS512、RS256 和 EdDSA
+	Alg string
+	// Secret HS512 的密钥
+	Secret string
+	// PrivateKey RS256 和 EdDSA 的私钥，PEM 格式
+	PrivateKey string
+}
+
+// KeySetConfig 同一种 token 可以同时有多把密钥
+// 签发的时候只用 Active，校验的时候所有的都可以用
+// 轮换密钥的时候先加上新的密钥，再把 Active 切过去，等旧的 token 都过期了再删掉旧的密钥
+type KeySetConfig struct {
+	Active string
+	Keys   []KeyConfig
+}
+
+type Config struct {
+	AccessToken  KeySetConfig
+	RefreshToken KeySetConfig
+}
+
+// Keys access_token 和 refresh_token 分开用不同的密钥
+type Keys struct {
+	Access  *KeySet
+	Refresh *KeySet
+}
+
+func NewKeys(cfg Config) (Keys, error) {
+	access, err := NewKeySet(cfg.AccessToken)
+	if err != nil {
+		return Keys{}, fmt.Errorf("access_token 的密钥有误 %w", err)
+	}
+	refresh, err := NewKeySet(cfg.RefreshToken)
+	if err != nil {
+		return Keys{}, fmt.Errorf("refresh_token 的密钥有误 %w", err)
+	}
+	return Keys{Access: access, Refresh: refresh}, nil
+}
+
+type signingKey struct {
+	kid    string
+	method jwt.SigningMethod
+	// 签名用的，HS512 是 []byte，RS256 是 *rsa.PrivateKey，EdDSA 是 ed25519.PrivateKey
+	signKey any
+	// 校验用的，非对称的算法是公钥
+	verifyKey any
+}
+
+type KeySet struct {
+	active *signingKey
+	keys   map[string]*signingKey
+	// order 保持配置里面的顺序，生成 JWKS 的时候用
+	order []string
+}
+
+func NewKeySet(cfg KeySetConfig) (*KeySet, error) {
+	ks := &KeySet{
+		keys: make(map[string]*signingKey, len(cfg.Keys)),
+	}
+	for _, kc := range cfg.Keys {
+		if _, ok := ks.keys[kc.Kid]; ok {
+			return nil, fmt.Errorf("kid %s 重复了", kc.Kid)
+		}
+		key, err := newSigningKey(kc)
+		if err != nil {
+			return nil, fmt.Errorf("kid %s: %w", kc.Kid, err)
+		}
+		ks.keys[kc.Kid] = key
+		ks.order = append(ks.order, kc.Kid)
+	}
+	active, ok := ks.keys[cfg.Active]
+	if !ok {
+		return nil, fmt.Errorf("没有找到 active 的密钥 %s", cfg.Active)
+	}
+	ks.active = active
+	return ks, nil
+}
+
+func newSigningKey(cfg KeyConfig) (*signingKey, error) {
+	switch cfg.Alg {
+	case "", jwt.SigningMethodHS512.Alg():
+		if cfg.Secret == "" {
+			return nil, errors.New("没有配置 secret")
+		}
+		return &signingKey{
+			kid:       cfg.Kid,
+			method:    jwt.SigningMethodHS512,
+			signKey:   []byte(cfg.Secret),
+			verifyKey: []byte(cfg.Secret),
+		}, nil
+	case jwt.SigningMethodRS256.Alg():
+		priv, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(cfg.PrivateKey))
+		if err != nil {
+			return nil, err
+		}
+		return &signingKey{
+			kid:       cfg.Kid,
+			method:    jwt.SigningMethodRS256,
+			signKey:   priv,
+			verifyKey: &priv.PublicKey,
+		}, nil
+	case jwt.SigningMethodEdDSA.Alg():
+		priv, err := jwt.ParseEdPrivateKeyFromPEM([]byte(cfg.PrivateKey))
+		if err != nil {
+			return nil, err
+		}
+		edPriv, ok := priv.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("只支持 Ed25519 的私钥")
+		}
+		return &signingKey{
+			kid:       cfg.Kid,
+			method:    jwt.SigningMethodEdDSA,
+			signKey:   edPriv,
+			verifyKey: edPriv.Public(),
+		}, nil
+	default:
+		return nil, fmt.Errorf("不支持的签名算法 %s", cfg.Alg)
+	}
+}
+
+// Sign 用 Active 的密钥签名，并且在 header 里面带上 kid
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.method, claims)
+	token.Header["kid"] = ks.active.kid
+	return token.SignedString(ks.active.signKey)
+}
+
+// Parse 根据 header 里面的 kid 找到密钥来校验
+func (ks *KeySet) Parse(tokenStr string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenStr, claims, ks.keyfunc)
+}
+
+func (ks *KeySet) keyfunc(token *jwt.Token) (interface{}, error) {
+	key := ks.active
+	// 没有 kid 的是引入 kid 之前签发的 token，用 Active 的密钥校验
+	if kid, ok := token.Header["kid"]; ok {
+		kidStr, _ := kid.(string)
+		key, ok = ks.keys[kidStr]
+		if !ok {
+			return nil, ErrUnknownKid
+		}
+	}
+	// 算法一定要和密钥匹配，防止拿公钥当成 HMAC 的密钥来伪造 token
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("签名算法 %s 和密钥不匹配", token.Method.Alg())
+	}
+	return key.verifyKey, nil
+}
+
+// JWK 只包含公钥，HMAC 的密钥是不能公开的
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA 的公钥
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 的公钥
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS 所有非对称密钥的公钥，其他服务可以拿来校验 token
+func (ks *KeySet) JWKS() JWKSet {
+	res := JWKSet{Keys: make([]JWK, 0, len(ks.order))}
+	enc := base64.RawURLEncoding
+	for _, kid := range ks.order {
+		key := ks.keys[kid]
+		switch pub := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			res.Keys = append(res.Keys, JWK{
+				Kty: "RSA",
+				Kid: kid,
+				Alg: key.method.Alg(),
+				Use: "sig",
+				N:   enc.EncodeToString(pub.N.Bytes()),
+				E:   enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			res.Keys = append(res.Keys, JWK{
+				Kty: "OKP",
+				Kid: kid,
+				Alg: key.method.Alg(),
+				Use: "sig",
+				Crv: "Ed25519",
+				X:   enc.EncodeToString(pub),
+			})
+		}
+	}
+	return res
+}
@@ -0,0 +1,223 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func newTestKeys(t *testing.T) Keys {
+	keys, err := NewKeys(Config{
+		AccessToken: KeySetConfig{
+			Active: "at-v1",
+			Keys:   []KeyConfig{{Kid: "at-v1", Secret: "access-secret"}},
+		},
+		RefreshToken: KeySetConfig{
+			Active: "rt-v1",
+			Keys:   []KeyConfig{{Kid: "rt-v1", Secret: "refresh-secret"}},
+		},
+	})
+	require.NoError(t, err)
+	return keys
+}
+
+func rsaPEM(t *testing.T) (string, *rsa.PrivateKey) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), priv
+}
+
+func ed25519PEM(t *testing.T) (string, ed25519.PrivateKey) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), priv
+}
+
+func testClaims() *UserClaims {
+	return &UserClaims{
+		Id:   123,
+		Ssid: "ssid",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}
+}
+
+func TestKeySet_SignAndParse(t *testing.T) {
+	rsaKey, _ := rsaPEM(t)
+	edKey, _ := ed25519PEM(t)
+	testCases := []struct {
+		name string
+		cfg  KeySetConfig
+	}{
+		{
+			name: "HS512",
+			cfg: KeySetConfig{Active: "v1",
+				Keys: []KeyConfig{{Kid: "v1", Alg: "HS512", Secret: "secret"}}},
+		},
+		{
+			name: "RS256",
+			cfg: KeySetConfig{Active: "v1",
+				Keys: []KeyConfig{{Kid: "v1", Alg: "RS256", PrivateKey: rsaKey}}},
+		},
+		{
+			name: "EdDSA",
+			cfg: KeySetConfig{Active: "v1",
+				Keys: []KeyConfig{{Kid: "v1", Alg: "EdDSA", PrivateKey: edKey}}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ks, err := NewKeySet(tc.cfg)
+			require.NoError(t, err)
+			tokenStr, err := ks.Sign(testClaims())
+			require.NoError(t, err)
+
+			var claims UserClaims
+			token, err := ks.Parse(tokenStr, &claims)
+			require.NoError(t, err)
+			assert.True(t, token.Valid)
+			assert.Equal(t, "v1", token.Header["kid"])
+			assert.Equal(t, tc.name, token.Method.Alg())
+			assert.Equal(t, int64(123), claims.Id)
+		})
+	}
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	edKey, _ := ed25519PEM(t)
+	oldKs, err := NewKeySet(KeySetConfig{Active: "v1",
+		Keys: []KeyConfig{{Kid: "v1", Secret: "old-secret"}}})
+	require.NoError(t, err)
+	oldToken, err := oldKs.Sign(testClaims())
+	require.NoError(t, err)
+	// 引入 kid 之前签发的 token
+	legacyToken, err := jwt.NewWithClaims(jwt.SigningMethodHS512, testClaims()).
+		SignedString([]byte("old-secret"))
+	require.NoError(t, err)
+
+	// 加上了新的密钥，并且切换过去了，旧的 token 还能用
+	newKs, err := NewKeySet(KeySetConfig{Active: "v2",
+		Keys: []KeyConfig{
+			{Kid: "v1", Secret: "old-secret"},
+			{Kid: "v2", Alg: "EdDSA", PrivateKey: edKey},
+		}})
+	require.NoError(t, err)
+	_, err = newKs.Parse(oldToken, &UserClaims{})
+	assert.NoError(t, err)
+	newToken, err := newKs.Sign(testClaims())
+	require.NoError(t, err)
+	token, err := newKs.Parse(newToken, &UserClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, "v2", token.Header["kid"])
+	// 没有 kid 的用 Active 的密钥校验，已经切到 v2 了，所以校验不过
+	_, err = newKs.Parse(legacyToken, &UserClaims{})
+	assert.Error(t, err)
+	_, err = oldKs.Parse(legacyToken, &UserClaims{})
+	assert.NoError(t, err)
+
+	// 旧的密钥删掉之后，旧的 token 就不能用了
+	finalKs, err := NewKeySet(KeySetConfig{Active: "v2",
+		Keys: []KeyConfig{{Kid: "v2", Alg: "EdDSA", PrivateKey: edKey}}})
+	require.NoError(t, err)
+	_, err = finalKs.Parse(oldToken, &UserClaims{})
+	assert.ErrorIs(t, err, ErrUnknownKid)
+	_, err = finalKs.Parse(newToken, &UserClaims{})
+	assert.NoError(t, err)
+}
+
+func TestKeySet_AlgorithmMismatch(t *testing.T) {
+	rsaKey, priv := rsaPEM(t)
+	ks, err := NewKeySet(KeySetConfig{Active: "v1",
+		Keys: []KeyConfig{{Kid: "v1", Alg: "RS256", PrivateKey: rsaKey}}})
+	require.NoError(t, err)
+	// 拿公钥当成 HMAC 的密钥伪造 token
+	pubDER, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	require.NoError(t, err)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	forged.Header["kid"] = "v1"
+	forgedStr, err := forged.SignedString(pubDER)
+	require.NoError(t, err)
+	_, err = ks.Parse(forgedStr, &UserClaims{})
+	assert.Error(t, err)
+}
+
+func TestNewKeySet(t *testing.T) {
+	testCases := []struct {
+		name string
+		cfg  KeySetConfig
+	}{
+		{
+			name: "active 不存在",
+			cfg:  KeySetConfig{Active: "v2", Keys: []KeyConfig{{Kid: "v1", Secret: "secret"}}},
+		},
+		{
+			name: "kid 重复",
+			cfg: KeySetConfig{Active: "v1", Keys: []KeyConfig{
+				{Kid: "v1", Secret: "secret"}, {Kid: "v1", Secret: "secret2"}}},
+		},
+		{
+			name: "没有 secret",
+			cfg:  KeySetConfig{Active: "v1", Keys: []KeyConfig{{Kid: "v1"}}},
+		},
+		{
+			name: "私钥格式不对",
+			cfg:  KeySetConfig{Active: "v1", Keys: []KeyConfig{{Kid: "v1", Alg: "RS256", PrivateKey: "abc"}}},
+		},
+		{
+			name: "不支持的算法",
+			cfg:  KeySetConfig{Active: "v1", Keys: []KeyConfig{{Kid: "v1", Alg: "none"}}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewKeySet(tc.cfg)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestKeySet_JWKS(t *testing.T) {
+	rsaKey, rsaPriv := rsaPEM(t)
+	edKey, edPriv := ed25519PEM(t)
+	ks, err := NewKeySet(KeySetConfig{Active: "v3",
+		Keys: []KeyConfig{
+			{Kid: "v1", Secret: "secret"},
+			{Kid: "v2", Alg: "RS256", PrivateKey: rsaKey},
+			{Kid: "v3", Alg: "EdDSA", PrivateKey: edKey},
+		}})
+	require.NoError(t, err)
+	jwks := ks.JWKS()
+	// HMAC 的密钥不能出现在 JWKS 里面
+	require.Len(t, jwks.Keys, 2)
+
+	rsaJWK := jwks.Keys[0]
+	assert.Equal(t, "RSA", rsaJWK.Kty)
+	assert.Equal(t, "v2", rsaJWK.Kid)
+	assert.Equal(t, "RS256", rsaJWK.Alg)
+	n, err := base64.RawURLEncoding.DecodeString(rsaJWK.N)
+	require.NoError(t, err)
+	assert.Equal(t, 0, new(big.Int).SetBytes(n).Cmp(rsaPriv.N))
+	assert.Equal(t, "AQAB", rsaJWK.E)
+
+	edJWK := jwks.Keys[1]
+	assert.Equal(t, "OKP", edJWK.Kty)
+	assert.Equal(t, "Ed25519", edJWK.Crv)
+	assert.Equal(t, "EdDSA", edJWK.Alg)
+	x, err := base64.RawURLEncoding.DecodeString(edJWK.X)
+	require.NoError(t, err)
+	assert.Equal(t, []byte(edPriv.Public().(ed25519.PublicKey)), x)
+}
@@ -0,0 +1,17 @@
+-- 两步验证的登录挑战
+local key = KEYS[1]
+-- 最多可以尝试多少次
+local maxAttempts = tonumber(ARGV[1])
+
+local uid = redis.call("hget", key, "uid")
+if not uid then
+    -- 不存在或者已经过期了
+    return -1
+end
+local attempts = redis.call("hincrby", key, "attempts", 1)
+if attempts > maxAttempts then
+    -- 试太多次了，防止暴力破解 6 位的验证码
+    redis.call("del", key)
+    return -1
+end
+return tonumber(uid)
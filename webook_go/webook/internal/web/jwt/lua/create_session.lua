@@ -0,0 +1,35 @@
+-- 用户名下所有会话的有序集合，score 是创建时间（毫秒）
+local sessionsKey = KEYS[1]
+-- 这一次登录的会话详情
+local sessionKey = KEYS[2]
+local ssid = ARGV[1]
+-- 最多同时有多少个会话，0 代表不限制
+local maxSessions = tonumber(ARGV[2])
+-- 会话的有效期（秒）
+local expiration = tonumber(ARGV[3])
+local now = tonumber(ARGV[4])
+-- 会话详情 key 的前缀，拼上 ssid 就是会话详情的 key
+local prefix = ARGV[5]
+
+-- 先把已经过期的会话清理掉，不然会占着名额
+redis.call("zremrangebyscore", sessionsKey, "-inf", now - expiration * 1000)
+
+-- ARGV[6] 之后都是会话详情的 field 和 value
+redis.call("hset", sessionKey, unpack(ARGV, 6))
+redis.call("expire", sessionKey, expiration)
+redis.call("zadd", sessionsKey, now, ssid)
+redis.call("expire", sessionsKey, expiration)
+
+-- 超过了上限，把最早登录的踢下线
+if maxSessions > 0 then
+    local cnt = redis.call("zcard", sessionsKey)
+    if cnt > maxSessions then
+        local evicted = redis.call("zrange", sessionsKey, 0, cnt - maxSessions - 1)
+        for _, old in ipairs(evicted) do
+            redis.call("del", prefix .. old)
+        end
+        redis.call("zremrangebyrank", sessionsKey, 0, cnt - maxSessions - 1)
+        return #evicted
+    end
+end
+return 0
@@ -0,0 +1,27 @@
+-- 会话详情
+local sessionKey = KEYS[1]
+-- 用户名下所有的会话
+local sessionsKey = KEYS[2]
+local uid = ARGV[1]
+local ssid = ARGV[2]
+-- 请求里面带过来的 refresh_token 的 id
+local oldRtid = ARGV[3]
+-- 新签发的 refresh_token 的 id
+local newRtid = ARGV[4]
+local lastSeen = ARGV[5]
+
+local owner = redis.call("hget", sessionKey, "uid")
+if not owner or owner ~= uid then
+    -- 会话已经不在了
+    return 0
+end
+local rtid = redis.call("hget", sessionKey, "rtid")
+if rtid ~= oldRtid then
+    -- 用了一个已经用过的 refresh_token，说明 token 可能被盗了
+    -- 整个会话都作废，不管是攻击者还是用户手上的 token 都不能用了
+    redis.call("del", sessionKey)
+    redis.call("zrem", sessionsKey, ssid)
+    return -1
+end
+redis.call("hset", sessionKey, "rtid", newRtid, "last_seen", lastSeen)
+return 1
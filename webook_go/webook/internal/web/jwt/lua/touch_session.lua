@@ -0,0 +1,15 @@
+-- 会话详情
+local key = KEYS[1]
+local uid = ARGV[1]
+local lastSeen = ARGV[2]
+local ip = ARGV[3]
+
+local owner = redis.call("hget", key, "uid")
+-- 会话不存在，要么过期了，要么被踢下线了
+-- 或者 ssid 不是这个用户的
+if not owner or owner ~= uid then
+    return 0
+end
+-- 顺便更新最后活跃的时间和 IP
+redis.call("hset", key, "last_seen", lastSeen, "ip", ip)
+return 1
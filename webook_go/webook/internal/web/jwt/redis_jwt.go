@@ -1,7 +1,6 @@
 package jwt
 
 import (
-	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
@@ -10,52 +9,53 @@ import (
 	"time"
 )
 
-// AtKey 和 RtKey 是两个用于JWT加密的密钥，它们分别用于access_token和refresh_token
-var (
-	AtKey = []byte("NDIOaqI8vCUZfWoNVcol0CuqFwHbu4cn")
-	RtKey = []byte("NDIOaqI8vCUZfWoNVcol0CuqFwHbu4cc")
-)
-
 type RedisJWTHandler struct {
-	// access_token key
-	atKey []byte
-	// refresh_token key
-	rtKey []byte
+	// access_token 和 refresh_token 的密钥，从配置里面加载
+	keys Keys
 	// 用于与Redis交互的命令对象
 	cmd redis.Cmdable
+	cfg SessionConfig
 }
 
 // NewRedisJWTHandler 用于创建一个新的RedisJWTHandler实例
-func NewRedisJWTHandler(cmd redis.Cmdable) Handler {
+func NewRedisJWTHandler(cmd redis.Cmdable, cfg SessionConfig, keys Keys) Handler {
 	return &RedisJWTHandler{
-		cmd: cmd,
+		keys: keys,
+		cmd:  cmd,
+		cfg:  cfg,
 	}
 }
 
 // SetLoginToken 方法用于设置登录令牌。它首先生成一个唯一的ssid，然后使用这个ssid设置JWT Token，最后设置Refresh Token
-func (h *RedisJWTHandler) SetLoginToken(ctx *gin.Context, uid int64) error {
-	ssid := uuid.New().String()          // 生成一个唯一的ssid
-	err := h.SetJWTToken(ctx, uid, ssid) // 设置JWT Token
+func (h *RedisJWTHandler) SetLoginToken(ctx *gin.Context, uid int64, roles []string) error {
+	ssid := uuid.New().String()                 // 生成一个唯一的ssid
+	err := h.SetJWTToken(ctx, uid, ssid, roles) // 设置JWT Token
+	if err != nil {
+		return err
+	}
+	// 登录成功之后才有会话，超过同时在线的设备数会把最早的踢掉
+	rtid := uuid.New().String()
+	err = h.createSession(ctx, uid, ssid, rtid, roles)
 	if err != nil {
 		return err
 	}
-	err = h.SetRefreshToken(ctx, uid, ssid)
+	err = h.SetRefreshToken(ctx, uid, ssid, rtid)
 	return err
 }
 
 // SetRefreshToken 方法用于设置Refresh Token。它首先生成一个带有uid和ssid的Refresh Claims
 // 然后使用这些Claims生成一个新的JWT Token，最后将这个Token放入请求的Header中
-func (h *RedisJWTHandler) SetRefreshToken(ctx *gin.Context, uid int64, ssid string) error {
+func (h *RedisJWTHandler) SetRefreshToken(ctx *gin.Context, uid int64, ssid string, rtid string) error {
 	claims := RefreshClaims{
 		Ssid: ssid,
+		Rtid: rtid,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24 * 7)), // 过期时间：获取当前时间再加上1分钟
 		},
 		Uid: uid,
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims) // 使用HS512签名方法创建一个新的JWT Token
-	tokenStr, err := token.SignedString(RtKey)                 // token 加密
+	tokenStr, err := h.keys.Refresh.Sign(claims) // 用当前的密钥签名，header 里面会带上 kid
 	if err != nil {
 		return err
 	}
@@ -71,14 +71,20 @@ func (h *RedisJWTHandler) ClearToken(ctx *gin.Context) error {
 	ctx.Header("x-refresh-token", "")             // 清除Refresh Token
 	claims := ctx.MustGet("claims").(*UserClaims) // 从上下文中获取用户声明
 	// 删除Redis中的会话数据
-	return h.cmd.Set(ctx, fmt.Sprintf("users:ssid:%s", claims.Ssid), "", time.Hour*24*7).Err()
+	return h.deleteSessions(ctx, claims.Id, claims.Ssid)
+}
+
+func (h *RedisJWTHandler) ParseAccessToken(tokenStr string, claims *UserClaims) (*jwt.Token, error) {
+	return h.keys.Access.Parse(tokenStr, claims)
+}
+
+func (h *RedisJWTHandler) ParseRefreshToken(tokenStr string, claims *RefreshClaims) (*jwt.Token, error) {
+	return h.keys.Refresh.Parse(tokenStr, claims)
 }
 
-// 检查用户会话的方法。
-// 通过给定的会话ID检查Redis中是否存在该会话数据
-func (h *RedisJWTHandler) CheckSession(ctx *gin.Context, ssid string) error {
-	_, err := h.cmd.Exists(ctx, fmt.Sprintf("users:ssid:%s", ssid)).Result() // 检查Redis中是否存在该会话数据
-	return err                                                               // 返回错误（如果有）或nil（如果存在会话）
+// JWKS 只公开 access_token 的公钥，refresh_token 只有我们自己会校验
+func (h *RedisJWTHandler) JWKS() JWKSet {
+	return h.keys.Access.JWKS()
 }
 
 // 从上下文的Header中提取JWT Token。
@@ -96,7 +102,7 @@ func (h *RedisJWTHandler) ExtractToken(ctx *gin.Context) string {
 // 设置用户JWT Token的方法
 // 生成一个新的JWT，并使用给定的密钥对其进行签名
 // 将签名的JWT放入上下文的Header中
-func (h RedisJWTHandler) SetJWTToken(ctx *gin.Context, uid int64, ssid string) error {
+func (h RedisJWTHandler) SetJWTToken(ctx *gin.Context, uid int64, ssid string, roles []string) error {
 	claims := UserClaims{ // 创建用户声明，包括标准的和自定义的声明
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute * 30)), // 过期时间：获取当前时间再加上30分钟
@@ -104,10 +110,10 @@ func (h RedisJWTHandler) SetJWTToken(ctx *gin.Context, uid int64, ssid string) e
 		Id:        uid,                     // 用户ID作为自定义声明的一部分，可以在JWT验证时使用此ID进行验证或授权决策
 		Ssid:      ssid,                    // 会话ID作为自定义声明的一部分，用于识别特定会话
 		UserAgent: ctx.Request.UserAgent(), // 拿到浏览器的 UserAgent, 也可以记录前端当时登录的设备信息，浏览信息等，然后打包传进来，这样可以保护 JWT 被盗用
+		Roles:     roles,                   // 用户的角色，权限校验的中间件会用到
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims) // 使用HS512签名方法创建一个新的JWT，并使用给定的声明和密钥
-	tokenStr, err := token.SignedString(AtKey)                 // token 加密
+	tokenStr, err := h.keys.Access.Sign(claims) // 用当前的密钥签名，header 里面会带上 kid
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,215 @@
+package jwt
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrSessionInvalid = errors.New("登录态已经失效")
+var ErrSessionNotFound = errors.New("会话不存在")
+var ErrRefreshTokenReused = errors.New("refresh_token 被重复使用")
+
+//go:embed lua/create_session.lua
+var luaCreateSession string
+
+//go:embed lua/touch_session.lua
+var luaTouchSession string
+
+//go:embed lua/rotate_refresh.lua
+var luaRotateRefresh string
+
+// sessionExpiration 和 refresh_token 的有效期保持一致
+const sessionExpiration = time.Hour * 24 * 7
+
+// 会话详情是一个 hash，key 是 users:session:$ssid
+// 用户名下所有的会话是一个 zset，key 是 users:sessions:$uid，score 是登录的时间
+const sessionKeyPrefix = "users:session:"
+
+func (h *RedisJWTHandler) createSession(ctx *gin.Context, uid int64, ssid string, rtid string, roles []string) error {
+	now := time.Now().UnixMilli()
+	args := []any{ssid, h.cfg.MaxSessions, int64(sessionExpiration.Seconds()), now, sessionKeyPrefix,
+		"uid", uid,
+		"device", ctx.GetHeader("X-Device-Id"),
+		"user_agent", ctx.Request.UserAgent(),
+		"ip", ctx.ClientIP(),
+		"ctime", now,
+		"last_seen", now,
+		"rtid", rtid,
+		// 刷新 token 的时候要重新签发角色
+		"roles", strings.Join(roles, ","),
+	}
+	return h.cmd.Eval(ctx, luaCreateSession,
+		[]string{h.userSessionsKey(uid), h.sessionKey(ssid)}, args...).Err()
+}
+
+// 检查用户会话的方法。
+// 会话在 Redis 里面存在，并且是这个用户的，才算有效；顺便更新最后活跃时间
+func (h *RedisJWTHandler) CheckSession(ctx *gin.Context, uid int64, ssid string) error {
+	res, err := h.cmd.Eval(ctx, luaTouchSession, []string{h.sessionKey(ssid)},
+		uid, time.Now().UnixMilli(), ctx.ClientIP()).Int()
+	if err != nil {
+		return err
+	}
+	if res != 1 {
+		return ErrSessionInvalid
+	}
+	return nil
+}
+
+func (h *RedisJWTHandler) RotateTokens(ctx *gin.Context, rc *RefreshClaims) error {
+	newRtid := uuid.New().String()
+	// 检查、作废旧的 refresh_token、记录新的，要在一个 Lua 脚本里面完成
+	// 不然两个并发的刷新请求可能都会成功
+	res, err := h.cmd.Eval(ctx, luaRotateRefresh,
+		[]string{h.sessionKey(rc.Ssid), h.userSessionsKey(rc.Uid)},
+		rc.Uid, rc.Ssid, rc.Rtid, newRtid, time.Now().UnixMilli()).Int()
+	if err != nil {
+		return err
+	}
+	switch res {
+	case 1:
+	case -1:
+		return ErrRefreshTokenReused
+	default:
+		return ErrSessionInvalid
+	}
+	// 角色沿用登录时候的，修改了角色会清掉用户的会话，不会用到旧的角色
+	rolesStr, err := h.cmd.HGet(ctx, h.sessionKey(rc.Ssid), "roles").Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	var roles []string
+	if rolesStr != "" {
+		roles = strings.Split(rolesStr, ",")
+	}
+	err = h.SetJWTToken(ctx, rc.Uid, rc.Ssid, roles)
+	if err != nil {
+		return err
+	}
+	return h.SetRefreshToken(ctx, rc.Uid, rc.Ssid, newRtid)
+}
+
+func (h *RedisJWTHandler) ListSessions(ctx context.Context, uid int64) ([]Session, error) {
+	key := h.userSessionsKey(uid)
+	ssids, err := h.cmd.ZRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	pipe := h.cmd.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, 0, len(ssids))
+	for _, ssid := range ssids {
+		cmds = append(cmds, pipe.HGetAll(ctx, h.sessionKey(ssid)))
+	}
+	if len(cmds) > 0 {
+		if _, err = pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+	}
+	res := make([]Session, 0, len(ssids))
+	var expired []any
+	for i, cmd := range cmds {
+		vals := cmd.Val()
+		// 会话详情已经过期了，顺手清理掉
+		if len(vals) == 0 {
+			expired = append(expired, ssids[i])
+			continue
+		}
+		res = append(res, Session{
+			Ssid:      ssids[i],
+			Device:    vals["device"],
+			UserAgent: vals["user_agent"],
+			IP:        vals["ip"],
+			Ctime:     parseMilli(vals["ctime"]),
+			LastSeen:  parseMilli(vals["last_seen"]),
+		})
+	}
+	if len(expired) > 0 {
+		_ = h.cmd.ZRem(ctx, key, expired...).Err()
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Ctime.After(res[j].Ctime)
+	})
+	return res, nil
+}
+
+func (h *RedisJWTHandler) RevokeSession(ctx context.Context, uid int64, ssid string) error {
+	owner, err := h.cmd.HGet(ctx, h.sessionKey(ssid), "uid").Result()
+	if err == redis.Nil {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	// 只能踢掉自己的设备
+	if owner != strconv.FormatInt(uid, 10) {
+		return ErrSessionNotFound
+	}
+	return h.deleteSessions(ctx, uid, ssid)
+}
+
+func (h *RedisJWTHandler) RevokeOtherSessions(ctx context.Context, uid int64, currentSsid string) error {
+	ssids, err := h.cmd.ZRange(ctx, h.userSessionsKey(uid), 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	others := make([]string, 0, len(ssids))
+	for _, ssid := range ssids {
+		if ssid != currentSsid {
+			others = append(others, ssid)
+		}
+	}
+	return h.deleteSessions(ctx, uid, others...)
+}
+
+// ClearUserSessions 把这个用户所有的会话都删掉
+func (h *RedisJWTHandler) ClearUserSessions(ctx context.Context, uid int64) error {
+	key := h.userSessionsKey(uid)
+	ssids, err := h.cmd.ZRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	pipe := h.cmd.TxPipeline()
+	for _, ssid := range ssids {
+		pipe.Del(ctx, h.sessionKey(ssid))
+	}
+	pipe.Del(ctx, key)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (h *RedisJWTHandler) deleteSessions(ctx context.Context, uid int64, ssids ...string) error {
+	if len(ssids) == 0 {
+		return nil
+	}
+	pipe := h.cmd.TxPipeline()
+	members := make([]any, 0, len(ssids))
+	for _, ssid := range ssids {
+		pipe.Del(ctx, h.sessionKey(ssid))
+		members = append(members, ssid)
+	}
+	pipe.ZRem(ctx, h.userSessionsKey(uid), members...)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (h *RedisJWTHandler) sessionKey(ssid string) string {
+	return sessionKeyPrefix + ssid
+}
+
+func (h *RedisJWTHandler) userSessionsKey(uid int64) string {
+	return fmt.Sprintf("users:sessions:%d", uid)
+}
+
+func parseMilli(val string) time.Time {
+	ms, _ := strconv.ParseInt(val, 10, 64)
+	return time.UnixMilli(ms)
+}
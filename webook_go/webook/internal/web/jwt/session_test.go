@@ -0,0 +1,228 @@
+package jwt
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestRedis 会话相关的测试用 miniredis 跑，不需要本地的 Redis
+func newTestRedis(t *testing.T) redis.Cmdable {
+	mr := miniredis.RunT(t)
+	return redis.NewClient(&redis.Options{
+		Addr: mr.Addr(),
+	})
+}
+
+// login 模拟某个设备登录，返回 ssid
+func login(t *testing.T, h *RedisJWTHandler, uid int64, device string) string {
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	req, err := http.NewRequest(http.MethodPost, "/users/login", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Device-Id", device)
+	req.Header.Set("User-Agent", "test-agent")
+	ctx.Request = req
+	require.NoError(t, h.SetLoginToken(ctx, uid, nil))
+
+	var claims UserClaims
+	_, err = h.ParseAccessToken(recorder.Header().Get("x-jwt-token"), &claims)
+	require.NoError(t, err)
+	// 会话是按照登录时间排序的，错开一点
+	time.Sleep(time.Millisecond * 2)
+	return claims.Ssid
+}
+
+func checkSession(h *RedisJWTHandler, uid int64, ssid string) error {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request, _ = http.NewRequest(http.MethodGet, "/users/profile", nil)
+	return h.CheckSession(ctx, uid, ssid)
+}
+
+func TestRedisJWTHandler_Sessions(t *testing.T) {
+	rdb := newTestRedis(t)
+	const uid = int64(98765)
+	h := NewRedisJWTHandler(rdb, SessionConfig{MaxSessions: 2}, newTestKeys(t)).(*RedisJWTHandler)
+	cleanup := func() {
+		require.NoError(t, h.ClearUserSessions(context.Background(), uid))
+	}
+	cleanup()
+	defer cleanup()
+	ctx := context.Background()
+
+	phone := login(t, h, uid, "phone")
+	assert.NoError(t, checkSession(h, uid, phone))
+	// 别人的 uid 不行
+	assert.Equal(t, ErrSessionInvalid, checkSession(h, uid+1, phone))
+
+	pad := login(t, h, uid, "pad")
+	// 超过两个设备，最早登录的 phone 被踢掉
+	pc := login(t, h, uid, "pc")
+	assert.Equal(t, ErrSessionInvalid, checkSession(h, uid, phone))
+	sessions, err := h.ListSessions(ctx, uid)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.Equal(t, pc, sessions[0].Ssid)
+	assert.Equal(t, "pc", sessions[0].Device)
+	assert.Equal(t, "test-agent", sessions[0].UserAgent)
+	assert.Equal(t, pad, sessions[1].Ssid)
+
+	// 不能踢别人的设备
+	assert.Equal(t, ErrSessionNotFound, h.RevokeSession(ctx, uid+1, pad))
+	require.NoError(t, h.RevokeSession(ctx, uid, pad))
+	assert.Equal(t, ErrSessionInvalid, checkSession(h, uid, pad))
+	assert.Equal(t, ErrSessionNotFound, h.RevokeSession(ctx, uid, pad))
+
+	phone = login(t, h, uid, "phone")
+	require.NoError(t, h.RevokeOtherSessions(ctx, uid, phone))
+	assert.NoError(t, checkSession(h, uid, phone))
+	assert.Equal(t, ErrSessionInvalid, checkSession(h, uid, pc))
+
+	require.NoError(t, h.ClearUserSessions(ctx, uid))
+	assert.Equal(t, ErrSessionInvalid, checkSession(h, uid, phone))
+	sessions, err = h.ListSessions(ctx, uid)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+// refreshClaimsOf 从响应里面拿到 refresh_token 的内容
+func refreshClaimsOf(t *testing.T, h *RedisJWTHandler, recorder *httptest.ResponseRecorder) *RefreshClaims {
+	var rc RefreshClaims
+	_, err := h.ParseRefreshToken(recorder.Header().Get("x-refresh-token"), &rc)
+	require.NoError(t, err)
+	return &rc
+}
+
+func loginForRefresh(t *testing.T, h *RedisJWTHandler, uid int64) *RefreshClaims {
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request, _ = http.NewRequest(http.MethodPost, "/users/login", nil)
+	require.NoError(t, h.SetLoginToken(ctx, uid, []string{"admin"}))
+	return refreshClaimsOf(t, h, recorder)
+}
+
+func rotate(h *RedisJWTHandler, rc *RefreshClaims) (*httptest.ResponseRecorder, error) {
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request, _ = http.NewRequest(http.MethodPost, "/users/refresh_token", nil)
+	return recorder, h.RotateTokens(ctx, rc)
+}
+
+func TestRedisJWTHandler_RotateTokens(t *testing.T) {
+	rdb := newTestRedis(t)
+	const uid = int64(98766)
+	h := NewRedisJWTHandler(rdb, SessionConfig{}, newTestKeys(t)).(*RedisJWTHandler)
+	cleanup := func() {
+		require.NoError(t, h.ClearUserSessions(context.Background(), uid))
+	}
+	cleanup()
+	defer cleanup()
+
+	rc := loginForRefresh(t, h, uid)
+	recorder, err := rotate(h, rc)
+	require.NoError(t, err)
+	var claims UserClaims
+	_, err = h.ParseAccessToken(recorder.Header().Get("x-jwt-token"), &claims)
+	require.NoError(t, err)
+	// 刷新之后角色还在
+	assert.Equal(t, []string{"admin"}, claims.Roles)
+	newRc := refreshClaimsOf(t, h, recorder)
+	assert.Equal(t, rc.Ssid, newRc.Ssid)
+	assert.NotEqual(t, rc.Rtid, newRc.Rtid)
+
+	// 新的可以继续用
+	recorder, err = rotate(h, newRc)
+	require.NoError(t, err)
+	latest := refreshClaimsOf(t, h, recorder)
+
+	// 旧的再拿来用，整个会话都作废
+	_, err = rotate(h, rc)
+	assert.Equal(t, ErrRefreshTokenReused, err)
+	assert.Equal(t, ErrSessionInvalid, checkSession(h, uid, rc.Ssid))
+	_, err = rotate(h, latest)
+	assert.Equal(t, ErrSessionInvalid, err)
+}
+
+func TestRedisJWTHandler_RotateTokensConcurrently(t *testing.T) {
+	rdb := newTestRedis(t)
+	const uid = int64(98767)
+	h := NewRedisJWTHandler(rdb, SessionConfig{}, newTestKeys(t)).(*RedisJWTHandler)
+	cleanup := func() {
+		require.NoError(t, h.ClearUserSessions(context.Background(), uid))
+	}
+	cleanup()
+	defer cleanup()
+
+	rc := loginForRefresh(t, h, uid)
+	// 两个请求同时拿着同一个 refresh_token 来刷新
+	const n = 2
+	errs := make([]error, n)
+	recorders := make([]*httptest.ResponseRecorder, n)
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			claims := *rc
+			recorders[i], errs[i] = rotate(h, &claims)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	// 只能有一个成功，另一个会被当成重复使用
+	var succeeded, reused int
+	var winner *httptest.ResponseRecorder
+	for i, err := range errs {
+		switch err {
+		case nil:
+			succeeded++
+			winner = recorders[i]
+		case ErrRefreshTokenReused:
+			reused++
+		default:
+			t.Fatalf("预期之外的错误 %v", err)
+		}
+	}
+	assert.Equal(t, 1, succeeded)
+	assert.Equal(t, 1, reused)
+	// 发现了重复使用，成功的那一个拿到的新 token 也不能用了
+	_, err := rotate(h, refreshClaimsOf(t, h, winner))
+	assert.Equal(t, ErrSessionInvalid, err)
+	assert.Equal(t, ErrSessionInvalid, checkSession(h, uid, rc.Ssid))
+}
+
+func TestRedisJWTHandler_Challenge(t *testing.T) {
+	rdb := newTestRedis(t)
+	h := NewRedisJWTHandler(rdb, SessionConfig{}, newTestKeys(t)).(*RedisJWTHandler)
+	ctx := context.Background()
+
+	token, err := h.CreateChallenge(ctx, 123)
+	require.NoError(t, err)
+	for i := 0; i < challengeMaxAttempts; i++ {
+		uid, err := h.CheckChallenge(ctx, token)
+		require.NoError(t, err)
+		assert.Equal(t, int64(123), uid)
+	}
+	// 尝试太多次了
+	_, err = h.CheckChallenge(ctx, token)
+	assert.Equal(t, ErrChallengeInvalid, err)
+
+	token, err = h.CreateChallenge(ctx, 123)
+	require.NoError(t, err)
+	require.NoError(t, h.DeleteChallenge(ctx, token))
+	_, err = h.CheckChallenge(ctx, token)
+	assert.Equal(t, ErrChallengeInvalid, err)
+	_, err = h.CheckChallenge(ctx, "not-exist")
+	assert.Equal(t, ErrChallengeInvalid, err)
+}
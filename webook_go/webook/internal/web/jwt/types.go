@@ -1,21 +1,64 @@
 package jwt
 
 import (
+	"context"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"time"
 )
 
 type Handler interface {
-	SetLoginToken(ctx *gin.Context, uid int64) error
-	SetJWTToken(ctx *gin.Context, uid int64, ssid string) error
+	// SetLoginToken roles 会放进 access_token 里面，刷新 token 的时候从会话里面取
+	SetLoginToken(ctx *gin.Context, uid int64, roles []string) error
+	SetJWTToken(ctx *gin.Context, uid int64, ssid string, roles []string) error
 	ClearToken(ctx *gin.Context) error
-	CheckSession(ctx *gin.Context, ssid string) error
+	// CheckSession 会话不存在或者不属于这个用户的时候，返回 ErrSessionInvalid
+	CheckSession(ctx *gin.Context, uid int64, ssid string) error
 	ExtractToken(ctx *gin.Context) string
+	// ParseAccessToken 和 ParseRefreshToken 根据 token header 里面的 kid 选择密钥校验
+	ParseAccessToken(tokenStr string, claims *UserClaims) (*jwt.Token, error)
+	ParseRefreshToken(tokenStr string, claims *RefreshClaims) (*jwt.Token, error)
+	// JWKS 给其他服务校验 access_token 用的公钥
+	JWKS() JWKSet
+	// RotateTokens 用 refresh_token 换一对新的 access_token 和 refresh_token
+	// refresh_token 是一次性的，重复使用会返回 ErrRefreshTokenReused，并且整个会话都会失效
+	RotateTokens(ctx *gin.Context, rc *RefreshClaims) error
+	// ClearUserSessions 让这个用户所有的登录态都失效，比如说重置了密码
+	ClearUserSessions(ctx context.Context, uid int64) error
+	// ListSessions 列出这个用户所有登录的设备，最近登录的在前面
+	ListSessions(ctx context.Context, uid int64) ([]Session, error)
+	// RevokeSession 踢掉某一个设备
+	RevokeSession(ctx context.Context, uid int64, ssid string) error
+	// RevokeOtherSessions 除了当前设备，其他设备都踢下线
+	RevokeOtherSessions(ctx context.Context, uid int64, currentSsid string) error
+	// CreateChallenge 开启了两步验证的用户，密码校验通过之后先拿到一个挑战，验证通过之后才登录
+	CreateChallenge(ctx context.Context, uid int64) (string, error)
+	// CheckChallenge 返回挑战对应的用户，挑战不存在、过期或者尝试太多次返回 ErrChallengeInvalid
+	CheckChallenge(ctx context.Context, token string) (int64, error)
+	DeleteChallenge(ctx context.Context, token string) error
+}
+
+// Session 一次登录就是一个会话
+type Session struct {
+	Ssid      string
+	Device    string
+	UserAgent string
+	IP        string
+	Ctime     time.Time
+	LastSeen  time.Time
+}
+
+type SessionConfig struct {
+	// MaxSessions 一个用户最多同时在多少个设备上登录，超过了就把最早登录的踢掉
+	// 0 代表不限制
+	MaxSessions int
 }
 
 type RefreshClaims struct {
 	Uid  int64
 	Ssid string
+	// Rtid 每个 refresh_token 的唯一 id，会话里面只记录最新的那一个
+	Rtid string
 	jwt.RegisteredClaims
 }
 
@@ -25,4 +68,6 @@ type UserClaims struct {
 	Ssid      string
 	Id        int64
 	UserAgent string
+	// Roles 登录的时候用户的角色，角色变了之后要让用户重新登录
+	Roles []string
 }
@@ -0,0 +1,44 @@
+package web
+
+import (
+	"github.com/gin-gonic/gin"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/service"
+	ijwt "webook_go/webook/internal/web/jwt"
+	"webook_go/webook/pkg/logger"
+)
+
+// loginLogJWTHandler 所有的登录方式最后都会调用 SetLoginToken，在这里统一记录登录记录
+type loginLogJWTHandler struct {
+	ijwt.Handler
+	svc service.LoginLogService
+	l   logger.LoggerV1
+}
+
+// NewLoginLogJWTHandler 装饰 hdl，登录成功之后记录登录记录
+func NewLoginLogJWTHandler(hdl ijwt.Handler, svc service.LoginLogService, l logger.LoggerV1) ijwt.Handler {
+	return &loginLogJWTHandler{
+		Handler: hdl,
+		svc:     svc,
+		l:       l,
+	}
+}
+
+func (h *loginLogJWTHandler) SetLoginToken(ctx *gin.Context, uid int64, roles []string) error {
+	err := h.Handler.SetLoginToken(ctx, uid, roles)
+	if err != nil {
+		return err
+	}
+	// 记录失败不影响登录
+	err = h.svc.Record(ctx, domain.LoginLog{
+		Uid: uid,
+		// 第三方登录的回调路径里面带了是哪个平台
+		Method:    ctx.Request.URL.Path,
+		IP:        ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
+	})
+	if err != nil {
+		h.l.Error("记录登录记录失败", logger.Error(err), logger.Int64("uid", uid))
+	}
+	return nil
+}
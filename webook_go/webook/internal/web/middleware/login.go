@@ -11,15 +11,34 @@ import (
 // 步骤三
 // 此模块用来校验 session
 type LoginMiddlewareBuilder struct {
-	paths []string
+	rules authRules
 }
 
 func NewLoginMiddlewareBuilder() *LoginMiddlewareBuilder {
 	return &LoginMiddlewareBuilder{}
 }
 
+// IgnorePaths 不需要登录，path 可以是真实的路径，也可以是路由模板
 func (l *LoginMiddlewareBuilder) IgnorePaths(path string) *LoginMiddlewareBuilder {
-	l.paths = append(l.paths, path)
+	l.rules.ignore(routeRule{path: path})
+	return l
+}
+
+// IgnoreRoutes 只忽略某个 HTTP 方法，method 为空代表所有方法
+func (l *LoginMiddlewareBuilder) IgnoreRoutes(method string, paths ...string) *LoginMiddlewareBuilder {
+	l.rules.ignore(routeRules(method, paths)...)
+	return l
+}
+
+// IgnorePrefix 以 prefix 开头的路径都不需要登录
+func (l *LoginMiddlewareBuilder) IgnorePrefix(prefix string) *LoginMiddlewareBuilder {
+	l.rules.ignore(routeRule{path: prefix, prefix: true})
+	return l
+}
+
+// OptionalRoutes 登录可选，没有登录也放行
+func (l *LoginMiddlewareBuilder) OptionalRoutes(method string, paths ...string) *LoginMiddlewareBuilder {
+	l.rules.optional(routeRules(method, paths)...)
 	return l
 }
 
@@ -28,10 +47,8 @@ func (l *LoginMiddlewareBuilder) Build() gin.HandlerFunc {
 	gob.Register(time.Now()) // gob: go object binary
 	return func(ctx *gin.Context) {
 		// 不需要登录校验的
-		for _, path := range l.paths {
-			if ctx.Request.URL.Path == path {
-				return
-			}
+		if l.rules.ignored(ctx) {
+			return
 		}
 		// 不需要登录校验的
 		//if ctx.Request.URL.Path == "/users/login" ||
@@ -42,6 +59,10 @@ func (l *LoginMiddlewareBuilder) Build() gin.HandlerFunc {
 		sess := sessions.Default(ctx)
 		id := sess.Get("userId")
 		if id == nil {
+			if l.rules.isOptional(ctx) {
+				// 游客
+				return
+			}
 			// 没有登录
 			ctx.AbortWithStatus(http.StatusUnauthorized)
 			return
@@ -1,8 +1,8 @@
 package middleware
 
 import (
+	"context"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"net/http"
 	ijwt "webook_go/webook/internal/web/jwt"
 )
@@ -10,8 +10,14 @@ import (
 // 步骤三
 // JWT 登录校验
 type LoginJWTMiddlewareBuilder struct {
-	paths []string
+	rules authRules
 	ijwt.Handler
+	banChecker BanChecker
+}
+
+// BanChecker 判断用户有没有被封禁
+type BanChecker interface {
+	Banned(ctx context.Context, uid int64) (bool, error)
 }
 
 func NewLoginJWTMiddlewareBuilder(jwtHdl ijwt.Handler) *LoginJWTMiddlewareBuilder {
@@ -20,50 +26,91 @@ func NewLoginJWTMiddlewareBuilder(jwtHdl ijwt.Handler) *LoginJWTMiddlewareBuilde
 	}
 }
 
+// IgnorePaths 不需要登录，path 可以是真实的路径，也可以是路由模板
 func (l *LoginJWTMiddlewareBuilder) IgnorePaths(path string) *LoginJWTMiddlewareBuilder {
-	l.paths = append(l.paths, path)
+	l.rules.ignore(routeRule{path: path})
+	return l
+}
+
+// IgnoreRoutes 只忽略某个 HTTP 方法，method 为空代表所有方法
+// paths 是注册路由时候的模板，比如 /articles/pub/:id
+func (l *LoginJWTMiddlewareBuilder) IgnoreRoutes(method string, paths ...string) *LoginJWTMiddlewareBuilder {
+	l.rules.ignore(routeRules(method, paths)...)
+	return l
+}
+
+// IgnorePrefix 以 prefix 开头的路径都不需要登录
+func (l *LoginJWTMiddlewareBuilder) IgnorePrefix(prefix string) *LoginJWTMiddlewareBuilder {
+	l.rules.ignore(routeRule{path: prefix, prefix: true})
+	return l
+}
+
+// OptionalRoutes 登录可选：带了有效的 token 就会设置 claims，没有带或者无效就当成游客
+func (l *LoginJWTMiddlewareBuilder) OptionalRoutes(method string, paths ...string) *LoginJWTMiddlewareBuilder {
+	l.rules.optional(routeRules(method, paths)...)
+	return l
+}
+
+// CheckBanned 被封禁的用户就算 token 和会话都有效，也当成没有登录
+// 查询出错的时候放行，不能因为缓存或者数据库的问题让所有人都掉线
+func (l *LoginJWTMiddlewareBuilder) CheckBanned(c BanChecker) *LoginJWTMiddlewareBuilder {
+	l.banChecker = c
 	return l
 }
 
 func (l *LoginJWTMiddlewareBuilder) Build() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		// 不需要登录校验的
-		for _, path := range l.paths {
-			if ctx.Request.URL.Path == path {
+		if l.rules.ignored(ctx) {
+			return
+		}
+		claims, ok := l.parseClaims(ctx)
+		if !ok {
+			if l.rules.isOptional(ctx) {
+				// 游客，后面的 handler 拿不到 claims
 				return
 			}
-		}
-		// 我现在用 JWT 来校验
-		tokenStr := l.ExtractToken(ctx)
-		claims := &ijwt.UserClaims{}
-		println(claims)
-		// ParseWithClaims 会将 claims 里面的 userId 解析出来，所以上一步要用指针传入 ParseWithClaims
-		token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte("NDIOaqI8vCUZfWoNVcol0CuqFwHbu4cn"), nil // 这里的加密算法一定要和登录功能中设置的一样，不然无效
-		})
-		if err != nil {
 			// 没登录
 			ctx.AbortWithStatus(http.StatusUnauthorized)
 			return
 		}
 		ctx.Set("claims", claims)
-		// err 为 nil, token 不为 nil
-		if token == nil || !token.Valid || claims.Id == 0 {
-			// 没登录
-			ctx.AbortWithStatus(http.StatusUnauthorized)
-			return
-		}
-		if claims.UserAgent != ctx.Request.UserAgent() {
-			// 严重的安全问题
-			// 你是要监控
-			ctx.AbortWithStatus(http.StatusUnauthorized)
-			return
-		}
-		err = l.CheckSession(ctx, claims.Ssid)
-		if err != nil {
-			// 没登录
-			ctx.AbortWithStatus(http.StatusUnauthorized)
-			return
+	}
+}
+
+// parseClaims 校验 token 和会话，都没问题才返回 true
+func (l *LoginJWTMiddlewareBuilder) parseClaims(ctx *gin.Context) (*ijwt.UserClaims, bool) {
+	// 我现在用 JWT 来校验
+	tokenStr := l.ExtractToken(ctx)
+	if tokenStr == "" {
+		return nil, false
+	}
+	claims := &ijwt.UserClaims{}
+	// ParseWithClaims 会将 claims 里面的 userId 解析出来，所以上一步要用指针传入 ParseWithClaims
+	// 密钥是根据 token header 里面的 kid 来选的，轮换密钥的时候旧的 token 还能用
+	token, err := l.ParseAccessToken(tokenStr, claims)
+	if err != nil {
+		return nil, false
+	}
+	// err 为 nil, token 不为 nil
+	if token == nil || !token.Valid || claims.Id == 0 {
+		return nil, false
+	}
+	if claims.UserAgent != ctx.Request.UserAgent() {
+		// 严重的安全问题
+		// 你是要监控
+		return nil, false
+	}
+	// 退出登录、被踢下线、重置密码之后，会话就不在了
+	err = l.CheckSession(ctx, claims.Id, claims.Ssid)
+	if err != nil {
+		return nil, false
+	}
+	if l.banChecker != nil {
+		banned, err := l.banChecker.Banned(ctx, claims.Id)
+		if err == nil && banned {
+			return nil, false
 		}
 	}
+	return claims, true
 }
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	ijwt "webook_go/webook/internal/web/jwt"
+)
+
+// fakeJWTHandler 只有 "valid" 这个 token 是有效的
+type fakeJWTHandler struct {
+	ijwt.Handler
+}
+
+func (f fakeJWTHandler) ExtractToken(ctx *gin.Context) string {
+	return ctx.GetHeader("Authorization")
+}
+
+func (f fakeJWTHandler) ParseAccessToken(tokenStr string, claims *ijwt.UserClaims) (*jwt.Token, error) {
+	if tokenStr != "valid" {
+		return nil, jwt.ErrTokenMalformed
+	}
+	claims.Id = 123
+	return &jwt.Token{Valid: true}, nil
+}
+
+func (f fakeJWTHandler) CheckSession(ctx *gin.Context, uid int64, ssid string) error {
+	return nil
+}
+
+func TestLoginJWTMiddlewareBuilder_Rules(t *testing.T) {
+	server := gin.New()
+	server.Use(NewLoginJWTMiddlewareBuilder(fakeJWTHandler{}).
+		IgnorePaths("/users/login").
+		IgnoreRoutes(http.MethodGet, "/articles/pub/:id").
+		IgnorePrefix("/oauth2/").
+		OptionalRoutes(http.MethodGet, "/articles/list").
+		Build())
+	hdl := func(ctx *gin.Context) {
+		if _, ok := ctx.Get("claims"); ok {
+			ctx.String(http.StatusOK, "user")
+			return
+		}
+		ctx.String(http.StatusOK, "guest")
+	}
+	server.POST("/users/login", hdl)
+	server.GET("/articles/pub/:id", hdl)
+	server.POST("/articles/pub/:id", hdl)
+	server.GET("/oauth2/wechat/callback", hdl)
+	server.GET("/articles/list", hdl)
+	server.GET("/users/profile", hdl)
+
+	testCases := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+
+		wantCode int
+		wantBody string
+	}{
+		{name: "精确匹配", method: http.MethodPost, path: "/users/login",
+			wantCode: http.StatusOK, wantBody: "guest"},
+		{name: "路由模板", method: http.MethodGet, path: "/articles/pub/12",
+			wantCode: http.StatusOK, wantBody: "guest"},
+		{name: "路由模板，方法不对", method: http.MethodPost, path: "/articles/pub/12",
+			wantCode: http.StatusUnauthorized},
+		{name: "前缀", method: http.MethodGet, path: "/oauth2/wechat/callback",
+			wantCode: http.StatusOK, wantBody: "guest"},
+		{name: "登录可选，游客", method: http.MethodGet, path: "/articles/list",
+			wantCode: http.StatusOK, wantBody: "guest"},
+		{name: "登录可选，token 无效当成游客", method: http.MethodGet, path: "/articles/list",
+			token: "invalid", wantCode: http.StatusOK, wantBody: "guest"},
+		{name: "登录可选，已登录", method: http.MethodGet, path: "/articles/list",
+			token: "valid", wantCode: http.StatusOK, wantBody: "user"},
+		{name: "需要登录", method: http.MethodGet, path: "/users/profile",
+			wantCode: http.StatusUnauthorized},
+		{name: "已登录", method: http.MethodGet, path: "/users/profile",
+			token: "valid", wantCode: http.StatusOK, wantBody: "user"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, tc.path, nil)
+			require.NoError(t, err)
+			if tc.token != "" {
+				req.Header.Set("Authorization", tc.token)
+			}
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
+
+type fakeBanChecker struct {
+	banned bool
+	err    error
+}
+
+func (f fakeBanChecker) Banned(ctx context.Context, uid int64) (bool, error) {
+	return f.banned, f.err
+}
+
+func TestLoginJWTMiddlewareBuilder_CheckBanned(t *testing.T) {
+	testCases := []struct {
+		name    string
+		checker fakeBanChecker
+
+		wantCode int
+	}{
+		{name: "没有被封禁", wantCode: http.StatusOK},
+		{name: "被封禁了", checker: fakeBanChecker{banned: true}, wantCode: http.StatusUnauthorized},
+		{name: "查询出错放行", checker: fakeBanChecker{err: errors.New("redis 错误")}, wantCode: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := gin.New()
+			server.Use(NewLoginJWTMiddlewareBuilder(fakeJWTHandler{}).CheckBanned(tc.checker).Build())
+			server.GET("/users/profile", func(ctx *gin.Context) {
+				ctx.String(http.StatusOK, "user")
+			})
+			req, err := http.NewRequest(http.MethodGet, "/users/profile", nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "valid")
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"webook_go/webook/internal/domain"
+	ijwt "webook_go/webook/internal/web/jwt"
+)
+
+// RBACMiddlewareBuilder 权限校验，要放在 LoginJWTMiddlewareBuilder 后面，依赖它放进去的 claims
+// 用法：server.Group("/admin", builder.Require(domain.PermUserBan))
+type RBACMiddlewareBuilder struct {
+}
+
+func NewRBACMiddlewareBuilder() *RBACMiddlewareBuilder {
+	return &RBACMiddlewareBuilder{}
+}
+
+// Require 要同时拥有所有的权限才能访问
+func (b *RBACMiddlewareBuilder) Require(perms ...domain.Permission) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, ok := ctx.Get("claims")
+		if !ok {
+			// 没登录
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		claims, ok := c.(*ijwt.UserClaims)
+		if !ok {
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		roles := make([]domain.Role, 0, len(claims.Roles))
+		for _, r := range claims.Roles {
+			roles = append(roles, domain.Role(r))
+		}
+		for _, perm := range perms {
+			if !domain.HasPermission(roles, perm) {
+				// 登录了，但是没有权限
+				ctx.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"webook_go/webook/internal/domain"
+	ijwt "webook_go/webook/internal/web/jwt"
+)
+
+func TestRBACMiddlewareBuilder_Require(t *testing.T) {
+	testCases := []struct {
+		name   string
+		claims *ijwt.UserClaims
+		perms  []domain.Permission
+
+		wantCode int
+	}{
+		{
+			name:     "管理员",
+			claims:   &ijwt.UserClaims{Id: 1, Roles: []string{"admin"}},
+			perms:    []domain.Permission{domain.PermUserRole, domain.PermUserBan},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "普通用户",
+			claims:   &ijwt.UserClaims{Id: 1},
+			perms:    []domain.Permission{domain.PermUserRole},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "未知的角色",
+			claims:   &ijwt.UserClaims{Id: 1, Roles: []string{"root"}},
+			perms:    []domain.Permission{domain.PermUserBan},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "没有登录",
+			perms:    []domain.Permission{domain.PermUserBan},
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := gin.New()
+			server.Use(func(ctx *gin.Context) {
+				if tc.claims != nil {
+					ctx.Set("claims", tc.claims)
+				}
+			})
+			server.GET("/admin/test", NewRBACMiddlewareBuilder().Require(tc.perms...),
+				func(ctx *gin.Context) {
+					ctx.Status(http.StatusOK)
+				})
+			req, err := http.NewRequest(http.MethodGet, "/admin/test", nil)
+			assert.NoError(t, err)
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+		})
+	}
+}
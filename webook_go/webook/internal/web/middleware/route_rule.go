@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"strings"
+)
+
+// routeRule 一条不需要登录（或者登录可选）的规则
+type routeRule struct {
+	// method 为空代表所有的 HTTP 方法
+	method string
+	// path 可以是真实的路径，也可以是注册路由时候的模板，比如 /articles/pub/:id
+	path string
+	// prefix 为 true 的时候，只要路径以 path 开头就算匹配
+	prefix bool
+}
+
+func (r routeRule) match(ctx *gin.Context) bool {
+	if r.method != "" && r.method != ctx.Request.Method {
+		return false
+	}
+	if r.prefix {
+		return strings.HasPrefix(ctx.Request.URL.Path, r.path)
+	}
+	// FullPath 是命中的路由模板，没有命中任何路由的时候是空的
+	return ctx.Request.URL.Path == r.path || ctx.FullPath() == r.path
+}
+
+// authRules 两个登录校验的中间件共用
+type authRules struct {
+	// ignores 完全不校验
+	ignores []routeRule
+	// optionals 登录了就解析出用户信息，没登录也可以访问，比如说看文章
+	optionals []routeRule
+}
+
+func (a *authRules) ignore(rules ...routeRule) {
+	a.ignores = append(a.ignores, rules...)
+}
+
+func (a *authRules) optional(rules ...routeRule) {
+	a.optionals = append(a.optionals, rules...)
+}
+
+func (a *authRules) ignored(ctx *gin.Context) bool {
+	return matchAny(a.ignores, ctx)
+}
+
+func (a *authRules) isOptional(ctx *gin.Context) bool {
+	return matchAny(a.optionals, ctx)
+}
+
+func matchAny(rules []routeRule, ctx *gin.Context) bool {
+	for _, r := range rules {
+		if r.match(ctx) {
+			return true
+		}
+	}
+	return false
+}
+
+func routeRules(method string, paths []string) []routeRule {
+	res := make([]routeRule, 0, len(paths))
+	for _, p := range paths {
+		res = append(res, routeRule{method: method, path: p})
+	}
+	return res
+}
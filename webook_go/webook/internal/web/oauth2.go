@@ -0,0 +1,311 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"net/http"
+	"time"
+	"webook_go/webook/internal/service"
+	"webook_go/webook/internal/service/oauth2"
+	ijwt "webook_go/webook/internal/web/jwt"
+	"webook_go/webook/pkg/logger"
+)
+
+// stateTTL 你预期中一个用户完成第三方登录的时间，cookie 和 state token 用同一个过期时间
+const stateTTL = 10 * time.Minute
+
+const stateCookieName = "jwt-state"
+
+// OAuth2Handler 统一处理所有的第三方登录，每个平台一个 oauth2.Provider
+type OAuth2Handler struct {
+	providers   map[string]oauth2.Provider
+	identitySvc service.IdentityService
+	linkSvc     service.LinkService
+	totpSvc     service.TOTPService
+	ijwt.Handler
+	cfg OAuth2HandlerConfig
+	l   logger.LoggerV1
+}
+
+type OAuth2HandlerConfig struct {
+	// StateKey 签名 state cookie 用的
+	StateKey string
+	// Secure 生产环境要用 true，cookie 只在 HTTPS 下面发送
+	Secure bool
+}
+
+func NewOAuth2Handler(providers []oauth2.Provider, identitySvc service.IdentityService,
+	linkSvc service.LinkService, totpSvc service.TOTPService, jwtHdl ijwt.Handler, cfg OAuth2HandlerConfig, l logger.LoggerV1) *OAuth2Handler {
+	m := make(map[string]oauth2.Provider, len(providers))
+	for _, p := range providers {
+		m[p.Name()] = p
+	}
+	return &OAuth2Handler{
+		providers:   m,
+		identitySvc: identitySvc,
+		linkSvc:     linkSvc,
+		totpSvc:     totpSvc,
+		Handler:     jwtHdl,
+		cfg:         cfg,
+		l:           l,
+	}
+}
+
+func (h *OAuth2Handler) RegisterRoutes(server *gin.Engine) {
+	g := server.Group("/oauth2")
+	g.GET("/:provider/authurl", h.AuthURL)
+	g.Any("/:provider/callback", h.Callback)
+	// 登录之后绑定第三方账号，回调还是同一个，靠 state 里面的 uid 区分
+	server.GET("/users/bind/:provider/authurl", h.BindURL)
+}
+
+func (h *OAuth2Handler) AuthURL(ctx *gin.Context) {
+	h.authURL(ctx, 0)
+}
+
+// BindURL 要登录之后才能调用
+func (h *OAuth2Handler) BindURL(ctx *gin.Context) {
+	claims, ok := ctx.MustGet("claims").(*ijwt.UserClaims)
+	if !ok {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		h.l.Error("设置claims失败")
+		return
+	}
+	h.authURL(ctx, claims.Id)
+}
+
+// authURL bindUid 不是 0 的时候，回调里面是绑定到这个用户上，而不是登录
+func (h *OAuth2Handler) authURL(ctx *gin.Context, bindUid int64) {
+	p, ok := h.providers[ctx.Param("provider")]
+	if !ok {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "不支持的登录方式",
+		})
+		return
+	}
+	sc, err := newStateClaims(p.Name())
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统异常",
+		})
+		h.l.Error("生成 state 失败", logger.Error(err))
+		return
+	}
+	sc.BindUid = bindUid
+	url, err := p.AuthURL(ctx, oauth2.AuthParams{
+		State:         sc.State,
+		Nonce:         sc.Nonce,
+		CodeChallenge: oauth2.S256Challenge(sc.Verifier),
+	})
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "构造登录URL失败",
+		})
+		h.l.Error("构造第三方登录URL失败", logger.Error(err), logger.String("provider", p.Name()))
+		return
+	}
+	if err = h.setStateCookie(ctx, sc); err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统异常",
+		})
+		h.l.Error("设置 state cookie 失败", logger.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Data: url,
+	})
+}
+
+func (h *OAuth2Handler) Callback(ctx *gin.Context) {
+	p, ok := h.providers[ctx.Param("provider")]
+	if !ok {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "不支持的登录方式",
+		})
+		return
+	}
+	sc, err := h.verifyState(ctx, p.Name())
+	// state 只能用一次
+	h.clearStateCookie(ctx, p.Name())
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "登录失败，请重新登录",
+		})
+		h.l.Warn("第三方登录 state 校验失败", logger.Error(err), logger.String("provider", p.Name()))
+		return
+	}
+	code := ctx.Query("code")
+	if code == "" {
+		// 用户拒绝了授权
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "没有授权",
+		})
+		return
+	}
+	identity, err := p.Exchange(ctx, oauth2.ExchangeParams{
+		Code:         code,
+		CodeVerifier: sc.Verifier,
+		Nonce:        sc.Nonce,
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, oauth2.ErrInvalidCode):
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "授权已经过期，请重新登录",
+		})
+		return
+	case errors.Is(err, oauth2.ErrTimeout), errors.Is(err, oauth2.ErrUnavailable):
+		// 第三方平台的问题，用户重试一下就好
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "第三方平台繁忙，请稍后重试",
+		})
+		h.l.Warn("第三方平台不可用", logger.Error(err), logger.String("provider", p.Name()))
+		return
+	default:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		h.l.Error("第三方登录换取身份失败", logger.Error(err), logger.String("provider", p.Name()))
+		return
+	}
+	if sc.BindUid != 0 {
+		ticket, err := h.linkSvc.BindIdentity(ctx, sc.BindUid, identity)
+		bindResult(ctx, h.l, sc.BindUid, ticket, err)
+		return
+	}
+	u, err := h.identitySvc.FindOrCreate(ctx, identity)
+	if err == service.ErrUserBanned {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "账号已被封禁",
+		})
+		return
+	}
+	if err == service.ErrDegraded {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统繁忙，请稍后再试",
+		})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		h.l.Error("第三方登录查找用户失败", logger.Error(err), logger.String("provider", p.Name()))
+		return
+	}
+	// 开了两步验证的，第三方登录也不能绕过去
+	enabled, err := h.totpSvc.Enabled(ctx, u.Id)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		h.l.Error("查询两步验证失败", logger.Error(err), logger.Int64("uid", u.Id))
+		return
+	}
+	if enabled {
+		writeTOTPChallenge(ctx, h.Handler, h.l, u.Id)
+		return
+	}
+	err = h.SetLoginToken(ctx, u.Id, u.RoleNames())
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		h.l.Error("设置登录鉴权信息失败", logger.Error(err), logger.Int64("uid", u.Id))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Msg: "ok",
+	})
+}
+
+func (h *OAuth2Handler) setStateCookie(ctx *gin.Context, sc StateClaims) error {
+	sc.RegisteredClaims = jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(stateTTL)),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, sc)
+	tokenStr, err := token.SignedString([]byte(h.cfg.StateKey))
+	if err != nil {
+		return err
+	}
+	ctx.SetCookie(stateCookieName, tokenStr, int(stateTTL.Seconds()), h.callbackPath(sc.Provider),
+		"", h.cfg.Secure, true)
+	return nil
+}
+
+func (h *OAuth2Handler) clearStateCookie(ctx *gin.Context, provider string) {
+	ctx.SetCookie(stateCookieName, "", -1, h.callbackPath(provider), "", h.cfg.Secure, true)
+}
+
+func (h *OAuth2Handler) callbackPath(provider string) string {
+	return "/oauth2/" + provider + "/callback"
+}
+
+func (h *OAuth2Handler) verifyState(ctx *gin.Context, provider string) (StateClaims, error) {
+	var sc StateClaims
+	state := ctx.Query("state")
+	if state == "" {
+		return sc, errors.New("没有 state 参数")
+	}
+	ck, err := ctx.Cookie(stateCookieName)
+	if err != nil {
+		return sc, fmt.Errorf("拿不到 state 的 cookie, %w", err)
+	}
+	token, err := jwt.ParseWithClaims(ck, &sc, func(token *jwt.Token) (interface{}, error) {
+		return []byte(h.cfg.StateKey), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return sc, fmt.Errorf("state cookie 无效或者已经过期了, %w", err)
+	}
+	if sc.Provider != provider {
+		return sc, errors.New("state 不是这个平台的")
+	}
+	if sc.State != state {
+		return sc, errors.New("state 不相等")
+	}
+	return sc, nil
+}
+
+// StateClaims 发起登录的时候生成的随机数，放在 cookie 里面，回调的时候拿出来对比
+type StateClaims struct {
+	Provider string
+	State    string
+	Nonce    string
+	// Verifier PKCE 的 code_verifier
+	Verifier string
+	// BindUid 登录之后发起的绑定，回调的时候绑定到这个用户上
+	BindUid int64
+	jwt.RegisteredClaims
+}
+
+func newStateClaims(provider string) (StateClaims, error) {
+	sc := StateClaims{Provider: provider}
+	for _, field := range []*string{&sc.State, &sc.Nonce, &sc.Verifier} {
+		val, err := oauth2.RandomString()
+		if err != nil {
+			return StateClaims{}, err
+		}
+		*field = val
+	}
+	return sc, nil
+}
@@ -1,21 +1,60 @@
 package web
 
 import (
-	"fmt"
 	regexp "github.com/dlclark/regexp2"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/redis/go-redis/v9"
 	"net/http"
+	"time"
 	"webook_go/webook/internal/domain"
 	"webook_go/webook/internal/service"
+	"webook_go/webook/internal/service/captcha"
 	ijwt "webook_go/webook/internal/web/jwt"
 	"webook_go/webook/pkg/logger"
 )
 
 const biz = "login"
 
+// bizLoginEmail 邮箱登录的验证码，和短信登录的 biz 要区分开
+const bizLoginEmail = "login_email"
+
+// 重置密码的验证码，短信和邮件各用一个 biz
+const (
+	bizResetPassword      = "reset_password"
+	bizResetPasswordEmail = "reset_password_email"
+)
+
+// 发送验证码的业务错误码，4 代表用户侧的问题，01 代表 user 模块，后三位代表具体原因
+const (
+	codeSendTooFrequent  = 401001
+	codeSendPhoneHour    = 401002
+	codeSendPhoneDay     = 401003
+	codeSendIPLimit      = 401004
+	codeSendDeviceLimit  = 401005
+	codeSendBizLimit     = 401006
+	codeCaptchaRequired  = 401007
+	codeCaptchaIncorrect = 401008
+)
+
+// 登录的业务错误码
+const (
+	// codeTOTPRequired 密码是对的，但是还要输入两步验证的验证码
+	codeTOTPRequired = 401101
+)
+
+// 绑定的业务错误码
+const (
+	// codeLinkConflict 要绑定的已经属于另外一个账号了，返回合并凭证
+	codeLinkConflict = 401201
+)
+
+// 绑定手机号和邮箱的验证码
+const (
+	bizBindPhone = "bind_phone"
+	bizBindEmail = "bind_email"
+)
+
 // 确保 UserHandler 上实现了 handler 接口
 var _ handler = &UserHandler{}
 
@@ -23,43 +62,69 @@ var _ handler = &UserHandler{}
 var _ handler = (*UserHandler)(nil)
 
 type UserHandler struct {
-	emailExp    *regexp.Regexp
-	codeSvc     service.CodeService
-	passwordExp *regexp.Regexp
-	BirthdayExp *regexp.Regexp
-	svc         service.UserService
+	emailExp      *regexp.Regexp
+	codeSvc       service.CodeService
+	emailCodeSvc  service.EmailCodeService
+	activationSvc service.ActivationService
+	totpSvc       service.TOTPService
+	loginLimitSvc service.LoginLimitService
+	linkSvc       service.LinkService
+	accountSvc    service.AccountService
+	captchaSvc    captcha.Service
+	passwordExp   *regexp.Regexp
+	phoneExp      *regexp.Regexp
+	svc           service.UserService
 	ijwt.Handler
 	cmd redis.Cmdable
 	l   logger.LoggerV1
 }
 
-func NewUserHandler(svc service.UserService, codeSvc service.CodeService, jwtHdl ijwt.Handler) *UserHandler {
-	// 定义校验邮箱和密码的正则表达式
+func NewUserHandler(svc service.UserService, codeSvc service.CodeService,
+	emailCodeSvc service.EmailCodeService, activationSvc service.ActivationService,
+	totpSvc service.TOTPService, loginLimitSvc service.LoginLimitService,
+	linkSvc service.LinkService, accountSvc service.AccountService,
+	captchaSvc captcha.Service, jwtHdl ijwt.Handler, l logger.LoggerV1) *UserHandler {
+	// 定义校验邮箱、密码和手机号的正则表达式
 	const (
 		emailRegexPattern    = "^\\w+([-+.]\\w+)*@\\w+([-.]\\w+)*\\.\\w+([-.]\\w+)*$"
 		passwordRegexPattern = `^(?=.*[A-Za-z])(?=.*\d)(?=.*[$@$!%*#?&])[A-Za-z\d$@$!%*#?&]{8,72}$`
-		//birthRegexPattern    = `\b\d{4}-\d{2}-\d{2}\b`
-		birthRegexPattern = `^\d{4}-\d{2}-\d{2}$`
+		phoneRegexPattern    = `^1[3-9]\d{9}$`
 	)
 	// 预编译正则表达式，提高校验速度
 	emailExp := regexp.MustCompile(emailRegexPattern, regexp.None)
 	passwordExp := regexp.MustCompile(passwordRegexPattern, regexp.None)
-	birthdayExp := regexp.MustCompile(birthRegexPattern, regexp.None)
+	phoneExp := regexp.MustCompile(phoneRegexPattern, regexp.None)
 	return &UserHandler{
-		emailExp:    emailExp,
-		passwordExp: passwordExp,
-		BirthdayExp: birthdayExp,
-		svc:         svc,
-		codeSvc:     codeSvc,
-		Handler:     jwtHdl,
+		emailExp:      emailExp,
+		passwordExp:   passwordExp,
+		phoneExp:      phoneExp,
+		svc:           svc,
+		codeSvc:       codeSvc,
+		emailCodeSvc:  emailCodeSvc,
+		activationSvc: activationSvc,
+		totpSvc:       totpSvc,
+		loginLimitSvc: loginLimitSvc,
+		linkSvc:       linkSvc,
+		accountSvc:    accountSvc,
+		captchaSvc:    captchaSvc,
+		Handler:       jwtHdl,
+		l:             l,
 	}
 }
 
 func (u *UserHandler) RegisterRoutes(server *gin.Engine) {
 	ug := server.Group("/users")
 	ug.POST("/signup", u.SignUp)
+	ug.GET("/activate", u.Activate)
+	ug.POST("/activate/resend", u.ResendActivation)
 	//ug.POST("/login", u.Login)
 	ug.POST("/login", u.LoginJWT)
+	ug.POST("/login/2fa", u.LoginTOTP)
+	ug.POST("/login/unlock/send", u.SendUnlockCode)
+	ug.POST("/login/unlock", u.Unlock)
+	ug.POST("/2fa/setup", u.SetupTOTP)
+	ug.POST("/2fa/enable", u.EnableTOTP)
+	ug.POST("/2fa/disable", u.DisableTOTP)
 	//ug.POST("/edit", u.Edit)
 	ug.POST("/edit", u.EditJWT)
 	//ug.GET("/profile", u.Profile)
@@ -67,27 +132,53 @@ func (u *UserHandler) RegisterRoutes(server *gin.Engine) {
 	ug.GET("/logout", u.LogOutJWT)
 	ug.POST("/login_sms/code/send", u.SendLoginSMSCode)
 	ug.POST("/login_sms", u.LoginSMS)
+	ug.POST("/login_email/code/send", u.SendLoginEmailCode)
+	ug.POST("/login_email", u.LoginEmail)
 	ug.POST("/refresh_token", u.RefreshToken)
+	ug.GET("/sessions", u.Sessions)
+	ug.POST("/sessions/revoke", u.RevokeSession)
+	ug.POST("/sessions/revoke_others", u.RevokeOtherSessions)
+	ug.POST("/password/reset/send", u.SendResetPasswordCode)
+	ug.POST("/password/reset", u.ResetPassword)
+	ug.GET("/links", u.Links)
+	ug.POST("/bind/phone/code/send", u.SendBindPhoneCode)
+	ug.POST("/bind/phone", u.BindPhone)
+	ug.POST("/bind/email/code/send", u.SendBindEmailCode)
+	ug.POST("/bind/email", u.BindEmail)
+	ug.POST("/unbind", u.Unbind)
+	ug.POST("/merge", u.Merge)
+	ug.POST("/delete", u.RequestDeletion)
+	ug.POST("/delete/cancel", u.CancelDeletion)
+	ug.GET("/export", u.Export)
 }
 
 // RefreshToken 可以同时刷新长短 token，用 redis 来记录是否有效，即 refresh_token 是一次性的
+// 每次刷新都会签发新的 refresh_token，旧的重复使用会让整个会话失效
 // 参考登录校验部分，比较 User-Agent 来增强安全性
 func (u *UserHandler) RefreshToken(ctx *gin.Context) {
 	// 只有这个接口，拿出来的才是 refresh_token，其他地方都是 access token
 	refreshToken := u.ExtractToken(ctx)
 	var rc ijwt.RefreshClaims
-	token, err := jwt.ParseWithClaims(refreshToken, &rc, func(token *jwt.Token) (interface{}, error) {
-		return ijwt.RtKey, nil
-	})
+	token, err := u.ParseRefreshToken(refreshToken, &rc)
 	if err != nil || !token.Valid {
 		ctx.AbortWithStatus(http.StatusUnauthorized)
 		u.l.Debug("token过期，请重新登录")
 		return
 	}
-	// 检查给定的会话ID是否存在于Redis中
-	err = u.CheckSession(ctx, rc.Ssid)
-	// 搞个新的 access_token
-	err = u.SetJWTToken(ctx, rc.Uid, rc.Ssid)
+	// 搞个新的 access_token，refresh_token 也一起换掉，旧的就不能再用了
+	err = u.RotateTokens(ctx, &rc)
+	if err == ijwt.ErrRefreshTokenReused {
+		// 旧的 refresh_token 又被拿来用了，大概率是被盗了，整个会话已经作废
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		u.l.Warn("refresh_token 被重复使用，会话已经作废",
+			logger.Int64("uid", rc.Uid), logger.String("ssid", rc.Ssid))
+		return
+	}
+	if err == ijwt.ErrSessionInvalid {
+		// 已经退出登录了，或者被踢下线了
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
 	if err != nil {
 		ctx.AbortWithStatus(http.StatusUnauthorized)
 		// 这种系统异常的含糊日志不要打，信息量不足，无法明确知道发生了什么错误，要坐到能根据日志定位问题
@@ -109,6 +200,118 @@ func (u *UserHandler) RefreshToken(ctx *gin.Context) {
 	})
 }
 
+// Sessions 列出当前用户所有登录的设备
+func (u *UserHandler) Sessions(ctx *gin.Context) {
+	claims, ok := ctx.MustGet("claims").(*ijwt.UserClaims)
+	if !ok {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("设置claims失败")
+		return
+	}
+	sessions, err := u.ListSessions(ctx, claims.Id)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("查询登录设备失败", logger.Error(err))
+		return
+	}
+	type Session struct {
+		Ssid      string `json:"ssid"`
+		Device    string `json:"device"`
+		UserAgent string `json:"userAgent"`
+		IP        string `json:"ip"`
+		Ctime     int64  `json:"ctime"`
+		LastSeen  int64  `json:"lastSeen"`
+		// Current 是不是当前这个设备
+		Current bool `json:"current"`
+	}
+	res := make([]Session, 0, len(sessions))
+	for _, s := range sessions {
+		res = append(res, Session{
+			Ssid:      s.Ssid,
+			Device:    s.Device,
+			UserAgent: s.UserAgent,
+			IP:        s.IP,
+			Ctime:     s.Ctime.UnixMilli(),
+			LastSeen:  s.LastSeen.UnixMilli(),
+			Current:   s.Ssid == claims.Ssid,
+		})
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Data: res,
+	})
+}
+
+// RevokeSession 踢掉某个设备
+func (u *UserHandler) RevokeSession(ctx *gin.Context) {
+	type Req struct {
+		Ssid string `json:"ssid"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		u.l.Error("系统错误", logger.Field{Key: "接收参数出错, err", Value: err})
+		return
+	}
+	claims, ok := ctx.MustGet("claims").(*ijwt.UserClaims)
+	if !ok {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("设置claims失败")
+		return
+	}
+	err := u.Handler.RevokeSession(ctx, claims.Id, req.Ssid)
+	if err == ijwt.ErrSessionNotFound {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "设备不存在或者已经下线",
+		})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("踢下线失败", logger.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Msg: "已下线",
+	})
+}
+
+// RevokeOtherSessions 除了当前设备，其他设备全部下线
+func (u *UserHandler) RevokeOtherSessions(ctx *gin.Context) {
+	claims, ok := ctx.MustGet("claims").(*ijwt.UserClaims)
+	if !ok {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("设置claims失败")
+		return
+	}
+	err := u.Handler.RevokeOtherSessions(ctx, claims.Id, claims.Ssid)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("其他设备下线失败", logger.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Msg: "其他设备已下线",
+	})
+}
+
 func (u *UserHandler) LoginSMS(ctx *gin.Context) {
 	type Req struct {
 		Phone string `json:"phone"`
@@ -147,6 +350,21 @@ func (u *UserHandler) LoginSMS(ctx *gin.Context) {
 
 	// 我这个手机号会不会是一个新用户呢
 	user, err := u.svc.FindOrCreate(ctx, req.Phone)
+	if err == service.ErrUserBanned {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "账号已被封禁",
+		})
+		return
+	}
+	if err == service.ErrDegraded {
+		// 降级的时候新用户不能注册
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统繁忙，请稍后再试",
+		})
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusOK, Result{
 			Code: 5,
@@ -155,8 +373,12 @@ func (u *UserHandler) LoginSMS(ctx *gin.Context) {
 		u.l.Error("用户登录/注册失败", logger.Field{Key: "err", Value: err})
 		return
 	}
+	// 验证码登录也不能绕过两步验证
+	if !u.passTOTP(ctx, user.Id) {
+		return
+	}
 
-	if err = u.SetLoginToken(ctx, user.Id); err != nil {
+	if err = u.SetLoginToken(ctx, user.Id, user.RoleNames()); err != nil {
 		ctx.JSON(http.StatusOK, Result{
 			Code: 5,
 			Msg:  "系统错误",
@@ -171,9 +393,314 @@ func (u *UserHandler) LoginSMS(ctx *gin.Context) {
 	})
 }
 
+func (u *UserHandler) LoginEmail(ctx *gin.Context) {
+	type Req struct {
+		Email string `json:"email"`
+		Code  string `json:"code"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		u.l.Error("系统错误", logger.Field{Key: "接收参数出错, err", Value: err})
+		return
+	}
+	ok, err := u.emailCodeSvc.Verify(ctx, bizLoginEmail, req.Email, req.Code)
+	if err == service.ErrCodeVerifyTooManyTimes {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "验证码已失效，请重新获取",
+		})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		// 邮箱也是敏感数据，不要打到日志里面
+		u.l.Error("校验邮箱验证码出错", logger.Error(err))
+		return
+	}
+	if !ok {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "验证码有误",
+		})
+		return
+	}
+
+	user, err := u.svc.FindOrCreateByEmail(ctx, req.Email)
+	if err == service.ErrUserBanned {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "账号已被封禁",
+		})
+		return
+	}
+	if err == service.ErrDegraded {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统繁忙，请稍后再试",
+		})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("邮箱登录/注册失败", logger.Error(err))
+		return
+	}
+	if !u.passTOTP(ctx, user.Id) {
+		return
+	}
+
+	if err = u.SetLoginToken(ctx, user.Id, user.RoleNames()); err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("获取登录信息错误", logger.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Msg: "登录成功",
+	})
+}
+
+func (u *UserHandler) SendLoginEmailCode(ctx *gin.Context) {
+	type Req struct {
+		Email string `json:"email"`
+		// Captcha 图形验证码的票据，触发了图形验证码的要求之后才需要传
+		Captcha string `json:"captcha"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		u.l.Error("系统错误", logger.Field{Key: "接收参数出错, err", Value: err})
+		return
+	}
+	ok, err := u.emailExp.MatchString(req.Email)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("系统错误", logger.Field{Key: "邮箱正则表达式出错, err", Value: err})
+		return
+	}
+	if !ok {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "邮箱格式不正确",
+		})
+		return
+	}
+	meta, ok := u.codeSendMeta(ctx, req.Captcha)
+	if !ok {
+		return
+	}
+	err = u.emailCodeSvc.Send(ctx, bizLoginEmail, req.Email, meta)
+	if err != nil {
+		u.codeSendFailed(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Msg: "发送成功",
+	})
+}
+
+// SendResetPasswordCode 忘记密码的时候发送验证码，邮箱和手机号二选一
+func (u *UserHandler) SendResetPasswordCode(ctx *gin.Context) {
+	type Req struct {
+		Email   string `json:"email"`
+		Phone   string `json:"phone"`
+		Captcha string `json:"captcha"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		u.l.Error("系统错误", logger.Field{Key: "接收参数出错, err", Value: err})
+		return
+	}
+	codeSvc, bizName, target, ok := u.resetPasswordChannel(ctx, req.Email, req.Phone)
+	if !ok {
+		return
+	}
+	meta, ok := u.codeSendMeta(ctx, req.Captcha)
+	if !ok {
+		return
+	}
+	// 不管账号存不存在都发，避免被用来探测有没有注册
+	err := codeSvc.Send(ctx, bizName, target, meta)
+	if err != nil {
+		u.codeSendFailed(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Msg: "发送成功",
+	})
+}
+
+// ResetPassword 校验验证码之后重置密码，并且让所有的登录态都失效
+func (u *UserHandler) ResetPassword(ctx *gin.Context) {
+	type Req struct {
+		Email           string `json:"email"`
+		Phone           string `json:"phone"`
+		Code            string `json:"code"`
+		Password        string `json:"password"`
+		ConfirmPassword string `json:"confirmPassword"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		u.l.Error("系统错误", logger.Field{Key: "接收参数出错, err", Value: err})
+		return
+	}
+	codeSvc, bizName, target, ok := u.resetPasswordChannel(ctx, req.Email, req.Phone)
+	if !ok {
+		return
+	}
+	ok, err := u.passwordExp.MatchString(req.Password)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("系统错误", logger.Field{Key: "密码正则表达式出错, err", Value: err})
+		return
+	}
+	if !ok {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "密码必须大于8位，包含数字、英文字母、特殊字符",
+		})
+		return
+	}
+	if req.ConfirmPassword != req.Password {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "两次输入的密码不一致",
+		})
+		return
+	}
+	// 先校验完密码格式再校验验证码，不然密码格式不对也会浪费一次验证机会
+	ok, err = codeSvc.Verify(ctx, bizName, target, req.Code)
+	if err == service.ErrCodeVerifyTooManyTimes {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "验证码已失效，请重新获取",
+		})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("校验重置密码验证码出错", logger.Error(err))
+		return
+	}
+	if !ok {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "验证码有误",
+		})
+		return
+	}
+
+	var user domain.User
+	if req.Email != "" {
+		user, err = u.svc.ResetPasswordByEmail(ctx, target, req.Password)
+	} else {
+		user, err = u.svc.ResetPasswordByPhone(ctx, target, req.Password)
+	}
+	if err == service.ErrUserNotFound {
+		// 和验证码错误的返回一样，不然能用来探测这个邮箱、手机号有没有注册过
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "验证码有误",
+		})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("重置密码失败", logger.Error(err))
+		return
+	}
+	// 能重置密码说明是本人，顺便解锁
+	if err = u.loginLimitSvc.Reset(ctx, user.Email); err != nil {
+		u.l.Warn("重置密码之后解锁失败", logger.Error(err), logger.Int64("uid", user.Id))
+	}
+	// 密码已经改了，旧的登录态都不能再用
+	if err = u.ClearUserSessions(ctx, user.Id); err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "密码已经重置，但是退出其他设备失败，请稍候重试",
+		})
+		u.l.Error("重置密码之后清除登录态失败", logger.Error(err),
+			logger.Int64("uid", user.Id))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Msg: "密码重置成功，请重新登录",
+	})
+}
+
+// resetPasswordChannel 根据传了邮箱还是手机号，选择对应的验证码渠道
+// 返回 false 的时候，已经写回了响应
+func (u *UserHandler) resetPasswordChannel(ctx *gin.Context,
+	email, phone string) (service.CodeService, string, string, bool) {
+	if email != "" {
+		ok, err := u.emailExp.MatchString(email)
+		if err != nil {
+			ctx.JSON(http.StatusOK, Result{
+				Code: 5,
+				Msg:  "系统错误",
+			})
+			u.l.Error("系统错误", logger.Field{Key: "邮箱正则表达式出错, err", Value: err})
+			return nil, "", "", false
+		}
+		if !ok {
+			ctx.JSON(http.StatusOK, Result{
+				Code: 4,
+				Msg:  "邮箱格式不正确",
+			})
+			return nil, "", "", false
+		}
+		return u.emailCodeSvc, bizResetPasswordEmail, email, true
+	}
+	if phone == "" {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "请输入邮箱或手机号",
+		})
+		return nil, "", "", false
+	}
+	ok, err := u.phoneExp.MatchString(phone)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("系统错误", logger.Field{Key: "手机号正则表达式出错, err", Value: err})
+		return nil, "", "", false
+	}
+	if !ok {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "手机号格式不正确",
+		})
+		return nil, "", "", false
+	}
+	return u.codeSvc, bizResetPassword, phone, true
+}
+
 func (u *UserHandler) SendLoginSMSCode(ctx *gin.Context) {
 	type Req struct {
 		Phone string `json:"phone"`
+		// Captcha 图形验证码的票据，触发了图形验证码的要求之后才需要传
+		Captcha string `json:"captcha"`
 	}
 	var req Req
 	if err := ctx.Bind(&req); err != nil {
@@ -190,24 +717,102 @@ func (u *UserHandler) SendLoginSMSCode(ctx *gin.Context) {
 		u.l.Error("输入邮箱或手机号有误", logger.Field{Key: "输入有误", Value: req.Phone})
 		return
 	}
-	err := u.codeSvc.Send(ctx, biz, req.Phone)
-	switch err {
-	case nil:
+	meta, ok := u.codeSendMeta(ctx, req.Captcha)
+	if !ok {
+		return
+	}
+	err := u.codeSvc.Send(ctx, biz, req.Phone, meta)
+	if err != nil {
+		u.codeSendFailed(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Msg: "发送成功",
+	})
+}
+
+// codeSendMeta 收集发送验证码的请求来源，有图形验证码票据的话顺便校验掉
+// 返回 false 的时候，已经写回了响应
+func (u *UserHandler) codeSendMeta(ctx *gin.Context, captchaTicket string) (domain.CodeSendMeta, bool) {
+	meta := domain.CodeSendMeta{
+		IP:     ctx.ClientIP(),
+		Device: ctx.GetHeader("X-Device-Id"),
+	}
+	if captchaTicket == "" {
+		return meta, true
+	}
+	ok, err := u.captchaSvc.Verify(ctx, captchaTicket, meta.IP)
+	if err != nil {
 		ctx.JSON(http.StatusOK, Result{
-			Msg: "发送成功",
+			Code: 5,
+			Msg:  "系统错误",
 		})
+		u.l.Error("校验图形验证码失败", logger.Error(err))
+		return meta, false
+	}
+	if !ok {
+		ctx.JSON(http.StatusOK, Result{
+			Code: codeCaptchaIncorrect,
+			Msg:  "图形验证码有误",
+		})
+		return meta, false
+	}
+	meta.CaptchaPassed = true
+	return meta, true
+}
+
+// codeSendFailed 把发送验证码的错误翻译成对应的业务错误码
+func (u *UserHandler) codeSendFailed(ctx *gin.Context, err error) {
+	switch err {
 	case service.ErrCodeSendTooMany:
 		//zap.L().Error("发送太频繁", zap.Error(err))
 		u.l.Error("发送太频繁", logger.Field{Key: "err", Value: err})
 		ctx.JSON(http.StatusOK, Result{
-			Msg: "发送太频繁，请稍候重试",
+			Code: codeSendTooFrequent,
+			Msg:  "发送太频繁，请稍候重试",
+		})
+	case service.ErrCodePhoneHourLimit:
+		u.l.Warn("手机号每小时发送次数超限", logger.Error(err))
+		ctx.JSON(http.StatusOK, Result{
+			Code: codeSendPhoneHour,
+			Msg:  "发送次数太多，请一小时后重试",
+		})
+	case service.ErrCodePhoneDayLimit:
+		u.l.Warn("手机号每天发送次数超限", logger.Error(err))
+		ctx.JSON(http.StatusOK, Result{
+			Code: codeSendPhoneDay,
+			Msg:  "今天发送次数太多，请明天再试",
+		})
+	case service.ErrCodeIPLimit:
+		u.l.Warn("IP 发送次数超限", logger.String("ip", ctx.ClientIP()))
+		ctx.JSON(http.StatusOK, Result{
+			Code: codeSendIPLimit,
+			Msg:  "当前网络发送次数太多，请稍候重试",
+		})
+	case service.ErrCodeDeviceLimit:
+		u.l.Warn("设备发送次数超限", logger.Error(err))
+		ctx.JSON(http.StatusOK, Result{
+			Code: codeSendDeviceLimit,
+			Msg:  "当前设备发送次数太多，请稍候重试",
+		})
+	case service.ErrCodeBizLimit:
+		// 全局限制都触发了，要么是业务量暴涨，要么是有人在刷，都要告警
+		u.l.Error("验证码发送触发全局限制", logger.Error(err))
+		ctx.JSON(http.StatusOK, Result{
+			Code: codeSendBizLimit,
+			Msg:  "系统繁忙，请稍候重试",
+		})
+	case service.ErrCodeCaptchaRequired:
+		ctx.JSON(http.StatusOK, Result{
+			Code: codeCaptchaRequired,
+			Msg:  "请先完成图形验证码",
 		})
 	default:
 		ctx.JSON(http.StatusOK, Result{
 			Code: 5,
 			Msg:  "系统错误",
 		})
-		u.l.Error("系统错误", logger.Field{Key: "发送短信失败", Value: err})
+		u.l.Error("系统错误", logger.Field{Key: "发送验证码失败", Value: err})
 	}
 }
 
@@ -268,8 +873,81 @@ func (u *UserHandler) SignUp(ctx *gin.Context) {
 		u.l.Error("系统异常", logger.Field{Key: "注册异常, err", Value: err})
 		return
 	}
-	ctx.String(http.StatusOK, "注册成功")
-	fmt.Printf("%v", req)
+	// 注册成功了，发送激活邮件失败也不影响，用户可以重新发送
+	meta, _ := u.codeSendMeta(ctx, "")
+	err = u.activationSvc.Send(ctx, req.Email, meta)
+	if err != nil {
+		ctx.String(http.StatusOK, "注册成功，激活邮件发送失败，请稍候重新发送")
+		u.l.Error("发送激活邮件失败", logger.Error(err))
+		return
+	}
+	ctx.String(http.StatusOK, "注册成功，请到邮箱点击激活链接")
+}
+
+// Activate 用户点击激活邮件里面的链接
+func (u *UserHandler) Activate(ctx *gin.Context) {
+	token := ctx.Query("token")
+	err := u.activationSvc.Activate(ctx, token)
+	if err == service.ErrInvalidActivationToken {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "激活链接无效或者已经过期，请重新发送",
+		})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("激活账号失败", logger.Error(err))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Msg: "激活成功",
+	})
+}
+
+// ResendActivation 重新发送激活邮件，和发送验证码一样有发送限制
+func (u *UserHandler) ResendActivation(ctx *gin.Context) {
+	type Req struct {
+		Email   string `json:"email"`
+		Captcha string `json:"captcha"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		u.l.Error("系统错误", logger.Field{Key: "接收参数出错, err", Value: err})
+		return
+	}
+	ok, err := u.emailExp.MatchString(req.Email)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("系统错误", logger.Field{Key: "邮箱正则表达式出错, err", Value: err})
+		return
+	}
+	if !ok {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "邮箱格式不正确",
+		})
+		return
+	}
+	meta, ok := u.codeSendMeta(ctx, req.Captcha)
+	if !ok {
+		return
+	}
+	err = u.activationSvc.Send(ctx, req.Email, meta)
+	if err != nil {
+		u.codeSendFailed(ctx, err)
+		return
+	}
+	// 不管邮箱有没有注册，都返回发送成功
+	ctx.JSON(http.StatusOK, Result{
+		Msg: "发送成功",
+	})
 }
 
 func (u *UserHandler) LoginJWT(ctx *gin.Context) {
@@ -282,10 +960,23 @@ func (u *UserHandler) LoginJWT(ctx *gin.Context) {
 		u.l.Error("系统错误", logger.Field{Key: "接收参数出错, err", Value: err})
 		return
 	}
+	if !u.checkLoginLimit(ctx, req.Email) {
+		return
+	}
 	user, err := u.svc.Login(ctx, req.Email, req.Password)
 	if err == service.ErrInvalidUserOrPassword {
-		ctx.String(http.StatusOK, "用户名或密码不对")
-		u.l.Debug("用户名或密码不对")
+		u.loginFailed(ctx, req.Email)
+		return
+	}
+	if err == service.ErrUserNotActivated {
+		// 密码是对的，不算失败
+		u.loginSucceeded(ctx, req.Email)
+		ctx.String(http.StatusOK, "账号未激活，请先到邮箱点击激活链接")
+		return
+	}
+	if err == service.ErrUserBanned {
+		u.loginSucceeded(ctx, req.Email)
+		ctx.String(http.StatusOK, "账号已被封禁")
 		return
 	}
 	if err != nil {
@@ -293,15 +984,26 @@ func (u *UserHandler) LoginJWT(ctx *gin.Context) {
 		u.l.Error("系统错误", logger.Field{Key: "登录失败, err", Value: err})
 		return
 	}
+	u.loginSucceeded(ctx, req.Email)
+	// 开启了两步验证的，先不登录，验证码校验通过之后再发 token
+	enabled, err := u.totpSvc.Enabled(ctx, user.Id)
+	if err != nil {
+		ctx.String(http.StatusOK, "系统错误")
+		u.l.Error("查询两步验证失败", logger.Error(err), logger.Int64("uid", user.Id))
+		return
+	}
+	if enabled {
+		u.totpChallenge(ctx, user.Id)
+		return
+	}
 
-	if err = u.SetLoginToken(ctx, user.Id); err != nil {
+	if err = u.SetLoginToken(ctx, user.Id, user.RoleNames()); err != nil {
 		ctx.String(http.StatusOK, "系统错误")
 		u.l.Error("系统错误", logger.Field{Key: "设置登录鉴权信息失败, err", Value: err})
 		return
 	}
 
 	ctx.String(http.StatusOK, "登录成功")
-	fmt.Println(user)
 	return
 }
 
@@ -321,6 +1023,10 @@ func (u *UserHandler) Login(ctx *gin.Context) {
 		u.l.Debug("用户名或密码不对")
 		return
 	}
+	if err == service.ErrUserBanned {
+		ctx.String(http.StatusOK, "账号已被封禁")
+		return
+	}
 	if err != nil {
 		ctx.String(http.StatusOK, "系统错误")
 		u.l.Error("系统错误", logger.Field{Key: "登录失败, err", Value: err})
@@ -344,7 +1050,6 @@ func (u *UserHandler) Login(ctx *gin.Context) {
 	sess.Save()
 
 	ctx.String(http.StatusOK, "登录成功")
-	fmt.Println(user)
 	return
 }
 
@@ -392,49 +1097,7 @@ func (u *UserHandler) EditJWT(ctx *gin.Context) {
 		u.l.Error("设置claims失败")
 		return
 	}
-	type EditReq struct {
-		Nickname string `json:"nickname"`
-		Birthday string `json:"birthday"`
-		AboutMe  string `json:"aboutMe"`
-	}
-	var req EditReq
-	if err := ctx.Bind(&req); err != nil {
-		u.l.Error("系统错误", logger.Field{Key: "接收参数出错, err", Value: err})
-		return
-	}
-	// 校验生日
-	ok, err := u.BirthdayExp.MatchString(req.Birthday)
-	if err != nil {
-		ctx.String(http.StatusOK, "系统错误")
-		u.l.Error("系统错误", logger.Field{Key: "生日正则表达式出错, err", Value: err})
-		return
-	}
-	if !ok {
-		ctx.String(http.StatusOK, "生日日期格式不对")
-		u.l.Debug("生日日期格式不对", logger.Field{Key: "生日日期格式不对, err", Value: req.Birthday})
-		return
-	}
-	fmt.Println(claims.Id)
-	// 调用一下 svc 的方法
-	user, err := u.svc.Edit(ctx, claims.Id, req.Nickname, req.Birthday, req.AboutMe)
-	if err != nil {
-		ctx.String(http.StatusOK, "系统异常")
-		u.l.Error("系统错误", logger.Field{Key: "调用编辑方法出错, err", Value: err})
-		return
-	}
-	if len(req.Nickname) > 24 {
-		ctx.String(http.StatusOK, "昵称过长")
-		u.l.Debug("昵称过长", logger.Field{Key: "昵称过长, err", Value: req.Nickname})
-		return
-	}
-	if len(req.AboutMe) > 1024 {
-		ctx.String(http.StatusOK, "个人简介过长")
-		u.l.Debug("个人简介过长", logger.Field{Key: "个人简介过长, err", Value: req.AboutMe})
-		return
-	}
-	ctx.String(http.StatusOK, "提交成功")
-	fmt.Printf("%v", user)
-	fmt.Printf("%v", req)
+	u.editProfile(ctx, claims.Id)
 }
 
 func (u *UserHandler) Edit(ctx *gin.Context) {
@@ -446,58 +1109,90 @@ func (u *UserHandler) Edit(ctx *gin.Context) {
 		ctx.AbortWithStatus(http.StatusUnauthorized)
 		return
 	}
+	u.editProfile(ctx, id)
+}
+
+// editProfile 没有传的字段不修改，传了空字符串代表清空
+func (u *UserHandler) editProfile(ctx *gin.Context, uid int64) {
 	type EditReq struct {
-		Nickname string `json:"nickname"`
-		Birthday string `json:"birthday"`
-		AboutMe  string `json:"aboutMe"`
+		Nickname *string `json:"nickname"`
+		// Birthday 2006-01-02 格式
+		Birthday *string `json:"birthday"`
+		AboutMe  *string `json:"aboutMe"`
+		Avatar   *string `json:"avatar"`
 	}
 	var req EditReq
 	if err := ctx.Bind(&req); err != nil {
 		u.l.Error("系统错误", logger.Field{Key: "接收参数出错, err", Value: err})
 		return
 	}
-	// 校验生日
-	ok, err := u.BirthdayExp.MatchString(req.Birthday)
-	if err != nil {
-		ctx.String(http.StatusOK, "系统错误")
-		u.l.Error("系统错误", logger.Field{Key: "生日正则表达式出错, err", Value: err})
-		return
+	upd := domain.ProfileUpdate{
+		Nickname: req.Nickname,
+		AboutMe:  req.AboutMe,
+		Avatar:   req.Avatar,
 	}
-	if !ok {
-		ctx.String(http.StatusOK, "生日日期格式不对")
-		u.l.Debug("生日日期格式不对", logger.Field{Key: "生日日期格式不对, err", Value: req.Birthday})
-		return
+	if req.Birthday != nil {
+		var birthday time.Time
+		if *req.Birthday != "" {
+			var err error
+			birthday, err = time.Parse(time.DateOnly, *req.Birthday)
+			if err != nil {
+				ctx.JSON(http.StatusOK, Result{
+					Code: 4,
+					Msg:  "生日日期格式不对",
+				})
+				return
+			}
+		}
+		upd.Birthday = &birthday
 	}
-	// 调用一下 svc 的方法
-	user, err := u.svc.Edit(ctx, id, req.Nickname, req.Birthday, req.AboutMe)
-	if err != nil {
-		ctx.String(http.StatusOK, "系统异常")
-		u.l.Error("系统错误", logger.Field{Key: "调用编辑方法出错, err", Value: err})
-		return
+	user, err := u.svc.UpdateProfile(ctx, uid, upd)
+	switch err {
+	case nil:
+		ctx.JSON(http.StatusOK, Result{
+			Msg:  "提交成功",
+			Data: newProfileVO(user),
+		})
+	case service.ErrNicknameTooLong, service.ErrAboutMeTooLong,
+		service.ErrInvalidBirthday, service.ErrInvalidAvatar:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  err.Error(),
+		})
+	default:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统异常",
+		})
+		u.l.Error("修改个人资料失败", logger.Error(err), logger.Int64("uid", uid))
 	}
-	if len(req.Nickname) > 24 {
-		ctx.String(http.StatusOK, "昵称过长")
-		u.l.Debug("昵称过长", logger.Field{Key: "昵称过长, err", Value: req.Nickname})
-		return
+}
+
+// ProfileVO 个人资料，字段名和以前保持一致，没有加 json tag
+type ProfileVO struct {
+	Email    string
+	Nickname string
+	// Birthday 2006-01-02 格式，没有填就是空字符串
+	Birthday string
+	AboutMe  string
+	Avatar   string
+}
+
+func newProfileVO(user domain.User) ProfileVO {
+	vo := ProfileVO{
+		Email:    user.Email,
+		Nickname: user.Nickname,
+		AboutMe:  user.AboutMe,
+		Avatar:   user.Avatar,
 	}
-	if len(req.AboutMe) > 1024 {
-		ctx.String(http.StatusOK, "个人简介过长")
-		u.l.Debug("个人简介过长", logger.Field{Key: "个人简介过长, err", Value: req.AboutMe})
-		return
+	if !user.Birthday.IsZero() {
+		vo.Birthday = user.Birthday.Format(time.DateOnly)
 	}
-	ctx.String(http.StatusOK, "提交成功")
-	fmt.Printf("%v", user)
-	fmt.Printf("%v", req)
+	return vo
 }
 
 func (u *UserHandler) ProfileJWT(ctx *gin.Context) {
-	c, ok := ctx.Get("claims")
-	// 你可以断定，必然有 claims
-	//if !ok {
-	//	// 你可以考虑监控住这里
-	//	ctx.String(http.StatusOK, "系统错误")
-	//	return
-	//}
+	c, _ := ctx.Get("claims")
 	// ok 代表是不是 *UserClaims
 	claims, ok := c.(*ijwt.UserClaims) // 断言 c 是不是 UserClaims 的指针，如果不是就会 panic
 	if !ok {
@@ -506,13 +1201,12 @@ func (u *UserHandler) ProfileJWT(ctx *gin.Context) {
 		u.l.Error("设置claims失败")
 		return
 	}
-	type Profile struct {
-		Email    string
-		Nickname string
-		Birthday string
-		AboutMe  string
-	}
 	user, err := u.svc.Profile(ctx, claims.Id)
+	if err == service.ErrDegraded {
+		ctx.String(http.StatusOK, "系统繁忙，请稍后再试")
+		u.l.Warn("查询用户信息被降级", logger.Int64("uid", claims.Id))
+		return
+	}
 	if err != nil {
 		// 按照道理来说，这边 id 对应的数据肯定存在，所以要是没找到，
 		// 那就说明是系统出了问题。
@@ -520,23 +1214,12 @@ func (u *UserHandler) ProfileJWT(ctx *gin.Context) {
 		u.l.Error("系统错误", logger.Field{Key: "claims.Id 没找到", Value: err})
 		return
 	}
-	ctx.JSON(http.StatusOK, Profile{
-		Email:    user.Email,
-		Nickname: user.Nickname,
-		Birthday: user.Birthday,
-		AboutMe:  user.AboutMe,
-	})
+	ctx.JSON(http.StatusOK, newProfileVO(user))
 }
 
 func (u *UserHandler) Profile(ctx *gin.Context) {
 	sess := sessions.Default(ctx)
 	id := sess.Get("userId").(int64)
-	type Profile struct {
-		Email    string
-		Nickname string
-		Birthday string
-		AboutMe  string
-	}
 	user, err := u.svc.Profile(ctx, id)
 	if err != nil {
 		// 按照道理来说，这边 id 对应的数据肯定存在，所以要是没找到，
@@ -545,10 +1228,5 @@ func (u *UserHandler) Profile(ctx *gin.Context) {
 		u.l.Error("系统错误", logger.Field{Key: "claims.Id 没找到", Value: err})
 		return
 	}
-	ctx.JSON(http.StatusOK, Profile{
-		Email:    user.Email,
-		Nickname: user.Nickname,
-		Birthday: user.Birthday,
-		AboutMe:  user.AboutMe,
-	})
+	ctx.JSON(http.StatusOK, newProfileVO(user))
 }
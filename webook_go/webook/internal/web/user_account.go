@@ -0,0 +1,184 @@
+package web
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/service"
+	"webook_go/webook/pkg/logger"
+)
+
+// RequestDeletion 申请注销，冷静期里面重新登录之后可以撤销
+// 申请成功之后所有设备都会下线
+func (u *UserHandler) RequestDeletion(ctx *gin.Context) {
+	type Req struct {
+		// Password 设置了密码的账号要再输一次密码
+		Password string `json:"password"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	claims, ok := u.linkClaims(ctx)
+	if !ok {
+		return
+	}
+	deleteAt, err := u.accountSvc.RequestDeletion(ctx, claims.Id, req.Password)
+	switch err {
+	case nil:
+	case service.ErrInvalidUserOrPassword:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "密码不对",
+		})
+		return
+	case service.ErrDeletionRequested:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "已经申请注销了",
+			Data: map[string]any{"deleteAt": deleteAt.UnixMilli()},
+		})
+		return
+	case service.ErrAccountNotActive:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "账号当前状态不能注销",
+		})
+		return
+	default:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("申请注销失败", logger.Error(err), logger.Int64("uid", claims.Id))
+		return
+	}
+	if err = u.ClearUserSessions(ctx, claims.Id); err != nil {
+		// 冷静期结束的时候还会再清一次
+		u.l.Error("清除申请注销账号的登录态失败", logger.Error(err), logger.Int64("uid", claims.Id))
+	}
+	_ = u.ClearToken(ctx)
+	ctx.JSON(http.StatusOK, Result{
+		Msg:  "已申请注销，在此之前重新登录可以撤销",
+		Data: map[string]any{"deleteAt": deleteAt.UnixMilli()},
+	})
+}
+
+// CancelDeletion 冷静期里面撤销注销
+func (u *UserHandler) CancelDeletion(ctx *gin.Context) {
+	claims, ok := u.linkClaims(ctx)
+	if !ok {
+		return
+	}
+	err := u.accountSvc.CancelDeletion(ctx, claims.Id)
+	switch err {
+	case nil:
+		ctx.JSON(http.StatusOK, Result{
+			Msg: "已撤销注销",
+		})
+	case service.ErrDeletionNotRequested:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "没有申请注销",
+		})
+	default:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("撤销注销失败", logger.Error(err), logger.Int64("uid", claims.Id))
+	}
+}
+
+// Export 以 JSON 文件的形式下载个人数据
+func (u *UserHandler) Export(ctx *gin.Context) {
+	claims, ok := u.linkClaims(ctx)
+	if !ok {
+		return
+	}
+	data, err := u.accountSvc.Export(ctx, claims.Id)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("导出个人数据失败", logger.Error(err), logger.Int64("uid", claims.Id))
+		return
+	}
+	ctx.Header("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="webook-%d-%s.json"`, claims.Id, data.ExportedAt.Format("20060102")))
+	ctx.JSON(http.StatusOK, newAccountExportVO(data))
+}
+
+type AccountExportVO struct {
+	Profile    ExportProfileVO    `json:"profile"`
+	Identities []ExportIdentityVO `json:"identities"`
+	Articles   []ExportArticleVO  `json:"articles"`
+	ExportedAt string             `json:"exportedAt"`
+}
+
+type ExportProfileVO struct {
+	Id       int64  `json:"id"`
+	Email    string `json:"email"`
+	Phone    string `json:"phone"`
+	Nickname string `json:"nickname"`
+	Birthday string `json:"birthday"`
+	AboutMe  string `json:"aboutMe"`
+	Avatar   string `json:"avatar"`
+	// DeleteAt 申请了注销才有
+	DeleteAt string `json:"deleteAt,omitempty"`
+	Ctime    string `json:"ctime"`
+}
+
+type ExportIdentityVO struct {
+	Provider string `json:"provider"`
+	Subject  string `json:"subject"`
+	UnionID  string `json:"unionId,omitempty"`
+}
+
+type ExportArticleVO struct {
+	Id      int64  `json:"id"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	Status  string `json:"status"`
+}
+
+func newAccountExportVO(data domain.AccountExport) AccountExportVO {
+	profile := newProfileVO(data.User)
+	res := AccountExportVO{
+		Profile: ExportProfileVO{
+			Id:       data.User.Id,
+			Email:    profile.Email,
+			Phone:    data.User.Phone,
+			Nickname: profile.Nickname,
+			Birthday: profile.Birthday,
+			AboutMe:  profile.AboutMe,
+			Avatar:   profile.Avatar,
+			Ctime:    data.User.Ctime.Format(time.RFC3339),
+		},
+		Identities: make([]ExportIdentityVO, 0, len(data.Identities)),
+		Articles:   make([]ExportArticleVO, 0, len(data.Articles)),
+		ExportedAt: data.ExportedAt.Format(time.RFC3339),
+	}
+	if !data.User.DeleteAt.IsZero() {
+		res.Profile.DeleteAt = data.User.DeleteAt.Format(time.RFC3339)
+	}
+	for _, i := range data.Identities {
+		res.Identities = append(res.Identities, ExportIdentityVO{
+			Provider: i.Provider,
+			Subject:  i.Subject,
+			UnionID:  i.UnionID,
+		})
+	}
+	for _, art := range data.Articles {
+		res.Articles = append(res.Articles, ExportArticleVO{
+			Id:      art.Id,
+			Title:   art.Title,
+			Content: art.Content,
+			Status:  art.Status.String(),
+		})
+	}
+	return res
+}
@@ -0,0 +1,100 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"webook_go/webook/internal/domain"
+	"webook_go/webook/internal/service"
+	svcmocks "webook_go/webook/internal/service/mocks"
+	"webook_go/webook/pkg/logger"
+)
+
+func TestUserHandler_SendLoginSMSCode(t *testing.T) {
+	testCases := []struct {
+		name    string
+		sendErr error
+
+		wantRes Result
+	}{
+		{
+			name:    "发送成功",
+			wantRes: Result{Msg: "发送成功"},
+		},
+		{
+			name:    "发送太频繁",
+			sendErr: service.ErrCodeSendTooMany,
+			wantRes: Result{Code: codeSendTooFrequent, Msg: "发送太频繁，请稍候重试"},
+		},
+		{
+			name:    "手机号每小时超限",
+			sendErr: service.ErrCodePhoneHourLimit,
+			wantRes: Result{Code: codeSendPhoneHour, Msg: "发送次数太多，请一小时后重试"},
+		},
+		{
+			name:    "手机号每天超限",
+			sendErr: service.ErrCodePhoneDayLimit,
+			wantRes: Result{Code: codeSendPhoneDay, Msg: "今天发送次数太多，请明天再试"},
+		},
+		{
+			name:    "IP 超限",
+			sendErr: service.ErrCodeIPLimit,
+			wantRes: Result{Code: codeSendIPLimit, Msg: "当前网络发送次数太多，请稍候重试"},
+		},
+		{
+			name:    "设备超限",
+			sendErr: service.ErrCodeDeviceLimit,
+			wantRes: Result{Code: codeSendDeviceLimit, Msg: "当前设备发送次数太多，请稍候重试"},
+		},
+		{
+			name:    "全局限制",
+			sendErr: service.ErrCodeBizLimit,
+			wantRes: Result{Code: codeSendBizLimit, Msg: "系统繁忙，请稍候重试"},
+		},
+		{
+			name:    "要先过图形验证码",
+			sendErr: service.ErrCodeCaptchaRequired,
+			wantRes: Result{Code: codeCaptchaRequired, Msg: "请先完成图形验证码"},
+		},
+		{
+			name:    "系统错误",
+			sendErr: errors.New("redis 错误"),
+			wantRes: Result{Code: 5, Msg: "系统错误"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			codeSvc := svcmocks.NewMockCodeService(ctrl)
+			codeSvc.EXPECT().Send(gomock.Any(), biz, "15212345678", domain.CodeSendMeta{
+				IP:     "192.0.2.1",
+				Device: "device-1",
+			}).Return(tc.sendErr)
+			h := NewUserHandler(nil, codeSvc, nil, nil, nil, nil, nil, nil, nil, nil, &logger.NopLogger{})
+			server := gin.New()
+			h.RegisterRoutes(server)
+
+			req, err := http.NewRequest(http.MethodPost, "/users/login_sms/code/send",
+				bytes.NewBufferString(`{"phone":"15212345678"}`))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Device-Id", "device-1")
+			req.RemoteAddr = "192.0.2.1:1234"
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusOK, resp.Code)
+			var res Result
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+			assert.Equal(t, tc.wantRes, res)
+		})
+	}
+}
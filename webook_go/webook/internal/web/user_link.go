@@ -0,0 +1,287 @@
+package web
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"webook_go/webook/internal/service"
+	ijwt "webook_go/webook/internal/web/jwt"
+	"webook_go/webook/pkg/logger"
+)
+
+// Links 当前账号绑定了哪些登录方式
+func (u *UserHandler) Links(ctx *gin.Context) {
+	claims, ok := u.linkClaims(ctx)
+	if !ok {
+		return
+	}
+	links, err := u.linkSvc.Links(ctx, claims.Id)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("查询绑定信息失败", logger.Error(err), logger.Int64("uid", claims.Id))
+		return
+	}
+	providers := links.Providers
+	if providers == nil {
+		providers = []string{}
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Data: map[string]any{
+			"phone":     links.Phone,
+			"email":     links.Email,
+			"providers": providers,
+		},
+	})
+}
+
+// SendBindPhoneCode 绑定手机号之前先发验证码，证明手机号是自己的
+func (u *UserHandler) SendBindPhoneCode(ctx *gin.Context) {
+	type Req struct {
+		Phone   string `json:"phone"`
+		Captcha string `json:"captcha"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	if req.Phone == "" {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "输入有误",
+		})
+		return
+	}
+	meta, ok := u.codeSendMeta(ctx, req.Captcha)
+	if !ok {
+		return
+	}
+	err := u.codeSvc.Send(ctx, bizBindPhone, req.Phone, meta)
+	if err != nil {
+		u.codeSendFailed(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Msg: "发送成功",
+	})
+}
+
+// BindPhone 已经绑定过手机号的话，就是换绑
+func (u *UserHandler) BindPhone(ctx *gin.Context) {
+	type Req struct {
+		Phone string `json:"phone"`
+		Code  string `json:"code"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	claims, ok := u.linkClaims(ctx)
+	if !ok {
+		return
+	}
+	if !u.verifyBindCode(ctx, u.codeSvc, bizBindPhone, req.Phone, req.Code) {
+		return
+	}
+	ticket, err := u.linkSvc.BindPhone(ctx, claims.Id, req.Phone)
+	bindResult(ctx, u.l, claims.Id, ticket, err)
+}
+
+func (u *UserHandler) SendBindEmailCode(ctx *gin.Context) {
+	type Req struct {
+		Email   string `json:"email"`
+		Captcha string `json:"captcha"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	ok, err := u.emailExp.MatchString(req.Email)
+	if err != nil || !ok {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "邮箱格式不对",
+		})
+		return
+	}
+	meta, ok := u.codeSendMeta(ctx, req.Captcha)
+	if !ok {
+		return
+	}
+	err = u.emailCodeSvc.Send(ctx, bizBindEmail, req.Email, meta)
+	if err != nil {
+		u.codeSendFailed(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Msg: "发送成功",
+	})
+}
+
+func (u *UserHandler) BindEmail(ctx *gin.Context) {
+	type Req struct {
+		Email string `json:"email"`
+		Code  string `json:"code"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	claims, ok := u.linkClaims(ctx)
+	if !ok {
+		return
+	}
+	if !u.verifyBindCode(ctx, u.emailCodeSvc, bizBindEmail, req.Email, req.Code) {
+		return
+	}
+	ticket, err := u.linkSvc.BindEmail(ctx, claims.Id, req.Email)
+	bindResult(ctx, u.l, claims.Id, ticket, err)
+}
+
+// Unbind type 是 phone、email 或者第三方平台的名字，比如 wechat
+func (u *UserHandler) Unbind(ctx *gin.Context) {
+	type Req struct {
+		Type string `json:"type"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	claims, ok := u.linkClaims(ctx)
+	if !ok {
+		return
+	}
+	err := u.linkSvc.Unbind(ctx, claims.Id, req.Type)
+	switch err {
+	case nil:
+		ctx.JSON(http.StatusOK, Result{
+			Msg: "解绑成功",
+		})
+	case service.ErrNotLinked:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "没有绑定",
+		})
+	case service.ErrLastLoginMethod:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "至少要保留一种登录方式",
+		})
+	default:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("解绑失败", logger.Error(err), logger.Int64("uid", claims.Id))
+	}
+}
+
+// Merge 绑定的时候发现冲突，用返回的凭证把另外一个账号合并到当前账号
+// 被合并的账号所有的登录态都会失效
+func (u *UserHandler) Merge(ctx *gin.Context) {
+	type Req struct {
+		Ticket string `json:"ticket"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	claims, ok := u.linkClaims(ctx)
+	if !ok {
+		return
+	}
+	from, err := u.linkSvc.Merge(ctx, claims.Id, req.Ticket)
+	if err == service.ErrMergeTicketInvalid {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "合并凭证已经过期，请重新绑定",
+		})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("合并账号失败", logger.Error(err), logger.Int64("uid", claims.Id))
+		return
+	}
+	if err = u.ClearUserSessions(ctx, from); err != nil {
+		// 已经合并了，登录方式都转过来了，旧的登录态过期之后也就登录不了
+		u.l.Error("清除被合并账号的登录态失败", logger.Error(err), logger.Int64("uid", from))
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Msg: "合并成功",
+	})
+}
+
+func (u *UserHandler) linkClaims(ctx *gin.Context) (*ijwt.UserClaims, bool) {
+	claims, ok := ctx.MustGet("claims").(*ijwt.UserClaims)
+	if !ok {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("设置claims失败")
+	}
+	return claims, ok
+}
+
+// verifyBindCode 返回 false 的时候已经写回了响应
+func (u *UserHandler) verifyBindCode(ctx *gin.Context, codeSvc service.CodeService,
+	biz, target, code string) bool {
+	ok, err := codeSvc.Verify(ctx, biz, target, code)
+	switch err {
+	case nil:
+	case service.ErrCodeVerifyTooManyTimes:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "验证次数太多，请重新发送验证码",
+		})
+		return false
+	default:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("校验绑定验证码失败", logger.Error(err))
+		return false
+	}
+	if !ok {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "验证码有误",
+		})
+	}
+	return ok
+}
+
+// bindResult 绑定手机号、邮箱和第三方账号的结果都是一样处理的
+func bindResult(ctx *gin.Context, l logger.LoggerV1, uid int64, ticket string, err error) {
+	switch err {
+	case nil:
+		ctx.JSON(http.StatusOK, Result{
+			Msg: "绑定成功",
+		})
+	case service.ErrLinkConflict:
+		ctx.JSON(http.StatusOK, Result{
+			Code: codeLinkConflict,
+			Msg:  "已经绑定了另外一个账号，可以把那个账号合并过来",
+			Data: map[string]string{
+				"ticket": ticket,
+			},
+		})
+	case service.ErrAlreadyLinked:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "已经绑定过这个平台的账号了，请先解绑",
+		})
+	default:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		l.Error("绑定失败", logger.Error(err), logger.Int64("uid", uid))
+	}
+}
@@ -0,0 +1,170 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"webook_go/webook/internal/service"
+	svcmocks "webook_go/webook/internal/service/mocks"
+	ijwt "webook_go/webook/internal/web/jwt"
+	jwtmocks "webook_go/webook/internal/web/jwt/mocks"
+	"webook_go/webook/pkg/logger"
+)
+
+func TestUserHandler_BindPhone(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) (service.CodeService, service.LinkService)
+
+		wantRes Result
+	}{
+		{
+			name: "绑定成功",
+			mock: func(ctrl *gomock.Controller) (service.CodeService, service.LinkService) {
+				codeSvc := svcmocks.NewMockCodeService(ctrl)
+				codeSvc.EXPECT().Verify(gomock.Any(), bizBindPhone, "15212345678", "123456").Return(true, nil)
+				linkSvc := svcmocks.NewMockLinkService(ctrl)
+				linkSvc.EXPECT().BindPhone(gomock.Any(), int64(123), "15212345678").Return("", nil)
+				return codeSvc, linkSvc
+			},
+			wantRes: Result{Msg: "绑定成功"},
+		},
+		{
+			name: "验证码不对",
+			mock: func(ctrl *gomock.Controller) (service.CodeService, service.LinkService) {
+				codeSvc := svcmocks.NewMockCodeService(ctrl)
+				codeSvc.EXPECT().Verify(gomock.Any(), bizBindPhone, "15212345678", "123456").Return(false, nil)
+				return codeSvc, svcmocks.NewMockLinkService(ctrl)
+			},
+			wantRes: Result{Code: 4, Msg: "验证码有误"},
+		},
+		{
+			name: "手机号属于另外一个账号，返回合并凭证",
+			mock: func(ctrl *gomock.Controller) (service.CodeService, service.LinkService) {
+				codeSvc := svcmocks.NewMockCodeService(ctrl)
+				codeSvc.EXPECT().Verify(gomock.Any(), bizBindPhone, "15212345678", "123456").Return(true, nil)
+				linkSvc := svcmocks.NewMockLinkService(ctrl)
+				linkSvc.EXPECT().BindPhone(gomock.Any(), int64(123), "15212345678").
+					Return("ticket-1", service.ErrLinkConflict)
+				return codeSvc, linkSvc
+			},
+			wantRes: Result{
+				Code: codeLinkConflict,
+				Msg:  "已经绑定了另外一个账号，可以把那个账号合并过来",
+				Data: map[string]any{"ticket": "ticket-1"},
+			},
+		},
+		{
+			name: "绑定失败",
+			mock: func(ctrl *gomock.Controller) (service.CodeService, service.LinkService) {
+				codeSvc := svcmocks.NewMockCodeService(ctrl)
+				codeSvc.EXPECT().Verify(gomock.Any(), bizBindPhone, "15212345678", "123456").Return(true, nil)
+				linkSvc := svcmocks.NewMockLinkService(ctrl)
+				linkSvc.EXPECT().BindPhone(gomock.Any(), int64(123), "15212345678").
+					Return("", errors.New("数据库错误"))
+				return codeSvc, linkSvc
+			},
+			wantRes: Result{Code: 5, Msg: "系统错误"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			codeSvc, linkSvc := tc.mock(ctrl)
+			h := NewUserHandler(nil, codeSvc, nil, nil, nil, nil, linkSvc, nil, nil, nil, &logger.NopLogger{})
+
+			res := doLinkRequest(t, h, "/users/bind/phone", `{"phone":"15212345678","code":"123456"}`)
+			assert.Equal(t, tc.wantRes, res)
+		})
+	}
+}
+
+func TestUserHandler_Merge(t *testing.T) {
+	testCases := []struct {
+		name string
+		mock func(ctrl *gomock.Controller) (service.LinkService, ijwt.Handler)
+
+		wantRes Result
+	}{
+		{
+			name: "合并成功，被合并的账号下线",
+			mock: func(ctrl *gomock.Controller) (service.LinkService, ijwt.Handler) {
+				linkSvc := svcmocks.NewMockLinkService(ctrl)
+				linkSvc.EXPECT().Merge(gomock.Any(), int64(123), "ticket-1").Return(int64(456), nil)
+				jwtHdl := jwtmocks.NewMockHandler(ctrl)
+				jwtHdl.EXPECT().ClearUserSessions(gomock.Any(), int64(456)).Return(nil)
+				return linkSvc, jwtHdl
+			},
+			wantRes: Result{Msg: "合并成功"},
+		},
+		{
+			name: "下线失败也算合并成功",
+			mock: func(ctrl *gomock.Controller) (service.LinkService, ijwt.Handler) {
+				linkSvc := svcmocks.NewMockLinkService(ctrl)
+				linkSvc.EXPECT().Merge(gomock.Any(), int64(123), "ticket-1").Return(int64(456), nil)
+				jwtHdl := jwtmocks.NewMockHandler(ctrl)
+				jwtHdl.EXPECT().ClearUserSessions(gomock.Any(), int64(456)).Return(errors.New("redis 错误"))
+				return linkSvc, jwtHdl
+			},
+			wantRes: Result{Msg: "合并成功"},
+		},
+		{
+			name: "凭证无效",
+			mock: func(ctrl *gomock.Controller) (service.LinkService, ijwt.Handler) {
+				linkSvc := svcmocks.NewMockLinkService(ctrl)
+				linkSvc.EXPECT().Merge(gomock.Any(), int64(123), "ticket-1").
+					Return(int64(0), service.ErrMergeTicketInvalid)
+				return linkSvc, jwtmocks.NewMockHandler(ctrl)
+			},
+			wantRes: Result{Code: 4, Msg: "合并凭证已经过期，请重新绑定"},
+		},
+		{
+			name: "合并失败",
+			mock: func(ctrl *gomock.Controller) (service.LinkService, ijwt.Handler) {
+				linkSvc := svcmocks.NewMockLinkService(ctrl)
+				linkSvc.EXPECT().Merge(gomock.Any(), int64(123), "ticket-1").
+					Return(int64(456), errors.New("数据库错误"))
+				return linkSvc, jwtmocks.NewMockHandler(ctrl)
+			},
+			wantRes: Result{Code: 5, Msg: "系统错误"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			linkSvc, jwtHdl := tc.mock(ctrl)
+			h := NewUserHandler(nil, nil, nil, nil, nil, nil, linkSvc, nil, nil, jwtHdl, &logger.NopLogger{})
+
+			res := doLinkRequest(t, h, "/users/merge", `{"ticket":"ticket-1"}`)
+			assert.Equal(t, tc.wantRes, res)
+		})
+	}
+}
+
+// doLinkRequest 以用户 123 的身份调用接口
+func doLinkRequest(t *testing.T, h *UserHandler, path, body string) Result {
+	server := gin.New()
+	server.Use(func(ctx *gin.Context) {
+		ctx.Set("claims", &ijwt.UserClaims{Id: 123})
+	})
+	h.RegisterRoutes(server)
+	req, err := http.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	server.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var res Result
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	return res
+}
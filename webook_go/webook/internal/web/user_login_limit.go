@@ -0,0 +1,129 @@
+package web
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"webook_go/webook/internal/service"
+	"webook_go/webook/pkg/logger"
+)
+
+// checkLoginLimit 密码登录之前检查并且先记一次失败，返回 false 的时候已经写回了响应
+// 不管邮箱有没有注册，提示都是一样的
+func (u *UserHandler) checkLoginLimit(ctx *gin.Context, email string) bool {
+	err := u.loginLimitSvc.Attempt(ctx, email, ctx.ClientIP())
+	switch err {
+	case nil:
+		return true
+	case service.ErrLoginLocked:
+		ctx.String(http.StatusOK, "密码错误次数太多，账号已被暂时锁定，可以通过验证码解锁")
+		return false
+	case service.ErrLoginTooFrequent, service.ErrLoginIPLimit:
+		ctx.String(http.StatusOK, "登录太频繁，请稍后再试")
+		return false
+	default:
+		// Redis 出问题的时候不能让所有人都登录不了
+		u.l.Error("检查登录限制失败", logger.Error(err))
+		return true
+	}
+}
+
+// loginFailed 失败次数在 checkLoginLimit 的时候已经记过了，这里只看有没有被锁定
+func (u *UserHandler) loginFailed(ctx *gin.Context, email string) {
+	err := u.loginLimitSvc.Failed(ctx, email)
+	if err == service.ErrLoginLocked {
+		u.l.Warn("密码错误次数太多，账号已被锁定", logger.String("ip", ctx.ClientIP()))
+		ctx.String(http.StatusOK, "密码错误次数太多，账号已被暂时锁定，可以通过验证码解锁")
+		return
+	}
+	if err != nil {
+		u.l.Error("记录登录失败次数失败", logger.Error(err))
+	}
+	ctx.String(http.StatusOK, "用户名或密码不对")
+	u.l.Debug("用户名或密码不对")
+}
+
+// loginSucceeded 密码是对的，回滚 checkLoginLimit 记的失败
+func (u *UserHandler) loginSucceeded(ctx *gin.Context, email string) {
+	if err := u.loginLimitSvc.Succeeded(ctx, email, ctx.ClientIP()); err != nil {
+		u.l.Warn("清除登录失败次数失败", logger.Error(err))
+	}
+}
+
+// SendUnlockCode 发送解锁验证码，channel 是 email 或者 sms，短信发到账号绑定的手机
+func (u *UserHandler) SendUnlockCode(ctx *gin.Context) {
+	type Req struct {
+		Email   string `json:"email"`
+		Channel string `json:"channel"`
+		Captcha string `json:"captcha"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	meta, ok := u.codeSendMeta(ctx, req.Captcha)
+	if !ok {
+		return
+	}
+	err := u.loginLimitSvc.SendUnlockCode(ctx, req.Email, req.Channel, meta)
+	if err == service.ErrUnknownUnlockChannel {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "未知的解锁方式",
+		})
+		return
+	}
+	if err != nil {
+		u.codeSendFailed(ctx, err)
+		return
+	}
+	// 账号不存在的时候也提示发送成功
+	ctx.JSON(http.StatusOK, Result{
+		Msg: "发送成功",
+	})
+}
+
+// Unlock 校验验证码之后解锁
+func (u *UserHandler) Unlock(ctx *gin.Context) {
+	type Req struct {
+		Email   string `json:"email"`
+		Channel string `json:"channel"`
+		Code    string `json:"code"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	ok, err := u.loginLimitSvc.Unlock(ctx, req.Email, req.Channel, req.Code)
+	switch err {
+	case nil:
+	case service.ErrUnknownUnlockChannel:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "未知的解锁方式",
+		})
+		return
+	case service.ErrCodeVerifyTooManyTimes:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "验证次数太多，请重新发送验证码",
+		})
+		return
+	default:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("解锁账号失败", logger.Error(err))
+		return
+	}
+	if !ok {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "验证码有误",
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Msg: "解锁成功，请重新登录",
+	})
+}
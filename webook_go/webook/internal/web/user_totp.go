@@ -0,0 +1,265 @@
+package web
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"webook_go/webook/internal/service"
+	ijwt "webook_go/webook/internal/web/jwt"
+	"webook_go/webook/pkg/logger"
+)
+
+// totpChallenge 密码校验通过了，返回一个挑战，前端带着它和验证码调用 /users/login/2fa
+func (u *UserHandler) totpChallenge(ctx *gin.Context, uid int64) {
+	writeTOTPChallenge(ctx, u.Handler, u.l, uid)
+}
+
+// passTOTP 验证码登录之后调用，开启了两步验证的先不登录，返回挑战
+// 返回 false 的时候已经写好了响应
+func (u *UserHandler) passTOTP(ctx *gin.Context, uid int64) bool {
+	enabled, err := u.totpSvc.Enabled(ctx, uid)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("查询两步验证失败", logger.Error(err), logger.Int64("uid", uid))
+		return false
+	}
+	if enabled {
+		u.totpChallenge(ctx, uid)
+		return false
+	}
+	return true
+}
+
+// writeTOTPChallenge 第三方登录也要走两步验证，所以单独拿出来
+func writeTOTPChallenge(ctx *gin.Context, jwtHdl ijwt.Handler, l logger.LoggerV1, uid int64) {
+	challenge, err := jwtHdl.CreateChallenge(ctx, uid)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		l.Error("创建两步验证挑战失败", logger.Error(err), logger.Int64("uid", uid))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Code: codeTOTPRequired,
+		Msg:  "请输入两步验证的验证码",
+		Data: map[string]string{
+			"challenge": challenge,
+		},
+	})
+}
+
+// LoginTOTP 登录的第二步，验证码和恢复码都可以
+func (u *UserHandler) LoginTOTP(ctx *gin.Context) {
+	type Req struct {
+		Challenge string `json:"challenge"`
+		Code      string `json:"code"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	uid, err := u.CheckChallenge(ctx, req.Challenge)
+	if err == ijwt.ErrChallengeInvalid {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "验证已经过期，请重新登录",
+		})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("校验两步验证挑战失败", logger.Error(err))
+		return
+	}
+	err = u.totpSvc.Verify(ctx, uid, req.Code)
+	switch err {
+	case nil:
+	case service.ErrInvalidTOTPCode:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "验证码不对",
+		})
+		return
+	case service.ErrTOTPNotEnabled:
+		// 中途关掉了两步验证，重新走一遍登录
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "验证已经过期，请重新登录",
+		})
+		return
+	default:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("两步验证失败", logger.Error(err), logger.Int64("uid", uid))
+		return
+	}
+	if err = u.DeleteChallenge(ctx, req.Challenge); err != nil {
+		// 挑战会自己过期，不影响登录
+		u.l.Warn("删除两步验证挑战失败", logger.Error(err), logger.Int64("uid", uid))
+	}
+	user, err := u.svc.Profile(ctx, uid)
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("查询用户失败", logger.Error(err), logger.Int64("uid", uid))
+		return
+	}
+	if err = u.SetLoginToken(ctx, user.Id, user.RoleNames()); err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("设置登录鉴权信息失败", logger.Error(err), logger.Int64("uid", uid))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Msg: "登录成功",
+	})
+}
+
+// SetupTOTP 生成密钥，前端把 uri 做成二维码给 App 扫，扫完之后调用 EnableTOTP 确认
+func (u *UserHandler) SetupTOTP(ctx *gin.Context) {
+	claims, ok := ctx.MustGet("claims").(*ijwt.UserClaims)
+	if !ok {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("设置claims失败")
+		return
+	}
+	secret, uri, err := u.totpSvc.Setup(ctx, claims.Id)
+	if err == service.ErrTOTPAlreadyEnabled {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "已经开启了两步验证，要换绑请先关闭",
+		})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("生成两步验证密钥失败", logger.Error(err), logger.Int64("uid", claims.Id))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Data: map[string]string{
+			"secret": secret,
+			"uri":    uri,
+		},
+	})
+}
+
+// EnableTOTP 输入 App 上的验证码确认绑定，返回恢复码
+func (u *UserHandler) EnableTOTP(ctx *gin.Context) {
+	type Req struct {
+		Code string `json:"code"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	claims, ok := ctx.MustGet("claims").(*ijwt.UserClaims)
+	if !ok {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("设置claims失败")
+		return
+	}
+	codes, err := u.totpSvc.Enable(ctx, claims.Id, req.Code)
+	switch err {
+	case nil:
+	case service.ErrInvalidTOTPCode:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "验证码不对",
+		})
+		return
+	case service.ErrTOTPNotEnabled:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "请先生成密钥",
+		})
+		return
+	case service.ErrTOTPAlreadyEnabled:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "已经开启了两步验证",
+		})
+		return
+	default:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("开启两步验证失败", logger.Error(err), logger.Int64("uid", claims.Id))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Msg: "两步验证已开启，请妥善保存恢复码",
+		Data: map[string][]string{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// DisableTOTP 关闭两步验证，需要验证码或者恢复码
+func (u *UserHandler) DisableTOTP(ctx *gin.Context) {
+	type Req struct {
+		Code string `json:"code"`
+	}
+	var req Req
+	if err := ctx.Bind(&req); err != nil {
+		return
+	}
+	claims, ok := ctx.MustGet("claims").(*ijwt.UserClaims)
+	if !ok {
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("设置claims失败")
+		return
+	}
+	err := u.totpSvc.Disable(ctx, claims.Id, req.Code)
+	switch err {
+	case nil:
+	case service.ErrInvalidTOTPCode:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "验证码不对",
+		})
+		return
+	case service.ErrTOTPNotEnabled:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 4,
+			Msg:  "没有开启两步验证",
+		})
+		return
+	default:
+		ctx.JSON(http.StatusOK, Result{
+			Code: 5,
+			Msg:  "系统错误",
+		})
+		u.l.Error("关闭两步验证失败", logger.Error(err), logger.Int64("uid", claims.Id))
+		return
+	}
+	ctx.JSON(http.StatusOK, Result{
+		Msg: "两步验证已关闭",
+	})
+}
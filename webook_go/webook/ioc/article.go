@@ -0,0 +1,63 @@
+package ioc
+
+import (
+	"github.com/spf13/viper"
+	"go.mongodb.org/mongo-driver/mongo"
+	"gorm.io/gorm"
+	"time"
+	"webook_go/webook/internal/job"
+	"webook_go/webook/internal/repository/dao/article"
+	"webook_go/webook/pkg/idgen"
+	"webook_go/webook/pkg/logger"
+	"webook_go/webook/pkg/sharding"
+)
+
+// articleMigratePattern 双写的阶段，viper 监听了配置文件，改了之后马上生效
+func articleMigratePattern() string {
+	return viper.GetString("migrator.articles.pattern")
+}
+
+// InitArticleDAO 配置了 MongoDB 的时候，文章从 MySQL 往 MongoDB 迁移，按照 migrator.articles.pattern 双写
+func InitArticleDAO(db *gorm.DB, s *sharding.Sharding, gen idgen.Generator,
+	mdb *mongo.Database, l logger.LoggerV1) article.ArticleDAO {
+	var src article.ArticleDAO
+	if s == nil {
+		src = article.NewGORMArticleDAO(db, gen)
+	} else {
+		mustGenerator(gen)
+		src = article.NewShardingArticleDAO(s, gen)
+	}
+	if mdb == nil {
+		return src
+	}
+	if s != nil {
+		panic("分库分表之后不支持迁移文章到 MongoDB")
+	}
+	// 两边的 ID 要一样
+	mustGenerator(gen)
+	return article.NewDoubleWriteDAO(src, article.NewMongoDBDAO(mdb, gen), articleMigratePattern, l)
+}
+
+// InitArticleMigrateJob 没有配置 MongoDB 的时候什么都不做
+func InitArticleMigrateJob(db *gorm.DB, mdb *mongo.Database, l logger.LoggerV1) *job.ArticleMigrateJob {
+	cfg := job.ArticleMigrateConfig{
+		Interval:  time.Minute,
+		Lag:       time.Second * 10,
+		BatchSize: 100,
+	}
+	err := viper.UnmarshalKey("migrator.articles.validate", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	var tables []job.ArticleMigrateTable
+	if mdb != nil {
+		for _, name := range []string{"articles", "published_articles"} {
+			tables = append(tables, job.ArticleMigrateTable{
+				Name: name,
+				Src:  article.NewGORMStore(db, name),
+				Dst:  article.NewMongoStore(mdb.Collection(name)),
+			})
+		}
+	}
+	return job.NewArticleMigrateJob(tables, articleMigratePattern, cfg, l)
+}
@@ -0,0 +1,60 @@
+package ioc
+
+import (
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+	"net/http"
+	"time"
+	"webook_go/webook/internal/repository/cache"
+	"webook_go/webook/internal/service/captcha"
+	"webook_go/webook/internal/service/captcha/siteverify"
+)
+
+func InitCodeLimitConfig() cache.CodeLimitConfig {
+	// 没有配置的时候的默认值
+	cfg := cache.CodeLimitConfig{
+		PhonePerHour:     5,
+		PhonePerDay:      10,
+		IPPerHour:        20,
+		DevicePerHour:    10,
+		BizPerMinute:     1000,
+		CaptchaThreshold: 3,
+	}
+	err := viper.UnmarshalKey("code.limit", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	return cfg
+}
+
+// InitCodeCache 单机部署的时候可以把 code.cache 配置成 local，验证码就不依赖 Redis 了
+func InitCodeCache(client redis.Cmdable, limit cache.CodeLimitConfig) cache.CodeRedisCache {
+	if viper.GetString("code.cache") == "local" {
+		// 最多保存多少个验证码
+		capacity := viper.GetInt("code.localCapacity")
+		if capacity <= 0 {
+			capacity = 100000
+		}
+		// 最多保存多少个限制的计数器，每个验证码最多用到五个
+		counters := viper.GetInt("code.localCounters")
+		if counters <= 0 {
+			counters = capacity * 5
+		}
+		return cache.NewLocalCodeCache(capacity, counters, limit)
+	}
+	return cache.NewCodeCache(client, limit)
+}
+
+// InitCaptchaService 内存实现只在测试里面用，这里没有配置的话直接启动失败
+func InitCaptchaService() captcha.Service {
+	var cfg siteverify.Config
+	err := viper.UnmarshalKey("captcha.siteverify", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	if cfg.URL == "" || cfg.Secret == "" {
+		panic("没有配置图形验证码 captcha.siteverify 的 url 和 secret")
+	}
+	// 服务商慢的时候不能把发验证码的请求一直挂着
+	return siteverify.NewService(cfg, &http.Client{Timeout: time.Second * 3})
+}
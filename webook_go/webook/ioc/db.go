@@ -1,26 +1,76 @@
 package ioc
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
 	"github.com/spf13/viper"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	glogger "gorm.io/gorm/logger"
 	"time"
 	"webook_go/webook/internal/repository/dao"
+	"webook_go/webook/pkg/gormx"
 	"webook_go/webook/pkg/logger"
 )
 
 func InitDB(l logger.LoggerV1) *gorm.DB {
 	type Config struct {
 		DSN string `yaml:"dsn"`
+		// Replicas 从库的 DSN，没有配置的话读写都走 DSN
+		Replicas []string
+		// HealthCheckInterval 从库健康检查的间隔，不健康的从库不会再读，都不健康的时候读主库
+		HealthCheckInterval time.Duration
 	}
 	var cfg = Config{
-		DSN: "root:root@tcp(localhost:13316)/webook",
+		DSN:                 "root:root@tcp(localhost:13316)/webook",
+		HealthCheckInterval: time.Second * 5,
 	}
 	//dsn := viper.GetString("db.mysql.dsn")
 	// remote 看起来不支持 key 的切割
 	err := viper.UnmarshalKey("db", &cfg)
-	db, err := gorm.Open(mysql.Open(cfg.DSN), &gorm.Config{
+	if err != nil {
+		panic(err)
+	}
+	if len(cfg.Replicas) == 0 {
+		db := openDB(cfg.DSN, l)
+		if err = dao.InitTables(db); err != nil {
+			panic(err)
+		}
+		return db
+	}
+	primary := openSQLDB(cfg.DSN)
+	replicas := make([]gormx.ReplicaConfig, 0, len(cfg.Replicas))
+	for i, dsn := range cfg.Replicas {
+		replicas = append(replicas, gormx.ReplicaConfig{
+			Name: fmt.Sprintf("replica-%d", i),
+			DB:   openSQLDB(dsn),
+		})
+	}
+	pool := gormx.NewReadWriteConnPool(primary, replicas, cfg.HealthCheckInterval, l)
+	db := newGormDB(mysql.New(mysql.Config{Conn: pool}), l)
+	// 建表的时候要查表结构，从库可能还没有同步过来
+	err = dao.InitTables(db.WithContext(gormx.WithPrimary(context.Background())))
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+func openSQLDB(dsn string) *sql.DB {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+func openDB(dsn string, l logger.LoggerV1) *gorm.DB {
+	return newGormDB(mysql.Open(dsn), l)
+}
+
+func newGormDB(dialector gorm.Dialector, l logger.LoggerV1) *gorm.DB {
+	db, err := gorm.Open(dialector, &gorm.Config{
 		// 缺了一个 writer
 		Logger: glogger.New(gormLoggerFunc(l.Debug), glogger.Config{
 			// 慢查询阈值，只有执行时间超过这个阈值，才会使用
@@ -36,10 +86,6 @@ func InitDB(l logger.LoggerV1) *gorm.DB {
 	if err != nil {
 		panic(err)
 	}
-	err = dao.InitTables(db)
-	if err != nil {
-		panic(err)
-	}
 	return db
 }
 
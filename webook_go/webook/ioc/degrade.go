@@ -0,0 +1,15 @@
+package ioc
+
+import (
+	"github.com/spf13/viper"
+	"webook_go/webook/pkg/degrade"
+)
+
+// InitDegrade 降级开关放在配置 degrade.enabled 里面
+// viper 监听了配置文件，改了之后马上生效
+// 不用 viper.OnConfigChange，因为它只能注册一个回调，会覆盖掉别的
+func InitDegrade() {
+	degrade.SetSource(func() bool {
+		return viper.GetBool("degrade.enabled")
+	})
+}
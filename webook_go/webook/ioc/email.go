@@ -0,0 +1,21 @@
+package ioc
+
+import (
+	"github.com/spf13/viper"
+	"webook_go/webook/internal/service/email"
+	"webook_go/webook/internal/service/email/memory"
+	"webook_go/webook/internal/service/email/smtp"
+)
+
+func InitEmailService() email.Service {
+	var cfg smtp.Config
+	err := viper.UnmarshalKey("email.smtp", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	// 没有配置 SMTP 服务器就用内存实现
+	if cfg.Host == "" {
+		return memory.NewService()
+	}
+	return smtp.NewService(cfg)
+}
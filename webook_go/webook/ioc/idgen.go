@@ -0,0 +1,47 @@
+package ioc
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+	"time"
+	"webook_go/webook/pkg/idgen"
+	"webook_go/webook/pkg/logger"
+)
+
+// InitIDGenerator 没有开启的时候返回 nil，MySQL 的表继续用自增主键
+// 开启之后每个实例启动的时候从 Redis 拿一个节点
+func InitIDGenerator(client redis.Cmdable, l logger.LoggerV1) idgen.Generator {
+	type Config struct {
+		Enabled bool
+		// Prefix 节点 key 的前缀，Redis cluster 下面要带 hash tag
+		Prefix   string
+		LeaseTTL time.Duration
+		// MaxBackward 时钟回拨不超过这个时间就等一下
+		MaxBackward time.Duration
+	}
+	cfg := Config{
+		Prefix:      "idgen:{webook}:node",
+		LeaseTTL:    time.Second * 30,
+		MaxBackward: time.Millisecond * 10,
+	}
+	err := viper.UnmarshalKey("idgen", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	if !cfg.Enabled {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	lease, err := idgen.NewRedisNodeAllocator(client, cfg.Prefix, cfg.LeaseTTL, l).Allocate(ctx)
+	if err != nil {
+		panic(err)
+	}
+	l.Info("idgen 分配到节点", logger.Int64("node", lease.NodeId()))
+	gen, err := idgen.NewSnowflake(lease, idgen.SnowflakeConfig{MaxBackward: cfg.MaxBackward})
+	if err != nil {
+		panic(err)
+	}
+	return gen
+}
@@ -0,0 +1,37 @@
+package ioc
+
+import (
+	"context"
+	"github.com/spf13/viper"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+	"webook_go/webook/internal/repository/dao/article"
+)
+
+// InitMongoDB 没有配置 mongo.uri 的时候返回 nil，文章只存在 MySQL 里面
+func InitMongoDB() *mongo.Database {
+	type Config struct {
+		URI      string `mapstructure:"uri"`
+		Database string
+	}
+	cfg := Config{Database: "webook"}
+	err := viper.UnmarshalKey("mongo", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	if cfg.URI == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.URI))
+	if err != nil {
+		panic(err)
+	}
+	db := client.Database(cfg.Database)
+	if err = article.InitCollections(db); err != nil {
+		panic(err)
+	}
+	return db
+}
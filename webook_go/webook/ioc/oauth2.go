@@ -0,0 +1,69 @@
+package ioc
+
+import (
+	"github.com/spf13/viper"
+	"net/http"
+	"os"
+	"time"
+	"webook_go/webook/internal/service/oauth2"
+	"webook_go/webook/internal/service/oauth2/github"
+	"webook_go/webook/internal/service/oauth2/oidc"
+	"webook_go/webook/internal/service/oauth2/wechat"
+	"webook_go/webook/internal/web"
+	"webook_go/webook/pkg/logger"
+)
+
+// InitOAuth2Providers 只启用配置了的平台，微信的 appId 和 appSecret 还是从环境变量里面读
+func InitOAuth2Providers(l logger.LoggerV1) []oauth2.Provider {
+	type Config struct {
+		Wechat struct {
+			RedirectURI string
+		}
+		Github struct {
+			ClientID     string
+			ClientSecret string
+			RedirectURI  string
+		}
+		OIDC []oidc.Config
+	}
+	var cfg Config
+	err := viper.UnmarshalKey("oauth2", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	// 第三方平台慢的时候不能把请求一直挂着
+	client := &http.Client{Timeout: time.Second * 5}
+	var res []oauth2.Provider
+	appId, hasId := os.LookupEnv("WECHAT_APP_ID")
+	appSecret, hasSecret := os.LookupEnv("WECHAT_APP_SECRET")
+	if hasId && hasSecret {
+		svc := wechat.NewService(appId, appSecret, cfg.Wechat.RedirectURI, client, l)
+		res = append(res, wechat.NewProvider(svc, l))
+	}
+	if cfg.Github.ClientID != "" {
+		res = append(res, github.NewProvider(github.Config{
+			ClientID:     cfg.Github.ClientID,
+			ClientSecret: cfg.Github.ClientSecret,
+			RedirectURI:  cfg.Github.RedirectURI,
+		}, client))
+	}
+	for _, c := range cfg.OIDC {
+		if c.Name == "" || c.Issuer == "" {
+			panic("OIDC 登录要配置 name 和 issuer")
+		}
+		res = append(res, oidc.NewProvider(c, client))
+	}
+	return res
+}
+
+func InitOAuth2HandlerConfig() web.OAuth2HandlerConfig {
+	var cfg web.OAuth2HandlerConfig
+	err := viper.UnmarshalKey("oauth2", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	if cfg.StateKey == "" {
+		panic("没有配置第三方登录 state 的签名密钥 oauth2.stateKey")
+	}
+	return cfg
+}
@@ -0,0 +1,67 @@
+package ioc
+
+import (
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+	"webook_go/webook/internal/repository/dao"
+	"webook_go/webook/internal/repository/dao/article"
+	"webook_go/webook/pkg/idgen"
+	"webook_go/webook/pkg/logger"
+	"webook_go/webook/pkg/sharding"
+)
+
+// InitSharding 没有开启的时候返回 nil，用户和文章还是放在 InitDB 的库里面
+func InitSharding(l logger.LoggerV1) *sharding.Sharding {
+	type Config struct {
+		Enabled bool
+		// DBs 每个库的 DSN，数量定了之后不能再改
+		DBs []string `mapstructure:"dbs"`
+		// Tables 每个库有多少张分表
+		Tables int
+	}
+	cfg := Config{Tables: 4}
+	err := viper.UnmarshalKey("sharding", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	if !cfg.Enabled {
+		return nil
+	}
+	if len(cfg.DBs) == 0 || cfg.Tables <= 0 {
+		panic("分库分表至少要一个库、一张表")
+	}
+	dbs := make([]*gorm.DB, 0, len(cfg.DBs))
+	for _, dsn := range cfg.DBs {
+		dbs = append(dbs, openDB(dsn, l))
+	}
+	s := sharding.NewSharding(dbs, cfg.Tables)
+	if err = dao.InitShardingTables(s); err != nil {
+		panic(err)
+	}
+	l.Info("开启分库分表", logger.Int64("dbs", int64(len(dbs))), logger.Int64("tables", int64(cfg.Tables)))
+	return s
+}
+
+// InitUserDAO 合并、注销账号的时候文章通过 arts 改，迁移的时候 MongoDB 那边也能改到
+func InitUserDAO(db *gorm.DB, s *sharding.Sharding, gen idgen.Generator, arts article.ArticleDAO) dao.UserDAO {
+	if s == nil {
+		return dao.NewUserDAO(db, gen, arts)
+	}
+	mustGenerator(gen)
+	return dao.NewShardingUserDAO(s, db, gen, arts)
+}
+
+func InitIdentityDAO(db *gorm.DB, users dao.UserDAO, s *sharding.Sharding, gen idgen.Generator) dao.IdentityDAO {
+	if s == nil {
+		return dao.NewIdentityDAO(db, gen)
+	}
+	mustGenerator(gen)
+	return dao.NewShardingIdentityDAO(db, users, gen)
+}
+
+// mustGenerator 分表之后每张表的自增主键会重复，迁移的时候两边的 ID 要一样，都一定要开启 idgen
+func mustGenerator(gen idgen.Generator) {
+	if gen == nil {
+		panic("分库分表或者迁移文章的时候一定要开启 idgen")
+	}
+}
@@ -1,5 +1,16 @@
 package ioc
 
+import (
+	"expvar"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+	"time"
+	"webook_go/webook/internal/repository"
+	"webook_go/webook/internal/repository/cache"
+	"webook_go/webook/internal/service"
+	"webook_go/webook/pkg/logger"
+)
+
 //func InitUserHandler(repo repository.UserRepository, c cache.CodeRedisCache) service.UserService {
 //	l, err := zap.NewDevelopment()
 //	if err != nil {
@@ -7,3 +18,102 @@ package ioc
 //	}
 //	return service.NewUserService(repo, c, l)
 //}
+
+func InitActivationConfig() service.ActivationConfig {
+	cfg := service.ActivationConfig{
+		URL:        "http://localhost:8080/users/activate",
+		Expiration: time.Hour * 24,
+	}
+	err := viper.UnmarshalKey("user.activation", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	if cfg.Key == "" {
+		panic("没有配置激活链接的签名密钥 user.activation.key")
+	}
+	return cfg
+}
+
+func InitTOTPConfig() service.TOTPConfig {
+	cfg := service.TOTPConfig{
+		Issuer: "webook",
+	}
+	err := viper.UnmarshalKey("user.totp", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	return cfg
+}
+
+func InitLoginLimitConfig() cache.LoginLimitConfig {
+	// 没有配置的时候的默认值
+	cfg := cache.LoginLimitConfig{
+		Window:        time.Minute * 15,
+		FreeAttempts:  3,
+		BaseDelay:     time.Second,
+		MaxDelay:      time.Second * 30,
+		LockThreshold: 10,
+		LockDuration:  time.Minute * 30,
+		IPThreshold:   100,
+	}
+	err := viper.UnmarshalKey("user.loginLimit", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	return cfg
+}
+
+func InitUserCacheConfig() repository.UserCacheConfig {
+	cfg := repository.UserCacheConfig{
+		DoubleDeleteDelay:  time.Millisecond * 500,
+		DegradeConcurrency: 100,
+		PrimaryAfterWrite:  time.Second,
+	}
+	err := viper.UnmarshalKey("user.cache", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	return cfg
+}
+
+// InitUserCache 配置了 user.cache.local.enabled 的时候在 Redis 前面加一层本地缓存
+// 命中率挂在 expvar 的 user_cache 下面，管理后台的 /admin/debug/vars 能看到
+func InitUserCache(client redis.Cmdable, l logger.LoggerV1) cache.UserCache {
+	remote := cache.NewUserCache(client)
+	if !viper.GetBool("user.cache.local.enabled") {
+		return remote
+	}
+	cfg := cache.MultiLevelUserCacheConfig{
+		Capacity:   10000,
+		Expiration: time.Second * 10,
+		Channel:    "user:cache:invalidate",
+	}
+	err := viper.UnmarshalKey("user.cache.local", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	// 单机的和集群的 Redis 客户端都可以订阅
+	sub, _ := client.(cache.Subscriber)
+	if sub == nil {
+		l.Warn("Redis 客户端不支持订阅，本地用户缓存只能等过期")
+	}
+	stats := &cache.UserCacheStats{}
+	// 重复注册 expvar 会 panic，测试里面可能会初始化好几次
+	if expvar.Get("user_cache") == nil {
+		expvar.Publish("user_cache", expvar.Func(func() any {
+			return stats.Snapshot()
+		}))
+	}
+	return cache.NewMultiLevelUserCache(remote, client, sub, cfg, stats, l)
+}
+
+func InitAccountConfig() service.AccountConfig {
+	cfg := service.AccountConfig{
+		DeletionCooldown: time.Hour * 24 * 15,
+	}
+	err := viper.UnmarshalKey("user.account", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	return cfg
+}
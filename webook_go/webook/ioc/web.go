@@ -7,8 +7,10 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 	"github.com/spf13/viper"
+	"net/http"
 	"strings"
 	"time"
+	"webook_go/webook/internal/service"
 	"webook_go/webook/internal/web"
 	ijwt "webook_go/webook/internal/web/jwt"
 	"webook_go/webook/internal/web/middleware"
@@ -17,16 +19,20 @@ import (
 )
 
 func InitGin(mdls []gin.HandlerFunc, hdl *web.UserHandler,
-	oauth2WechatHdl *web.OAuth2WechatHandler, articleHdl *web.ArticleHandler) *gin.Engine {
+	oauth2Hdl *web.OAuth2Handler, articleHdl *web.ArticleHandler,
+	jwksHdl *web.JWKSHandler, adminHdl *web.AdminHandler) *gin.Engine {
 	server := gin.Default()
 	server.Use(mdls...)
 	hdl.RegisterRoutes(server)
 	articleHdl.RegisterRoutes(server)
-	oauth2WechatHdl.RegisterRoutes(server)
+	oauth2Hdl.RegisterRoutes(server)
+	jwksHdl.RegisterRoutes(server)
+	adminHdl.RegisterRoutes(server)
 	return server
 }
 
-func InitMiddlewares(redisClient redis.Cmdable, jwtHdl ijwt.Handler, l logger2.LoggerV1) []gin.HandlerFunc {
+func InitMiddlewares(redisClient redis.Cmdable, jwtHdl ijwt.Handler,
+	userSvc service.UserService, l logger2.LoggerV1) []gin.HandlerFunc {
 	bd := logger.NewBuilder(func(ctx context.Context, al *logger.AccessLog) {
 		l.Debug("HTTP请求", logger2.Field{Key: "al", Value: al})
 	}).AllowReqBody(true).AllowRespBody()
@@ -42,9 +48,22 @@ func InitMiddlewares(redisClient redis.Cmdable, jwtHdl ijwt.Handler, l logger2.L
 			IgnorePaths("/users/refresh_token").
 			IgnorePaths("/users/login_sms/code/send").
 			IgnorePaths("/users/login_sms").
-			IgnorePaths("/oauth2/wechat/authurl").
-			IgnorePaths("/oauth2/wechat/callback").
-			IgnorePaths("/users/login").Build(),
+			IgnorePaths("/users/login_email/code/send").
+			IgnorePaths("/users/login_email").
+			IgnorePaths("/users/activate").
+			IgnorePaths("/users/activate/resend").
+			IgnorePaths("/users/password/reset/send").
+			IgnorePaths("/users/password/reset").
+			IgnoreRoutes(http.MethodGet, "/.well-known/jwks.json").
+			// 第三方登录的跳转和回调，回调不同的平台可能用 GET 也可能用 POST
+			IgnoreRoutes(http.MethodGet, "/oauth2/:provider/authurl").
+			IgnoreRoutes("", "/oauth2/:provider/callback").
+			IgnorePaths("/users/login/2fa").
+			IgnorePaths("/users/login/unlock/send").
+			IgnorePaths("/users/login/unlock").
+			IgnorePaths("/users/login").
+			// 被封禁的用户马上就不能用了，不用等 token 过期
+			CheckBanned(userSvc).Build(),
 		//ratelimit.NewBuilder(redisClient, time.Second, 100).Build(),
 	}
 }
@@ -52,7 +71,7 @@ func InitMiddlewares(redisClient redis.Cmdable, jwtHdl ijwt.Handler, l logger2.L
 func corsHdl() gin.HandlerFunc {
 	return cors.New(cors.Config{
 		AllowMethods:     []string{"GET", "POST"},
-		AllowHeaders:     []string{"Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Content-Type", "Authorization", "X-Device-Id"},
 		ExposeHeaders:    []string{"x-jwt-token"},
 		AllowCredentials: true,
 		AllowOriginFunc: func(origin string) bool {
@@ -64,3 +83,33 @@ func corsHdl() gin.HandlerFunc {
 		MaxAge: 12 * time.Hour,
 	})
 }
+
+// InitJWTHandler 登录成功的时候顺便记录登录记录
+func InitJWTHandler(cmd redis.Cmdable, cfg ijwt.SessionConfig, keys ijwt.Keys,
+	svc service.LoginLogService, l logger2.LoggerV1) ijwt.Handler {
+	return web.NewLoginLogJWTHandler(ijwt.NewRedisJWTHandler(cmd, cfg, keys), svc, l)
+}
+
+func InitSessionConfig() ijwt.SessionConfig {
+	cfg := ijwt.SessionConfig{
+		MaxSessions: 5,
+	}
+	err := viper.UnmarshalKey("session", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	return cfg
+}
+
+func InitJWTKeys() ijwt.Keys {
+	var cfg ijwt.Config
+	err := viper.UnmarshalKey("jwt", &cfg)
+	if err != nil {
+		panic(err)
+	}
+	keys, err := ijwt.NewKeys(cfg)
+	if err != nil {
+		panic(err)
+	}
+	return keys
+}
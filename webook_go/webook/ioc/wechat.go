@@ -1,26 +0,0 @@
-package ioc
-
-import (
-	"os"
-	"webook_go/webook/internal/service/oauth2/wechat"
-	"webook_go/webook/internal/web"
-	"webook_go/webook/pkg/logger"
-)
-
-func InitWechatService(l logger.LoggerV1) wechat.Service {
-	appId, ok := os.LookupEnv("WECHAT_APP_ID")
-	if !ok {
-		panic("没有找到环境变量 WECHAT_APP_ID ")
-	}
-	appKey, ok := os.LookupEnv("WECHAT_APP_SECRET")
-	if !ok {
-		panic("没有找到环境变量 WECHAT_APP_SECRET")
-	}
-	return wechat.NewService(appId, appKey, l)
-}
-
-func NewWechatHandlerConfig() web.WechatHandlerConfig {
-	return web.WechatHandlerConfig{
-		Secret: false,
-	}
-}
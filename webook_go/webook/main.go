@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/fsnotify/fsnotify"
@@ -12,9 +13,9 @@ import (
 	"net/http"
 	"strings"
 	"time"
-	"webook_go/webook/internal/integration/startup"
 	ijwt "webook_go/webook/internal/web/jwt"
 	"webook_go/webook/internal/web/middleware"
+	"webook_go/webook/ioc"
 )
 
 func main() {
@@ -27,10 +28,15 @@ func main() {
 	//u.RegisterRoutes(server)
 	initViper()
 	initLogger()
+	ioc.InitDegrade()
 	//initViperRemote()
 	keys := viper.AllKeys()
 	println(keys)
-	server := startup.InitWebServer()
+	app := InitApp()
+	go app.purgeJob.Start(context.Background())
+	go app.migrateJob.Start(context.Background())
+	go app.refreshJob.Start(context.Background())
+	server := app.server
 	//server := gin.Default()
 	server.GET("/hello", func(ctx *gin.Context) {
 		ctx.String(http.StatusOK, "你好，你来了")
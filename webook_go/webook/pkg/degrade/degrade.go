@@ -0,0 +1,32 @@
+// Package degrade 全局的降级开关
+// 打开之后，各个业务自己决定哪些非核心的功能不执行，比如新用户注册，优先保证老用户能用
+package degrade
+
+import "sync/atomic"
+
+var (
+	enabled atomic.Bool
+	// source 外部的开关，比如配置文件，每次判断的时候都会读
+	source atomic.Value
+)
+
+// Enabled 手动打开了降级，或者外部的开关打开了，都算降级
+func Enabled() bool {
+	if enabled.Load() {
+		return true
+	}
+	if f, ok := source.Load().(func() bool); ok {
+		return f()
+	}
+	return false
+}
+
+// Set 手动打开或者关闭降级，比如 Redis 挂了之后查数据库的请求太多了
+func Set(val bool) {
+	enabled.Store(val)
+}
+
+// SetSource 设置外部的开关，f 要足够快，每次调用 Enabled 都会执行
+func SetSource(f func() bool) {
+	source.Store(f)
+}
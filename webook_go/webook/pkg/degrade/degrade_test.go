@@ -0,0 +1,25 @@
+package degrade
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEnabled(t *testing.T) {
+	defer func() {
+		Set(false)
+		SetSource(func() bool { return false })
+	}()
+	assert.False(t, Enabled())
+
+	Set(true)
+	assert.True(t, Enabled())
+	Set(false)
+
+	// 外部开关打开了也算
+	src := true
+	SetSource(func() bool { return src })
+	assert.True(t, Enabled())
+	src = false
+	assert.False(t, Enabled())
+}
@@ -0,0 +1,190 @@
+// Package gormx GORM 的扩展
+package gormx
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+	"webook_go/webook/pkg/logger"
+)
+
+type primaryKey struct{}
+
+// WithPrimary 读也走主库，刚写完马上要读的时候用，不然从库还没有同步过来会读到旧数据
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// UsePrimary 是不是要求走主库
+func UsePrimary(ctx context.Context) bool {
+	val, _ := ctx.Value(primaryKey{}).(bool)
+	return val
+}
+
+// ReadWriteConnPool 读写分离，作为 GORM 的 ConnPool 使用
+// 写和事务都走主库，读轮询健康的从库，从库都不健康的时候读主库
+// 事务里面的语句用的是 BeginTx 返回的 *sql.Tx，所以一定在主库上
+type ReadWriteConnPool struct {
+	primary  *sql.DB
+	replicas []*replica
+	next     atomic.Uint64
+	l        logger.LoggerV1
+
+	// interval 健康检查的间隔
+	interval time.Duration
+	// timeout 健康检查 Ping 的超时时间
+	timeout   time.Duration
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+type replica struct {
+	db      *sql.DB
+	name    string
+	healthy atomic.Bool
+}
+
+type ReplicaConfig struct {
+	// Name 打日志用的，不要把 DSN 打到日志里面
+	Name string
+	DB   *sql.DB
+}
+
+// NewReadWriteConnPool 创建之后开始后台的健康检查，不用的时候要 Close
+// 一开始认为所有的从库都是健康的
+func NewReadWriteConnPool(primary *sql.DB, replicas []ReplicaConfig,
+	interval time.Duration, l logger.LoggerV1) *ReadWriteConnPool {
+	p := &ReadWriteConnPool{
+		primary:  primary,
+		replicas: make([]*replica, 0, len(replicas)),
+		l:        l,
+		interval: interval,
+		timeout:  time.Second,
+		closed:   make(chan struct{}),
+	}
+	for _, r := range replicas {
+		rp := &replica{db: r.DB, name: r.Name}
+		rp.healthy.Store(true)
+		p.replicas = append(p.replicas, rp)
+	}
+	if len(p.replicas) > 0 && interval > 0 {
+		go p.healthCheckLoop()
+	}
+	return p
+}
+
+func (p *ReadWriteConnPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return p.primary.PrepareContext(ctx, query)
+}
+
+func (p *ReadWriteConnPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return p.primary.ExecContext(ctx, query, args...)
+}
+
+func (p *ReadWriteConnPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	r := p.pick(ctx)
+	if r == nil {
+		return p.primary.QueryContext(ctx, query, args...)
+	}
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil && p.unavailable(ctx, err) {
+		// 从库连不上了，不等下一次健康检查，马上摘掉，这一次读主库
+		p.markUnhealthy(r, err)
+		return p.primary.QueryContext(ctx, query, args...)
+	}
+	return rows, err
+}
+
+// QueryRowContext 查询本身的错误不用等到 Scan，Err 就能拿到，从库连不上的时候一样切主库
+func (p *ReadWriteConnPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	r := p.pick(ctx)
+	if r == nil {
+		return p.primary.QueryRowContext(ctx, query, args...)
+	}
+	row := r.db.QueryRowContext(ctx, query, args...)
+	if err := row.Err(); err != nil && p.unavailable(ctx, err) {
+		p.markUnhealthy(r, err)
+		return p.primary.QueryRowContext(ctx, query, args...)
+	}
+	return row
+}
+
+// BeginTx 事务都在主库上
+func (p *ReadWriteConnPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return p.primary.BeginTx(ctx, opts)
+}
+
+// GetDBConn 让 gorm.DB.DB() 返回主库
+func (p *ReadWriteConnPool) GetDBConn() (*sql.DB, error) {
+	return p.primary, nil
+}
+
+// pick 返回 nil 代表读主库
+func (p *ReadWriteConnPool) pick(ctx context.Context) *replica {
+	if len(p.replicas) == 0 || UsePrimary(ctx) {
+		return nil
+	}
+	start := p.next.Add(1)
+	for i := 0; i < len(p.replicas); i++ {
+		r := p.replicas[(start+uint64(i))%uint64(len(p.replicas))]
+		if r.healthy.Load() {
+			return r
+		}
+	}
+	return nil
+}
+
+// unavailable 只有连不上才算从库不可用，SQL 本身的错误换到主库也一样会出错
+func (p *ReadWriteConnPool) unavailable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr)
+}
+
+func (p *ReadWriteConnPool) markUnhealthy(r *replica, err error) {
+	if r.healthy.CompareAndSwap(true, false) {
+		p.l.Error("从库不可用，读请求切到主库", logger.String("replica", r.name), logger.Error(err))
+	}
+}
+
+func (p *ReadWriteConnPool) healthCheckLoop() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.checkReplicas()
+		case <-p.closed:
+			return
+		}
+	}
+}
+
+func (p *ReadWriteConnPool) checkReplicas() {
+	for _, r := range p.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+		err := r.db.PingContext(ctx)
+		cancel()
+		if err != nil {
+			p.markUnhealthy(r, err)
+			continue
+		}
+		if r.healthy.CompareAndSwap(false, true) {
+			p.l.Info("从库恢复了", logger.String("replica", r.name))
+		}
+	}
+}
+
+// Close 停止健康检查，不会关闭数据库连接
+func (p *ReadWriteConnPool) Close() {
+	p.closeOnce.Do(func() {
+		close(p.closed)
+	})
+}
@@ -0,0 +1,75 @@
+package gormx
+
+import (
+	"context"
+	"errors"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"webook_go/webook/pkg/logger"
+)
+
+func TestReadWriteConnPool(t *testing.T) {
+	primary, pmock, err := sqlmock.New()
+	require.NoError(t, err)
+	replicaDB, rmock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	require.NoError(t, err)
+	p := NewReadWriteConnPool(primary, []ReplicaConfig{{Name: "replica-0", DB: replicaDB}}, 0, &logger.NopLogger{})
+	defer p.Close()
+	ctx := context.Background()
+
+	// 读走从库，写走主库
+	rmock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+	rows, err := p.QueryContext(ctx, "SELECT 1")
+	require.NoError(t, err)
+	_ = rows.Close()
+	pmock.ExpectExec("UPDATE users").WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err = p.ExecContext(ctx, "UPDATE users")
+	require.NoError(t, err)
+
+	// 要求读主库
+	pmock.ExpectQuery("SELECT 2").WillReturnRows(sqlmock.NewRows([]string{"2"}).AddRow(2))
+	rows, err = p.QueryContext(WithPrimary(ctx), "SELECT 2")
+	require.NoError(t, err)
+	_ = rows.Close()
+
+	// 从库连不上，这一次切到主库，后面也读主库
+	rmock.ExpectQuery("SELECT 3").WillReturnError(&net.OpError{Op: "read", Err: errors.New("connection reset")})
+	pmock.ExpectQuery("SELECT 3").WillReturnRows(sqlmock.NewRows([]string{"3"}).AddRow(3))
+	rows, err = p.QueryContext(ctx, "SELECT 3")
+	require.NoError(t, err)
+	_ = rows.Close()
+	pmock.ExpectQuery("SELECT 4").WillReturnRows(sqlmock.NewRows([]string{"4"}).AddRow(4))
+	rows, err = p.QueryContext(ctx, "SELECT 4")
+	require.NoError(t, err)
+	_ = rows.Close()
+
+	// 单行查询也一样，从库连不上切主库
+	rmock.ExpectPing()
+	p.checkReplicas()
+	rmock.ExpectQuery("SELECT 6").WillReturnError(&net.OpError{Op: "read", Err: errors.New("connection reset")})
+	pmock.ExpectQuery("SELECT 6").WillReturnRows(sqlmock.NewRows([]string{"6"}).AddRow(6))
+	var val int
+	err = p.QueryRowContext(ctx, "SELECT 6").Scan(&val)
+	require.NoError(t, err)
+	assert.Equal(t, 6, val)
+	assert.False(t, p.replicas[0].healthy.Load())
+
+	// SQL 本身的错误不切主库
+	rmock.ExpectPing()
+	p.checkReplicas()
+	rmock.ExpectQuery("SELECT 5").WillReturnError(errors.New("语法错误"))
+	_, err = p.QueryContext(ctx, "SELECT 5")
+	assert.Error(t, err)
+	assert.True(t, p.replicas[0].healthy.Load())
+
+	// 健康检查失败了也摘掉
+	rmock.ExpectPing().WillReturnError(errors.New("ping 失败"))
+	p.checkReplicas()
+	assert.False(t, p.replicas[0].healthy.Load())
+
+	assert.NoError(t, pmock.ExpectationsWereMet())
+	assert.NoError(t, rmock.ExpectationsWereMet())
+}
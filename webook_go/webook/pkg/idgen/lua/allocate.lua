@@ -0,0 +1,13 @@
+-- 找一个空闲的节点占住
+-- KEYS 两个一组，节点 i 的 key 是 KEYS[2i+1]，上一次用到的时间存在 KEYS[2i+2]
+-- ARGV[1] 实例的 token，ARGV[2] 租约的时间（毫秒）
+-- ARGV[3] 这一次租约最多生成到什么时候（毫秒时间戳），ARGV[4] 时间 key 的过期时间（毫秒）
+-- 返回 {节点 ID, 上一个实例最多生成到的时间}，没有空闲的节点返回 {-1, 0}
+for i = 1, #KEYS, 2 do
+    if redis.call('SET', KEYS[i], ARGV[1], 'NX', 'PX', ARGV[2]) then
+        local ts = tonumber(redis.call('GET', KEYS[i + 1])) or 0
+        redis.call('SET', KEYS[i + 1], math.max(ts, tonumber(ARGV[3])), 'PX', ARGV[4])
+        return {(i - 1) / 2, ts}
+    end
+end
+return {-1, 0}
@@ -0,0 +1,9 @@
+-- 释放节点，只能释放自己的
+-- KEYS[1] 节点的 key，KEYS[2] 记录时间的 key
+-- ARGV[1] 实例的 token，ARGV[2] 最后一次生成 ID 的时间（毫秒时间戳），ARGV[3] 时间 key 的过期时间（毫秒）
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+    return 0
+end
+redis.call('SET', KEYS[2], ARGV[2], 'PX', ARGV[3])
+redis.call('DEL', KEYS[1])
+return 1
@@ -0,0 +1,10 @@
+-- 续约，节点已经不是自己的了返回 0
+-- KEYS[1] 节点的 key，KEYS[2] 记录时间的 key
+-- ARGV[1] 实例的 token，ARGV[2] 租约的时间（毫秒）
+-- ARGV[3] 续约之后最多生成到什么时候（毫秒时间戳），ARGV[4] 时间 key 的过期时间（毫秒）
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+    return 0
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+redis.call('SET', KEYS[2], ARGV[3], 'PX', ARGV[4])
+return 1
@@ -0,0 +1,233 @@
+package idgen
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"sync"
+	"sync/atomic"
+	"time"
+	"webook_go/webook/pkg/logger"
+)
+
+var (
+	//go:embed lua/allocate.lua
+	luaAllocate string
+	//go:embed lua/renew.lua
+	luaRenew string
+	//go:embed lua/release.lua
+	luaRelease string
+)
+
+// tsExpiration 节点最后一次用到的时间要保存多久，比所有实例之间可能的时钟偏差长就够了
+const tsExpiration = time.Hour * 24
+
+// RedisNodeAllocator 用 Redis 的 key 当作租约来分配节点
+// 实例活着的时候每过三分之一个租约时间续约一次，挂了之后租约过期，节点就可以给别的实例用了
+// 续约一直失败导致租约丢了的话，重新分配一个节点，在这之前生成 ID 都返回 ErrLeaseExpired
+type RedisNodeAllocator struct {
+	client redis.Cmdable
+	// prefix 在 Redis cluster 下面要带上 hash tag，比如 idgen:{webook}，所有节点的 key 才会在同一个槽
+	prefix string
+	// keys 分配节点的时候要用到所有节点的 key，通过 KEYS 传给脚本，cluster 才能检查是不是在同一个槽
+	keys []string
+	ttl  time.Duration
+	l    logger.LoggerV1
+	now  func() time.Time
+}
+
+func NewRedisNodeAllocator(client redis.Cmdable, prefix string, ttl time.Duration, l logger.LoggerV1) NodeAllocator {
+	keys := make([]string, 0, (MaxNode+1)*2)
+	for i := int64(0); i <= MaxNode; i++ {
+		keys = append(keys, nodeKey(prefix, i), nodeKey(prefix, i)+":ts")
+	}
+	return &RedisNodeAllocator{
+		client: client,
+		prefix: prefix,
+		keys:   keys,
+		ttl:    ttl,
+		l:      l,
+		now:    time.Now,
+	}
+}
+
+func nodeKey(prefix string, node int64) string {
+	return fmt.Sprintf("%s:%d", prefix, node)
+}
+
+func (a *RedisNodeAllocator) Allocate(ctx context.Context) (Lease, error) {
+	al, err := a.allocate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lease := &redisLease{
+		a:         a,
+		node:      al.node,
+		token:     al.token,
+		notBefore: al.notBefore,
+		stop:      make(chan struct{}),
+	}
+	lease.deadline.Store(al.deadline)
+	go lease.keepAlive()
+	return lease, nil
+}
+
+// allocation 一次分配的结果，时间都是毫秒时间戳
+type allocation struct {
+	node      int64
+	token     string
+	notBefore int64
+	deadline  int64
+}
+
+func (a *RedisNodeAllocator) allocate(ctx context.Context) (allocation, error) {
+	token := uuid.New().String()
+	// 先算好截止时间再发请求，宁可早一点过期
+	deadline := a.now().Add(a.ttl)
+	res, err := a.client.Eval(ctx, luaAllocate, a.keys,
+		token, a.ttl.Milliseconds(),
+		deadline.UnixMilli(), tsExpiration.Milliseconds()).Int64Slice()
+	if err != nil {
+		return allocation{}, err
+	}
+	if len(res) != 2 {
+		return allocation{}, fmt.Errorf("idgen: 分配节点的返回值不对 %v", res)
+	}
+	if res[0] < 0 {
+		return allocation{}, ErrNoAvailableNode
+	}
+	return allocation{
+		node:      res[0],
+		token:     token,
+		notBefore: res[1],
+		deadline:  deadline.UnixMilli(),
+	}, nil
+}
+
+func (a *RedisNodeAllocator) release(ctx context.Context, node int64, token string, now time.Time) error {
+	key := nodeKey(a.prefix, node)
+	return a.client.Eval(ctx, luaRelease, []string{key, key + ":ts"},
+		token, now.UnixMilli(), tsExpiration.Milliseconds()).Err()
+}
+
+type redisLease struct {
+	a *RedisNodeAllocator
+	// mu 重新分配节点的时候会改 node、token 和 notBefore
+	mu    sync.Mutex
+	node  int64
+	token string
+	// notBefore 毫秒时间戳，0 代表不知道
+	notBefore int64
+	// deadline 毫秒时间戳，每次续约成功之后往后推
+	deadline  atomic.Int64
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *redisLease) NodeId() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.node
+}
+
+func (l *redisLease) NotBefore() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.notBefore <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(l.notBefore)
+}
+
+func (l *redisLease) Deadline() time.Time {
+	return time.UnixMilli(l.deadline.Load())
+}
+
+func (l *redisLease) keepAlive() {
+	ticker := time.NewTicker(l.a.ttl / 3)
+	defer ticker.Stop()
+	// lost 租约已经丢了，每次都尝试重新分配
+	lost := false
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			if lost {
+				lost = !l.reallocate()
+				continue
+			}
+			ok, err := l.renew()
+			if err != nil {
+				// 下一次再试，一直失败的话过了截止时间就不能再生成 ID 了
+				l.a.l.Error("idgen 续约失败", logger.Error(err), logger.Int64("node", l.NodeId()))
+				continue
+			}
+			if !ok {
+				// 租约已经过期了，这个节点可能已经被别的实例拿走，换一个节点
+				l.a.l.Error("idgen 租约丢了，重新分配节点", logger.Int64("node", l.NodeId()))
+				// 比如说 Redis 重启丢了数据，截止时间还没到，也要马上停下来
+				l.deadline.Store(l.a.now().UnixMilli())
+				lost = !l.reallocate()
+			}
+		}
+	}
+}
+
+func (l *redisLease) renew() (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.a.ttl/3)
+	defer cancel()
+	l.mu.Lock()
+	key, token := nodeKey(l.a.prefix, l.node), l.token
+	l.mu.Unlock()
+	deadline := l.a.now().Add(l.a.ttl)
+	res, err := l.a.client.Eval(ctx, luaRenew, []string{key, key + ":ts"},
+		token, l.a.ttl.Milliseconds(),
+		deadline.UnixMilli(), tsExpiration.Milliseconds()).Int()
+	if err != nil || res != 1 {
+		return false, err
+	}
+	l.deadline.Store(deadline.UnixMilli())
+	return true, nil
+}
+
+// reallocate 换一个节点，失败了返回 false，下一次再试
+func (l *redisLease) reallocate() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), l.a.ttl/3)
+	defer cancel()
+	al, err := l.a.allocate(ctx)
+	if err != nil {
+		l.a.l.Error("idgen 重新分配节点失败", logger.Error(err))
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-l.stop:
+		// 已经关掉了，刚分配到的节点马上还回去
+		_ = l.a.release(ctx, al.node, al.token, l.a.now())
+		return true
+	default:
+	}
+	l.node, l.token, l.notBefore = al.node, al.token, al.notBefore
+	// 截止时间最后改，生成器看到新的截止时间的时候一定能拿到新的节点
+	l.deadline.Store(al.deadline)
+	l.a.l.Info("idgen 重新分配到了节点", logger.Int64("node", al.node))
+	return true
+}
+
+// Close 先让生成器停下来，再释放节点
+func (l *redisLease) Close(ctx context.Context) error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.stop)
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		now := l.a.now()
+		l.deadline.Store(now.UnixMilli())
+		err = l.a.release(ctx, l.node, l.token, now)
+	})
+	return err
+}
@@ -0,0 +1,106 @@
+package idgen
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"testing"
+	"time"
+	"webook_go/webook/internal/repository/cache/redismocks"
+	"webook_go/webook/pkg/logger"
+)
+
+func TestRedisNodeAllocator_Allocate(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	testCases := []struct {
+		name string
+		val  []any
+		err  error
+
+		wantNode      int64
+		wantNotBefore time.Time
+		wantErr       error
+	}{
+		{name: "第一次用这个节点", val: []any{int64(3), int64(0)}, wantNode: 3},
+		{name: "别的实例用过这个节点", val: []any{int64(5), int64(1700000000100)},
+			wantNode: 5, wantNotBefore: time.UnixMilli(1700000000100)},
+		{name: "没有空闲的节点", val: []any{int64(-1), int64(0)}, wantErr: ErrNoAvailableNode},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			cmd := redismocks.NewMockCmdable(ctrl)
+			res := redis.NewCmd(context.Background())
+			res.SetVal(tc.val)
+			a := NewRedisNodeAllocator(cmd, "idgen:{test}", time.Second*30, &logger.NopLogger{}).(*RedisNodeAllocator)
+			a.now = func() time.Time { return now }
+			// 所有节点的 key 都通过 KEYS 传进去
+			require.Len(t, a.keys, (MaxNode+1)*2)
+			assert.Equal(t, []string{"idgen:{test}:0", "idgen:{test}:0:ts"}, a.keys[:2])
+			assert.Equal(t, []string{"idgen:{test}:1023", "idgen:{test}:1023:ts"}, a.keys[len(a.keys)-2:])
+			cmd.EXPECT().Eval(gomock.Any(), luaAllocate, a.keys,
+				gomock.Any(), int64(30000), now.Add(time.Second*30).UnixMilli(), gomock.Any()).
+				Return(res)
+			lease, err := a.Allocate(context.Background())
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantNode, lease.NodeId())
+			assert.Equal(t, tc.wantNotBefore, lease.NotBefore())
+			assert.Equal(t, now.Add(time.Second*30), lease.Deadline())
+
+			// 释放之后不能再生成 ID
+			release := redis.NewCmd(context.Background())
+			release.SetVal(int64(1))
+			cmd.EXPECT().Eval(gomock.Any(), luaRelease, gomock.Any(), gomock.Any()).Return(release)
+			require.NoError(t, lease.Close(context.Background()))
+			assert.Equal(t, now, lease.Deadline())
+		})
+	}
+}
+
+func TestRedisLease_Reallocate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	now := time.UnixMilli(1700000000000)
+	cmd := redismocks.NewMockCmdable(ctrl)
+	a := NewRedisNodeAllocator(cmd, "idgen:{test}", time.Second*30, &logger.NopLogger{}).(*RedisNodeAllocator)
+	a.now = func() time.Time { return now }
+
+	allocated := redis.NewCmd(context.Background())
+	allocated.SetVal([]any{int64(3), int64(0)})
+	cmd.EXPECT().Eval(gomock.Any(), luaAllocate, a.keys, gomock.Any()).Return(allocated)
+	lease, err := a.Allocate(context.Background())
+	require.NoError(t, err)
+	l := lease.(*redisLease)
+
+	// 租约过期之后节点被别的实例拿走了，续约失败
+	now = now.Add(time.Minute)
+	renewed := redis.NewCmd(context.Background())
+	renewed.SetVal(int64(0))
+	cmd.EXPECT().Eval(gomock.Any(), luaRenew, []string{"idgen:{test}:3", "idgen:{test}:3:ts"}, gomock.Any()).
+		Return(renewed)
+	ok, err := l.renew()
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// 换一个节点，上一个用这个节点的实例最多生成到了 notBefore
+	reallocated := redis.NewCmd(context.Background())
+	reallocated.SetVal([]any{int64(7), now.Add(time.Second).UnixMilli()})
+	cmd.EXPECT().Eval(gomock.Any(), luaAllocate, a.keys, gomock.Any()).Return(reallocated)
+	assert.True(t, l.reallocate())
+	assert.Equal(t, int64(7), lease.NodeId())
+	assert.Equal(t, now.Add(time.Second), lease.NotBefore())
+	assert.Equal(t, now.Add(time.Second*30), lease.Deadline())
+
+	// 释放的是新的节点
+	release := redis.NewCmd(context.Background())
+	release.SetVal(int64(1))
+	cmd.EXPECT().Eval(gomock.Any(), luaRelease, []string{"idgen:{test}:7", "idgen:{test}:7:ts"}, gomock.Any()).
+		Return(release)
+	require.NoError(t, lease.Close(context.Background()))
+}
@@ -0,0 +1,120 @@
+package idgen
+
+import (
+	"sync"
+	"time"
+)
+
+// ID 的结构：1 位符号位 + 41 位毫秒时间戳 + 10 位节点 + 12 位序号
+// 每个节点每毫秒最多生成 4096 个 ID，时间戳从 Epoch 开始可以用大概 69 年
+const (
+	nodeBits = 10
+	seqBits  = 12
+
+	MaxNode = 1<<nodeBits - 1
+	maxSeq  = 1<<seqBits - 1
+	maxTs   = 1<<41 - 1
+)
+
+// defaultEpoch 2024-01-01 00:00:00 UTC，改了之后会生成重复的 ID，上线之后不能再改
+var defaultEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type SnowflakeConfig struct {
+	// Epoch 时间戳的起点，零值用 2024-01-01
+	Epoch time.Time
+	// MaxBackward 时钟回拨不超过这个时间的话，等时钟追上来，超过了直接返回 ErrClockBackward
+	// 0 代表一点都不等
+	MaxBackward time.Duration
+}
+
+type Snowflake struct {
+	mu    sync.Mutex
+	lease Lease
+	node  int64
+	epoch int64
+	cfg   SnowflakeConfig
+	// last 上一次生成 ID 的时间戳，相对于 epoch
+	last int64
+	seq  int64
+
+	now   func() time.Time
+	sleep func(d time.Duration)
+}
+
+func NewSnowflake(lease Lease, cfg SnowflakeConfig) (Generator, error) {
+	node := lease.NodeId()
+	if node < 0 || node > MaxNode {
+		return nil, ErrInvalidNode
+	}
+	if cfg.Epoch.IsZero() {
+		cfg.Epoch = defaultEpoch
+	}
+	s := &Snowflake{
+		lease: lease,
+		node:  node,
+		epoch: cfg.Epoch.UnixMilli(),
+		cfg:   cfg,
+		now:   time.Now,
+		sleep: time.Sleep,
+	}
+	// 上一个用这个节点的实例时钟比我们快的话，要等我们的时钟追上来，不然可能会重复
+	if nb := lease.NotBefore(); !nb.IsZero() {
+		s.last = nb.UnixMilli() - s.epoch
+	}
+	return s, nil
+}
+
+func (s *Snowflake) Next() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if d := s.lease.Deadline(); !d.IsZero() && !now.Before(d) {
+		return 0, ErrLeaseExpired
+	}
+	if node := s.lease.NodeId(); node != s.node {
+		// 租约丢了之后换了一个节点
+		if node < 0 || node > MaxNode {
+			return 0, ErrInvalidNode
+		}
+		s.node = node
+		s.seq = 0
+		if nb := s.lease.NotBefore(); !nb.IsZero() && nb.UnixMilli()-s.epoch > s.last {
+			s.last = nb.UnixMilli() - s.epoch
+		}
+	}
+	ts := now.UnixMilli() - s.epoch
+	if ts < s.last {
+		back := time.Duration(s.last-ts) * time.Millisecond
+		if back > s.cfg.MaxBackward {
+			return 0, ErrClockBackward
+		}
+		// 回拨的不多，等一下
+		s.sleep(back)
+		ts = s.waitAfter(s.last - 1)
+	}
+	if ts == s.last {
+		s.seq = (s.seq + 1) & maxSeq
+		if s.seq == 0 {
+			// 这一毫秒的序号用完了
+			ts = s.waitAfter(s.last)
+		}
+	} else {
+		s.seq = 0
+	}
+	if ts < 0 || ts > maxTs {
+		// 时钟比 Epoch 还早，或者 41 位已经用完了
+		return 0, ErrTimeOverflow
+	}
+	s.last = ts
+	return ts<<(nodeBits+seqBits) | s.node<<seqBits | s.seq, nil
+}
+
+// waitAfter 等到时间戳大于 last
+func (s *Snowflake) waitAfter(last int64) int64 {
+	ts := s.now().UnixMilli() - s.epoch
+	for ts <= last {
+		s.sleep(time.Millisecond)
+		ts = s.now().UnixMilli() - s.epoch
+	}
+	return ts
+}
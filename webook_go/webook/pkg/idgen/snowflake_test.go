@@ -0,0 +1,135 @@
+package idgen
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// fakeClock sleep 的时候时间往前走
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+type fakeLease struct {
+	StaticLease
+	notBefore time.Time
+	deadline  time.Time
+}
+
+func (l fakeLease) NotBefore() time.Time {
+	return l.notBefore
+}
+
+func (l fakeLease) Deadline() time.Time {
+	return l.deadline
+}
+
+func newTestSnowflake(t *testing.T, lease Lease, cfg SnowflakeConfig, clock *fakeClock) *Snowflake {
+	g, err := NewSnowflake(lease, cfg)
+	require.NoError(t, err)
+	s := g.(*Snowflake)
+	s.now = clock.Now
+	s.sleep = clock.Sleep
+	return s
+}
+
+func TestSnowflake_Next(t *testing.T) {
+	clock := &fakeClock{now: defaultEpoch.Add(time.Hour)}
+	s := newTestSnowflake(t, StaticLease(3), SnowflakeConfig{}, clock)
+
+	id, err := s.Next()
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour.Milliseconds()<<22|3<<12, id)
+
+	// 同一毫秒里面序号递增
+	next, err := s.Next()
+	require.NoError(t, err)
+	assert.Equal(t, id+1, next)
+
+	// 序号用完了等到下一毫秒
+	s.seq = maxSeq
+	next, err = s.Next()
+	require.NoError(t, err)
+	assert.Equal(t, (time.Hour.Milliseconds()+1)<<22|3<<12, next)
+	assert.Equal(t, defaultEpoch.Add(time.Hour+time.Millisecond), clock.now)
+}
+
+func TestSnowflake_ClockBackward(t *testing.T) {
+	start := defaultEpoch.Add(time.Hour)
+	clock := &fakeClock{now: start}
+	s := newTestSnowflake(t, StaticLease(1), SnowflakeConfig{MaxBackward: time.Millisecond * 5}, clock)
+	last, err := s.Next()
+	require.NoError(t, err)
+
+	// 回拨 3 毫秒，等时钟追上来
+	clock.now = start.Add(-time.Millisecond * 3)
+	id, err := s.Next()
+	require.NoError(t, err)
+	assert.Greater(t, id, last)
+	assert.False(t, clock.now.Before(start))
+
+	// 回拨太多
+	clock.now = start.Add(-time.Second)
+	_, err = s.Next()
+	assert.Equal(t, ErrClockBackward, err)
+}
+
+func TestSnowflake_Lease(t *testing.T) {
+	start := defaultEpoch.Add(time.Hour)
+	clock := &fakeClock{now: start}
+	lease := fakeLease{
+		StaticLease: 1,
+		// 上一个实例的时钟比我们快 2 毫秒
+		notBefore: start.Add(time.Millisecond * 2),
+		deadline:  start.Add(time.Second),
+	}
+	s := newTestSnowflake(t, lease, SnowflakeConfig{MaxBackward: time.Millisecond * 5}, clock)
+	id, err := s.Next()
+	require.NoError(t, err)
+	assert.Equal(t, (time.Hour.Milliseconds()+2)<<22|1<<12|1, id)
+
+	clock.now = start.Add(time.Second)
+	_, err = s.Next()
+	assert.Equal(t, ErrLeaseExpired, err)
+	assert.NoError(t, lease.Close(context.Background()))
+}
+
+func TestNewSnowflake_InvalidNode(t *testing.T) {
+	_, err := NewSnowflake(StaticLease(MaxNode+1), SnowflakeConfig{})
+	assert.Equal(t, ErrInvalidNode, err)
+}
+
+func TestNext_Nil(t *testing.T) {
+	id, err := Next(nil)
+	assert.NoError(t, err)
+	assert.Zero(t, id)
+}
+
+func TestSnowflake_NodeChanged(t *testing.T) {
+	clock := &fakeClock{now: defaultEpoch.Add(time.Hour)}
+	lease := &fakeLease{StaticLease: 3}
+	s := newTestSnowflake(t, lease, SnowflakeConfig{MaxBackward: time.Second}, clock)
+
+	id, err := s.Next()
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour.Milliseconds()<<22|3<<12, id)
+
+	// 租约丢了之后换到了节点 5，上一个用节点 5 的实例时钟快了 10ms，要等一下
+	lease.StaticLease = 5
+	lease.notBefore = clock.now.Add(time.Millisecond * 10)
+	id, err = s.Next()
+	require.NoError(t, err)
+	// 等到了 notBefore 这一毫秒，和建生成器的时候一样，序号从 1 开始
+	assert.Equal(t, (time.Hour.Milliseconds()+10)<<22|5<<12|1, id)
+}
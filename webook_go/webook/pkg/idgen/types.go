@@ -0,0 +1,70 @@
+// Package idgen 分布式 ID 生成器
+// 所有的 DAO 用同一个生成器，不管是存在 MySQL 还是 MongoDB，ID 都是一样的规则，
+// 也不会像自增主键那样暴露出一共有多少数据
+package idgen
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrClockBackward 时钟回拨太多了，等不了
+	ErrClockBackward = errors.New("idgen: 时钟回拨")
+	// ErrLeaseExpired 节点的租约过期了，别的实例可能已经在用这个节点了
+	ErrLeaseExpired = errors.New("idgen: 节点租约已过期")
+	// ErrNoAvailableNode 所有的节点都被占用了
+	ErrNoAvailableNode = errors.New("idgen: 没有可用的节点")
+	// ErrTimeOverflow 时间戳超出了 41 位能表示的范围
+	ErrTimeOverflow = errors.New("idgen: 时间戳超出范围")
+	// ErrInvalidNode 节点 ID 超出范围
+	ErrInvalidNode = errors.New("idgen: 节点 ID 超出范围")
+)
+
+type Generator interface {
+	Next() (int64, error)
+}
+
+// Next g 为 nil 的时候返回 0，交给数据库自增
+func Next(g Generator) (int64, error) {
+	if g == nil {
+		return 0, nil
+	}
+	return g.Next()
+}
+
+// Lease 一个实例占用的节点，多个实例不能同时用同一个节点，不然会生成重复的 ID
+type Lease interface {
+	NodeId() int64
+	// NotBefore 上一个用这个节点的实例最多生成到了这个时间，零值代表不知道
+	NotBefore() time.Time
+	// Deadline 过了这个时间还没有续约成功，就不能再生成 ID 了，零值代表永不过期
+	Deadline() time.Time
+	// Close 释放节点，之后不能再生成 ID
+	Close(ctx context.Context) error
+}
+
+// NodeAllocator 给每个实例分配一个不重复的节点
+type NodeAllocator interface {
+	Allocate(ctx context.Context) (Lease, error)
+}
+
+// StaticLease 单机部署或者测试的时候，手动指定节点
+type StaticLease int64
+
+func (s StaticLease) NodeId() int64 {
+	return int64(s)
+}
+
+func (s StaticLease) NotBefore() time.Time {
+	return time.Time{}
+}
+
+func (s StaticLease) Deadline() time.Time {
+	return time.Time{}
+}
+
+func (s StaticLease) Close(ctx context.Context) error {
+	return nil
+}
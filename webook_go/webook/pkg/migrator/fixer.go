@@ -0,0 +1,33 @@
+package migrator
+
+import "context"
+
+// Fixer 用 base 的数据覆盖 target
+// 不管是哪种不一致，都重新查一次 base：上报和修复之间数据可能又变了，以修复的时候为准
+type Fixer[T Entity] struct {
+	base   Store[T]
+	target Store[T]
+}
+
+func NewFixer[T Entity](base, target Store[T]) *Fixer[T] {
+	return &Fixer[T]{
+		base:   base,
+		target: target,
+	}
+}
+
+func (f *Fixer[T]) Fix(ctx context.Context, id int64) error {
+	res, err := f.base.FindByIds(ctx, []int64{id})
+	if err != nil {
+		return err
+	}
+	if len(res) == 0 {
+		return f.target.Delete(ctx, id)
+	}
+	return f.target.Upsert(ctx, res[0])
+}
+
+// Report 发现一条修一条
+func (f *Fixer[T]) Report(ctx context.Context, inc Inconsistency) error {
+	return f.Fix(ctx, inc.ID)
+}
@@ -0,0 +1,99 @@
+// Package migrator 不停机迁移数据：双写，校验，修复
+// 迁移的步骤是 src_only -> src_first -> dst_first -> dst_only，每一步之间都要校验，不一致的修复之后再切下一步
+package migrator
+
+import (
+	"context"
+	"errors"
+)
+
+// Pattern 双写的阶段
+type Pattern string
+
+const (
+	// PatternSrcOnly 只读写源表，还没有开始迁移
+	PatternSrcOnly Pattern = "src_only"
+	// PatternSrcFirst 先写源表再写目标表，读源表，目标表写失败了不影响业务
+	PatternSrcFirst Pattern = "src_first"
+	// PatternDstFirst 先写目标表再写源表，读目标表，源表写失败了不影响业务
+	PatternDstFirst Pattern = "dst_first"
+	// PatternDstOnly 只读写目标表，迁移完成
+	PatternDstOnly Pattern = "dst_only"
+)
+
+var ErrUnknownPattern = errors.New("未知的双写阶段")
+
+// ParsePattern 空字符串当成 src_only
+func ParsePattern(val string) (Pattern, error) {
+	switch p := Pattern(val); p {
+	case "":
+		return PatternSrcOnly, nil
+	case PatternSrcOnly, PatternSrcFirst, PatternDstFirst, PatternDstOnly:
+		return p, nil
+	default:
+		return "", ErrUnknownPattern
+	}
+}
+
+// Base 以哪边的数据为准，src_first 之前以源表为准，dst_first 之后以目标表为准
+func (p Pattern) Base() Direction {
+	if p == PatternDstFirst || p == PatternDstOnly {
+		return DirectionDst
+	}
+	return DirectionSrc
+}
+
+// Entity 要迁移的数据
+type Entity interface {
+	// ID 主键，源表和目标表是一样的
+	ID() int64
+	// UpdateTime 增量校验的时候用，毫秒
+	UpdateTime() int64
+	// CompareTo 业务上是不是一样的，双写的时候两边各自生成的更新时间之类的可以不比较
+	CompareTo(dst Entity) bool
+}
+
+// Store 校验和修复的时候读写一边的数据
+type Store[T Entity] interface {
+	// FindByIds 没有的 ID 不在结果里面
+	FindByIds(ctx context.Context, ids []int64) ([]T, error)
+	// ListById 按照 ID 升序，ID 大于 afterId 的最多 limit 条
+	ListById(ctx context.Context, afterId int64, limit int) ([]T, error)
+	// ListByUtime 按照 (utime, id) 升序，在 (utime, afterId) 后面的最多 limit 条
+	ListByUtime(ctx context.Context, utime int64, afterId int64, limit int) ([]T, error)
+	// Upsert 整条覆盖，包括创建时间和更新时间
+	Upsert(ctx context.Context, t T) error
+	Delete(ctx context.Context, id int64) error
+}
+
+// Direction 以哪边的数据为准
+type Direction string
+
+const (
+	DirectionSrc Direction = "src"
+	DirectionDst Direction = "dst"
+)
+
+// InconsistentType 不一致的类型
+type InconsistentType string
+
+const (
+	// InconsistentTargetMissing 校验的目标里面没有
+	InconsistentTargetMissing InconsistentType = "target_missing"
+	// InconsistentNotEqual 两边都有，但是不一样
+	InconsistentNotEqual InconsistentType = "not_equal"
+	// InconsistentBaseMissing 为准的那边没有，目标里面有，一般是删掉的没有同步过去
+	InconsistentBaseMissing InconsistentType = "base_missing"
+)
+
+// Inconsistency 校验发现的一条不一致的数据
+type Inconsistency struct {
+	ID        int64
+	Direction Direction
+	Type      InconsistentType
+}
+
+// Reporter 处理校验发现的不一致，可以直接修复，也可以发到消息队列里面慢慢修
+type Reporter interface {
+	Report(ctx context.Context, inc Inconsistency) error
+}
@@ -0,0 +1,164 @@
+package migrator
+
+import (
+	"context"
+	"time"
+	"webook_go/webook/pkg/logger"
+)
+
+// Validator 以 base 为准校验 target，发现的不一致交给 reporter
+// 双写的时候两边不是同时写的，可能会把刚写了一边的数据当成不一致，修复的时候会重新查 base，所以没关系
+type Validator[T Entity] struct {
+	base      Store[T]
+	target    Store[T]
+	direction Direction
+	reporter  Reporter
+	l         logger.LoggerV1
+
+	batchSize int
+	// interval 增量校验追上了之后，隔多久再查一次
+	interval time.Duration
+}
+
+// NewValidator direction 是 base 是哪一边，打日志和上报的时候用
+func NewValidator[T Entity](base, target Store[T], direction Direction,
+	reporter Reporter, l logger.LoggerV1) *Validator[T] {
+	return &Validator[T]{
+		base:      base,
+		target:    target,
+		direction: direction,
+		reporter:  reporter,
+		l:         l,
+		batchSize: 100,
+	}
+}
+
+func (v *Validator[T]) BatchSize(n int) *Validator[T] {
+	v.batchSize = n
+	return v
+}
+
+// Interval 为 0 的时候，增量校验追上了就返回
+func (v *Validator[T]) Interval(d time.Duration) *Validator[T] {
+	v.interval = d
+	return v
+}
+
+// Full 全量校验：base 有的 target 要有而且一样，target 有的 base 也要有
+func (v *Validator[T]) Full(ctx context.Context) error {
+	var afterId int64
+	for {
+		batch, err := v.base.ListById(ctx, afterId, v.batchSize)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		if err = v.validateBatch(ctx, batch); err != nil {
+			return err
+		}
+		afterId = batch[len(batch)-1].ID()
+	}
+	return v.validateBaseMissing(ctx)
+}
+
+// Incremental 按照更新时间校验从 utime 开始更新过的数据
+// 没有设置 Interval 的话追上了就返回，设置了的话一直校验到 ctx 结束
+// 删除的数据 base 里面已经没有了，增量校验发现不了，要靠全量校验
+func (v *Validator[T]) Incremental(ctx context.Context, utime int64) error {
+	var afterId int64
+	for {
+		batch, err := v.base.ListByUtime(ctx, utime, afterId, v.batchSize)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			if v.interval <= 0 {
+				return nil
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(v.interval):
+			}
+			continue
+		}
+		if err = v.validateBatch(ctx, batch); err != nil {
+			return err
+		}
+		last := batch[len(batch)-1]
+		utime, afterId = last.UpdateTime(), last.ID()
+	}
+}
+
+func (v *Validator[T]) validateBatch(ctx context.Context, batch []T) error {
+	ids := make([]int64, 0, len(batch))
+	for _, t := range batch {
+		ids = append(ids, t.ID())
+	}
+	targets, err := v.target.FindByIds(ctx, ids)
+	if err != nil {
+		return err
+	}
+	targetMap := make(map[int64]T, len(targets))
+	for _, t := range targets {
+		targetMap[t.ID()] = t
+	}
+	for _, t := range batch {
+		dst, ok := targetMap[t.ID()]
+		switch {
+		case !ok:
+			v.report(ctx, t.ID(), InconsistentTargetMissing)
+		case !t.CompareTo(dst):
+			v.report(ctx, t.ID(), InconsistentNotEqual)
+		}
+	}
+	return nil
+}
+
+// validateBaseMissing 反过来找 target 有但是 base 没有的
+func (v *Validator[T]) validateBaseMissing(ctx context.Context) error {
+	var afterId int64
+	for {
+		batch, err := v.target.ListById(ctx, afterId, v.batchSize)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		ids := make([]int64, 0, len(batch))
+		for _, t := range batch {
+			ids = append(ids, t.ID())
+		}
+		bases, err := v.base.FindByIds(ctx, ids)
+		if err != nil {
+			return err
+		}
+		exists := make(map[int64]struct{}, len(bases))
+		for _, t := range bases {
+			exists[t.ID()] = struct{}{}
+		}
+		for _, id := range ids {
+			if _, ok := exists[id]; !ok {
+				v.report(ctx, id, InconsistentBaseMissing)
+			}
+		}
+		afterId = ids[len(ids)-1]
+	}
+}
+
+// report 上报失败了只打日志，下一轮校验还会发现
+func (v *Validator[T]) report(ctx context.Context, id int64, typ InconsistentType) {
+	err := v.reporter.Report(ctx, Inconsistency{
+		ID:        id,
+		Direction: v.direction,
+		Type:      typ,
+	})
+	if err != nil {
+		v.l.Error("上报不一致的数据失败", logger.Error(err),
+			logger.Int64("id", id), logger.String("type", string(typ)),
+			logger.String("direction", string(v.direction)))
+	}
+}
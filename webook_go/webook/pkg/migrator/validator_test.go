@@ -0,0 +1,177 @@
+package migrator
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sort"
+	"testing"
+	"time"
+	"webook_go/webook/pkg/logger"
+)
+
+type testEntity struct {
+	Id    int64
+	Name  string
+	Utime int64
+}
+
+func (e testEntity) ID() int64 {
+	return e.Id
+}
+
+func (e testEntity) UpdateTime() int64 {
+	return e.Utime
+}
+
+func (e testEntity) CompareTo(dst Entity) bool {
+	d, ok := dst.(testEntity)
+	return ok && e.Id == d.Id && e.Name == d.Name
+}
+
+// memStore 按照 ID 存在内存里面
+type memStore map[int64]testEntity
+
+func (s memStore) sorted(less func(a, b testEntity) bool) []testEntity {
+	res := make([]testEntity, 0, len(s))
+	for _, e := range s {
+		res = append(res, e)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return less(res[i], res[j])
+	})
+	return res
+}
+
+func (s memStore) FindByIds(ctx context.Context, ids []int64) ([]testEntity, error) {
+	var res []testEntity
+	for _, id := range ids {
+		if e, ok := s[id]; ok {
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+
+func (s memStore) ListById(ctx context.Context, afterId int64, limit int) ([]testEntity, error) {
+	var res []testEntity
+	for _, e := range s.sorted(func(a, b testEntity) bool { return a.Id < b.Id }) {
+		if e.Id > afterId && len(res) < limit {
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+
+func (s memStore) ListByUtime(ctx context.Context, utime int64, afterId int64, limit int) ([]testEntity, error) {
+	var res []testEntity
+	all := s.sorted(func(a, b testEntity) bool {
+		return a.Utime < b.Utime || a.Utime == b.Utime && a.Id < b.Id
+	})
+	for _, e := range all {
+		after := e.Utime > utime || e.Utime == utime && e.Id > afterId
+		if after && len(res) < limit {
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+
+func (s memStore) Upsert(ctx context.Context, e testEntity) error {
+	s[e.Id] = e
+	return nil
+}
+
+func (s memStore) Delete(ctx context.Context, id int64) error {
+	delete(s, id)
+	return nil
+}
+
+type recordReporter []Inconsistency
+
+func (r *recordReporter) Report(ctx context.Context, inc Inconsistency) error {
+	*r = append(*r, inc)
+	return nil
+}
+
+func TestValidator_Full(t *testing.T) {
+	base := memStore{
+		1: {Id: 1, Name: "a"},
+		2: {Id: 2, Name: "b"},
+		3: {Id: 3, Name: "c"},
+		4: {Id: 4, Name: "d"},
+	}
+	target := memStore{
+		1: {Id: 1, Name: "a", Utime: 100},
+		// 2 没有同步过去
+		3: {Id: 3, Name: "x"},
+		4: {Id: 4, Name: "d"},
+		// base 里面已经删掉了
+		5: {Id: 5, Name: "e"},
+	}
+	var reporter recordReporter
+	err := NewValidator[testEntity](base, target, DirectionSrc, &reporter, &logger.NopLogger{}).
+		BatchSize(2).Full(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, recordReporter{
+		{ID: 2, Direction: DirectionSrc, Type: InconsistentTargetMissing},
+		{ID: 3, Direction: DirectionSrc, Type: InconsistentNotEqual},
+		{ID: 5, Direction: DirectionSrc, Type: InconsistentBaseMissing},
+	}, reporter)
+
+	// 修复之后再校验就一致了
+	fixer := NewFixer[testEntity](base, target)
+	for _, inc := range reporter {
+		require.NoError(t, fixer.Report(context.Background(), inc))
+	}
+	// 1 只是更新时间不一样，不用修
+	assert.Equal(t, testEntity{Id: 1, Name: "a", Utime: 100}, target[1])
+	target[1] = base[1]
+	assert.Equal(t, base, target)
+	reporter = nil
+	err = NewValidator[testEntity](base, target, DirectionSrc, &reporter, &logger.NopLogger{}).
+		Full(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, reporter)
+}
+
+func TestValidator_Incremental(t *testing.T) {
+	base := memStore{
+		1: {Id: 1, Name: "a", Utime: 100},
+		2: {Id: 2, Name: "b", Utime: 200},
+		3: {Id: 3, Name: "c", Utime: 200},
+		4: {Id: 4, Name: "d", Utime: 300},
+	}
+	target := memStore{
+		// 1 在起点之前，不校验
+		1: {Id: 1, Name: "x", Utime: 100},
+		2: {Id: 2, Name: "b", Utime: 200},
+		4: {Id: 4, Name: "x", Utime: 300},
+	}
+	var reporter recordReporter
+	v := NewValidator[testEntity](base, target, DirectionDst, &reporter, &logger.NopLogger{}).BatchSize(1)
+	err := v.Incremental(context.Background(), 150)
+	require.NoError(t, err)
+	assert.Equal(t, recordReporter{
+		{ID: 3, Direction: DirectionDst, Type: InconsistentTargetMissing},
+		{ID: 4, Direction: DirectionDst, Type: InconsistentNotEqual},
+	}, reporter)
+
+	// 一直校验到 ctx 结束
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	err = v.Interval(time.Millisecond * 10).Incremental(ctx, 150)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestParsePattern(t *testing.T) {
+	p, err := ParsePattern("")
+	require.NoError(t, err)
+	assert.Equal(t, PatternSrcOnly, p)
+	assert.Equal(t, DirectionSrc, p.Base())
+	p, err = ParsePattern("dst_first")
+	require.NoError(t, err)
+	assert.Equal(t, DirectionDst, p.Base())
+	_, err = ParsePattern("abc")
+	assert.Equal(t, ErrUnknownPattern, err)
+}
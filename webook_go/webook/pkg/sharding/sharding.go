@@ -0,0 +1,118 @@
+// Package sharding 分库分表
+// 每个库里面的分表结构都一样，表名是 前缀_序号，比如 users_0 到 users_3
+package sharding
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"golang.org/x/sync/errgroup"
+	"gorm.io/gorm"
+	"hash/fnv"
+)
+
+// Dst 一张分表：第几个库的第几张表
+type Dst struct {
+	DB    int
+	Table int
+}
+
+// TableName 分表的表名
+func (d Dst) TableName(prefix string) string {
+	return fmt.Sprintf("%s_%d", prefix, d.Table)
+}
+
+// Sharding 按照哈希分库分表，分片数量定了之后不能再改，改了要迁移数据
+type Sharding struct {
+	dbs []*gorm.DB
+	// tables 每个库有多少张表
+	tables int
+}
+
+func NewSharding(dbs []*gorm.DB, tables int) *Sharding {
+	return &Sharding{
+		dbs:    dbs,
+		tables: tables,
+	}
+}
+
+// ShardInt 用户 ID、作者 ID 之类的分片键
+// 不能直接取模：snowflake 的低位是序号，并发低的时候基本都是 0，会全部落到同一个分片上
+func (s *Sharding) ShardInt(key int64) Dst {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(key))
+	return s.shard(buf[:])
+}
+
+// ShardString 邮箱、手机号之类的分片键
+func (s *Sharding) ShardString(key string) Dst {
+	return s.shard([]byte(key))
+}
+
+func (s *Sharding) shard(key []byte) Dst {
+	h := fnv.New64a()
+	_, _ = h.Write(key)
+	sum := h.Sum64()
+	dbs := uint64(len(s.dbs))
+	return Dst{
+		DB:    int(sum % dbs),
+		Table: int(sum / dbs % uint64(s.tables)),
+	}
+}
+
+// All 所有的分表，广播查询的时候用
+func (s *Sharding) All() []Dst {
+	res := make([]Dst, 0, len(s.dbs)*s.tables)
+	for db := range s.dbs {
+		for table := 0; table < s.tables; table++ {
+			res = append(res, Dst{DB: db, Table: table})
+		}
+	}
+	return res
+}
+
+// Table 已经指定好了表名，同一个库里面的别的表要用 DB
+func (s *Sharding) Table(dst Dst, prefix string) *gorm.DB {
+	// 用 Session 隔开，返回的 *gorm.DB 可以重复使用，条件不会互相污染
+	return s.dbs[dst.DB].Table(dst.TableName(prefix)).Session(&gorm.Session{})
+}
+
+// DB 分表所在的库
+func (s *Sharding) DB(dst Dst) *gorm.DB {
+	return s.dbs[dst.DB]
+}
+
+// AutoMigrate 在所有的库里面建好分表
+func (s *Sharding) AutoMigrate(prefix string, model any) error {
+	for _, dst := range s.All() {
+		err := s.dbs[dst.DB].Table(dst.TableName(prefix)).AutoMigrate(model)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Scatter 并发查所有的分表，把结果合在一起，顺序是不确定的，调用方自己排序
+// 任何一个分表出错都会返回错误，其他分表的查询会被取消
+func Scatter[T any](ctx context.Context, dsts []Dst,
+	fn func(ctx context.Context, dst Dst) ([]T, error)) ([]T, error) {
+	results := make([][]T, len(dsts))
+	eg, ctx := errgroup.WithContext(ctx)
+	for i, dst := range dsts {
+		i, dst := i, dst
+		eg.Go(func() error {
+			res, err := fn(ctx, dst)
+			results[i] = res
+			return err
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	var res []T
+	for _, r := range results {
+		res = append(res, r...)
+	}
+	return res, nil
+}
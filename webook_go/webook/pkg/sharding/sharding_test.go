@@ -0,0 +1,56 @@
+package sharding
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"sort"
+	"testing"
+)
+
+func TestSharding_ShardInt(t *testing.T) {
+	s := NewSharding(make([]*gorm.DB, 2), 4)
+	counts := map[Dst]int{}
+	// 模拟低并发的 snowflake：序号都是 0，只有时间戳在变
+	for i := int64(0); i < 8000; i++ {
+		id := i << 22
+		dst := s.ShardInt(id)
+		// 同一个 key 一定落在同一张表
+		assert.Equal(t, dst, s.ShardInt(id))
+		counts[dst]++
+	}
+	assert.Len(t, counts, 8)
+	for dst, cnt := range counts {
+		// 理想情况下每张表 1000 个
+		assert.InDelta(t, 1000, cnt, 200, "分布不均匀 %v", dst)
+	}
+}
+
+func TestSharding_All(t *testing.T) {
+	s := NewSharding(make([]*gorm.DB, 2), 3)
+	all := s.All()
+	assert.Len(t, all, 6)
+	assert.Equal(t, Dst{DB: 1, Table: 2}, all[5])
+	assert.Equal(t, "users_2", all[5].TableName("users"))
+}
+
+func TestScatter(t *testing.T) {
+	dsts := NewSharding(make([]*gorm.DB, 2), 2).All()
+	res, err := Scatter(context.Background(), dsts, func(ctx context.Context, dst Dst) ([]int, error) {
+		return []int{dst.DB*10 + dst.Table}, nil
+	})
+	require.NoError(t, err)
+	sort.Ints(res)
+	assert.Equal(t, []int{0, 1, 10, 11}, res)
+
+	// 有一张表出错整个都失败
+	_, err = Scatter(context.Background(), dsts, func(ctx context.Context, dst Dst) ([]int, error) {
+		if dst.DB == 1 {
+			return nil, errors.New("mock db error")
+		}
+		return []int{1}, nil
+	})
+	assert.Error(t, err)
+}
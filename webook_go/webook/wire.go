@@ -0,0 +1,104 @@
+//go:build wireinject
+
+package main
+
+import (
+	"github.com/google/wire"
+	"webook_go/webook/internal/job"
+	"webook_go/webook/internal/repository"
+	"webook_go/webook/internal/repository/article"
+	"webook_go/webook/internal/repository/cache"
+	"webook_go/webook/internal/repository/dao"
+	"webook_go/webook/internal/service"
+	"webook_go/webook/internal/web"
+	"webook_go/webook/ioc"
+)
+
+var thirdPartySet = wire.NewSet(
+	ioc.InitDB,
+	ioc.InitRedis,
+	ioc.InitLogger,
+	ioc.InitIDGenerator,
+	ioc.InitSharding,
+	ioc.InitMongoDB)
+
+var userSvcSet = wire.NewSet(
+	ioc.InitUserDAO,
+	ioc.InitUserCache,
+	ioc.InitUserCacheConfig,
+	ioc.InitCodeCache,
+	ioc.InitCodeLimitConfig,
+	repository.NewUserRepository,
+	service.NewUserService)
+
+var codeSvcSet = wire.NewSet(
+	repository.NewCodeRepository,
+	ioc.InitSMSService,
+	ioc.InitEmailService,
+	ioc.InitCaptchaService,
+	service.NewCodeService,
+	service.NewEmailCodeService,
+	service.NewActivationService,
+	ioc.InitActivationConfig)
+
+var loginSvcSet = wire.NewSet(
+	dao.NewTOTPDAO,
+	repository.NewTOTPRepository,
+	service.NewTOTPService,
+	ioc.InitTOTPConfig,
+	cache.NewLoginLimitCache,
+	ioc.InitLoginLimitConfig,
+	repository.NewLoginLimitRepository,
+	service.NewLoginLimitService,
+	dao.NewLoginLogDAO,
+	repository.NewLoginLogRepository,
+	service.NewLoginLogService,
+	ioc.InitJWTHandler,
+	ioc.InitSessionConfig,
+	ioc.InitJWTKeys)
+
+var accountSvcSet = wire.NewSet(
+	ioc.InitIdentityDAO,
+	repository.NewIdentityRepository,
+	service.NewIdentityService,
+	cache.NewMergeTicketCache,
+	repository.NewMergeTicketRepository,
+	service.NewLinkService,
+	service.NewAccountService,
+	ioc.InitAccountConfig,
+	ioc.InitOAuth2Providers,
+	ioc.InitOAuth2HandlerConfig,
+	dao.NewAuditLogDAO,
+	repository.NewAuditLogRepository,
+	service.NewAdminService)
+
+var articleSvcSet = wire.NewSet(
+	ioc.InitArticleDAO,
+	article.NewArticleRepository,
+	service.NewArticleService)
+
+func InitApp() *App {
+	wire.Build(
+		thirdPartySet,
+		userSvcSet,
+		codeSvcSet,
+		loginSvcSet,
+		accountSvcSet,
+		articleSvcSet,
+
+		web.NewUserHandler,
+		web.NewOAuth2Handler,
+		web.NewArticleHandler,
+		web.NewJWKSHandler,
+		web.NewAdminHandler,
+		ioc.InitGin,
+		ioc.InitMiddlewares,
+
+		job.NewAccountPurgeJob,
+		ioc.InitArticleMigrateJob,
+		job.NewTokenRefreshJob,
+
+		wire.Struct(new(App), "*"),
+	)
+	return new(App)
+}
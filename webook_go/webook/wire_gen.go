@@ -0,0 +1,110 @@
+// Code generated by Wire. DO NOT EDIT.
+
+//go:generate go run github.com/google/wire/cmd/wire
+//go:build !wireinject
+// +build !wireinject
+
+package main
+
+import (
+	"github.com/google/wire"
+	"webook_go/webook/internal/job"
+	"webook_go/webook/internal/repository"
+	"webook_go/webook/internal/repository/article"
+	"webook_go/webook/internal/repository/cache"
+	"webook_go/webook/internal/repository/dao"
+	"webook_go/webook/internal/service"
+	"webook_go/webook/internal/web"
+	"webook_go/webook/ioc"
+)
+
+import (
+	_ "github.com/spf13/viper/remote"
+)
+
+// Injectors from wire.go:
+
+func InitApp() *App {
+	cmdable := ioc.InitRedis()
+	sessionConfig := ioc.InitSessionConfig()
+	keys := ioc.InitJWTKeys()
+	loggerV1 := ioc.InitLogger()
+	db := ioc.InitDB(loggerV1)
+	loginLogDAO := dao.NewLoginLogDAO(db)
+	loginLogRepository := repository.NewLoginLogRepository(loginLogDAO)
+	loginLogService := service.NewLoginLogService(loginLogRepository)
+	handler := ioc.InitJWTHandler(cmdable, sessionConfig, keys, loginLogService, loggerV1)
+	sharding := ioc.InitSharding(loggerV1)
+	generator := ioc.InitIDGenerator(cmdable, loggerV1)
+	database := ioc.InitMongoDB()
+	articleDAO := ioc.InitArticleDAO(db, sharding, generator, database, loggerV1)
+	userDAO := ioc.InitUserDAO(db, sharding, generator, articleDAO)
+	userCache := ioc.InitUserCache(cmdable, loggerV1)
+	userCacheConfig := ioc.InitUserCacheConfig()
+	userRepository := repository.NewUserRepository(userDAO, userCache, userCacheConfig)
+	codeLimitConfig := ioc.InitCodeLimitConfig()
+	codeRedisCache := ioc.InitCodeCache(cmdable, codeLimitConfig)
+	userService := service.NewUserService(userRepository, codeRedisCache, loggerV1)
+	v := ioc.InitMiddlewares(cmdable, handler, userService, loggerV1)
+	codeRepository := repository.NewCodeRepository(codeRedisCache)
+	smsService := ioc.InitSMSService()
+	codeService := service.NewCodeService(codeRepository, smsService)
+	emailService := ioc.InitEmailService()
+	emailCodeService := service.NewEmailCodeService(codeRepository, emailService)
+	activationConfig := ioc.InitActivationConfig()
+	activationService := service.NewActivationService(userRepository, codeRepository, emailService, activationConfig, loggerV1)
+	totpdao := dao.NewTOTPDAO(db)
+	totpRepository := repository.NewTOTPRepository(totpdao)
+	totpConfig := ioc.InitTOTPConfig()
+	totpService := service.NewTOTPService(totpRepository, userRepository, totpConfig)
+	loginLimitConfig := ioc.InitLoginLimitConfig()
+	loginLimitCache := cache.NewLoginLimitCache(cmdable, loginLimitConfig)
+	loginLimitRepository := repository.NewLoginLimitRepository(loginLimitCache)
+	loginLimitService := service.NewLoginLimitService(loginLimitRepository, userRepository, codeService, emailCodeService)
+	identityDAO := ioc.InitIdentityDAO(db, userDAO, sharding, generator)
+	identityRepository := repository.NewIdentityRepository(identityDAO)
+	mergeTicketCache := cache.NewMergeTicketCache(cmdable)
+	mergeTicketRepository := repository.NewMergeTicketRepository(mergeTicketCache)
+	linkService := service.NewLinkService(userRepository, identityRepository, mergeTicketRepository)
+	articleRepository := article.NewArticleRepository(articleDAO)
+	accountConfig := ioc.InitAccountConfig()
+	accountService := service.NewAccountService(userRepository, identityRepository, articleRepository, accountConfig, loggerV1)
+	captchaService := ioc.InitCaptchaService()
+	userHandler := web.NewUserHandler(userService, codeService, emailCodeService, activationService, totpService, loginLimitService, linkService, accountService, captchaService, handler, loggerV1)
+	v2 := ioc.InitOAuth2Providers(loggerV1)
+	identityService := service.NewIdentityService(identityRepository, userRepository, v2, loggerV1)
+	oAuth2HandlerConfig := ioc.InitOAuth2HandlerConfig()
+	oAuth2Handler := web.NewOAuth2Handler(v2, identityService, linkService, totpService, handler, oAuth2HandlerConfig, loggerV1)
+	articleService := service.NewArticleService(articleRepository)
+	articleHandler := web.NewArticleHandler(articleService, loggerV1)
+	jwksHandler := web.NewJWKSHandler(handler)
+	auditLogDAO := dao.NewAuditLogDAO(db)
+	auditLogRepository := repository.NewAuditLogRepository(auditLogDAO)
+	adminService := service.NewAdminService(userRepository, loginLogRepository, auditLogRepository)
+	adminHandler := web.NewAdminHandler(userService, adminService, handler, loggerV1)
+	engine := ioc.InitGin(v, userHandler, oAuth2Handler, articleHandler, jwksHandler, adminHandler)
+	accountPurgeJob := job.NewAccountPurgeJob(accountService, handler, loggerV1)
+	articleMigrateJob := ioc.InitArticleMigrateJob(db, database, loggerV1)
+	tokenRefreshJob := job.NewTokenRefreshJob(identityService, loggerV1)
+	app := &App{
+		server:     engine,
+		purgeJob:   accountPurgeJob,
+		migrateJob: articleMigrateJob,
+		refreshJob: tokenRefreshJob,
+	}
+	return app
+}
+
+// wire.go:
+
+var thirdPartySet = wire.NewSet(ioc.InitDB, ioc.InitRedis, ioc.InitLogger, ioc.InitIDGenerator, ioc.InitSharding, ioc.InitMongoDB)
+
+var userSvcSet = wire.NewSet(ioc.InitUserDAO, ioc.InitUserCache, ioc.InitUserCacheConfig, ioc.InitCodeCache, ioc.InitCodeLimitConfig, repository.NewUserRepository, service.NewUserService)
+
+var codeSvcSet = wire.NewSet(repository.NewCodeRepository, ioc.InitSMSService, ioc.InitEmailService, ioc.InitCaptchaService, service.NewCodeService, service.NewEmailCodeService, service.NewActivationService, ioc.InitActivationConfig)
+
+var loginSvcSet = wire.NewSet(dao.NewTOTPDAO, repository.NewTOTPRepository, service.NewTOTPService, ioc.InitTOTPConfig, cache.NewLoginLimitCache, ioc.InitLoginLimitConfig, repository.NewLoginLimitRepository, service.NewLoginLimitService, dao.NewLoginLogDAO, repository.NewLoginLogRepository, service.NewLoginLogService, ioc.InitJWTHandler, ioc.InitSessionConfig, ioc.InitJWTKeys)
+
+var accountSvcSet = wire.NewSet(ioc.InitIdentityDAO, repository.NewIdentityRepository, service.NewIdentityService, cache.NewMergeTicketCache, repository.NewMergeTicketRepository, service.NewLinkService, service.NewAccountService, ioc.InitAccountConfig, ioc.InitOAuth2Providers, ioc.InitOAuth2HandlerConfig, dao.NewAuditLogDAO, repository.NewAuditLogRepository, service.NewAdminService)
+
+var articleSvcSet = wire.NewSet(ioc.InitArticleDAO, article.NewArticleRepository, service.NewArticleService)